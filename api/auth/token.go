@@ -1,9 +1,8 @@
 package auth
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
@@ -13,11 +12,18 @@ import (
 	jwt "github.com/dgrijalva/jwt-go"
 )
 
+// Token user types
+const (
+	UserPatient  = "patient"
+	UserEmployee = "employee"
+)
+
 // CreateToken ...
-func CreateToken(userID int) (string, error) {
+func CreateToken(userID int, userType string) (string, error) {
 	claims := jwt.MapClaims{}
 	claims["authorized"] = true
 	claims["user_id"] = userID
+	claims["user_type"] = userType
 	claims["exp"] = time.Now().Add(time.Hour * 1).Unix() //Token expires after 1 hour
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString([]byte(os.Getenv("API_SECRET")))
@@ -36,8 +42,8 @@ func TokenValid(r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		Formatter(claims)
+	if !token.Valid {
+		return errors.New("Invalid Token")
 	}
 	return nil
 }
@@ -80,13 +86,25 @@ func ExtractTokenID(r *http.Request) (uint32, error) {
 	return 0, nil
 }
 
-// Formatter for Standart display the claims in the terminal
-func Formatter(data interface{}) {
-	b, err := json.MarshalIndent(data, "", " ")
+// ExtractTokenUserType returns whether the token was issued to a patient or
+// an employee. Patient IDs and employee IDs are separate sequences, so
+// handlers comparing ExtractTokenID against a record must check this too.
+func ExtractTokenUserType(r *http.Request) (string, error) {
+
+	tokenString := ExtractToken(r)
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(os.Getenv("API_SECRET")), nil
+	})
 	if err != nil {
-		log.Println(err)
-		return
+		return "", err
 	}
-
-	fmt.Println(string(b))
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if ok && token.Valid {
+		userType, _ := claims["user_type"].(string)
+		return userType, nil
+	}
+	return "", nil
 }
@@ -0,0 +1,87 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/repoerna/hms_app/api/auth"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// tokenEmployee loads the employee the request's token was issued to. It
+// fails for patient tokens and for requests without a valid token.
+func (server *Server) tokenEmployee(r *http.Request) (*models.Employee, error) {
+	userType, err := auth.ExtractTokenUserType(r)
+	if err != nil || userType != auth.UserEmployee {
+		return &models.Employee{}, errors.New("Unauthorized")
+	}
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return &models.Employee{}, errors.New("Unauthorized")
+	}
+	employee := models.Employee{}
+	return employee.FindEmployeeByID(server.DB, int(tokenID))
+}
+
+// tokenAdmin is tokenEmployee restricted to administrators
+func (server *Server) tokenAdmin(r *http.Request) (*models.Employee, error) {
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		return employee, err
+	}
+	if !employee.IsAdmin() {
+		return &models.Employee{}, errors.New("Administrator Access Required")
+	}
+	return employee, nil
+}
+
+// tokenOwnsPatient reports whether the request was made by the patient with
+// the given medical record number
+func (server *Server) tokenOwnsPatient(r *http.Request, mrn string) bool {
+	userType, err := auth.ExtractTokenUserType(r)
+	if err != nil || userType != auth.UserPatient {
+		return false
+	}
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return false
+	}
+	patient := models.Patient{}
+	if _, err = patient.FindPatientByMRN(server.DB, mrn); err != nil {
+		return false
+	}
+	return patient.ID == tokenID
+}
+
+// tokenPatient loads the patient the request's token was issued to
+func (server *Server) tokenPatient(r *http.Request) (*models.Patient, error) {
+	userType, err := auth.ExtractTokenUserType(r)
+	if err != nil || userType != auth.UserPatient {
+		return &models.Patient{}, errors.New("Unauthorized")
+	}
+	tokenID, err := auth.ExtractTokenID(r)
+	if err != nil {
+		return &models.Patient{}, errors.New("Unauthorized")
+	}
+	patient := models.Patient{}
+	err = server.DB.Debug().Model(&models.Patient{}).Where("id = ?", tokenID).Take(&patient).Error
+	if err != nil {
+		return &models.Patient{}, errors.New("Unauthorized")
+	}
+	return patient.FindPatientByMRN(server.DB, patient.MRN)
+}
+
+// examinationAccess returns what the caller may read of restricted
+// examinations of the patient mrn. Patients read their own in full; other
+// callers who are not employees read no restricted examination.
+func (server *Server) examinationAccess(r *http.Request, mrn string) (*models.ExaminationAccess, error) {
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		if mrn != "" && server.tokenOwnsPatient(r, mrn) {
+			return nil, nil
+		}
+		return models.NewExaminationAccess(server.DB, nil, time.Now())
+	}
+	return models.NewExaminationAccess(server.DB, employee, time.Now())
+}
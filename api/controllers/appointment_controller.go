@@ -42,6 +42,7 @@ func (server *Server) CreateAppointment(w http.ResponseWriter, r *http.Request)
 		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	server.publishAppointment(appointmentCreated, "created")
 	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, appointmentCreated.AppointmentID))
 	handlers.ResponseJSON(w, http.StatusCreated, appointmentCreated)
 }
@@ -51,6 +52,17 @@ func (server *Server) GetAppointments(w http.ResponseWriter, r *http.Request) {
 
 	appointment := models.Appointment{}
 
+	// Patients only ever see their own bookings
+	if patient, err := server.tokenPatient(r); err == nil {
+		appointments, err := appointment.FindAppointmentsByMRN(server.DB, patient.MRN)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusInternalServerError, err)
+			return
+		}
+		handlers.ResponseJSON(w, http.StatusOK, appointments)
+		return
+	}
+
 	appointments, err := appointment.FindAllAppointment(server.DB)
 	if err != nil {
 		handlers.ResponseError(w, http.StatusInternalServerError, err)
@@ -125,6 +137,7 @@ func (server *Server) UpdateAppointment(w http.ResponseWriter, r *http.Request)
 		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	server.publishAppointment(updatedAppointment, "updated")
 	handlers.ResponseJSON(w, http.StatusOK, updatedAppointment)
 }
 
@@ -156,11 +169,17 @@ func (server *Server) DeleteAppointment(w http.ResponseWriter, r *http.Request)
 		handlers.ResponseError(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
+	deleted := models.Appointment{}
+	if _, err = deleted.FindAppointmentByID(server.DB, uint32(aid)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
 	_, err = appointment.DeleteAppointment(server.DB, uint32(aid))
 	if err != nil {
 		handlers.ResponseError(w, http.StatusInternalServerError, err)
 		return
 	}
+	server.publishAppointment(&deleted, "deleted")
 	w.Header().Set("Entity", fmt.Sprintf("%d", aid))
 	handlers.ResponseJSON(w, http.StatusNoContent, "")
 }
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/storage"
+)
+
+// CreatePatientAttachment attaches an uploaded file to a patient's record
+func (server *Server) CreatePatientAttachment(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	patient := models.Patient{}
+	if _, err = patient.FindPatientByMRN(server.DB, mux.Vars(r)["mrn"]); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	if patient.MergedInto != "" {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Patient Has Been Merged Into "+patient.MergedInto))
+		return
+	}
+	server.receiveAttachment(w, r, &models.Attachment{MRN: patient.MRN, UploadedBy: employee.EmployeeID})
+}
+
+// CreateExaminationAttachment attaches an uploaded file to an examination
+func (server *Server) CreateExaminationAttachment(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	eid, err := strconv.ParseUint(mux.Vars(r)["examination_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	examination := models.Examination{}
+	if _, err = examination.FindExaminationByID(server.DB, uint32(eid)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Examination Not Found"))
+		return
+	}
+	server.receiveAttachment(w, r, &models.Attachment{
+		MRN:           examination.MRN,
+		ExaminationID: examination.ExaminationID,
+		UploadedBy:    employee.EmployeeID,
+	})
+}
+
+// receiveAttachment reads a multipart upload with a "file" part and
+// optional "kind" and "description" fields. The file is spooled and
+// checked before anything is stored: its type is sniffed from its
+// contents and its size is limited to MaxAttachmentSize.
+func (server *Server) receiveAttachment(w http.ResponseWriter, r *http.Request, attachment *models.Attachment) {
+
+	if server.Attachments == nil {
+		handlers.ResponseError(w, http.StatusServiceUnavailable, errors.New("Attachment Storage Not Configured"))
+		return
+	}
+	// Leave room for the other fields and the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, models.MaxAttachmentSize+64<<10)
+	parts, err := r.MultipartReader()
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, errors.New("Expected A Multipart Upload"))
+		return
+	}
+
+	var upload *storage.Upload
+	defer func() {
+		if upload != nil {
+			upload.Close()
+		}
+	}()
+	for {
+		part, err := parts.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+		switch part.FormName() {
+		case "file":
+			if upload != nil {
+				handlers.ResponseError(w, http.StatusBadRequest, errors.New("Only One File Per Upload"))
+				return
+			}
+			upload, err = storage.Spool(part, models.MaxAttachmentSize)
+			if err == storage.ErrTooLarge {
+				handlers.ResponseError(w, http.StatusRequestEntityTooLarge, errors.New("File Too Large"))
+				return
+			}
+			if err != nil {
+				handlers.ResponseError(w, http.StatusBadRequest, err)
+				return
+			}
+			attachment.FileName = cleanFileName(part.FileName())
+		case "kind", "description":
+			value, err := ioutil.ReadAll(io.LimitReader(part, 1024))
+			if err != nil {
+				handlers.ResponseError(w, http.StatusBadRequest, err)
+				return
+			}
+			if part.FormName() == "kind" {
+				attachment.Kind = strings.ToLower(strings.TrimSpace(string(value)))
+			} else {
+				attachment.Description = strings.TrimSpace(string(value))
+			}
+		}
+		part.Close()
+	}
+	if upload == nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Required File"))
+		return
+	}
+
+	attachment.Size = upload.Size
+	attachment.SHA256 = upload.SHA256
+	attachment.ContentType = upload.ContentType
+	if err = attachment.Validate(""); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	random := make([]byte, 16)
+	if _, err = rand.Read(random); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	attachment.StorageKey = "attachments/" + attachment.MRN + "/" + hex.EncodeToString(random)
+
+	if err = server.Attachments.Put(r.Context(), attachment.StorageKey, upload.File, upload.Size, upload.ContentType); err != nil {
+		log.Printf("attachments: storing %s: %v", attachment.StorageKey, err)
+		handlers.ResponseError(w, http.StatusBadGateway, errors.New("Cannot Store File"))
+		return
+	}
+	saved, err := attachment.SaveAttachment(server.DB)
+	if err != nil {
+		server.Attachments.Delete(r.Context(), attachment.StorageKey)
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, saved)
+}
+
+// cleanFileName keeps the base name of an uploaded file, without control
+// characters or quotes, for display and for the download's file name
+func cleanFileName(name string) string {
+	name = filepath.Base(strings.Replace(name, `\`, "/", -1))
+	name = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if name == "." || name == "/" {
+		return ""
+	}
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	return name
+}
+
+// GetPatientAttachments lists a patient's attachments, of one examination
+// when ?examination_id= is given. Patients may list their own.
+func (server *Server) GetPatientAttachments(w http.ResponseWriter, r *http.Request) {
+
+	mrn := mux.Vars(r)["mrn"]
+	if _, err := server.tokenEmployee(r); err != nil && !server.tokenOwnsPatient(r, mrn) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	var examinationID uint64
+	var err error
+	if v := r.URL.Query().Get("examination_id"); v != "" {
+		examinationID, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	attachment := models.Attachment{}
+	attachments, err := attachment.FindAttachments(server.DB, mrn, uint32(examinationID))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	access, err := server.examinationAccess(r, mrn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	records := make([]models.ExaminationRecord, len(*attachments))
+	for i := range *attachments {
+		records[i] = &(*attachments)[i]
+	}
+	if err = access.FilterRecords(server.DB, records...); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, attachments)
+}
+
+// attachment loads the attachment named in the request, if the caller is
+// staff or the patient it belongs to. It is redacted if its examination is
+// restricted from the caller.
+func (server *Server) attachment(r *http.Request) (*models.Attachment, int, error) {
+	id, err := strconv.ParseUint(mux.Vars(r)["attachment_id"], 10, 32)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	attachment := models.Attachment{}
+	if _, err = attachment.FindAttachmentByID(server.DB, uint32(id)); err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	if _, err = server.tokenEmployee(r); err != nil && !server.tokenOwnsPatient(r, attachment.MRN) {
+		return nil, http.StatusUnauthorized, errors.New("Unauthorized")
+	}
+	access, err := server.examinationAccess(r, attachment.MRN)
+	if err == nil {
+		err = access.FilterRecords(server.DB, &attachment)
+	}
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	return &attachment, http.StatusOK, nil
+}
+
+// GetAttachment ...
+func (server *Server) GetAttachment(w http.ResponseWriter, r *http.Request) {
+
+	attachment, status, err := server.attachment(r)
+	if err != nil {
+		handlers.ResponseError(w, status, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, attachment)
+}
+
+// DownloadAttachment streams an attachment's file. The contents are
+// checked against the checksum taken on upload as they are sent; a file
+// that no longer matches is cut off and logged rather than delivered
+// whole.
+func (server *Server) DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+
+	attachment, status, err := server.attachment(r)
+	if err != nil {
+		handlers.ResponseError(w, status, err)
+		return
+	}
+	if attachment.Redacted {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Examination Is Restricted"))
+		return
+	}
+	if server.Attachments == nil {
+		handlers.ResponseError(w, http.StatusServiceUnavailable, errors.New("Attachment Storage Not Configured"))
+		return
+	}
+	etag := `"` + attachment.SHA256 + `"`
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	blob, err := server.Attachments.Get(r.Context(), attachment.StorageKey)
+	if err == storage.ErrNotFound {
+		handlers.ResponseError(w, http.StatusGone, errors.New("Attachment File Is Missing"))
+		return
+	}
+	if err != nil {
+		log.Printf("attachments: reading %s: %v", attachment.StorageKey, err)
+		handlers.ResponseError(w, http.StatusBadGateway, errors.New("Cannot Read File"))
+		return
+	}
+	defer blob.Close()
+
+	fileName := attachment.FileName
+	if fileName == "" {
+		fileName = "attachment-" + strconv.FormatUint(uint64(attachment.ID), 10)
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	if _, err = io.Copy(w, storage.NewVerifyingReader(blob, attachment.SHA256)); err != nil {
+		log.Printf("attachments: sending %d: %v", attachment.ID, err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// DeleteAttachment removes an attachment. Only whoever uploaded it and
+// administrators may.
+func (server *Server) DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	attachment, status, err := server.attachment(r)
+	if err != nil {
+		handlers.ResponseError(w, status, err)
+		return
+	}
+	if !employee.IsAdmin() && employee.EmployeeID != attachment.UploadedBy {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Only The Uploader Or An Administrator May Delete"))
+		return
+	}
+	if _, err = attachment.DeleteAttachment(server.DB, attachment.ID); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if server.Attachments != nil {
+		if err = server.Attachments.Delete(r.Context(), attachment.StorageKey); err != nil {
+			log.Printf("attachments: deleting %s: %v", attachment.StorageKey, err)
+		}
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", attachment.ID))
+	handlers.ResponseJSON(w, http.StatusNoContent, "")
+}
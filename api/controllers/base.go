@@ -11,13 +11,22 @@ import (
 	_ "github.com/jinzhu/gorm/dialects/mysql"    //mysql database driver
 	_ "github.com/jinzhu/gorm/dialects/postgres" //postgres database driver
 
+	"github.com/repoerna/hms_app/api/events"
+	"github.com/repoerna/hms_app/api/hl7"
 	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/payers"
+	"github.com/repoerna/hms_app/api/storage"
 )
 
 // Server ...
 type Server struct {
 	DB     *gorm.DB
 	Router *mux.Router
+	Events *events.Hub
+	// Payers holds the insurer integrations by adapter name
+	Payers map[string]payers.PayerAdapter
+	// Attachments holds uploaded files
+	Attachments storage.BlobStore
 }
 
 // Initialize ...
@@ -46,8 +55,32 @@ func (server *Server) Initialize(Dbdriver, DbUser, DbPassword, DbPort, DbHost, D
 		}
 	}
 
+	err = models.MigratePatientIdentifiers(server.DB)
+	if err != nil {
+		log.Fatal("Cannot migrate patient identifiers:", err)
+	}
+	err = models.MigratePatientNames(server.DB)
+	if err != nil {
+		log.Fatal("Cannot migrate patient names:", err)
+	}
+	err = models.MigrateEmployeeDepartments(server.DB)
+	if err != nil {
+		log.Fatal("Cannot migrate employee departments:", err)
+	}
+	err = models.MigrateEncryptedFields(server.DB)
+	if err != nil {
+		log.Fatal("Cannot migrate encrypted fields:", err)
+	}
+	err = models.LoadDataKeys(server.DB)
+	if err != nil {
+		log.Fatal("Cannot load data keys:", err)
+	}
 	server.DB.Debug().AutoMigrate(&models.Patient{}) //database migration
 
+	server.Events = events.NewHub(64)
+	server.Payers = map[string]payers.PayerAdapter{
+		"fake": payers.NewFakePayer(),
+	}
 	server.Router = mux.NewRouter()
 
 	server.initializeRoutes()
@@ -58,3 +91,10 @@ func (server *Server) Run(addr string) {
 	fmt.Println("Listening to port 8080")
 	log.Fatal(http.ListenAndServe(addr, server.Router))
 }
+
+// RunMLLP listens for HL7 v2 messages on addr
+func (server *Server) RunMLLP(addr string) {
+	fmt.Println("Listening for HL7 on", addr)
+	listener := hl7.Server{Handler: server.HandleHL7}
+	log.Fatal(listener.ListenAndServe(addr))
+}
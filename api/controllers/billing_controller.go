@@ -0,0 +1,336 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// canSeeBilling reports whether the request may read the bills of a
+// patient: any employee, or the patient themselves
+func (server *Server) canSeeBilling(r *http.Request, mrn string) bool {
+	if _, err := server.tokenEmployee(r); err == nil {
+		return true
+	}
+	return mrn != "" && server.tokenOwnsPatient(r, mrn)
+}
+
+// CreateTariff adds a service to the billing catalogue
+func (server *Server) CreateTariff(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	tariff := models.Tariff{}
+	err = json.Unmarshal(body, &tariff)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = tariff.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	tariffCreated, err := tariff.SaveTariff(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, tariffCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, tariffCreated)
+}
+
+// GetTariffs returns the catalogue, optionally only one ?kind=
+func (server *Server) GetTariffs(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	tariff := models.Tariff{}
+	tariffs, err := tariff.FindAllTariffs(server.DB, r.URL.Query().Get("kind"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, tariffs)
+}
+
+// UpdateTariff ...
+func (server *Server) UpdateTariff(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["tariff_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	tariff := models.Tariff{}
+	err = json.Unmarshal(body, &tariff)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if tariff.Name == "" {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Required Name"))
+		return
+	}
+	if tariff.Price < 0 || tariff.TaxRate < 0 || tariff.TaxRate > 10000 {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Invalid Price Or Tax Rate"))
+		return
+	}
+	tariffUpdated, err := tariff.UpdateTariff(server.DB, uint32(id))
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, tariffUpdated)
+}
+
+// GetInvoices lists invoices by ?mrn= and ?status=. Patients may list
+// their own.
+func (server *Server) GetInvoices(w http.ResponseWriter, r *http.Request) {
+
+	mrn := r.URL.Query().Get("mrn")
+	if !server.canSeeBilling(r, mrn) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	invoice := models.Invoice{}
+	invoices, err := invoice.FindInvoices(server.DB, mrn, r.URL.Query().Get("status"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, invoices)
+}
+
+// GetInvoice returns an invoice with its lines and payments
+func (server *Server) GetInvoice(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["invoice_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	invoice := models.Invoice{}
+	invoiceGotten, err := invoice.FindInvoiceByID(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	if !server.canSeeBilling(r, invoiceGotten.MRN) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, invoiceGotten)
+}
+
+// AddInvoiceLine charges a catalogue service to an open invoice
+func (server *Server) AddInvoiceLine(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["invoice_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	line := models.InvoiceLine{}
+	err = json.Unmarshal(body, &line)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = line.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	invoice, err := line.AddManualLine(server.DB, uint32(id), employee.EmployeeID)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, invoice)
+}
+
+// UpdateInvoiceLineDiscount sets the discount of a line, in basis points.
+// Only administrators grant discounts.
+func (server *Server) UpdateInvoiceLineDiscount(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["invoice_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	lineID, err := strconv.ParseUint(vars["line_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	line := models.InvoiceLine{}
+	err = json.Unmarshal(body, &line)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = line.Validate("discount")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	invoice, err := line.SetLineDiscount(server.DB, uint32(id), uint32(lineID), line.DiscountRate)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, invoice)
+}
+
+// UpdateInvoiceStatus issues or voids an invoice
+func (server *Server) UpdateInvoiceStatus(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["invoice_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	invoice := models.Invoice{}
+	var updated *models.Invoice
+	switch vars["action"] {
+	case "issue":
+		updated, err = invoice.Issue(server.DB, uint32(id), employee.EmployeeID)
+	case "void":
+		if !employee.IsAdmin() {
+			handlers.ResponseError(w, http.StatusForbidden, errors.New("Administrator Access Required"))
+			return
+		}
+		updated, err = invoice.Void(server.DB, uint32(id))
+	default:
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Unknown Invoice Action"))
+		return
+	}
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
+
+// CreatePayment records a payment against an invoice, or a refund when
+// the route ends in /refunds
+func (server *Server) CreatePayment(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["invoice_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	kind := models.PaymentReceived
+	if vars["kind"] == "refunds" {
+		if !employee.IsAdmin() {
+			handlers.ResponseError(w, http.StatusForbidden, errors.New("Administrator Access Required"))
+			return
+		}
+		kind = models.PaymentRefund
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	payment := models.Payment{}
+	err = json.Unmarshal(body, &payment)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = payment.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	payment.ReceivedBy = employee.EmployeeID
+	invoice, err := payment.Record(server.DB, uint32(id), kind)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, invoice)
+}
+
+// GetOutstanding returns what is still owed, by one patient with ?mrn= or
+// by everyone
+func (server *Server) GetOutstanding(w http.ResponseWriter, r *http.Request) {
+
+	mrn := r.URL.Query().Get("mrn")
+	if !server.canSeeBilling(r, mrn) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	outstanding, err := models.FindOutstanding(server.DB, mrn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, outstanding)
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+const (
+	defaultChartPageSize = 20
+	maxChartPageSize     = 100
+)
+
+// GetPatientChart returns the patient's timeline. Query parameters: page,
+// per_page, from and to (YYYY-MM-DD or RFC3339) and type, a comma separated
+// list of event types. Patients may read their own chart.
+func (server *Server) GetPatientChart(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	mrn := vars["mrn"]
+	if _, err := server.tokenEmployee(r); err != nil && !server.tokenOwnsPatient(r, mrn) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	filter, err := parseChartFilter(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	patient := models.Patient{}
+	if _, err = patient.FindPatientByMRN(server.DB, mrn); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Patient Not Found"))
+		return
+	}
+
+	if filter.Access, err = server.examinationAccess(r, patient.MRN); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	chart, err := models.BuildPatientChart(server.DB, patient.MRN, filter)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, chart)
+}
+
+func parseChartFilter(r *http.Request) (models.ChartFilter, error) {
+	query := r.URL.Query()
+	filter := models.ChartFilter{Page: 1, PerPage: defaultChartPageSize}
+
+	var err error
+	if v := query.Get("page"); v != "" {
+		filter.Page, err = strconv.Atoi(v)
+		if err != nil || filter.Page < 1 {
+			return filter, errors.New("Invalid Page")
+		}
+	}
+	if v := query.Get("per_page"); v != "" {
+		filter.PerPage, err = strconv.Atoi(v)
+		if err != nil || filter.PerPage < 1 || filter.PerPage > maxChartPageSize {
+			return filter, errors.New("Invalid Page Size")
+		}
+	}
+	if v := query.Get("from"); v != "" {
+		filter.From, err = parseQueryTime(v, false)
+		if err != nil {
+			return filter, errors.New("Invalid From Date")
+		}
+	}
+	if v := query.Get("to"); v != "" {
+		filter.To, err = parseQueryTime(v, true)
+		if err != nil {
+			return filter, errors.New("Invalid To Date")
+		}
+	}
+	if v := query.Get("type"); v != "" {
+		for _, t := range strings.Split(v, ",") {
+			t = strings.TrimSpace(t)
+			if !validChartType(t) {
+				return filter, errors.New("Invalid Event Type " + t)
+			}
+			filter.Types = append(filter.Types, t)
+		}
+	}
+	return filter, nil
+}
+
+// parseQueryTime accepts a plain date or an RFC3339 timestamp. A plain date
+// used as an upper bound covers the whole day.
+func parseQueryTime(v string, endOfDay bool) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", v, time.Local); err == nil {
+		if endOfDay {
+			return t.Add(24*time.Hour - time.Nanosecond), nil
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, v)
+}
+
+func validChartType(t string) bool {
+	for _, known := range models.ChartEventTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
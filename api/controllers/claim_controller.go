@@ -0,0 +1,258 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/payers"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// payerTimeout bounds a single call to an insurer
+const payerTimeout = 30 * time.Second
+
+// payerAdapter returns the integration configured for a payer
+func (server *Server) payerAdapter(payer *models.Payer) (payers.PayerAdapter, error) {
+	adapter, ok := server.Payers[payer.Adapter]
+	if !ok {
+		return nil, fmt.Errorf("No Adapter %q For Payer %s", payer.Adapter, payer.Code)
+	}
+	return adapter, nil
+}
+
+// consentStatus maps a missing consent to 403 and anything else to 422
+func consentStatus(err error) int {
+	if err == models.ErrConsentMissing {
+		return http.StatusForbidden
+	}
+	return http.StatusUnprocessableEntity
+}
+
+// CreatePayer ...
+func (server *Server) CreatePayer(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	payer := models.Payer{}
+	err = json.Unmarshal(body, &payer)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = payer.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if _, err = server.payerAdapter(&payer); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	payerCreated, err := payer.SavePayer(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, payerCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, payerCreated)
+}
+
+// GetPayers ...
+func (server *Server) GetPayers(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	payer := models.Payer{}
+	payerList, err := payer.FindAllPayers(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, payerList)
+}
+
+// GetPatientEligibility checks a patient's cover with ?payer_id= on
+// ?date=, today by default
+func (server *Server) GetPatientEligibility(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	payerID, err := strconv.ParseUint(r.URL.Query().Get("payer_id"), 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, errors.New("Required Payer ID"))
+		return
+	}
+	date := time.Now()
+	if value := r.URL.Query().Get("date"); value != "" {
+		date, err = time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, errors.New("Invalid Date, Use YYYY-MM-DD"))
+			return
+		}
+	}
+	payer := models.Payer{}
+	if _, err = payer.FindPayerByID(server.DB, uint32(payerID)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	adapter, err := server.payerAdapter(&payer)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), payerTimeout)
+	defer cancel()
+	eligibility, err := models.CheckEligibility(ctx, server.DB, adapter, vars["mrn"], payer.ID, date)
+	if err != nil {
+		handlers.ResponseError(w, consentStatus(err), err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, eligibility)
+}
+
+// CreateClaim drafts a claim for a completed examination
+func (server *Server) CreateClaim(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		ExaminationID uint32 `json:"examination_id"`
+		PayerID       uint32 `json:"payer_id"`
+	}{}
+	err = json.Unmarshal(body, &request)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if request.ExaminationID == 0 || request.PayerID == 0 {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Required Examination ID And Payer ID"))
+		return
+	}
+	claim := models.InsuranceClaim{}
+	claimCreated, err := claim.GenerateClaim(server.DB, request.ExaminationID, request.PayerID, employee.EmployeeID)
+	if err != nil {
+		handlers.ResponseError(w, consentStatus(err), err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, claimCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, claimCreated)
+}
+
+// GetClaims lists claims by ?mrn=, ?payer_id= and ?status=
+func (server *Server) GetClaims(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	var payerID uint64
+	if value := r.URL.Query().Get("payer_id"); value != "" {
+		var err error
+		if payerID, err = strconv.ParseUint(value, 10, 32); err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	claim := models.InsuranceClaim{}
+	claims, err := claim.FindClaims(server.DB, r.URL.Query().Get("mrn"), uint32(payerID), r.URL.Query().Get("status"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, claims)
+}
+
+// GetClaim ...
+func (server *Server) GetClaim(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["claim_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	claim := models.InsuranceClaim{}
+	claimGotten, err := claim.FindClaimByID(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, claimGotten)
+}
+
+// SubmitClaim sends a claim to its payer and returns the decision
+func (server *Server) SubmitClaim(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["claim_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	claim := models.InsuranceClaim{}
+	if _, err = claim.FindClaimByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	payer := models.Payer{}
+	if _, err = payer.FindPayerByID(server.DB, claim.PayerID); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	adapter, err := server.payerAdapter(&payer)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), payerTimeout)
+	defer cancel()
+	submitted, err := claim.Submit(ctx, server.DB, adapter, uint32(id), employee.EmployeeID)
+	if err == payers.ErrUnavailable {
+		handlers.ResponseError(w, http.StatusBadGateway, err)
+		return
+	}
+	if err != nil {
+		handlers.ResponseError(w, consentStatus(err), err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, submitted)
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// CreateConsentText publishes a new version of a consent text.
+// Administrators only.
+func (server *Server) CreateConsentText(w http.ResponseWriter, r *http.Request) {
+
+	admin, err := server.tokenAdmin(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	text := models.ConsentText{}
+	err = json.Unmarshal(body, &text)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = text.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	text.CreatedBy = admin.EmployeeID
+	textCreated, err := text.SaveConsentText(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, textCreated)
+}
+
+// GetConsentTexts ...
+func (server *Server) GetConsentTexts(w http.ResponseWriter, r *http.Request) {
+
+	text := models.ConsentText{}
+
+	texts, err := text.FindAllConsentTexts(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, texts)
+}
+
+// GetPatientConsents returns the consent history of a patient. Staff and
+// the patient themself may read it.
+func (server *Server) GetPatientConsents(w http.ResponseWriter, r *http.Request) {
+
+	mrn := mux.Vars(r)["mrn"]
+	if _, err := server.consentActor(r, mrn); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	consent := models.PatientConsent{}
+	consents, err := consent.FindConsentsByPatient(server.DB, mrn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, consents)
+}
+
+// GrantPatientConsent records a consent. When staff capture it on the
+// patient's behalf their employee ID is stored with it.
+func (server *Server) GrantPatientConsent(w http.ResponseWriter, r *http.Request) {
+
+	mrn := mux.Vars(r)["mrn"]
+	employeeID, err := server.consentActor(r, mrn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	consent := models.PatientConsent{}
+	err = json.Unmarshal(body, &consent)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	consent.PatientMRN = mrn
+	consent.CapturedBy = employeeID
+	if consent.Method == "" && employeeID == 0 {
+		consent.Method = "portal"
+	}
+	err = consent.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	granted, err := consent.Grant(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, granted)
+}
+
+// WithdrawPatientConsent ...
+func (server *Server) WithdrawPatientConsent(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	mrn := vars["mrn"]
+	employeeID, err := server.consentActor(r, mrn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	consent := models.PatientConsent{}
+	withdrawn, err := consent.Withdraw(server.DB, mrn, vars["type"], employeeID)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, withdrawn)
+}
+
+// consentActor allows staff and the patient themself to manage consent. It
+// returns the employee ID for staff and zero for the patient.
+func (server *Server) consentActor(r *http.Request, mrn string) (int, error) {
+	if employee, err := server.tokenEmployee(r); err == nil {
+		return employee.EmployeeID, nil
+	}
+	if server.tokenOwnsPatient(r, mrn) {
+		return 0, nil
+	}
+	return 0, errors.New("Unauthorized")
+}
@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// CreateDepartment ...
+func (server *Server) CreateDepartment(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	department := models.Department{}
+	err = json.Unmarshal(body, &department)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = department.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	departmentCreated, err := department.SaveDepartment(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, departmentCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, departmentCreated)
+}
+
+// GetDepartments ...
+func (server *Server) GetDepartments(w http.ResponseWriter, r *http.Request) {
+
+	department := models.Department{}
+
+	departments, err := department.FindAllDepartments(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, departments)
+}
+
+// GetDepartment ...
+func (server *Server) GetDepartment(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	department := models.Department{}
+	departmentGotten, err := department.FindDepartmentByID(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, departmentGotten)
+}
+
+// GetDepartmentEmployees lists a department's active employees, or all of
+// them with ?include_inactive=true
+func (server *Server) GetDepartmentEmployees(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	department := models.Department{}
+	if _, err = department.FindDepartmentByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	includeInactive := r.URL.Query().Get("include_inactive") == "true"
+	employee := models.Employee{}
+	employees, err := employee.FindEmployeesByDepartment(server.DB, uint32(id), includeInactive)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, employees)
+}
+
+// CreateSpecialty ...
+func (server *Server) CreateSpecialty(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	specialty := models.Specialty{}
+	err = json.Unmarshal(body, &specialty)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = specialty.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	specialtyCreated, err := specialty.SaveSpecialty(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, specialtyCreated)
+}
+
+// GetSpecialties ...
+func (server *Server) GetSpecialties(w http.ResponseWriter, r *http.Request) {
+
+	specialty := models.Specialty{}
+
+	specialties, err := specialty.FindAllSpecialties(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, specialties)
+}
+
+// GetLicenseAlerts lists active employees whose license expires within
+// ?within_days=N, by default the configured warning window
+func (server *Server) GetLicenseAlerts(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	window := models.LicenseWarningWindow
+	if days := r.URL.Query().Get("within_days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			handlers.ResponseError(w, http.StatusBadRequest, fmt.Errorf("Invalid within_days %q", days))
+			return
+		}
+		window = time.Duration(n) * 24 * time.Hour
+	}
+	employee := models.Employee{}
+	employees, err := employee.FindExpiringLicenses(server.DB, time.Now().Add(window))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, employees)
+}
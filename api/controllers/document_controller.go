@@ -0,0 +1,355 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/documents"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// maxSickLeaveDays is the longest sick leave one note can certify
+const maxSickLeaveDays = 30
+
+// sickLeave reads the period of a sick note from ?from=YYYY-MM-DD, which
+// defaults to the visit date, and ?days=, which defaults to 1
+func sickLeave(r *http.Request, visitDate string) (documents.SickLeave, error) {
+	q := r.URL.Query()
+	leave := documents.SickLeave{From: visitDate, Days: 1}
+	if from := q.Get("from"); from != "" {
+		leave.From = from
+	}
+	start, err := time.ParseInLocation("2006-01-02", leave.From, time.Local)
+	if err != nil {
+		return leave, errors.New("Invalid From Date")
+	}
+	if days := q.Get("days"); days != "" {
+		if leave.Days, err = strconv.Atoi(days); err != nil || leave.Days < 1 || leave.Days > maxSickLeaveDays {
+			return leave, fmt.Errorf("Days Must Be Between 1 And %d", maxSickLeaveDays)
+		}
+	}
+	leave.To = start.AddDate(0, 0, leave.Days-1).Format("2006-01-02")
+	return leave, nil
+}
+
+// staffDocuments are the certificates only staff may issue
+var staffDocuments = map[string]bool{documents.SickNote: true, documents.MedicalCertificate: true}
+
+// GetExaminationDocument prints a completed examination as a PDF document
+// under a signed serial number. Patients may print the visit summary and
+// prescription of their own examinations; certificates are issued by staff.
+// Printing the same document again reuses its serial.
+func (server *Server) GetExaminationDocument(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	eid, err := strconv.ParseUint(vars["examination_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	documentType := vars["type"]
+	known := false
+	for _, t := range documents.Types {
+		if documentType == t {
+			known = true
+		}
+	}
+	if !known {
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Unknown Document Type"))
+		return
+	}
+
+	examination := models.Examination{}
+	if _, err = examination.FindExaminationByID(server.DB, uint32(eid)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Examination Not Found"))
+		return
+	}
+	employee, employeeErr := server.tokenEmployee(r)
+	isEmployee := employeeErr == nil
+	if !isEmployee && (staffDocuments[documentType] || !server.tokenOwnsPatient(r, examination.MRN)) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !server.examinationAllowed(w, r, &examination) {
+		return
+	}
+	if examination.Status != models.ExaminationCompleted {
+		handlers.ResponseError(w, http.StatusConflict, errors.New("Examination Is Not Completed"))
+		return
+	}
+
+	data := documents.Data{Examination: &examination}
+	issued := models.IssuedDocument{IssuedBy: employee.EmployeeID}
+	switch documentType {
+	case documents.SickNote:
+		if data.SickLeave, err = sickLeave(r, examination.CreatedAt.Format("2006-01-02")); err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		issued.ValidFrom, issued.ValidTo = data.SickLeave.From, data.SickLeave.To
+	case documents.MedicalCertificate:
+		data.Purpose = strings.TrimSpace(r.URL.Query().Get("purpose"))
+		if len(data.Purpose) > 100 {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Purpose Too Long"))
+			return
+		}
+		issued.Purpose = data.Purpose
+	}
+	server.printDocument(w, documentType, examination.EmployeeID, &data, &issued)
+}
+
+// GetReferralLetter prints the letter the patient takes to the department
+// or facility they are referred to, signed by the referring doctor
+func (server *Server) GetReferralLetter(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["referral_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	referral := models.Referral{}
+	if _, err = referral.FindReferralByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	if referral.Status == models.ReferralRejected {
+		handlers.ResponseError(w, http.StatusConflict, errors.New("Referral Was Rejected"))
+		return
+	}
+	examination := models.Examination{}
+	if _, err = examination.FindExaminationByID(server.DB, referral.ExaminationID); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Examination Not Found"))
+		return
+	}
+	if !server.examinationAllowed(w, r, &examination) {
+		return
+	}
+
+	data := documents.Data{Examination: &examination, Referral: &referral, ReferredTo: referral.ExternalFacility}
+	if !referral.External() {
+		data.ReferredTo = referral.Department.Name
+		if referral.EmployeeID != 0 {
+			target := models.Employee{}
+			if _, err = target.FindEmployeeByID(server.DB, referral.EmployeeID); err == nil {
+				data.ReferredTo = target.Name + ", " + data.ReferredTo
+			}
+		}
+	}
+	issued := models.IssuedDocument{ReferralID: referral.ID, IssuedBy: employee.EmployeeID}
+	server.printDocument(w, documents.ReferralLetter, referral.ReferredBy, &data, &issued)
+}
+
+// printDocument issues data's document under a serial, or finds the serial
+// it was issued under before, and writes it as a PDF signed by doctorID
+func (server *Server) printDocument(w http.ResponseWriter, documentType string, doctorID int, data *documents.Data, issued *models.IssuedDocument) {
+
+	examination := data.Examination
+	patient := models.Patient{}
+	if _, err := patient.FindPatientByMRN(server.DB, examination.MRN); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	doctor := models.Employee{}
+	if _, err := doctor.FindEmployeeByID(server.DB, doctorID); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Doctor Not Found"))
+		return
+	}
+	data.Patient = &patient
+	data.Doctor = &doctor
+	data.VisitDate = examination.CreatedAt.Format("2006-01-02")
+
+	issued.Type = documentType
+	issued.ExaminationID = examination.ExaminationID
+	issued.MRN = examination.MRN
+	if _, err := issued.Issue(server.DB, documents.SerialPrefixes[documentType]); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	data.Serial = issued.Serial
+	data.Issued = issued.IssuedAt
+
+	file, err := documents.Render(documentType, data)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=\"%s-%s.pdf\"", documentType, issued.Serial))
+	w.Header().Set("Content-Length", strconv.Itoa(len(file)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(file)
+}
+
+// GetIssuedDocuments lists the documents printed for the examination given
+// by ?examination_id=
+func (server *Server) GetIssuedDocuments(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	eid, err := strconv.ParseUint(r.URL.Query().Get("examination_id"), 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, errors.New("Required Examination ID"))
+		return
+	}
+	issued := models.IssuedDocument{}
+	list, err := issued.FindIssuedDocumentsByExamination(server.DB, uint32(eid))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, list)
+}
+
+// RevokeDocument withdraws an issued document, for example a sick note
+// printed with the wrong period. The examining doctor and administrators
+// may revoke, giving a reason.
+func (server *Server) RevokeDocument(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	issued := models.IssuedDocument{}
+	if _, err = issued.FindIssuedDocumentBySerial(server.DB, mux.Vars(r)["serial"]); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	examination := models.Examination{}
+	if _, err = examination.FindExaminationByID(server.DB, issued.ExaminationID); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Examination Not Found"))
+		return
+	}
+	if !employee.IsAdmin() && employee.EmployeeID != examination.EmployeeID {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Only The Examining Doctor Or An Administrator May Revoke"))
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := struct {
+		Reason string `json:"reason"`
+	}{}
+	if err = json.Unmarshal(body, &request); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	revoked, err := issued.Revoke(server.DB, employee.EmployeeID, request.Reason)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, revoked)
+}
+
+// documentVerification is what anyone holding a serial is told about the
+// document. It names the patient by initials only and leaves out every
+// clinical detail.
+type documentVerification struct {
+	Serial    string     `json:"serial"`
+	Status    string     `json:"status"`
+	Document  string     `json:"document"`
+	Clinic    string     `json:"clinic"`
+	Patient   string     `json:"patient"`
+	Doctor    string     `json:"doctor"`
+	IssuedAt  time.Time  `json:"issued_at"`
+	ValidFrom string     `json:"valid_from,omitempty"`
+	ValidTo   string     `json:"valid_to,omitempty"`
+	Purpose   string     `json:"purpose,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// initials shortens a name to the first letter of each word
+func initials(name string) string {
+	parts := []string{}
+	for _, word := range strings.Fields(name) {
+		parts = append(parts, strings.ToUpper(string([]rune(word)[0]))+".")
+	}
+	return strings.Join(parts, " ")
+}
+
+// VerifyDocument is the public check of a document's serial number. It
+// answers 404 alike for serials never issued and for forged ones.
+func (server *Server) VerifyDocument(w http.ResponseWriter, r *http.Request) {
+
+	issued := models.IssuedDocument{}
+	if _, err := issued.FindIssuedDocumentBySerial(server.DB, mux.Vars(r)["serial"]); err != nil {
+		if err == models.ErrDocumentNotFound {
+			handlers.ResponseError(w, http.StatusNotFound, err)
+			return
+		}
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	examination := models.Examination{}
+	if _, err := examination.FindExaminationByID(server.DB, issued.ExaminationID); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, models.ErrDocumentNotFound)
+		return
+	}
+	// The patient is looked up without following merges: the document was
+	// issued to this record
+	patient := models.Patient{}
+	server.DB.Debug().Model(&models.Patient{}).Where("mrn = ?", issued.MRN).Take(&patient)
+	// A referral letter is signed by the referring doctor, who need not be
+	// the one who examined the patient
+	signer := examination.EmployeeID
+	if issued.ReferralID != 0 {
+		referral := models.Referral{}
+		if _, err := referral.FindReferralByID(server.DB, issued.ReferralID); err == nil {
+			signer = referral.ReferredBy
+		}
+	}
+	doctor := models.Employee{}
+	doctor.FindEmployeeByID(server.DB, signer)
+
+	verification := documentVerification{
+		Serial:    issued.Serial,
+		Status:    "valid",
+		Document:  documents.Titles[issued.Type],
+		Clinic:    documents.ClinicDetails.Name,
+		Patient:   initials(patient.Name),
+		Doctor:    doctor.Name,
+		IssuedAt:  issued.IssuedAt,
+		ValidFrom: issued.ValidFrom,
+		ValidTo:   issued.ValidTo,
+		Purpose:   issued.Purpose,
+		RevokedAt: issued.RevokedAt,
+	}
+	if issued.Revoked() {
+		verification.Status = "revoked"
+	}
+	handlers.ResponseJSON(w, http.StatusOK, verification)
+}
+
+// examinationAllowed answers 403 unless the caller may read the
+// examination in full. Documents are never printed redacted.
+func (server *Server) examinationAllowed(w http.ResponseWriter, r *http.Request, examination *models.Examination) bool {
+	access, err := server.examinationAccess(r, examination.MRN)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return false
+	}
+	if !access.Allows(examination) {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Examination Is Restricted"))
+		return false
+	}
+	return true
+}
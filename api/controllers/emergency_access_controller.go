@@ -0,0 +1,221 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/events"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// emergencyAccessEvent is the data of a break the glass compliance alert
+type emergencyAccessEvent struct {
+	AlertID    uint32    `json:"alert_id"`
+	ID         uint32    `json:"id"`
+	EmployeeID int       `json:"employee_id"`
+	Employee   string    `json:"employee"`
+	MRN        string    `json:"mrn"`
+	Reason     string    `json:"reason"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// BreakTheGlass grants the employee time limited access to the patient's
+// restricted examinations. It needs a reason and raises an alert with
+// compliance staff, which is kept until acknowledged and also sent to
+// those watching the event stream.
+func (server *Server) BreakTheGlass(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	patient := models.Patient{}
+	if _, err = patient.FindPatientByMRN(server.DB, mux.Vars(r)["mrn"]); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Patient Not Found"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	grant := models.EmergencyAccess{}
+	err = json.Unmarshal(body, &grant)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	grant.MRN = patient.MRN
+	grant.EmployeeID = employee.EmployeeID
+	err = grant.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	grantCreated, alert, err := grant.SaveEmergencyAccess(server.DB, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	log.Printf("emergency access: employee %d opened restricted records of %s until %s: %s",
+		grantCreated.EmployeeID, grantCreated.MRN, grantCreated.ExpiresAt.Format(time.RFC3339), grantCreated.Reason)
+	server.publish(events.Event{
+		Type:         events.ComplianceAlert,
+		Action:       "break-glass",
+		Confidential: true,
+		Data: emergencyAccessEvent{
+			AlertID:    alert.ID,
+			ID:         grantCreated.ID,
+			EmployeeID: employee.EmployeeID,
+			Employee:   employee.Name,
+			MRN:        grantCreated.MRN,
+			Reason:     grantCreated.Reason,
+			ExpiresAt:  grantCreated.ExpiresAt,
+		},
+	})
+
+	w.Header().Set("Location", fmt.Sprintf("%s/emergency-access/%d", r.Host, grantCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, grantCreated)
+}
+
+// GetEmergencyAccesses lists break the glass grants by ?mrn=, ?employee_id=
+// and ?unreviewed=true. Compliance staff and administrators see every
+// grant; other employees only their own.
+func (server *Server) GetEmergencyAccesses(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	query := r.URL.Query()
+	employeeID := 0
+	if v := query.Get("employee_id"); v != "" {
+		employeeID, err = strconv.Atoi(v)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if !employee.IsCompliance() && !employee.IsAdmin() {
+		employeeID = employee.EmployeeID
+	}
+
+	grant := models.EmergencyAccess{}
+	grants, err := grant.FindEmergencyAccesses(server.DB, query.Get("mrn"), employeeID, query.Get("unreviewed") == "true")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, grants)
+}
+
+// ReviewEmergencyAccess records that compliance staff looked into a break
+// the glass grant, with an optional note
+func (server *Server) ReviewEmergencyAccess(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !employee.IsCompliance() && !employee.IsAdmin() {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Compliance Access Required"))
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	review := struct {
+		Note string `json:"note"`
+	}{}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &review); err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+
+	grant := models.EmergencyAccess{}
+	if _, err = grant.FindEmergencyAccessByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	grantReviewed, err := grant.Review(server.DB, employee.EmployeeID, review.Note, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, grantReviewed)
+}
+
+// GetComplianceAlerts lists compliance alerts by ?kind= and
+// ?unacknowledged=true. Compliance staff and administrators only.
+func (server *Server) GetComplianceAlerts(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !employee.IsCompliance() && !employee.IsAdmin() {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Compliance Access Required"))
+		return
+	}
+	query := r.URL.Query()
+	alert := models.ComplianceAlert{}
+	alerts, err := alert.FindComplianceAlerts(server.DB, query.Get("kind"), query.Get("unacknowledged") == "true")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, alerts)
+}
+
+// AcknowledgeComplianceAlert records that compliance staff have seen an
+// alert. Reviewing a break the glass grant acknowledges its alert as well.
+func (server *Server) AcknowledgeComplianceAlert(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	if !employee.IsCompliance() && !employee.IsAdmin() {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Compliance Access Required"))
+		return
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	alert := models.ComplianceAlert{}
+	if _, err = alert.FindComplianceAlertByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	alertAcknowledged, err := alert.Acknowledge(server.DB, employee.EmployeeID, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, alertAcknowledged)
+}
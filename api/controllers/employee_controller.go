@@ -28,6 +28,11 @@ func (server *Server) CreateEmployee(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	// Signing up needs no token, so every new employee starts as staff
+	// with no clearances. An administrator grants other roles and
+	// clearances through the access endpoint.
+	employee.Role = models.RoleStaff
+	employee.Clearances = ""
 	err = employee.Validate("")
 	if err != nil {
 		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
@@ -150,3 +155,88 @@ func (server *Server) DeleteEmployee(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Entity", fmt.Sprintf("%d", uid))
 	handlers.ResponseJSON(w, http.StatusNoContent, "")
 }
+
+// UpdateEmployeeStatus activates or deactivates an employee. Administrators
+// only.
+func (server *Server) UpdateEmployeeStatus(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	employeeID, err := strconv.ParseUint(vars["employee_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	status := struct {
+		Active *bool `json:"active"`
+	}{}
+	err = json.Unmarshal(body, &status)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if status.Active == nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Required Active"))
+		return
+	}
+	employee := models.Employee{}
+	updated, err := employee.SetActive(server.DB, int(employeeID), *status.Active)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
+
+// UpdateEmployeeAccess sets an employee's role and the sensitivity labels
+// they are cleared to read. Administrators only.
+func (server *Server) UpdateEmployeeAccess(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	employeeID, err := strconv.ParseUint(vars["employee_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	access := struct {
+		Role       string   `json:"role"`
+		Clearances []string `json:"clearances"`
+	}{}
+	err = json.Unmarshal(body, &access)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if access.Role == "" {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Required Role"))
+		return
+	}
+	employee := models.Employee{}
+	if _, err = employee.FindEmployeeByID(server.DB, int(employeeID)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Employee Not Found"))
+		return
+	}
+	updated, err := employee.SetAccess(server.DB, int(employeeID), access.Role, access.Clearances)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
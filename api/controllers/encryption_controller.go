@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/repoerna/hms_app/api/encryption"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// encryptionStatus is the body of GET /encryption-keys
+type encryptionStatus struct {
+	MasterKey string                `json:"master_key_id"`
+	DataKey   uint32                `json:"active_data_key_id"`
+	Keys      []models.DataKey      `json:"data_keys"`
+	Columns   []models.SealedColumn `json:"columns"`
+}
+
+// GetEncryptionStatus lists the data keys and how many values of each
+// encrypted column are still waiting to be re-encrypted with the active
+// key. Administrators only.
+func (server *Server) GetEncryptionStatus(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	key := models.DataKey{}
+	keys, err := key.FindDataKeys(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	columns, err := models.FindSealedColumns(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, encryptionStatus{
+		MasterKey: encryption.CurrentMasterKey(),
+		DataKey:   encryption.CurrentDataKey(),
+		Keys:      *keys,
+		Columns:   columns,
+	})
+}
+
+// RotateEncryptionKey creates a new data key for new values and starts
+// re-encrypting existing values with it. Administrators only.
+func (server *Server) RotateEncryptionKey(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	key, err := models.RotateDataKey(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	go server.reencryptFields()
+
+	w.Header().Set("Location", "/encryption-keys")
+	handlers.ResponseJSON(w, http.StatusAccepted, key)
+}
+
+// reencrypting is set while reencryptFields runs, so a rotation during a
+// sweep does not start a second pass over the same rows
+var reencrypting int32
+
+// reencryptFields re-encrypts values in batches until none are left
+// sealed with a retired key
+func (server *Server) reencryptFields() {
+	if !atomic.CompareAndSwapInt32(&reencrypting, 0, 1) {
+		return
+	}
+	defer atomic.StoreInt32(&reencrypting, 0)
+	for {
+		n, err := models.ReencryptFields(server.DB, 500)
+		if err != nil {
+			log.Printf("encryption: %v", err)
+			return
+		}
+		if n == 0 {
+			return
+		}
+		log.Printf("encryption: re-encrypted %d values", n)
+	}
+}
+
+// SweepEncryption reloads the data keys, to pick up a rotation made by
+// another instance, then re-encrypts values sealed with a retired key or
+// still in plaintext, checking every interval
+func (server *Server) SweepEncryption(interval time.Duration) {
+	for {
+		if err := models.LoadDataKeys(server.DB); err != nil {
+			log.Printf("encryption: %v", err)
+		} else {
+			server.reencryptFields()
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,172 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/repoerna/hms_app/api/events"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// eventHeartbeat keeps idle event streams from being closed by proxies
+var eventHeartbeat = 25 * time.Second
+
+// appointmentEvent is what subscribers learn about an appointment. Patient
+// details are left out; screens look them up with their own access.
+type appointmentEvent struct {
+	AppointmentID uint32 `json:"appointment_id"`
+	ScheduleCode  string `json:"schedule_code"`
+	EmployeeID    int    `json:"employee_id"`
+	Date          string `json:"date"`
+	StartTime     string `json:"start_time"`
+	Status        string `json:"status"`
+}
+
+// publish hands an event to the hub, if the server has one
+func (server *Server) publish(e events.Event) {
+	if server.Events != nil {
+		server.Events.Publish(e)
+	}
+}
+
+// publishAppointment announces a change to an appointment to the doctor's
+// department
+func (server *Server) publishAppointment(a *models.Appointment, action string) {
+	var departmentID uint32
+	doctor := models.Employee{}
+	if _, err := doctor.FindEmployeeByID(server.DB, a.EmployeeID); err == nil {
+		departmentID = doctor.DepartmentID
+	}
+	server.publish(events.Event{
+		Type:         events.AppointmentChanged,
+		Action:       action,
+		DepartmentID: departmentID,
+		EmployeeID:   a.EmployeeID,
+		Data: appointmentEvent{
+			AppointmentID: a.AppointmentID,
+			ScheduleCode:  a.ScheduleCode,
+			EmployeeID:    a.EmployeeID,
+			Date:          a.Date,
+			StartTime:     a.StartTime,
+			Status:        a.Status,
+		},
+	})
+}
+
+// publishQueue announces a queue ticket being issued, called or moved on
+func (server *Server) publishQueue(t *models.QueueTicket, action string) {
+	server.publish(events.Event{
+		Type:         events.QueueChanged,
+		Action:       action,
+		DepartmentID: t.DepartmentID,
+		EmployeeID:   t.EmployeeID,
+		Data:         models.BoardTicket{ID: t.ID, Code: t.Code, Number: t.Number, Status: t.Status},
+	})
+}
+
+// publishSchedule announces a schedule change. Schedules are not tied to a
+// department, so every subscriber receives it.
+func (server *Server) publishSchedule(s *models.Schedule, action string) {
+	server.publish(events.Event{
+		Type:   events.ScheduleChanged,
+		Action: action,
+		Data:   s,
+	})
+}
+
+// parseEventFilter reads ?department_id=, ?employee_id= and ?types= (comma
+// separated)
+func parseEventFilter(r *http.Request) (events.Filter, error) {
+	filter := events.Filter{}
+	q := r.URL.Query()
+	if v := q.Get("department_id"); v != "" {
+		id, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid department_id %q", v)
+		}
+		filter.DepartmentID = uint32(id)
+	}
+	if v := q.Get("employee_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid employee_id %q", v)
+		}
+		filter.EmployeeID = id
+	}
+	if v := q.Get("types"); v != "" {
+		filter.Types = map[string]bool{}
+		for _, t := range strings.Split(v, ",") {
+			switch t = strings.TrimSpace(t); t {
+			case events.AppointmentChanged, events.QueueChanged, events.ScheduleChanged, events.ComplianceAlert:
+				filter.Types[t] = true
+			default:
+				return filter, fmt.Errorf("Unknown event type %q", t)
+			}
+		}
+	}
+	return filter, nil
+}
+
+// StreamEvents is a Server-Sent Events stream of live updates for staff
+// screens. Browsers cannot set headers on an EventSource, so the JWT may be
+// passed as ?token=. The stream ends when the client goes away or falls too
+// far behind, after which EventSource reconnects by itself.
+func (server *Server) StreamEvents(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	filter, err := parseEventFilter(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	// Compliance alerts name patients and staff, so only compliance staff
+	// and administrators receive them
+	filter.Confidential = employee.IsCompliance() || employee.IsAdmin()
+	flusher, ok := w.(http.Flusher)
+	if !ok || server.Events == nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, fmt.Errorf("Streaming Not Supported"))
+		return
+	}
+
+	sub := server.Events.Subscribe(filter)
+	defer server.Events.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 3000\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+			flusher.Flush()
+		case e, open := <-sub.C:
+			if !open {
+				return
+			}
+			data, err := json.Marshal(e)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+			flusher.Flush()
+		}
+	}
+}
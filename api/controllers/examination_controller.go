@@ -56,6 +56,14 @@ func (server *Server) GetExaminations(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusInternalServerError, err)
 		return
 	}
+	access, err := server.examinationAccess(r, "")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range *examinations {
+		access.Filter(&(*examinations)[i])
+	}
 	handlers.ResponseJSON(w, http.StatusOK, examinations)
 }
 
@@ -74,6 +82,13 @@ func (server *Server) GetExamination(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusBadRequest, err)
 		return
 	}
+	// Restricted clinical notes are redacted for callers without access
+	access, err := server.examinationAccess(r, examinationGotten.MRN)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	access.Filter(examinationGotten)
 	handlers.ResponseJSON(w, http.StatusOK, examinationGotten)
 }
 
@@ -119,12 +134,32 @@ func (server *Server) UpdateExamination(w http.ResponseWriter, r *http.Request)
 		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+	// Sensitivity labels are set by the examining doctor, administrators
+	// and compliance staff only
+	current := models.Examination{}
+	if _, err = current.FindExaminationByID(server.DB, uint32(eid)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Examination Not Found"))
+		return
+	}
+	if examination.Sensitivity != current.Sensitivity {
+		employee, err := server.tokenEmployee(r)
+		if err != nil || (employee.EmployeeID != current.EmployeeID && !employee.IsAdmin() && !employee.IsCompliance()) {
+			handlers.ResponseError(w, http.StatusForbidden, errors.New("Only The Examining Doctor May Change Sensitivity Labels"))
+			return
+		}
+	}
 	updatedExamination, err := examination.UpdateExamination(server.DB, uint32(eid))
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	access, err := server.examinationAccess(r, updatedExamination.MRN)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	access.Filter(updatedExamination)
 	handlers.ResponseJSON(w, http.StatusOK, updatedExamination)
 }
 
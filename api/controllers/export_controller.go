@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/exports"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// exportRequest is the body of POST /exports
+type exportRequest struct {
+	Resource string   `json:"resource"`
+	Format   string   `json:"format"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+	Columns  []string `json:"columns"`
+}
+
+// exportJob loads a job the caller may see: their own, or any for an
+// administrator
+func (server *Server) exportJob(r *http.Request) (*models.ExportJob, int, error) {
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		return nil, http.StatusUnauthorized, err
+	}
+	id, err := strconv.ParseUint(mux.Vars(r)["export_id"], 10, 32)
+	if err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+	job := models.ExportJob{}
+	if _, err = job.FindExportJobByID(server.DB, uint32(id)); err != nil {
+		return nil, http.StatusNotFound, err
+	}
+	if job.RequestedBy != employee.EmployeeID && !employee.IsAdmin() {
+		return nil, http.StatusNotFound, errors.New("Export Not Found")
+	}
+	if job.Status == models.ExportCompleted {
+		job.URL = fmt.Sprintf("/exports/%d/file", job.ID)
+	}
+	return &job, http.StatusOK, nil
+}
+
+// CreateExport queues an export and answers at once; the job is polled
+// with GET /exports/{export_id} until it is completed
+func (server *Server) CreateExport(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	request := exportRequest{}
+	if err = json.Unmarshal(body, &request); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	job := models.ExportJob{
+		Resource:    request.Resource,
+		Format:      request.Format,
+		DateFrom:    request.From,
+		DateTo:      request.To,
+		RequestedBy: employee.EmployeeID,
+	}
+	if job.Format == "" {
+		job.Format = models.ExportCSV
+	}
+	if err = job.Validate(""); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err = exports.Prepare(&job, request.Columns, employee.IsAdmin()); err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if _, err = job.SaveExportJob(server.DB); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	queued := job
+	go exports.Run(server.DB, &queued)
+
+	w.Header().Set("Location", fmt.Sprintf("/exports/%d", job.ID))
+	handlers.ResponseJSON(w, http.StatusAccepted, job)
+}
+
+// GetExports lists the caller's exports, or everyone's for an
+// administrator
+func (server *Server) GetExports(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	requestedBy := employee.EmployeeID
+	if employee.IsAdmin() {
+		requestedBy = 0
+	}
+	job := models.ExportJob{}
+	jobs, err := job.FindExportJobs(server.DB, requestedBy)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	for i := range *jobs {
+		if (*jobs)[i].Status == models.ExportCompleted {
+			(*jobs)[i].URL = fmt.Sprintf("/exports/%d/file", (*jobs)[i].ID)
+		}
+	}
+	handlers.ResponseJSON(w, http.StatusOK, jobs)
+}
+
+// GetExport returns the status of an export
+func (server *Server) GetExport(w http.ResponseWriter, r *http.Request) {
+
+	job, status, err := server.exportJob(r)
+	if err != nil {
+		handlers.ResponseError(w, status, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, job)
+}
+
+// DownloadExport streams the file of a completed export
+func (server *Server) DownloadExport(w http.ResponseWriter, r *http.Request) {
+
+	job, status, err := server.exportJob(r)
+	if err != nil {
+		handlers.ResponseError(w, status, err)
+		return
+	}
+	if job.Status == models.ExportExpired {
+		handlers.ResponseError(w, http.StatusGone, errors.New("Export Has Expired"))
+		return
+	}
+	if job.Status != models.ExportCompleted {
+		handlers.ResponseError(w, http.StatusConflict, errors.New("Export Is Not Ready"))
+		return
+	}
+	file, err := os.Open(job.Path)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusGone, errors.New("Export Has Expired"))
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", exports.ContentType(job.Format))
+	w.Header().Set("Content-Length", strconv.FormatInt(job.Size, 10))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%d.%s\"", job.Resource, job.ID, exports.Extension(job.Format)))
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, file)
+}
+
+// SweepExports fails exports a restart interrupted, then deletes finished
+// files once their retention has passed, checking every interval
+func (server *Server) SweepExports(interval time.Duration) {
+	if err := exports.Recover(server.DB); err != nil {
+		log.Printf("exports: %v", err)
+	}
+	for {
+		if err := exports.Sweep(server.DB, time.Now()); err != nil {
+			log.Printf("exports: %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,341 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/fhir"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// fhirBase is the absolute base URL of the FHIR facade for this request
+func fhirBase(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return fmt.Sprintf("%s://%s/fhir/R4", scheme, r.Host)
+}
+
+// fhirJSON writes a FHIR resource
+func fhirJSON(w http.ResponseWriter, statusCode int, payload interface{}) {
+	w.Header().Set("Content-Type", fhir.ContentType)
+	handlers.ResponseJSON(w, statusCode, payload)
+}
+
+// fhirError writes an OperationOutcome. code is the FHIR issue type.
+func fhirError(w http.ResponseWriter, statusCode int, code string, err error) {
+	fhirJSON(w, statusCode, fhir.NewOperationOutcome(code, err.Error()))
+}
+
+// fhirSearchError answers a failed search: 400 for a bad parameter, 500
+// otherwise
+func fhirSearchError(w http.ResponseWriter, err error) {
+	if _, ok := err.(*fhir.ParamError); ok {
+		fhirError(w, http.StatusBadRequest, "invalid", err)
+		return
+	}
+	fhirError(w, http.StatusInternalServerError, "exception", err)
+}
+
+// fhirAuthorized checks that the caller is an employee; partner systems
+// sign in with a service account
+func (server *Server) fhirAuthorized(w http.ResponseWriter, r *http.Request) bool {
+	if _, err := server.tokenEmployee(r); err != nil {
+		fhirError(w, http.StatusUnauthorized, "login", err)
+		return false
+	}
+	return true
+}
+
+// GetFHIRMetadata returns the CapabilityStatement
+func (server *Server) GetFHIRMetadata(w http.ResponseWriter, r *http.Request) {
+	fhirJSON(w, http.StatusOK, fhir.Capabilities(fhirBase(r)))
+}
+
+// ReadFHIRResource returns one resource by type and id
+func (server *Server) ReadFHIRResource(w http.ResponseWriter, r *http.Request) {
+
+	if !server.fhirAuthorized(w, r) {
+		return
+	}
+	vars := mux.Vars(r)
+	resourceType, id := vars["type"], vars["id"]
+	notFound := fmt.Errorf("%s/%s Not Found", resourceType, id)
+
+	var resource interface{}
+	switch resourceType {
+	case "Patient":
+		patient := models.Patient{}
+		if _, err := patient.FindPatientByMRN(server.DB, id); err == nil {
+			resource = fhir.FromPatient(&patient)
+		}
+	case "Practitioner":
+		if employeeID, err := strconv.Atoi(id); err == nil {
+			employee := models.Employee{}
+			if _, err = employee.FindEmployeeByID(server.DB, employeeID); err == nil {
+				resource = fhir.FromEmployee(&employee)
+			}
+		}
+	case "Appointment":
+		if appointmentID, err := strconv.ParseUint(id, 10, 32); err == nil {
+			appointment := models.Appointment{}
+			if _, err = appointment.FindAppointmentByID(server.DB, uint32(appointmentID)); err == nil {
+				resource = fhir.FromAppointment(&appointment)
+			}
+		}
+	case "Schedule":
+		schedule := models.Schedule{}
+		if _, err := schedule.FindSchedulesByCode(server.DB, id); err == nil {
+			resource = fhir.FromSchedule(&schedule)
+		}
+	case "Slot":
+		slot, err := fhir.FindSlot(server.DB, id)
+		if err != nil {
+			fhirError(w, http.StatusInternalServerError, "exception", err)
+			return
+		}
+		if slot != nil {
+			resource = slot
+		}
+	case "Encounter", "Condition", "MedicationRequest":
+		if examinationID, err := strconv.ParseUint(id, 10, 32); err == nil {
+			examination := models.Examination{}
+			if _, err = examination.FindExaminationByID(server.DB, uint32(examinationID)); err == nil {
+				access, err := server.examinationAccess(r, examination.MRN)
+				if err != nil {
+					fhirError(w, http.StatusInternalServerError, "exception", err)
+					return
+				}
+				access.Filter(&examination)
+				switch resourceType {
+				case "Encounter":
+					resource = fhir.FromExamination(&examination)
+				case "Condition":
+					if condition := fhir.FromDiagnosis(&examination); condition != nil {
+						resource = condition
+					}
+				case "MedicationRequest":
+					if request := fhir.FromPrescription(&examination); request != nil {
+						resource = request
+					}
+				}
+			}
+		}
+	default:
+		fhirError(w, http.StatusNotFound, "not-supported", fmt.Errorf("Resource Type %s Is Not Supported", resourceType))
+		return
+	}
+	if resource == nil {
+		fhirError(w, http.StatusNotFound, "not-found", notFound)
+		return
+	}
+	fhirJSON(w, http.StatusOK, resource)
+}
+
+// SearchFHIRResources searches one resource type and returns a searchset
+// Bundle
+func (server *Server) SearchFHIRResources(w http.ResponseWriter, r *http.Request) {
+
+	if !server.fhirAuthorized(w, r) {
+		return
+	}
+	resourceType := mux.Vars(r)["type"]
+	q := r.URL.Query()
+	page, err := fhir.ParsePage(q)
+	if err != nil {
+		fhirSearchError(w, err)
+		return
+	}
+
+	type found struct {
+		id       string
+		resource interface{}
+	}
+	results := []found{}
+	var total int
+
+	switch resourceType {
+	case "Patient":
+		patients, n, err := fhir.SearchPatients(server.DB, q, page)
+		if err != nil {
+			fhirSearchError(w, err)
+			return
+		}
+		for i := range patients {
+			results = append(results, found{patients[i].MRN, fhir.FromPatient(&patients[i])})
+		}
+		total = n
+	case "Practitioner":
+		employees, n, err := fhir.SearchPractitioners(server.DB, q, page)
+		if err != nil {
+			fhirSearchError(w, err)
+			return
+		}
+		for i := range employees {
+			results = append(results, found{strconv.Itoa(employees[i].EmployeeID), fhir.FromEmployee(&employees[i])})
+		}
+		total = n
+	case "Appointment":
+		appointments, n, err := fhir.SearchAppointments(server.DB, q, page)
+		if err != nil {
+			fhirSearchError(w, err)
+			return
+		}
+		for i := range appointments {
+			res := fhir.FromAppointment(&appointments[i])
+			results = append(results, found{res.ID, res})
+		}
+		total = n
+	case "Schedule":
+		schedules, n, err := fhir.SearchSchedules(server.DB, q, page)
+		if err != nil {
+			fhirSearchError(w, err)
+			return
+		}
+		for i := range schedules {
+			results = append(results, found{schedules[i].ScheduleCode, fhir.FromSchedule(&schedules[i])})
+		}
+		total = n
+	case "Slot":
+		slots, err := fhir.SearchSlots(server.DB, q, time.Now())
+		if err != nil {
+			fhirSearchError(w, err)
+			return
+		}
+		for i := range slots {
+			results = append(results, found{slots[i].ID, &slots[i]})
+		}
+		total = len(slots)
+		page = fhir.Page{Count: total}
+	case "Encounter", "Condition", "MedicationRequest":
+		require := map[string]string{"Condition": "diagnosis", "MedicationRequest": "prescription"}[resourceType]
+		examinations, n, err := fhir.SearchExaminations(server.DB, q, page, require)
+		if err != nil {
+			fhirSearchError(w, err)
+			return
+		}
+		access, err := server.examinationAccess(r, "")
+		if err != nil {
+			fhirError(w, http.StatusInternalServerError, "exception", err)
+			return
+		}
+		for i := range examinations {
+			e := &examinations[i]
+			// Redacted examinations keep their place on the page, with the
+			// notes masked, so the total and _offset paging stay true
+			access.Filter(e)
+			var res interface{}
+			switch resourceType {
+			case "Encounter":
+				res = fhir.FromExamination(e)
+			case "Condition":
+				if condition := fhir.FromDiagnosis(e); condition != nil {
+					res = condition
+				}
+			case "MedicationRequest":
+				if request := fhir.FromPrescription(e); request != nil {
+					res = request
+				}
+			}
+			if res == nil {
+				// The query only finds examinations with the notes asked for
+				continue
+			}
+			results = append(results, found{strconv.FormatUint(uint64(e.ExaminationID), 10), res})
+		}
+		total = n
+	default:
+		fhirError(w, http.StatusNotFound, "not-supported", fmt.Errorf("Resource Type %s Is Not Supported", resourceType))
+		return
+	}
+
+	base := fhirBase(r)
+	bundle := fhir.Bundle{
+		ResourceType: "Bundle",
+		Type:         "searchset",
+		Total:        total,
+		Link:         []fhir.BundleLink{{Relation: "self", URL: base + "/" + resourceType + "?" + r.URL.RawQuery}},
+		Entry:        []fhir.BundleEntry{},
+	}
+	if next := page.Offset + len(results); len(results) > 0 && next < total {
+		nextQuery := url.Values{}
+		for k, v := range q {
+			nextQuery[k] = v
+		}
+		nextQuery.Set("_offset", strconv.Itoa(next))
+		nextQuery.Set("_count", strconv.Itoa(page.Count))
+		bundle.Link = append(bundle.Link, fhir.BundleLink{Relation: "next", URL: base + "/" + resourceType + "?" + nextQuery.Encode()})
+	}
+	for _, f := range results {
+		bundle.Entry = append(bundle.Entry, fhir.BundleEntry{
+			FullURL:  base + "/" + resourceType + "/" + f.id,
+			Resource: f.resource,
+			Search:   &fhir.BundleSearch{Mode: "match"},
+		})
+	}
+	fhirJSON(w, http.StatusOK, bundle)
+}
+
+// CreateFHIRAppointment books an appointment from a FHIR Appointment that
+// references the patient, the practitioner and the slot to book. The same
+// booking rules apply as to patients booking for themselves.
+func (server *Server) CreateFHIRAppointment(w http.ResponseWriter, r *http.Request) {
+
+	if !server.fhirAuthorized(w, r) {
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fhirError(w, http.StatusBadRequest, "structure", err)
+		return
+	}
+	resource := fhir.Appointment{}
+	if err = json.Unmarshal(body, &resource); err != nil {
+		fhirError(w, http.StatusBadRequest, "structure", err)
+		return
+	}
+	appointment, err := fhir.ToAppointment(&resource)
+	if err != nil {
+		fhirError(w, http.StatusUnprocessableEntity, "invalid", err)
+		return
+	}
+	if err = appointment.Validate("booking"); err != nil {
+		fhirError(w, http.StatusUnprocessableEntity, "required", err)
+		return
+	}
+	patient := models.Patient{}
+	if _, err = patient.FindPatientByMRN(server.DB, appointment.MRN); err != nil {
+		fhirError(w, http.StatusUnprocessableEntity, "not-found", err)
+		return
+	}
+	if patient.MergedInto != "" {
+		fhirError(w, http.StatusUnprocessableEntity, "business-rule", errors.New("Patient Has Been Merged Into "+patient.MergedInto))
+		return
+	}
+	doctor := models.Employee{}
+	if _, err = doctor.FindEmployeeByID(server.DB, appointment.EmployeeID); err != nil {
+		fhirError(w, http.StatusUnprocessableEntity, "not-found", errors.New("Practitioner Not Found"))
+		return
+	}
+	booked, err := appointment.Book(server.DB, time.Now())
+	if err != nil {
+		fhirError(w, http.StatusUnprocessableEntity, "business-rule", err)
+		return
+	}
+	server.publishAppointment(booked, "booked")
+	created := fhir.FromAppointment(booked)
+	w.Header().Set("Location", fhirBase(r)+"/Appointment/"+created.ID)
+	fhirJSON(w, http.StatusCreated, created)
+}
@@ -0,0 +1,279 @@
+package controllers
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/repoerna/hms_app/api/hl7"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// hl7Null is the HL7 way of saying a field is to be cleared, as opposed to
+// an empty field which leaves it unchanged
+const hl7Null = `""`
+
+// HandleHL7 applies an ADT or SIU message from the MLLP listener. Patients
+// are only ever updated, never registered, from a feed.
+func (server *Server) HandleHL7(m *hl7.Message) error {
+	messageType, event := m.Type()
+	log.Printf("hl7: %s^%s from %s, control id %s", messageType, event, m.Sender(), m.ControlID())
+
+	switch messageType {
+	case "ADT":
+		switch event {
+		case "A01", "A08":
+			return server.hl7UpdatePatient(m)
+		case "A03":
+			return server.hl7Discharge(m)
+		}
+	case "SIU":
+		switch event {
+		case "S12":
+			return server.hl7BookAppointment(m)
+		case "S15":
+			return server.hl7CancelAppointment(m)
+		}
+	default:
+		return hl7.Rejectf(hl7.ErrUnsupportedMessageType, "Unsupported Message Type %s", messageType)
+	}
+	return hl7.Rejectf(hl7.ErrUnsupportedEventCode, "Unsupported Event %s^%s", messageType, event)
+}
+
+// hl7Patient finds the patient of PID-3. Identifiers typed MR are taken as
+// our MRN, NI, NN and SS as a national ID, and untyped ones are tried as
+// both. A merged record resolves to the record it was merged into.
+func (server *Server) hl7Patient(m *hl7.Message) (*models.Patient, error) {
+	if _, ok := m.Segment("PID"); !ok {
+		return nil, hl7.Errorf(hl7.ErrSegmentSequence, "Required PID Segment")
+	}
+	for _, repetition := range m.Repetitions("PID", 3) {
+		id := m.Unescape(m.Component(repetition, 1))
+		if id == "" {
+			continue
+		}
+		idType := m.Component(repetition, 5)
+		patient := models.Patient{}
+		var err error
+		switch idType {
+		case "MR":
+			_, err = patient.FindPatientByMRN(server.DB, id)
+		case "NI", "NN", "SS":
+			_, err = patient.FindPatientByNationalID(server.DB, id)
+		default:
+			if _, err = patient.FindPatientByMRN(server.DB, id); err != nil {
+				_, err = patient.FindPatientByNationalID(server.DB, id)
+			}
+		}
+		if err != nil {
+			continue
+		}
+		for hops := 0; patient.MergedInto != "" && hops < 5; hops++ {
+			survivor := models.Patient{}
+			if _, err = survivor.FindPatientByMRN(server.DB, patient.MergedInto); err != nil {
+				return nil, hl7.Errorf(hl7.ErrUnknownKey, "Merged Patient Not Found")
+			}
+			patient = survivor
+		}
+		return &patient, nil
+	}
+	return nil, hl7.Errorf(hl7.ErrUnknownKey, "Unknown Patient")
+}
+
+// hl7UpdatePatient copies the name, date of birth, sex and address of an
+// A01 or A08 onto the patient. Fields the sender leaves empty are kept.
+func (server *Server) hl7UpdatePatient(m *hl7.Message) error {
+	patient, err := server.hl7Patient(m)
+	if err != nil {
+		return err
+	}
+
+	// PID-5 is family^given^middle
+	if family := m.Get("PID", 5, 1); family != "" && family != hl7Null {
+		name := []string{}
+		for _, part := range []string{m.Get("PID", 5, 2), m.Get("PID", 5, 3), family} {
+			if part != "" {
+				name = append(name, part)
+			}
+		}
+		patient.Name = strings.Join(name, " ")
+	}
+	if dob := m.Get("PID", 7, 1); dob != "" && dob != hl7Null {
+		if len(dob) < 8 {
+			return hl7.Errorf(hl7.ErrDataType, "Invalid PID-7 Date Of Birth")
+		}
+		patient.DateOfBirth = dob[0:4] + "-" + dob[4:6] + "-" + dob[6:8]
+	}
+	if sex := m.Get("PID", 8, 1); sex != "" && sex != hl7Null {
+		if sex != "M" && sex != "F" {
+			return hl7.Errorf(hl7.ErrDataType, "Unsupported PID-8 Sex %s", sex)
+		}
+		patient.Sex = sex
+	}
+	// PID-11 is street^other^city^state^zip
+	if address := m.Get("PID", 11, 0); address == hl7Null {
+		patient.Address, patient.City, patient.Province, patient.PostalCode = "", "", "", ""
+	} else if address != "" {
+		street := m.Get("PID", 11, 1)
+		if other := m.Get("PID", 11, 2); other != "" {
+			street += ", " + other
+		}
+		patient.Address = street
+		patient.City = m.Get("PID", 11, 3)
+		patient.Province = m.Get("PID", 11, 4)
+		patient.PostalCode = m.Get("PID", 11, 5)
+	}
+
+	if _, err = patient.UpdateDemographics(server.DB, patient.MRN); err != nil {
+		return hl7.Errorf(hl7.ErrApplication, "%s", err.Error())
+	}
+	return nil
+}
+
+// hl7Discharge completes the appointment in PV1-19, the visit number, when
+// an A03 reports the patient has left
+func (server *Server) hl7Discharge(m *hl7.Message) error {
+	patient, err := server.hl7Patient(m)
+	if err != nil {
+		return err
+	}
+	visit := m.Get("PV1", 19, 1)
+	if visit == "" {
+		return hl7.Errorf(hl7.ErrRequiredFieldMissing, "Required PV1-19 Visit Number")
+	}
+	aid, err := strconv.ParseUint(visit, 10, 32)
+	if err != nil {
+		return hl7.Errorf(hl7.ErrDataType, "Invalid PV1-19 Visit Number")
+	}
+	appointment := models.Appointment{}
+	if _, err = appointment.FindAppointmentByID(server.DB, uint32(aid)); err != nil || appointment.MRN != patient.MRN {
+		return hl7.Errorf(hl7.ErrUnknownKey, "Appointment Not Found")
+	}
+	if appointment.Status == models.AppointmentCancelled {
+		return hl7.Errorf(hl7.ErrApplication, "Appointment Was Cancelled")
+	}
+	updated, err := appointment.SetStatus(server.DB, uint32(aid), models.AppointmentCompleted)
+	if err != nil {
+		return err
+	}
+	server.publishAppointment(updated, models.AppointmentCompleted)
+	return nil
+}
+
+// hl7Start returns the start of a booking: AIS-4, or the fourth component
+// of SCH-11 in messages from before v2.5
+func hl7Start(m *hl7.Message) (time.Time, error) {
+	start := m.Get("AIS", 4, 1)
+	if start == "" {
+		start = m.Get("SCH", 11, 4)
+	}
+	if len(start) < 12 {
+		return time.Time{}, hl7.Errorf(hl7.ErrRequiredFieldMissing, "Required Appointment Start In AIS-4 Or SCH-11")
+	}
+	at, err := time.ParseInLocation("200601021504", start[:12], time.Local)
+	if err != nil {
+		return time.Time{}, hl7.Errorf(hl7.ErrDataType, "Invalid Appointment Start")
+	}
+	return at, nil
+}
+
+// hl7BookAppointment books the slot an S12 asks for. The schedule is the one
+// held on that weekday starting at that time, and the doctor is AIP-3. A
+// repeated S12 for the same placer id is acknowledged without booking again.
+func (server *Server) hl7BookAppointment(m *hl7.Message) error {
+	placerID := m.Get("SCH", 1, 1)
+	if placerID == "" {
+		return hl7.Errorf(hl7.ErrRequiredFieldMissing, "Required SCH-1 Placer Appointment ID")
+	}
+	link := models.ExternalAppointment{}
+	if _, err := link.FindExternalAppointment(server.DB, m.Sender(), placerID); err == nil {
+		return nil
+	}
+
+	patient, err := server.hl7Patient(m)
+	if err != nil {
+		return err
+	}
+	start, err := hl7Start(m)
+	if err != nil {
+		return err
+	}
+	employeeID, err := strconv.Atoi(m.Get("AIP", 3, 1))
+	if err != nil {
+		return hl7.Errorf(hl7.ErrRequiredFieldMissing, "Required AIP-3 Practitioner ID")
+	}
+	doctor := models.Employee{}
+	if _, err = doctor.FindEmployeeByID(server.DB, employeeID); err != nil {
+		return hl7.Errorf(hl7.ErrUnknownKey, "Practitioner Not Found")
+	}
+
+	schedule := models.Schedule{}
+	schedules, err := schedule.FindAllSchedules(server.DB)
+	if err != nil {
+		return err
+	}
+	scheduleCode := ""
+	for _, s := range *schedules {
+		if day, ok := s.Weekday(); ok && day == start.Weekday() && s.StartTime == start.Format("15:04") {
+			scheduleCode = s.ScheduleCode
+			break
+		}
+	}
+	if scheduleCode == "" {
+		return hl7.Errorf(hl7.ErrUnknownKey, "No Schedule Starts At %s", start.Format("Monday 15:04"))
+	}
+
+	appointment := models.Appointment{
+		ScheduleCode: scheduleCode,
+		MRN:          patient.MRN,
+		EmployeeID:   employeeID,
+		Date:         start.Format("2006-01-02"),
+	}
+	if err = appointment.Validate("booking"); err != nil {
+		return hl7.Errorf(hl7.ErrRequiredFieldMissing, "%s", err.Error())
+	}
+	booked, err := appointment.BookExternal(server.DB, m.Sender(), placerID, time.Now())
+	if err != nil {
+		return hl7.Errorf(hl7.ErrApplication, "%s", err.Error())
+	}
+	server.publishAppointment(booked, "booked")
+	return nil
+}
+
+// hl7CancelAppointment cancels the appointment an S15 refers to, by the
+// placer id the sender booked it under or by our id in SCH-2
+func (server *Server) hl7CancelAppointment(m *hl7.Message) error {
+	var aid uint32
+	link := models.ExternalAppointment{}
+	if placerID := m.Get("SCH", 1, 1); placerID != "" {
+		if _, err := link.FindExternalAppointment(server.DB, m.Sender(), placerID); err == nil {
+			aid = link.AppointmentID
+		}
+	}
+	if aid == 0 {
+		if fillerID, err := strconv.ParseUint(m.Get("SCH", 2, 1), 10, 32); err == nil {
+			aid = uint32(fillerID)
+		}
+	}
+	if aid == 0 {
+		return hl7.Errorf(hl7.ErrUnknownKey, "Appointment Not Found")
+	}
+	// The filler id is only a number, so the patient must match as well
+	// before a feed may cancel the appointment
+	patient, err := server.hl7Patient(m)
+	if err != nil {
+		return err
+	}
+	appointment := models.Appointment{}
+	if _, err = appointment.FindAppointmentByID(server.DB, aid); err != nil || appointment.MRN != patient.MRN {
+		return hl7.Errorf(hl7.ErrUnknownKey, "Appointment Not Found")
+	}
+
+	cancelled, err := appointment.SetStatus(server.DB, aid, models.AppointmentCancelled)
+	if err != nil {
+		return hl7.Errorf(hl7.ErrUnknownKey, "%s", err.Error())
+	}
+	server.publishAppointment(cancelled, "cancelled")
+	return nil
+}
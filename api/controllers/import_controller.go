@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/importer"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// maxImportSize bounds an uploaded CSV file
+const maxImportSize = 10 << 20
+
+// importColumns lists the CSV columns accepted for each resource. Patients
+// may give one mobile number in a phone column.
+var importColumns = map[string][]string{
+	"patients": {"name", "email", "password", "national_id", "national_id_type", "date_of_birth", "sex",
+		"blood_type", "address", "city", "province", "postal_code", "phone"},
+	"employees": {"employee_id", "name", "email", "password", "department_id", "specialty_id",
+		"job_title", "license_number", "license_expiry"},
+	"schedules": {"schedule_code", "day", "start_time", "end_time", "status"},
+}
+
+// importFile returns the CSV of the request, sent either as the body or as
+// the file field of a multipart form
+func importFile(w http.ResponseWriter, r *http.Request) (io.ReadCloser, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			return nil, errors.New("Required CSV File In Field file")
+		}
+		return file, nil
+	}
+	return r.Body, nil
+}
+
+// decodeImportRow turns a CSV row into a record of the resource and
+// validates it the same way as the create endpoint does
+func decodeImportRow(resource string, row importer.Row) (interface{}, error) {
+	switch resource {
+	case "patients":
+		patient := models.Patient{}
+		if err := importer.Decode(row, &patient); err != nil {
+			return nil, err
+		}
+		if phone := row.Values["phone"]; phone != "" {
+			patient.Phones = []models.PatientPhone{{Kind: "mobile", Number: phone, Primary: true}}
+		}
+		return &patient, patient.Validate("")
+	case "employees":
+		employee := models.Employee{}
+		if err := importer.Decode(row, &employee); err != nil {
+			return nil, err
+		}
+		return &employee, employee.Validate("")
+	default:
+		schedule := models.Schedule{}
+		if err := importer.Decode(row, &schedule); err != nil {
+			return nil, err
+		}
+		return &schedule, schedule.Validate("")
+	}
+}
+
+// importKey names an imported record in the result
+func importKey(value interface{}) string {
+	switch record := value.(type) {
+	case *models.Patient:
+		return record.MRN
+	case *models.Employee:
+		return strconv.Itoa(record.EmployeeID)
+	case *models.Schedule:
+		return record.ScheduleCode
+	}
+	return ""
+}
+
+// ImportRecords creates patients, employees or schedules from a CSV file.
+// Every row is validated and reported on; valid rows are saved in batches.
+// With ?dry_run=true nothing is saved. Likely duplicate patients are
+// refused unless ?allow_duplicate=true.
+func (server *Server) ImportRecords(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	resource := mux.Vars(r)["resource"]
+	columns, ok := importColumns[resource]
+	if !ok {
+		handlers.ResponseError(w, http.StatusNotFound, fmt.Errorf("Cannot Import %s", resource))
+		return
+	}
+	q := r.URL.Query()
+	dryRun := q.Get("dry_run") == "true"
+	allowDuplicate := q.Get("allow_duplicate") == "true"
+
+	file, err := importFile(w, r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	defer file.Close()
+	rows, err := importer.ReadCSV(file, columns)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	result := importer.Result{Resource: resource, DryRun: dryRun, Rows: len(rows), Errors: []importer.RowError{}}
+	records := []importer.Record{}
+	for _, row := range rows {
+		value, err := decodeImportRow(resource, row)
+		if err != nil {
+			result.Fail(row.Number, err)
+			continue
+		}
+		records = append(records, importer.Record{Row: row.Number, Value: value})
+	}
+
+	im := importer.Importer{DB: server.DB, DryRun: dryRun, Key: importKey}
+	if resource == "patients" && !allowDuplicate {
+		im.Check = func(tx *gorm.DB, value interface{}) error {
+			duplicates, err := value.(*models.Patient).FindDuplicates(tx)
+			if err != nil {
+				return err
+			}
+			if len(duplicates) > 0 {
+				return fmt.Errorf("Possible Duplicate Of %s", duplicates[0].Patient.MRN)
+			}
+			return nil
+		}
+	}
+	if err = im.Run(&result, records); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,364 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// CreateRoom ...
+func (server *Server) CreateRoom(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	wardID, err := strconv.ParseUint(vars["ward_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	room := models.Room{}
+	err = json.Unmarshal(body, &room)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	room.WardID = uint32(wardID)
+	err = room.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	roomCreated, err := room.SaveRoom(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, roomCreated)
+}
+
+// GetWardRooms lists a ward's rooms and beds
+func (server *Server) GetWardRooms(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	wardID, err := strconv.ParseUint(vars["ward_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	room := models.Room{}
+	rooms, err := room.FindRoomsByWard(server.DB, uint32(wardID))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, rooms)
+}
+
+// CreateBed ...
+func (server *Server) CreateBed(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	roomID, err := strconv.ParseUint(vars["room_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	bed := models.Bed{}
+	err = json.Unmarshal(body, &bed)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	bed.RoomID = uint32(roomID)
+	err = bed.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	bedCreated, err := bed.SaveBed(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, bedCreated)
+}
+
+// GetBeds lists beds, filtered by ?ward_id= and ?status=
+func (server *Server) GetBeds(w http.ResponseWriter, r *http.Request) {
+
+	var wardID uint64
+	var err error
+	if ward := r.URL.Query().Get("ward_id"); ward != "" {
+		wardID, err = strconv.ParseUint(ward, 10, 32)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	bed := models.Bed{}
+	beds, err := bed.FindBeds(server.DB, uint32(wardID), r.URL.Query().Get("status"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, beds)
+}
+
+// UpdateBedStatus ...
+func (server *Server) UpdateBedStatus(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	bedID, err := strconv.ParseUint(vars["bed_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	bed := models.Bed{}
+	err = json.Unmarshal(body, &bed)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = bed.Validate("status")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	updated, err := bed.UpdateStatus(server.DB, uint32(bedID), bed.Status)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
+
+// GetWardOccupancy ...
+func (server *Server) GetWardOccupancy(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	wardID, err := strconv.ParseUint(vars["ward_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	occupancy, err := models.FindWardOccupancy(server.DB, uint32(wardID))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, occupancy)
+}
+
+// CreateAdmission admits a patient to a bed. The admitting employee is
+// taken from the token.
+func (server *Server) CreateAdmission(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	admission := models.Admission{}
+	err = json.Unmarshal(body, &admission)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = admission.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	admission.AdmittedBy = employee.EmployeeID
+	admitted, err := admission.Admit(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, admitted.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, admitted)
+}
+
+// GetAdmissions lists admissions, filtered by ?mrn= and ?status=
+func (server *Server) GetAdmissions(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	admission := models.Admission{}
+	admissions, err := admission.FindAdmissions(server.DB, r.URL.Query().Get("mrn"), r.URL.Query().Get("status"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, admissions)
+}
+
+// GetAdmission ...
+func (server *Server) GetAdmission(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["admission_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	admission := models.Admission{}
+	if _, err = admission.FindAdmissionByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	if _, err = server.tokenEmployee(r); err != nil && !server.tokenOwnsPatient(r, admission.MRN) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, admission)
+}
+
+// TransferAdmission moves an admitted patient to another bed
+func (server *Server) TransferAdmission(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["admission_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	admission := models.Admission{}
+	err = json.Unmarshal(body, &admission)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = admission.Validate("transfer")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	transferred, err := admission.Transfer(server.DB, uint32(id), admission.BedID, employee.EmployeeID)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, transferred)
+}
+
+// DischargeAdmission ...
+func (server *Server) DischargeAdmission(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["admission_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	admission := models.Admission{}
+	if len(body) > 0 {
+		if err = json.Unmarshal(body, &admission); err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	discharged, err := admission.Discharge(server.DB, uint32(id), employee.EmployeeID, admission.Disposition)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, discharged)
+}
+
+// GetCensus returns the inpatient census at ?at= (RFC 3339 or a date, default now),
+// for every ward or only ?ward_id=
+func (server *Server) GetCensus(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	at := time.Now()
+	var err error
+	if value := r.URL.Query().Get("at"); value != "" {
+		at, err = parseQueryTime(value, false)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	var wardID uint64
+	if ward := r.URL.Query().Get("ward_id"); ward != "" {
+		wardID, err = strconv.ParseUint(ward, 10, 32)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	census, err := models.BuildCensus(server.DB, at, uint32(wardID))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, census)
+}
@@ -0,0 +1,240 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// CreateLabTest adds a test to the catalogue. Its reference ranges flag
+// every later result, so only administrators may add one.
+func (server *Server) CreateLabTest(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	test := models.LabTest{}
+	err = json.Unmarshal(body, &test)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = test.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	testCreated, err := test.SaveLabTest(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, testCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, testCreated)
+}
+
+// GetLabTests ...
+func (server *Server) GetLabTests(w http.ResponseWriter, r *http.Request) {
+
+	test := models.LabTest{}
+
+	tests, err := test.FindAllLabTests(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, tests)
+}
+
+// GetLabTest ...
+func (server *Server) GetLabTest(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["lab_test_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	test := models.LabTest{}
+	testGotten, err := test.FindLabTestByID(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, testGotten)
+}
+
+// CreateLabOrder ...
+func (server *Server) CreateLabOrder(w http.ResponseWriter, r *http.Request) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	order := models.LabOrder{}
+	err = json.Unmarshal(body, &order)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = order.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	order.OrderedBy = employee.EmployeeID
+	orderCreated, err := order.SaveLabOrder(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, orderCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, orderCreated)
+}
+
+// GetLabOrders accepts examination_id, mrn and status query filters.
+// Patients must filter by their own mrn.
+func (server *Server) GetLabOrders(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+	mrn := query.Get("mrn")
+	if _, err := server.tokenEmployee(r); err != nil && (mrn == "" || !server.tokenOwnsPatient(r, mrn)) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	var examinationID uint64
+	var err error
+	if v := query.Get("examination_id"); v != "" {
+		examinationID, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	order := models.LabOrder{}
+	orders, err := order.FindLabOrders(server.DB, uint32(examinationID), mrn, query.Get("status"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	access, err := server.examinationAccess(r, mrn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	records := make([]models.ExaminationRecord, len(*orders))
+	for i := range *orders {
+		records[i] = &(*orders)[i]
+	}
+	if err = access.FilterRecords(server.DB, records...); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, orders)
+}
+
+// GetLabOrder ...
+func (server *Server) GetLabOrder(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["lab_order_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	order := models.LabOrder{}
+	orderGotten, err := order.FindLabOrderByID(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	if _, err = server.tokenEmployee(r); err != nil && !server.tokenOwnsPatient(r, orderGotten.MRN) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	access, err := server.examinationAccess(r, orderGotten.MRN)
+	if err == nil {
+		err = access.FilterRecords(server.DB, orderGotten)
+	}
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, orderGotten)
+}
+
+// UpdateLabOrderStatus moves an order through its lifecycle. The {action}
+// path segment is one of collect, result, verify or cancel.
+func (server *Server) UpdateLabOrderStatus(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["lab_order_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+
+	order := models.LabOrder{}
+	var updated *models.LabOrder
+	switch vars["action"] {
+	case "collect":
+		updated, err = order.CollectSpecimen(server.DB, uint32(id), employee.EmployeeID)
+	case "result":
+		var body []byte
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		err = json.Unmarshal(body, &order)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		err = order.Validate("result")
+		if err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		updated, err = order.EnterResult(server.DB, uint32(id), employee.EmployeeID)
+	case "verify":
+		updated, err = order.Verify(server.DB, uint32(id), employee.EmployeeID)
+	case "cancel":
+		updated, err = order.Cancel(server.DB, uint32(id))
+	default:
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Unknown Lab Order Action"))
+		return
+	}
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"io/ioutil"
 	"net/http"
 	"strings"
@@ -84,7 +85,10 @@ func (server *Server) SignIn(user, email, password string) (string, error) {
 
 		patient := models.Patient{}
 
-		err = server.DB.Debug().Model(models.Patient{}).Where("email = ?", email).Take(&patient).Error
+		// Emails are encrypted and found by their blind index. Patients whose
+		// rows have not been re-encrypted yet still have a plaintext email.
+		err = server.DB.Debug().Model(models.Patient{}).
+			Where("email_index = ? OR (email_index IS NULL AND email = ?)", models.EmailIndex(email), email).Take(&patient).Error
 		if err != nil {
 			return "", err
 		}
@@ -92,7 +96,11 @@ func (server *Server) SignIn(user, email, password string) (string, error) {
 		if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
 			return "", err
 		}
-		return auth.CreateToken(patient.SSN)
+		// A merged record is retired; the patient signs in to the survivor
+		if patient.MergedInto != "" {
+			return "", errors.New("Patient Has Been Merged Into " + patient.MergedInto)
+		}
+		return auth.CreateToken(int(patient.ID), auth.UserPatient)
 	} else if strings.ToLower(user) == "employee" {
 		var err error
 
@@ -106,7 +114,10 @@ func (server *Server) SignIn(user, email, password string) (string, error) {
 		if err != nil && err == bcrypt.ErrMismatchedHashAndPassword {
 			return "", err
 		}
-		return auth.CreateToken(employee.EmployeeID)
+		if !employee.Active {
+			return "", errors.New("Employee Is Inactive")
+		}
+		return auth.CreateToken(employee.EmployeeID, auth.UserEmployee)
 	}
 	return "", nil
 }
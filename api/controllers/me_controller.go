@@ -0,0 +1,213 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// GetMe returns the profile of the logged in patient
+func (server *Server) GetMe(w http.ResponseWriter, r *http.Request) {
+
+	patient, err := server.tokenPatient(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	patient.Password = ""
+	handlers.ResponseJSON(w, http.StatusOK, patient)
+}
+
+// UpdateMe changes the logged in patient's contact details
+func (server *Server) UpdateMe(w http.ResponseWriter, r *http.Request) {
+
+	me, err := server.tokenPatient(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	patient := models.Patient{}
+	err = json.Unmarshal(body, &patient)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = patient.Validate("contact")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	updated, err := patient.UpdateContactDetails(server.DB, me.MRN)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	updated.Password = ""
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
+
+// GetMyAppointments lists the patient's appointments. ?when=upcoming or
+// ?when=past splits them around the current time; upcoming ones are sorted
+// soonest first, past ones most recent first.
+func (server *Server) GetMyAppointments(w http.ResponseWriter, r *http.Request) {
+
+	me, err := server.tokenPatient(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	appointment := models.Appointment{}
+	appointments, err := appointment.FindAppointmentsByMRN(server.DB, me.MRN)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	when := r.URL.Query().Get("when")
+	now := time.Now()
+	upcoming := []models.Appointment{}
+	past := []models.Appointment{}
+	for _, a := range *appointments {
+		at, err := a.ScheduledAt()
+		if err == nil && at.After(now) && a.Status != models.AppointmentCancelled {
+			upcoming = append(upcoming, a)
+		} else {
+			past = append(past, a)
+		}
+	}
+	sortAppointments(upcoming, true)
+	sortAppointments(past, false)
+
+	switch when {
+	case "upcoming":
+		handlers.ResponseJSON(w, http.StatusOK, upcoming)
+	case "past":
+		handlers.ResponseJSON(w, http.StatusOK, past)
+	default:
+		handlers.ResponseJSON(w, http.StatusOK, append(upcoming, past...))
+	}
+}
+
+// BookMyAppointment books a schedule slot for the logged in patient
+func (server *Server) BookMyAppointment(w http.ResponseWriter, r *http.Request) {
+
+	me, err := server.tokenPatient(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	appointment := models.Appointment{}
+	err = json.Unmarshal(body, &appointment)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	appointment.MRN = me.MRN
+	err = appointment.Validate("booking")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	booked, err := appointment.Book(server.DB, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.publishAppointment(booked, "booked")
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, booked.AppointmentID))
+	handlers.ResponseJSON(w, http.StatusCreated, booked)
+}
+
+// CancelMyAppointment ...
+func (server *Server) CancelMyAppointment(w http.ResponseWriter, r *http.Request) {
+
+	me, err := server.tokenPatient(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	aid, err := strconv.ParseUint(vars["appointment_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	appointment := models.Appointment{}
+	cancelled, err := appointment.Cancel(server.DB, uint32(aid), me.MRN, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.publishAppointment(cancelled, "cancelled")
+	handlers.ResponseJSON(w, http.StatusOK, cancelled)
+}
+
+// GetMyExaminations lists the patient's finalized examinations with their
+// diagnoses and prescriptions
+func (server *Server) GetMyExaminations(w http.ResponseWriter, r *http.Request) {
+
+	me, err := server.tokenPatient(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	summaries, err := models.FindExaminationSummaries(server.DB, me.MRN)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, summaries)
+}
+
+// DownloadMyRecords sends the patient's complete record as a JSON file
+func (server *Server) DownloadMyRecords(w http.ResponseWriter, r *http.Request) {
+
+	me, err := server.tokenPatient(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	record, err := models.BuildPatientRecord(server.DB, me.MRN)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"record-%s.json\"", me.MRN))
+	handlers.ResponseJSON(w, http.StatusOK, record)
+}
+
+func sortAppointments(appointments []models.Appointment, ascending bool) {
+	at := func(a models.Appointment) time.Time {
+		t, err := a.ScheduledAt()
+		if err != nil {
+			return a.CreatedAt
+		}
+		return t
+	}
+	sort.SliceStable(appointments, func(i, j int) bool {
+		if ascending {
+			return at(appointments[i]).Before(at(appointments[j]))
+		}
+		return at(appointments[i]).After(at(appointments[j]))
+	})
+}
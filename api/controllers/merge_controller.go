@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// MergePatients folds one patient record into another. Administrators only.
+func (server *Server) MergePatients(w http.ResponseWriter, r *http.Request) {
+
+	admin, err := server.tokenAdmin(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	merge := models.PatientMerge{}
+	err = json.Unmarshal(body, &merge)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = merge.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	merge.MergedBy = admin.EmployeeID
+	merged, err := merge.Merge(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, merged)
+}
+
+// GetPatientMerges ...
+func (server *Server) GetPatientMerges(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	merge := models.PatientMerge{}
+	merges, err := merge.FindAllMerges(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, merges)
+}
+
+// UndoPatientMerge ...
+func (server *Server) UndoPatientMerge(w http.ResponseWriter, r *http.Request) {
+
+	admin, err := server.tokenAdmin(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["merge_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	merge := models.PatientMerge{}
+	undone, err := merge.Undo(server.DB, uint32(id), admin.EmployeeID)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, undone)
+}
@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
-	"strconv"
 
 	"github.com/gorilla/mux"
 	"github.com/repoerna/hms_app/api/auth"
@@ -33,6 +32,34 @@ func (server *Server) CreatePatient(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
 		return
 	}
+
+	// Stop likely duplicate registrations. Staff see the MRN, masked name and
+	// date of birth of the matching records and may register anyway with
+	// ?allow_duplicate=true; anyone else is sent to the front desk without
+	// learning who matched.
+	duplicates, err := patient.FindDuplicates(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(duplicates) > 0 {
+		if _, err := server.tokenEmployee(r); err != nil {
+			handlers.ResponseError(w, http.StatusConflict, errors.New("Possible Duplicate Registration, Please Contact The Front Desk"))
+			return
+		}
+		if r.URL.Query().Get("allow_duplicate") != "true" {
+			matches := make([]models.DuplicateMatch, len(duplicates))
+			for i := range duplicates {
+				matches[i] = duplicates[i].Match()
+			}
+			handlers.ResponseJSON(w, http.StatusConflict, struct {
+				Error      string                  `json:"error"`
+				Duplicates []models.DuplicateMatch `json:"duplicates"`
+			}{"Possible Duplicate Registration", matches})
+			return
+		}
+	}
+
 	patientCreated, err := patient.SavePatient(server.DB)
 
 	if err != nil {
@@ -42,7 +69,7 @@ func (server *Server) CreatePatient(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
 		return
 	}
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, patientCreated.ID))
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%s", r.Host, r.RequestURI, patientCreated.MRN))
 	handlers.ResponseJSON(w, http.StatusCreated, patientCreated)
 }
 
@@ -63,13 +90,9 @@ func (server *Server) GetPatients(w http.ResponseWriter, r *http.Request) {
 func (server *Server) GetPatient(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
-	ssn, err := strconv.ParseUint(vars["ssn"], 10, 32)
-	if err != nil {
-		handlers.ResponseError(w, http.StatusBadRequest, err)
-		return
-	}
+	mrn := vars["mrn"]
 	patient := models.Patient{}
-	patientGotten, err := patient.FindPatientBySSN(server.DB, uint32(ssn))
+	patientGotten, err := patient.FindPatientByMRN(server.DB, mrn)
 	if err != nil {
 		handlers.ResponseError(w, http.StatusBadRequest, err)
 		return
@@ -81,11 +104,7 @@ func (server *Server) GetPatient(w http.ResponseWriter, r *http.Request) {
 func (server *Server) UpdatePatient(w http.ResponseWriter, r *http.Request) {
 
 	vars := mux.Vars(r)
-	ssn, err := strconv.ParseUint(vars["ssn"], 10, 32)
-	if err != nil {
-		handlers.ResponseError(w, http.StatusBadRequest, err)
-		return
-	}
+	mrn := vars["mrn"]
 	body, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
@@ -97,12 +116,7 @@ func (server *Server) UpdatePatient(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	tokenID, err := auth.ExtractTokenID(r)
-	if err != nil {
-		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
-		return
-	}
-	if tokenID != uint32(ssn) {
+	if !server.tokenOwnsPatient(r, mrn) {
 		handlers.ResponseError(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
@@ -112,7 +126,7 @@ func (server *Server) UpdatePatient(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
 		return
 	}
-	updatedUser, err := patient.UpdatePatient(server.DB, uint32(ssn))
+	updatedUser, err := patient.UpdatePatient(server.DB, mrn)
 	if err != nil {
 		formattedError := formaterror.FormatError(err.Error())
 		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
@@ -128,25 +142,43 @@ func (server *Server) DeletePatient(w http.ResponseWriter, r *http.Request) {
 
 	patient := models.Patient{}
 
-	ssn, err := strconv.ParseUint(vars["ssn"], 10, 32)
-	if err != nil {
-		handlers.ResponseError(w, http.StatusBadRequest, err)
-		return
-	}
-	tokenID, err := auth.ExtractTokenID(r)
+	mrn := vars["mrn"]
+	userType, err := auth.ExtractTokenUserType(r)
 	if err != nil {
 		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
 		return
 	}
-	if tokenID != 0 && tokenID != uint32(ssn) {
+	if userType != auth.UserEmployee && !server.tokenOwnsPatient(r, mrn) {
 		handlers.ResponseError(w, http.StatusUnauthorized, errors.New(http.StatusText(http.StatusUnauthorized)))
 		return
 	}
-	_, err = patient.DeletePatient(server.DB, uint32(ssn))
+	_, err = patient.DeletePatient(server.DB, mrn)
 	if err != nil {
 		handlers.ResponseError(w, http.StatusInternalServerError, err)
 		return
 	}
-	w.Header().Set("Entity", fmt.Sprintf("%d", ssn))
+	w.Header().Set("Entity", mrn)
 	handlers.ResponseJSON(w, http.StatusNoContent, "")
 }
+
+// GetPatientDuplicates lists registered patients that look like the same
+// person as the given one
+func (server *Server) GetPatientDuplicates(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	patient := models.Patient{}
+	if _, err := patient.FindPatientByMRN(server.DB, vars["mrn"]); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	duplicates, err := patient.FindDuplicates(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, duplicates)
+}
@@ -0,0 +1,280 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// CreateMedication ...
+func (server *Server) CreateMedication(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	medication := models.Medication{}
+	err = json.Unmarshal(body, &medication)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = medication.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	medicationCreated, err := medication.SaveMedication(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, medicationCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, medicationCreated)
+}
+
+// GetMedications ...
+func (server *Server) GetMedications(w http.ResponseWriter, r *http.Request) {
+
+	medication := models.Medication{}
+
+	medications, err := medication.FindAllMedications(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, medications)
+}
+
+// GetMedication returns the medication together with its batches and the
+// latest stock movements
+func (server *Server) GetMedication(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["medication_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	medication := models.Medication{}
+	medicationGotten, err := medication.FindMedicationByID(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	batch := models.MedicationBatch{}
+	batches, err := batch.FindBatchesByMedication(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	movement := models.StockMovement{}
+	movements, err := movement.FindMovementsByMedication(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, struct {
+		*models.Medication
+		Batches   *[]models.MedicationBatch `json:"batches"`
+		Movements *[]models.StockMovement   `json:"movements"`
+	}{medicationGotten, batches, movements})
+}
+
+// UpdateMedication ...
+func (server *Server) UpdateMedication(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["medication_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	medication := models.Medication{}
+	err = json.Unmarshal(body, &medication)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = medication.Validate("update")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	updatedMedication, err := medication.UpdateMedication(server.DB, uint32(id))
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updatedMedication)
+}
+
+// ReceiveStock ...
+func (server *Server) ReceiveStock(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["medication_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	batch := models.MedicationBatch{}
+	err = json.Unmarshal(body, &batch)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	batch.MedicationID = uint32(id)
+	err = batch.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	batchReceived, err := batch.ReceiveBatch(server.DB, employee.EmployeeID)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, batchReceived)
+}
+
+// DispenseMedication ...
+func (server *Server) DispenseMedication(w http.ResponseWriter, r *http.Request) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	movement := models.StockMovement{}
+	err = json.Unmarshal(body, &movement)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = movement.Validate(models.MovementDispense)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	movement.EmployeeID = employee.EmployeeID
+	movements, err := movement.Dispense(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, movements)
+}
+
+// AdjustStock ...
+func (server *Server) AdjustStock(w http.ResponseWriter, r *http.Request) {
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	movement := models.StockMovement{}
+	err = json.Unmarshal(body, &movement)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = movement.Validate(models.MovementAdjust)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	movement.EmployeeID = employee.EmployeeID
+	adjusted, err := movement.Adjust(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, adjusted)
+}
+
+// ExpireStock ...
+func (server *Server) ExpireStock(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	movement := models.StockMovement{EmployeeID: employee.EmployeeID}
+	movements, err := movement.ExpireBatches(server.DB, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, movements)
+}
+
+// GetStockReport ...
+func (server *Server) GetStockReport(w http.ResponseWriter, r *http.Request) {
+
+	medication := models.Medication{}
+
+	levels, err := medication.StockReport(server.DB, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if r.URL.Query().Get("low_stock") == "true" {
+		low := []models.StockLevel{}
+		for _, level := range *levels {
+			if level.LowStock {
+				low = append(low, level)
+			}
+		}
+		levels = &low
+	}
+	handlers.ResponseJSON(w, http.StatusOK, levels)
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// CheckInAppointment issues a queue ticket for one of today's appointments
+// at reception
+func (server *Server) CheckInAppointment(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	checkIn := struct {
+		AppointmentID uint32 `json:"appointment_id"`
+	}{}
+	err = json.Unmarshal(body, &checkIn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if checkIn.AppointmentID == 0 {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, errors.New("Required Appointment ID"))
+		return
+	}
+	ticket := models.QueueTicket{}
+	issued, err := ticket.CheckIn(server.DB, checkIn.AppointmentID, employee.EmployeeID, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.publishQueue(issued, "checked_in")
+	handlers.ResponseJSON(w, http.StatusCreated, issued)
+}
+
+// GetQueueBoard returns the waiting room board of a department, given by
+// code or id, for today or ?date=
+func (server *Server) GetQueueBoard(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	department := models.Department{}
+	if _, err := department.FindDepartmentByCodeOrID(server.DB, vars["department"]); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	now := time.Now()
+	date := now.Format("2006-01-02")
+	if value := r.URL.Query().Get("date"); value != "" {
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, errors.New("Invalid Date, Use YYYY-MM-DD"))
+			return
+		}
+		date = value
+	}
+	board, err := models.BuildQueueBoard(server.DB, &department, date, now)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, board)
+}
+
+// UpdateQueueTicket moves a ticket through the queue: call, serve, done,
+// skip or requeue
+func (server *Server) UpdateQueueTicket(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["ticket_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var status string
+	switch vars["action"] {
+	case "call":
+		status = models.TicketCalled
+	case "serve":
+		status = models.TicketServing
+	case "done":
+		status = models.TicketDone
+	case "skip":
+		status = models.TicketSkipped
+	case "requeue":
+		status = models.TicketWaiting
+	default:
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Unknown Queue Action"))
+		return
+	}
+	ticket := models.QueueTicket{}
+	updated, err := ticket.Move(server.DB, uint32(id), status, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.publishQueue(updated, vars["action"])
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
@@ -0,0 +1,229 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// CreateReferral refers the patient of an examination on
+func (server *Server) CreateReferral(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	referral := models.Referral{}
+	err = json.Unmarshal(body, &referral)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = referral.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	referral.ReferredBy = employee.EmployeeID
+	referralCreated, err := referral.SaveReferral(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, referralCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, referralCreated)
+}
+
+// GetReferrals lists referrals by ?mrn=, ?examination_id=, ?department_id=
+// and ?status=. Patients only see their own.
+func (server *Server) GetReferrals(w http.ResponseWriter, r *http.Request) {
+
+	query := r.URL.Query()
+	mrn := query.Get("mrn")
+	if _, err := server.tokenEmployee(r); err != nil {
+		patient, err := server.tokenPatient(r)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+			return
+		}
+		mrn = patient.MRN
+	}
+	var examinationID, departmentID uint64
+	var err error
+	if v := query.Get("examination_id"); v != "" {
+		examinationID, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if v := query.Get("department_id"); v != "" {
+		departmentID, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	referral := models.Referral{}
+	referrals, err := referral.FindReferrals(server.DB, mrn, uint32(examinationID), uint32(departmentID), query.Get("status"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	access, err := server.examinationAccess(r, mrn)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	records := make([]models.ExaminationRecord, len(*referrals))
+	for i := range *referrals {
+		records[i] = &(*referrals)[i]
+	}
+	if err = access.FilterRecords(server.DB, records...); err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, referrals)
+}
+
+// GetReferral ...
+func (server *Server) GetReferral(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["referral_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	referral := models.Referral{}
+	if _, err = referral.FindReferralByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	if _, err = server.tokenEmployee(r); err != nil && !server.tokenOwnsPatient(r, referral.MRN) {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	access, err := server.examinationAccess(r, referral.MRN)
+	if err == nil {
+		err = access.FilterRecords(server.DB, &referral)
+	}
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, referral)
+}
+
+// UpdateReferralStatus accepts, rejects or completes a referral. Internal
+// referrals are accepted or rejected by staff of the target department;
+// the answer of an external facility is recorded by any staff member.
+func (server *Server) UpdateReferralStatus(w http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["referral_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	referral := models.Referral{}
+	if _, err = referral.FindReferralByID(server.DB, uint32(id)); err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	answering := vars["action"] == "accept" || vars["action"] == "reject"
+	if answering && !referral.External() && !employee.IsAdmin() && employee.DepartmentID != referral.DepartmentID {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Only The Referred Department May Answer"))
+		return
+	}
+
+	var updated *models.Referral
+	switch vars["action"] {
+	case "accept":
+		updated, err = referral.Accept(server.DB, uint32(id), employee.EmployeeID)
+	case "reject":
+		var body []byte
+		body, err = ioutil.ReadAll(r.Body)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		request := models.Referral{}
+		err = json.Unmarshal(body, &request)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		err = request.Validate("reject")
+		if err != nil {
+			handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+			return
+		}
+		updated, err = request.Reject(server.DB, uint32(id), employee.EmployeeID)
+	case "complete":
+		updated, err = referral.Complete(server.DB, uint32(id))
+	default:
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Unknown Referral Action"))
+		return
+	}
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
+
+// BookReferralAppointment books an appointment for an accepted referral
+// from a schedule_code, date and, unless a doctor was named on the
+// referral, employee_id
+func (server *Server) BookReferralAppointment(w http.ResponseWriter, r *http.Request) {
+
+	id, err := strconv.ParseUint(mux.Vars(r)["referral_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	if _, err = server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, errors.New("Unauthorized"))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	appointment := models.Appointment{}
+	err = json.Unmarshal(body, &appointment)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+
+	referral := models.Referral{}
+	booked, err := referral.BookAppointment(server.DB, uint32(id), &appointment, time.Now())
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	server.publishAppointment(booked, "booked")
+	handlers.ResponseJSON(w, http.StatusCreated, booked)
+}
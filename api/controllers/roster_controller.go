@@ -0,0 +1,293 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/repoerna/hms_app/api/handlers"
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// CreateWard ...
+func (server *Server) CreateWard(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	ward := models.Ward{}
+	err = json.Unmarshal(body, &ward)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = ward.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	wardCreated, err := ward.SaveWard(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, formattedError)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, wardCreated.ID))
+	handlers.ResponseJSON(w, http.StatusCreated, wardCreated)
+}
+
+// GetWards ...
+func (server *Server) GetWards(w http.ResponseWriter, r *http.Request) {
+
+	ward := models.Ward{}
+
+	wards, err := ward.FindAllWards(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, wards)
+}
+
+// GetWardRoster returns a ward's roster for the week containing ?week=,
+// which defaults to the current week
+func (server *Server) GetWardRoster(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	wardID, err := strconv.ParseUint(vars["ward_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	day := time.Now()
+	if week := r.URL.Query().Get("week"); week != "" {
+		day, err = time.ParseInLocation("2006-01-02", week, time.Local)
+		if err != nil {
+			handlers.ResponseError(w, http.StatusBadRequest, errors.New("Invalid Week, Use YYYY-MM-DD"))
+			return
+		}
+	}
+	roster, err := models.BuildWeekRoster(server.DB, uint32(wardID), day)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusNotFound, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, roster)
+}
+
+// CreateShiftTemplate ...
+func (server *Server) CreateShiftTemplate(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	template := models.ShiftTemplate{}
+	err = json.Unmarshal(body, &template)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = template.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	templateCreated, err := template.SaveShiftTemplate(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, templateCreated)
+}
+
+// GetShiftTemplates ...
+func (server *Server) GetShiftTemplates(w http.ResponseWriter, r *http.Request) {
+
+	template := models.ShiftTemplate{}
+
+	templates, err := template.FindAllShiftTemplates(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, templates)
+}
+
+// CreateShiftAssignment puts an employee on a shift. Administrators only.
+func (server *Server) CreateShiftAssignment(w http.ResponseWriter, r *http.Request) {
+
+	admin, err := server.tokenAdmin(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	assignment := models.ShiftAssignment{}
+	err = json.Unmarshal(body, &assignment)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	err = assignment.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	assignment.AssignedBy = admin.EmployeeID
+	assigned, err := assignment.Assign(server.DB)
+	if err != nil {
+		formattedError := formaterror.FormatError(err.Error())
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, formattedError)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, assigned)
+}
+
+// DeleteShiftAssignment ...
+func (server *Server) DeleteShiftAssignment(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenAdmin(r); err != nil {
+		handlers.ResponseError(w, http.StatusForbidden, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["assignment_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+	assignment := models.ShiftAssignment{}
+	_, err = assignment.DeleteShiftAssignment(server.DB, uint32(id))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	w.Header().Set("Entity", fmt.Sprintf("%d", id))
+	handlers.ResponseJSON(w, http.StatusNoContent, "")
+}
+
+// CreateShiftSwap lets an employee ask to hand over or exchange one of
+// their own shifts
+func (server *Server) CreateShiftSwap(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	swap := models.ShiftSwap{}
+	err = json.Unmarshal(body, &swap)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	swap.RequestedBy = employee.EmployeeID
+	err = swap.Validate("")
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	swapCreated, err := swap.RequestSwap(server.DB)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusCreated, swapCreated)
+}
+
+// GetShiftSwaps lists swap requests, filtered by ?status=
+func (server *Server) GetShiftSwaps(w http.ResponseWriter, r *http.Request) {
+
+	if _, err := server.tokenEmployee(r); err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	swap := models.ShiftSwap{}
+	swaps, err := swap.FindShiftSwaps(server.DB, r.URL.Query().Get("status"))
+	if err != nil {
+		handlers.ResponseError(w, http.StatusInternalServerError, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, swaps)
+}
+
+// UpdateShiftSwap approves or rejects a swap request, which only
+// administrators may do, or cancels it, which only the requester may do
+func (server *Server) UpdateShiftSwap(w http.ResponseWriter, r *http.Request) {
+
+	employee, err := server.tokenEmployee(r)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnauthorized, err)
+		return
+	}
+	vars := mux.Vars(r)
+	id, err := strconv.ParseUint(vars["swap_id"], 10, 32)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	swap := models.ShiftSwap{}
+	var status string
+	switch vars["action"] {
+	case "approve":
+		status = models.SwapApproved
+	case "reject":
+		status = models.SwapRejected
+	case "cancel":
+		status = models.SwapCancelled
+	default:
+		handlers.ResponseError(w, http.StatusNotFound, errors.New("Unknown Shift Swap Action"))
+		return
+	}
+	if status == models.SwapCancelled {
+		existing := models.ShiftSwap{}
+		err = server.DB.Debug().Model(&models.ShiftSwap{}).Where("id = ?", id).Take(&existing).Error
+		if err != nil || existing.RequestedBy != employee.EmployeeID {
+			handlers.ResponseError(w, http.StatusNotFound, errors.New("Shift Swap Not Found"))
+			return
+		}
+	} else if !employee.IsAdmin() {
+		handlers.ResponseError(w, http.StatusForbidden, errors.New("Administrator Access Required"))
+		return
+	}
+
+	updated, err := swap.Decide(server.DB, uint32(id), status, employee.EmployeeID)
+	if err != nil {
+		handlers.ResponseError(w, http.StatusUnprocessableEntity, err)
+		return
+	}
+	handlers.ResponseJSON(w, http.StatusOK, updated)
+}
@@ -13,16 +13,133 @@ func (s *Server) initializeRoutes() {
 	// Patient routes
 	s.Router.HandleFunc("/patients", middlewares.SetMiddlewareJSON(s.CreatePatient)).Methods("POST")
 	s.Router.HandleFunc("/patients", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatients))).Methods("GET")
-	s.Router.HandleFunc("/patients/{ssn}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatient))).Methods("GET")
-	s.Router.HandleFunc("/patients/{ssn}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdatePatient))).Methods("PUT")
-	s.Router.HandleFunc("/patients/{ssn}", middlewares.SetMiddlewareAuthentication(s.DeletePatient)).Methods("DELETE")
+	s.Router.HandleFunc("/patients/{mrn}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatient))).Methods("GET")
+	s.Router.HandleFunc("/patients/{mrn}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdatePatient))).Methods("PUT")
+	s.Router.HandleFunc("/patients/{mrn}", middlewares.SetMiddlewareAuthentication(s.DeletePatient)).Methods("DELETE")
+	s.Router.HandleFunc("/patients/{mrn}/chart", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatientChart))).Methods("GET")
+	s.Router.HandleFunc("/patients/{mrn}/duplicates", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatientDuplicates))).Methods("GET")
+	s.Router.HandleFunc("/patients/{mrn}/consents", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatientConsents))).Methods("GET")
+	s.Router.HandleFunc("/patients/{mrn}/consents", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GrantPatientConsent))).Methods("POST")
+	s.Router.HandleFunc("/patients/{mrn}/eligibility", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatientEligibility))).Methods("GET")
+	s.Router.HandleFunc("/patients/{mrn}/attachments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatientAttachments))).Methods("GET")
+	s.Router.HandleFunc("/patients/{mrn}/attachments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreatePatientAttachment))).Methods("POST")
+	s.Router.HandleFunc("/patients/{mrn}/consents/{type}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.WithdrawPatientConsent))).Methods("DELETE")
+
+	// Consent text routes
+	s.Router.HandleFunc("/consent-texts", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateConsentText))).Methods("POST")
+	s.Router.HandleFunc("/consent-texts", middlewares.SetMiddlewareJSON(s.GetConsentTexts)).Methods("GET")
+
+	// Patient merge routes
+	s.Router.HandleFunc("/patient-merges", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.MergePatients))).Methods("POST")
+	s.Router.HandleFunc("/patient-merges", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPatientMerges))).Methods("GET")
+	s.Router.HandleFunc("/patient-merges/{merge_id}/undo", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UndoPatientMerge))).Methods("POST")
+
+	// Patient self-service routes
+	s.Router.HandleFunc("/me", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetMe))).Methods("GET")
+	s.Router.HandleFunc("/me", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateMe))).Methods("PUT")
+	s.Router.HandleFunc("/me/appointments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetMyAppointments))).Methods("GET")
+	s.Router.HandleFunc("/me/appointments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.BookMyAppointment))).Methods("POST")
+	s.Router.HandleFunc("/me/appointments/{appointment_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CancelMyAppointment))).Methods("DELETE")
+	s.Router.HandleFunc("/me/examinations", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetMyExaminations))).Methods("GET")
+	s.Router.HandleFunc("/me/records", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.DownloadMyRecords))).Methods("GET")
 
 	// Employee routes
 	s.Router.HandleFunc("/employees", middlewares.SetMiddlewareJSON(s.CreateEmployee)).Methods("POST")
 	s.Router.HandleFunc("/employees", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetEmployees))).Methods("GET")
+	s.Router.HandleFunc("/employees/license-alerts", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetLicenseAlerts))).Methods("GET")
 	s.Router.HandleFunc("/employees/{employee_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetEmployee))).Methods("GET")
 	s.Router.HandleFunc("/employees/{employee_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateEmployee))).Methods("PUT")
 	s.Router.HandleFunc("/employees/{employee_id}", middlewares.SetMiddlewareAuthentication(s.DeleteEmployee)).Methods("DELETE")
+	s.Router.HandleFunc("/employees/{employee_id}/status", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateEmployeeStatus))).Methods("PUT")
+	s.Router.HandleFunc("/employees/{employee_id}/access", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateEmployeeAccess))).Methods("PUT")
+
+	// Department routes
+	s.Router.HandleFunc("/departments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateDepartment))).Methods("POST")
+	s.Router.HandleFunc("/departments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetDepartments))).Methods("GET")
+	s.Router.HandleFunc("/departments/{id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetDepartment))).Methods("GET")
+	s.Router.HandleFunc("/departments/{id}/employees", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetDepartmentEmployees))).Methods("GET")
+	s.Router.HandleFunc("/specialties", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateSpecialty))).Methods("POST")
+	s.Router.HandleFunc("/specialties", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetSpecialties))).Methods("GET")
+
+	// Ward and roster routes
+	s.Router.HandleFunc("/wards", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateWard))).Methods("POST")
+	s.Router.HandleFunc("/wards", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetWards))).Methods("GET")
+	s.Router.HandleFunc("/wards/{ward_id}/roster", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetWardRoster))).Methods("GET")
+	s.Router.HandleFunc("/wards/{ward_id}/rooms", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateRoom))).Methods("POST")
+	s.Router.HandleFunc("/wards/{ward_id}/rooms", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetWardRooms))).Methods("GET")
+	s.Router.HandleFunc("/wards/{ward_id}/occupancy", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetWardOccupancy))).Methods("GET")
+	s.Router.HandleFunc("/shift-templates", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateShiftTemplate))).Methods("POST")
+	s.Router.HandleFunc("/shift-templates", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetShiftTemplates))).Methods("GET")
+	s.Router.HandleFunc("/shift-assignments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateShiftAssignment))).Methods("POST")
+	s.Router.HandleFunc("/shift-assignments/{assignment_id}", middlewares.SetMiddlewareAuthentication(s.DeleteShiftAssignment)).Methods("DELETE")
+	s.Router.HandleFunc("/shift-swaps", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateShiftSwap))).Methods("POST")
+	s.Router.HandleFunc("/shift-swaps", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetShiftSwaps))).Methods("GET")
+	s.Router.HandleFunc("/shift-swaps/{swap_id}/{action}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateShiftSwap))).Methods("PUT")
+
+	// Bed and admission routes
+	s.Router.HandleFunc("/rooms/{room_id}/beds", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateBed))).Methods("POST")
+	s.Router.HandleFunc("/beds", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetBeds))).Methods("GET")
+	s.Router.HandleFunc("/beds/{bed_id}/status", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateBedStatus))).Methods("PUT")
+	s.Router.HandleFunc("/admissions", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateAdmission))).Methods("POST")
+	s.Router.HandleFunc("/admissions", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetAdmissions))).Methods("GET")
+	s.Router.HandleFunc("/admissions/{admission_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetAdmission))).Methods("GET")
+	s.Router.HandleFunc("/admissions/{admission_id}/transfer", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.TransferAdmission))).Methods("POST")
+	s.Router.HandleFunc("/admissions/{admission_id}/discharge", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.DischargeAdmission))).Methods("POST")
+	s.Router.HandleFunc("/census", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetCensus))).Methods("GET")
+
+	// Live update stream
+	s.Router.HandleFunc("/events", middlewares.SetMiddlewareAuthentication(s.StreamEvents)).Methods("GET")
+
+	// Queue routes
+	s.Router.HandleFunc("/queues/check-in", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CheckInAppointment))).Methods("POST")
+	s.Router.HandleFunc("/queues/tickets/{ticket_id}/{action}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateQueueTicket))).Methods("PUT")
+	s.Router.HandleFunc("/queues/{department}", middlewares.SetMiddlewareJSON(s.GetQueueBoard)).Methods("GET")
+
+	// Billing routes
+	s.Router.HandleFunc("/billing/tariffs", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateTariff))).Methods("POST")
+	s.Router.HandleFunc("/billing/tariffs", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetTariffs))).Methods("GET")
+	s.Router.HandleFunc("/billing/tariffs/{tariff_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateTariff))).Methods("PUT")
+	s.Router.HandleFunc("/billing/invoices", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetInvoices))).Methods("GET")
+	s.Router.HandleFunc("/billing/invoices/{invoice_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetInvoice))).Methods("GET")
+	s.Router.HandleFunc("/billing/invoices/{invoice_id}/lines", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.AddInvoiceLine))).Methods("POST")
+	s.Router.HandleFunc("/billing/invoices/{invoice_id}/lines/{line_id}/discount", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateInvoiceLineDiscount))).Methods("PUT")
+	s.Router.HandleFunc("/billing/invoices/{invoice_id}/{kind:payments|refunds}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreatePayment))).Methods("POST")
+	s.Router.HandleFunc("/billing/invoices/{invoice_id}/{action:issue|void}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateInvoiceStatus))).Methods("POST")
+	s.Router.HandleFunc("/billing/outstanding", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetOutstanding))).Methods("GET")
+
+	// Insurance routes
+	s.Router.HandleFunc("/payers", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreatePayer))).Methods("POST")
+	s.Router.HandleFunc("/payers", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetPayers))).Methods("GET")
+	s.Router.HandleFunc("/claims", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateClaim))).Methods("POST")
+	s.Router.HandleFunc("/claims", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetClaims))).Methods("GET")
+	s.Router.HandleFunc("/claims/{claim_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetClaim))).Methods("GET")
+	s.Router.HandleFunc("/claims/{claim_id}/submit", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.SubmitClaim))).Methods("POST")
+
+	// FHIR R4 facade
+	s.Router.HandleFunc("/fhir/R4/metadata", s.GetFHIRMetadata).Methods("GET")
+	s.Router.HandleFunc("/fhir/R4/Appointment", middlewares.SetMiddlewareAuthentication(s.CreateFHIRAppointment)).Methods("POST")
+	s.Router.HandleFunc("/fhir/R4/{type}", middlewares.SetMiddlewareAuthentication(s.SearchFHIRResources)).Methods("GET")
+	s.Router.HandleFunc("/fhir/R4/{type}/{id}", middlewares.SetMiddlewareAuthentication(s.ReadFHIRResource)).Methods("GET")
+
+	// Import routes
+	s.Router.HandleFunc("/import/{resource}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.ImportRecords))).Methods("POST")
+
+	// Export routes
+	s.Router.HandleFunc("/exports", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateExport))).Methods("POST")
+	s.Router.HandleFunc("/exports", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetExports))).Methods("GET")
+	s.Router.HandleFunc("/exports/{export_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetExport))).Methods("GET")
+	s.Router.HandleFunc("/exports/{export_id}/file", middlewares.SetMiddlewareAuthentication(s.DownloadExport)).Methods("GET")
+
+	// Encryption key routes
+	s.Router.HandleFunc("/encryption-keys", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetEncryptionStatus))).Methods("GET")
+	s.Router.HandleFunc("/encryption-keys/rotate", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RotateEncryptionKey))).Methods("POST")
+
+	// Emergency access routes
+	s.Router.HandleFunc("/patients/{mrn}/emergency-access", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.BreakTheGlass))).Methods("POST")
+	s.Router.HandleFunc("/emergency-access", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetEmergencyAccesses))).Methods("GET")
+	s.Router.HandleFunc("/emergency-access/{id}/review", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.ReviewEmergencyAccess))).Methods("POST")
+	s.Router.HandleFunc("/compliance-alerts", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetComplianceAlerts))).Methods("GET")
+	s.Router.HandleFunc("/compliance-alerts/{id}/acknowledge", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.AcknowledgeComplianceAlert))).Methods("POST")
 
 	// Schedule routes
 	s.Router.HandleFunc("/schedules", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateSchedule))).Methods("POST")
@@ -43,4 +160,44 @@ func (s *Server) initializeRoutes() {
 	s.Router.HandleFunc("/examinations/{user_id}/{examination_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetExamination))).Methods("GET")
 	s.Router.HandleFunc("/examinations/{user_id}/{examination_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateExamination))).Methods("PUT")
 	s.Router.HandleFunc("/examinations/{user_id}/{examination_id}", middlewares.SetMiddlewareAuthentication(s.DeleteExamination)).Methods("DELETE")
+	s.Router.HandleFunc("/examinations/{examination_id}/attachments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateExaminationAttachment))).Methods("POST")
+	s.Router.HandleFunc("/examinations/{examination_id}/documents/{type}.pdf", middlewares.SetMiddlewareAuthentication(s.GetExaminationDocument)).Methods("GET")
+
+	// Attachment routes
+	s.Router.HandleFunc("/attachments/{attachment_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetAttachment))).Methods("GET")
+	s.Router.HandleFunc("/attachments/{attachment_id}", middlewares.SetMiddlewareAuthentication(s.DeleteAttachment)).Methods("DELETE")
+	s.Router.HandleFunc("/attachments/{attachment_id}/file", middlewares.SetMiddlewareAuthentication(s.DownloadAttachment)).Methods("GET")
+
+	// Document verification routes
+	s.Router.HandleFunc("/documents", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetIssuedDocuments))).Methods("GET")
+	s.Router.HandleFunc("/documents/{serial}/revoke", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.RevokeDocument))).Methods("POST")
+	s.Router.HandleFunc("/verify/{serial}", middlewares.SetMiddlewareJSON(s.VerifyDocument)).Methods("GET")
+
+	// Pharmacy routes
+	s.Router.HandleFunc("/pharmacy/medications", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateMedication))).Methods("POST")
+	s.Router.HandleFunc("/pharmacy/medications", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetMedications))).Methods("GET")
+	s.Router.HandleFunc("/pharmacy/medications/{medication_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetMedication))).Methods("GET")
+	s.Router.HandleFunc("/pharmacy/medications/{medication_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateMedication))).Methods("PUT")
+	s.Router.HandleFunc("/pharmacy/medications/{medication_id}/batches", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.ReceiveStock))).Methods("POST")
+	s.Router.HandleFunc("/pharmacy/dispense", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.DispenseMedication))).Methods("POST")
+	s.Router.HandleFunc("/pharmacy/adjustments", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.AdjustStock))).Methods("POST")
+	s.Router.HandleFunc("/pharmacy/expire", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.ExpireStock))).Methods("POST")
+	s.Router.HandleFunc("/pharmacy/stock", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetStockReport))).Methods("GET")
+
+	// Laboratory routes
+	s.Router.HandleFunc("/lab/tests", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateLabTest))).Methods("POST")
+	s.Router.HandleFunc("/lab/tests", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetLabTests))).Methods("GET")
+	s.Router.HandleFunc("/lab/tests/{lab_test_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetLabTest))).Methods("GET")
+	s.Router.HandleFunc("/lab/orders", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateLabOrder))).Methods("POST")
+	s.Router.HandleFunc("/lab/orders", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetLabOrders))).Methods("GET")
+	s.Router.HandleFunc("/lab/orders/{lab_order_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetLabOrder))).Methods("GET")
+	s.Router.HandleFunc("/lab/orders/{lab_order_id}/{action}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateLabOrderStatus))).Methods("PUT")
+
+	// Referral routes
+	s.Router.HandleFunc("/referrals", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.CreateReferral))).Methods("POST")
+	s.Router.HandleFunc("/referrals", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetReferrals))).Methods("GET")
+	s.Router.HandleFunc("/referrals/{referral_id}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.GetReferral))).Methods("GET")
+	s.Router.HandleFunc("/referrals/{referral_id}/letter.pdf", middlewares.SetMiddlewareAuthentication(s.GetReferralLetter)).Methods("GET")
+	s.Router.HandleFunc("/referrals/{referral_id}/appointment", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.BookReferralAppointment))).Methods("POST")
+	s.Router.HandleFunc("/referrals/{referral_id}/{action}", middlewares.SetMiddlewareJSON(middlewares.SetMiddlewareAuthentication(s.UpdateReferralStatus))).Methods("PUT")
 }
@@ -42,7 +42,8 @@ func (server *Server) CreateSchedule(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
 		return
 	}
-	w.Header().Set("Location", fmt.Sprintf("%s%s/%d", r.Host, r.RequestURI, scheduleCreated.ScheduleCode))
+	server.publishSchedule(scheduleCreated, "created")
+	w.Header().Set("Location", fmt.Sprintf("%s%s/%s", r.Host, r.RequestURI, scheduleCreated.ScheduleCode))
 	handlers.ResponseJSON(w, http.StatusCreated, scheduleCreated)
 }
 
@@ -107,6 +108,7 @@ func (server *Server) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusInternalServerError, formattedError)
 		return
 	}
+	server.publishSchedule(updatedSchedule, "updated")
 	handlers.ResponseJSON(w, http.StatusOK, updatedSchedule)
 }
 
@@ -143,6 +145,7 @@ func (server *Server) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
 		handlers.ResponseError(w, http.StatusInternalServerError, err)
 		return
 	}
-	w.Header().Set("Entity", fmt.Sprintf("%d", sc))
+	server.publishSchedule(&models.Schedule{ScheduleCode: sc}, "deleted")
+	w.Header().Set("Entity", sc)
 	handlers.ResponseJSON(w, http.StatusNoContent, "")
 }
@@ -0,0 +1,158 @@
+// Package documents prints clinical documents as PDF: a visit summary, a
+// prescription slip, a sick leave certificate, a medical certificate and a
+// referral letter.
+// Each page carries the clinic letterhead and the document's serial
+// number, and the last page a QR code linking to its verification page.
+package documents
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"text/template"
+	"time"
+
+	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/pdf"
+	"github.com/repoerna/hms_app/api/utils/qr"
+)
+
+// Document types
+const (
+	VisitSummary       = "visit-summary"
+	Prescription       = "prescription"
+	SickNote           = "sick-note"
+	MedicalCertificate = "medical-certificate"
+	ReferralLetter     = "referral"
+)
+
+// Types lists the documents that can be printed from an examination. A
+// referral letter is printed from its referral.
+var Types = []string{VisitSummary, Prescription, SickNote, MedicalCertificate}
+
+// Titles names each document type
+var Titles = map[string]string{
+	VisitSummary:       "Visit Summary",
+	Prescription:       "Prescription",
+	SickNote:           "Sick Leave Certificate",
+	MedicalCertificate: "Medical Certificate",
+	ReferralLetter:     "Referral Letter",
+}
+
+// SerialPrefixes start the serial numbers of each document type
+var SerialPrefixes = map[string]string{
+	VisitSummary:       "VS",
+	Prescription:       "RX",
+	SickNote:           "SN",
+	MedicalCertificate: "MC",
+	ReferralLetter:     "RF",
+}
+
+// Clinic is shown on the letterhead
+type Clinic struct {
+	Name    string
+	Address string
+	Phone   string
+}
+
+// ClinicDetails is the clinic printed on every document
+var ClinicDetails = Clinic{Name: "HMS Clinic"}
+
+// VerifyURL is the base of the verification link in the QR code
+var VerifyURL = "http://localhost:8080/verify"
+
+// SickLeave is the period a sick note covers
+type SickLeave struct {
+	From string
+	To   string
+	Days int
+}
+
+// Data is what templates are rendered with
+type Data struct {
+	Clinic      Clinic
+	Examination *models.Examination
+	Patient     *models.Patient
+	Doctor      *models.Employee
+	VisitDate   string
+	SickLeave   SickLeave
+	Purpose     string
+	Referral    *models.Referral
+	ReferredTo  string
+	Serial      string
+	Issued      time.Time
+}
+
+var templates = template.New("documents").Funcs(template.FuncMap{
+	"date": formatDate,
+})
+
+func init() {
+	for name, text := range defaultTemplates {
+		template.Must(templates.New(name).Parse(text))
+	}
+}
+
+// LoadTemplates replaces the default templates with the files of the same
+// name found in dir, such as letterhead.tmpl
+func LoadTemplates(dir string) error {
+	for name := range defaultTemplates {
+		text, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if _, err = templates.New(name).Parse(string(text)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatDate prints a YYYY-MM-DD date in full
+func formatDate(value string) string {
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return value
+	}
+	return t.Format("2 January 2006")
+}
+
+// VerifyLink is where a document's serial can be checked
+func VerifyLink(serial string) string {
+	return VerifyURL + "/" + serial
+}
+
+// Render prints a document
+func Render(documentType string, data *Data) ([]byte, error) {
+	title, ok := Titles[documentType]
+	if !ok {
+		return nil, errors.New("Unknown Document Type")
+	}
+	data.Clinic = ClinicDetails
+	if data.Issued.IsZero() {
+		data.Issued = time.Now()
+	}
+
+	var letterhead, body bytes.Buffer
+	if err := templates.ExecuteTemplate(&letterhead, "letterhead.tmpl", data); err != nil {
+		return nil, err
+	}
+	if err := templates.ExecuteTemplate(&body, documentType+".tmpl", data); err != nil {
+		return nil, err
+	}
+	code, err := qr.Encode(VerifyLink(data.Serial))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := pdf.New(title)
+	doc.Author = data.Clinic.Name
+	doc.Created = data.Issued
+	layout(doc, letterhead.String(), body.String(), code, data)
+	return doc.Bytes()
+}
@@ -0,0 +1,120 @@
+package documents
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/repoerna/hms_app/api/utils/pdf"
+	"github.com/repoerna/hms_app/api/utils/qr"
+)
+
+const (
+	margin   = 56.0
+	bodySize = 10.5
+	// qrSide is the printed size of the QR code, quiet zone included
+	qrSide = 92.0
+	// footer is the space kept free at the bottom of every page for the QR
+	// code and page numbers
+	footer = qrSide + 24
+)
+
+// writer lays text out top to bottom, starting a new page with the
+// letterhead when one is full
+type writer struct {
+	doc        *pdf.Document
+	pages      []*pdf.Page
+	page       *pdf.Page
+	y          float64
+	letterhead string
+}
+
+func (w *writer) newPage() {
+	w.page = w.doc.AddPage()
+	w.pages = append(w.pages, w.page)
+	w.y = pdf.PageHeight - margin
+	w.write(w.letterhead, false)
+}
+
+// need starts a new page unless height points are left above the footer
+func (w *writer) need(height float64) {
+	if w.page == nil || w.y-height < margin+footer {
+		w.newPage()
+	}
+}
+
+// write lays out rendered template text. breakPages is false for the
+// letterhead, which must not itself start a page.
+func (w *writer) write(text string, breakPages bool) {
+	width := pdf.PageWidth - 2*margin
+	need := func(height float64) {
+		if breakPages {
+			w.need(height)
+		}
+	}
+	for _, line := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		line = strings.TrimRight(line, " \r")
+		switch {
+		case line == "---":
+			need(12)
+			w.y -= 4
+			w.page.Line(margin, w.y, margin+width, w.y, 0.8)
+			w.y -= 14
+		case line == "":
+			w.y -= bodySize * 0.8
+		case strings.HasPrefix(line, "## "):
+			need(24)
+			w.y -= 6
+			w.text(pdf.Bold, 11.5, width, line[3:], breakPages)
+		case strings.HasPrefix(line, "# "):
+			need(24)
+			w.text(pdf.Bold, 16, width, line[2:], breakPages)
+			w.y -= 2
+		default:
+			w.text(pdf.Regular, bodySize, width, line, breakPages)
+		}
+	}
+}
+
+func (w *writer) text(font pdf.Font, size, width float64, text string, breakPages bool) {
+	for _, line := range pdf.Wrap(font, size, width, text) {
+		if breakPages {
+			w.need(size * 1.4)
+		}
+		w.y -= size * 1.2
+		w.page.Text(margin, w.y, font, size, line)
+		w.y -= size * 0.2
+	}
+}
+
+// layout prints the document body under the letterhead, then the QR code
+// and verification details on the last page and page numbers on each
+func layout(doc *pdf.Document, letterhead, body string, code *qr.Code, data *Data) {
+	w := &writer{doc: doc, letterhead: letterhead}
+	w.newPage()
+	w.write(body, true)
+
+	last := w.pages[len(w.pages)-1]
+	module := qrSide / float64(code.Size+8)
+	left := pdf.PageWidth - margin - qrSide
+	bottom := margin + 12.0
+	for y, row := range code.Modules {
+		for x, dark := range row {
+			if dark {
+				last.Rect(left+float64(x+4)*module, bottom+qrSide-float64(y+5)*module, module, module)
+			}
+		}
+	}
+	caption := []string{
+		"Verify this document at",
+		VerifyLink(data.Serial),
+		"Issued " + data.Issued.Format("2 January 2006 15:04"),
+	}
+	for i, line := range caption {
+		lineWidth := pdf.Width(pdf.Regular, 8, line)
+		last.Text(left-12-lineWidth, bottom+qrSide-18-float64(i)*11, pdf.Regular, 8, line)
+	}
+
+	for i, page := range w.pages {
+		page.Text(margin, margin-16, pdf.Regular, 8, fmt.Sprintf("%s  |  Serial %s  |  Page %d of %d", data.Clinic.Name, data.Serial, i+1, len(w.pages)))
+	}
+}
@@ -0,0 +1,93 @@
+package documents
+
+// Default templates. Each renders to lines of text: a line starting with
+// "# " is a title, "## " a heading, "---" a horizontal rule, and an empty
+// line a gap. Files of the same name in TemplateDir replace them.
+var defaultTemplates = map[string]string{
+	"letterhead.tmpl": `# {{.Clinic.Name}}
+{{.Clinic.Address}}
+{{if .Clinic.Phone}}Tel. {{.Clinic.Phone}}{{end}}
+---
+`,
+
+	"visit-summary.tmpl": `# Visit Summary
+
+Patient: {{.Patient.Name}} ({{.Patient.MRN}})
+Date of birth: {{date .Patient.DateOfBirth}}
+Visit date: {{date .VisitDate}}
+Doctor: {{.Doctor.Name}}
+
+## Anamnesis
+{{.Examination.Anamnesis}}
+
+## Diagnosis
+{{.Examination.Diagnosis}}
+
+## Prescription
+{{.Examination.Prescription}}
+`,
+
+	"prescription.tmpl": `# Prescription
+
+Patient: {{.Patient.Name}} ({{.Patient.MRN}})
+Date of birth: {{date .Patient.DateOfBirth}}
+Date: {{date .VisitDate}}
+
+## R/
+{{.Examination.Prescription}}
+
+Prescriber: {{.Doctor.Name}}{{if .Doctor.LicenseNumber}}, license {{.Doctor.LicenseNumber}}{{end}}
+`,
+
+	"sick-note.tmpl": `# Sick Leave Certificate
+
+The undersigned doctor certifies that
+
+{{.Patient.Name}}, born {{date .Patient.DateOfBirth}},
+
+was examined on {{date .VisitDate}} and is unfit for work for {{.SickLeave.Days}} {{if eq .SickLeave.Days 1}}day{{else}}days{{end}}, from {{date .SickLeave.From}} to {{date .SickLeave.To}} inclusive.
+
+{{.Doctor.Name}}{{if .Doctor.LicenseNumber}}
+License {{.Doctor.LicenseNumber}}{{end}}
+`,
+
+	"referral.tmpl": `# Referral Letter
+
+To: {{.ReferredTo}}
+Urgency: {{.Referral.Urgency}}
+Date: {{.Referral.CreatedAt.Format "2 January 2006"}}
+
+Patient: {{.Patient.Name}} ({{.Patient.MRN}})
+Date of birth: {{date .Patient.DateOfBirth}}
+
+Dear colleague, I am referring the above patient, whom I examined on {{date .VisitDate}}, for your assessment.
+
+## Reason for referral
+{{.Referral.Reason}}
+
+## Diagnosis
+{{.Examination.Diagnosis}}
+
+## Current treatment
+{{.Examination.Prescription}}
+
+Kind regards,
+
+{{.Doctor.Name}}{{if .Doctor.LicenseNumber}}
+License {{.Doctor.LicenseNumber}}{{end}}
+`,
+
+	"medical-certificate.tmpl": `# Medical Certificate
+
+The undersigned doctor certifies that
+
+{{.Patient.Name}}, born {{date .Patient.DateOfBirth}},
+
+was examined at {{.Clinic.Name}} on {{date .VisitDate}}.{{if .Purpose}}
+
+This certificate is issued for: {{.Purpose}}{{end}}
+
+{{.Doctor.Name}}{{if .Doctor.LicenseNumber}}
+License {{.Doctor.LicenseNumber}}{{end}}
+`,
+}
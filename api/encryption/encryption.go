@@ -0,0 +1,352 @@
+// Package encryption seals sensitive model fields with envelope encryption.
+// Each value is encrypted with AES-256-GCM under a data key. Data keys are
+// kept in the database wrapped by a master key from the configuration, so
+// replacing the master key only rewraps the data keys, while rotating the
+// data key re-encrypts the values themselves.
+//
+// Sealed values cannot be compared in SQL. Columns that are looked up, such
+// as a patient's email, carry a blind index next to them: a keyed HMAC of
+// the normalized value that is the same every time it is computed.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrNotConfigured is returned when no master or data key has been loaded
+var ErrNotConfigured = errors.New("Encryption Not Configured")
+
+// ErrUnknownKey is returned for values sealed with a data key, or data keys
+// wrapped with a master key, that is not available
+var ErrUnknownKey = errors.New("Unknown Encryption Key")
+
+// ErrCorrupt is returned for values that do not decrypt
+var ErrCorrupt = errors.New("Cannot Decrypt Value")
+
+// prefix starts every sealed value. Values without it are plaintext
+// written before encryption was enabled, and are read as they are.
+const prefix = "enc:v1:"
+
+// KeySize is the size in bytes of master and data keys
+const KeySize = 32
+
+// MasterKey is a key encryption key from the configuration
+type MasterKey struct {
+	ID  string
+	Key []byte
+}
+
+var (
+	mu       sync.RWMutex
+	masters  []MasterKey
+	indexKey []byte
+	dataKeys = map[uint32]cipher.AEAD{}
+	current  uint32
+	loader   func(id uint32) ([]byte, error)
+)
+
+// ParseMasterKeys reads master keys given as comma separated id:key pairs,
+// with each key in base64. The first key is the current one; the others
+// are kept to unwrap data keys until they have been rewrapped.
+func ParseMasterKeys(spec string) ([]MasterKey, error) {
+	keys := []MasterKey{}
+	seen := map[string]bool{}
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		i := strings.Index(pair, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("Invalid Master Key %q, Expected id:base64", pair)
+		}
+		id := pair[:i]
+		if seen[id] {
+			return nil, fmt.Errorf("Duplicate Master Key %s", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(pair[i+1:])
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("Master Key %s Must Be %d Bytes In Base64", id, KeySize)
+		}
+		seen[id] = true
+		keys = append(keys, MasterKey{ID: id, Key: key})
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("Required Master Key")
+	}
+	return keys, nil
+}
+
+// Configure sets the master keys, current first, and the key blind indexes
+// are computed with. The blind index key must stay the same for as long as
+// the indexes it produced are in the database.
+func Configure(masterKeys []MasterKey, blindIndexKey []byte) error {
+	if len(masterKeys) == 0 {
+		return errors.New("Required Master Key")
+	}
+	if len(blindIndexKey) < 16 {
+		return errors.New("Blind Index Key Must Be At Least 16 Bytes")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	masters = masterKeys
+	indexKey = blindIndexKey
+	return nil
+}
+
+// CurrentMasterKey returns the id of the master key new data keys are
+// wrapped with
+func CurrentMasterKey() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	if len(masters) == 0 {
+		return ""
+	}
+	return masters[0].ID
+}
+
+func masterKey(id string) []byte {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, m := range masters {
+		if m.ID == id {
+			return m.Key
+		}
+	}
+	return nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plaintext with a fresh nonce, bound to context
+func seal(aead cipher.AEAD, plaintext, context []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, context), nil
+}
+
+func open(aead cipher.AEAD, sealed, context []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrCorrupt
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], context)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return plaintext, nil
+}
+
+// NewDataKey returns a random data key
+func NewDataKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// WrapDataKey encrypts a data key with the current master key. It returns
+// the master key's id with the wrapped key in base64.
+func WrapDataKey(key []byte) (string, string, error) {
+	id := CurrentMasterKey()
+	if id == "" {
+		return "", "", ErrNotConfigured
+	}
+	aead, err := newAEAD(masterKey(id))
+	if err != nil {
+		return "", "", err
+	}
+	wrapped, err := seal(aead, key, []byte(id))
+	if err != nil {
+		return "", "", err
+	}
+	return id, base64.StdEncoding.EncodeToString(wrapped), nil
+}
+
+// UnwrapDataKey decrypts a data key wrapped by the master key masterID
+func UnwrapDataKey(masterID, wrapped string) ([]byte, error) {
+	master := masterKey(masterID)
+	if master == nil {
+		return nil, ErrUnknownKey
+	}
+	sealed, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	aead, err := newAEAD(master)
+	if err != nil {
+		return nil, err
+	}
+	key, err := open(aead, sealed, []byte(masterID))
+	if err != nil || len(key) != KeySize {
+		return nil, ErrCorrupt
+	}
+	return key, nil
+}
+
+// AddDataKey makes an unwrapped data key available for opening values
+func AddDataKey(id uint32, key []byte) error {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	dataKeys[id] = aead
+	return nil
+}
+
+// SetCurrentDataKey chooses the data key new values are sealed with. The
+// key must have been added.
+func SetCurrentDataKey(id uint32) error {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := dataKeys[id]; !ok {
+		return ErrUnknownKey
+	}
+	current = id
+	return nil
+}
+
+// CurrentDataKey returns the id of the data key new values are sealed
+// with, or 0 when none has been loaded
+func CurrentDataKey() uint32 {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// SetLoader sets the function used to fetch a data key that has not been
+// added yet, such as one created by another instance since this one loaded
+// its keys
+func SetLoader(load func(id uint32) ([]byte, error)) {
+	mu.Lock()
+	defer mu.Unlock()
+	loader = load
+}
+
+func dataKey(id uint32) (cipher.AEAD, error) {
+	mu.RLock()
+	aead, ok := dataKeys[id]
+	load := loader
+	mu.RUnlock()
+	if ok {
+		return aead, nil
+	}
+	if load == nil {
+		return nil, ErrUnknownKey
+	}
+	key, err := load(id)
+	if err != nil {
+		return nil, err
+	}
+	if err = AddDataKey(id, key); err != nil {
+		return nil, err
+	}
+	return dataKey(id)
+}
+
+// Prefix returns how values sealed with the data key id begin, for
+// finding values that still need re-encrypting
+func Prefix(id uint32) string {
+	return prefix + strconv.FormatUint(uint64(id), 10) + ":"
+}
+
+// Seal encrypts plaintext with the current data key. context names where
+// the value is kept, such as "patients.email"; it is authenticated with the
+// value so a sealed value copied into another column does not open. Empty
+// values are left empty.
+func Seal(context, plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+	id := CurrentDataKey()
+	if id == 0 {
+		return "", ErrNotConfigured
+	}
+	aead, err := dataKey(id)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := seal(aead, []byte(plaintext), []byte(context))
+	if err != nil {
+		return "", err
+	}
+	return Prefix(id) + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// Open decrypts a value sealed for context. Values that were never sealed
+// are returned as they are.
+func Open(context, value string) (string, error) {
+	id, ok := DataKeyOf(value)
+	if !ok {
+		return value, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(value[len(Prefix(id)):])
+	if err != nil {
+		return "", ErrCorrupt
+	}
+	aead, err := dataKey(id)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, sealed, []byte(context))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// DataKeyOf returns the id of the data key value was sealed with, and false
+// when value is plaintext
+func DataKeyOf(value string) (uint32, bool) {
+	if !strings.HasPrefix(value, prefix) {
+		return 0, false
+	}
+	rest := value[len(prefix):]
+	i := strings.Index(rest, ":")
+	if i <= 0 {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(rest[:i], 10, 32)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint32(id), true
+}
+
+// BlindIndex returns the keyed hash value is looked up by in context. The
+// caller normalizes value first, for example by lower casing an email.
+// Empty values have an empty index.
+func BlindIndex(context, value string) string {
+	if value == "" {
+		return ""
+	}
+	mu.RLock()
+	key := indexKey
+	mu.RUnlock()
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(context))
+	mac.Write([]byte{0})
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,135 @@
+// Package events fans out live updates, such as appointment status changes
+// and queue calls, to subscribed clients.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types
+const (
+	AppointmentChanged = "appointment"
+	QueueChanged       = "queue"
+	ScheduleChanged    = "schedule"
+	ComplianceAlert    = "compliance"
+)
+
+// Event is one update. DepartmentID and EmployeeID scope it; zero means it
+// concerns everybody. Confidential events only go to subscribers allowed to
+// receive them.
+type Event struct {
+	ID           uint64      `json:"id"`
+	Type         string      `json:"type"`
+	Action       string      `json:"action"`
+	DepartmentID uint32      `json:"department_id,omitempty"`
+	EmployeeID   int         `json:"employee_id,omitempty"`
+	Confidential bool        `json:"-"`
+	Time         time.Time   `json:"time"`
+	Data         interface{} `json:"data"`
+}
+
+// Filter selects the events a subscriber receives. Zero values match
+// everything but confidential events.
+type Filter struct {
+	DepartmentID uint32
+	EmployeeID   int
+	Types        map[string]bool
+	Confidential bool
+}
+
+// Match reports whether the event passes the filter. Events without a
+// department or employee are sent to every subscriber.
+func (f Filter) Match(e Event) bool {
+	if e.Confidential && !f.Confidential {
+		return false
+	}
+	if len(f.Types) > 0 && !f.Types[e.Type] {
+		return false
+	}
+	if f.DepartmentID != 0 && e.DepartmentID != 0 && f.DepartmentID != e.DepartmentID {
+		return false
+	}
+	if f.EmployeeID != 0 && e.EmployeeID != 0 && f.EmployeeID != e.EmployeeID {
+		return false
+	}
+	return true
+}
+
+// Subscription receives events on C until it is closed, either by
+// Unsubscribe or by the hub when the subscriber falls too far behind
+type Subscription struct {
+	C      <-chan Event
+	c      chan Event
+	filter Filter
+}
+
+// Hub delivers published events to subscribers. Publish never blocks: each
+// subscriber has a buffer, and a subscriber whose buffer is full is
+// disconnected rather than allowed to hold up the handler that published.
+type Hub struct {
+	mu     sync.Mutex
+	subs   map[*Subscription]bool
+	buffer int
+	nextID uint64
+}
+
+// NewHub returns a hub giving each subscriber a buffer of the given size
+func NewHub(buffer int) *Hub {
+	if buffer < 1 {
+		buffer = 1
+	}
+	return &Hub{subs: map[*Subscription]bool{}, buffer: buffer}
+}
+
+// Subscribe registers a subscriber for the events matching filter
+func (h *Hub) Subscribe(filter Filter) *Subscription {
+	c := make(chan Event, h.buffer)
+	s := &Subscription{C: c, c: c, filter: filter}
+	h.mu.Lock()
+	h.subs[s] = true
+	h.mu.Unlock()
+	return s
+}
+
+// Unsubscribe removes a subscriber and closes its channel. It is safe to
+// call more than once.
+func (h *Hub) Unsubscribe(s *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[s] {
+		delete(h.subs, s)
+		close(s.c)
+	}
+}
+
+// Publish stamps the event and hands it to every matching subscriber
+func (h *Hub) Publish(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextID++
+	e.ID = h.nextID
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	for s := range h.subs {
+		if !s.filter.Match(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			// A slow consumer is dropped; the client reconnects and
+			// reloads its state instead of silently missing updates
+			delete(h.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// Subscribers returns the number of connected subscribers
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
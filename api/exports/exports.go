@@ -0,0 +1,427 @@
+// Package exports writes bulk extracts of appointments and examinations to
+// files in the background. Extracts only contain patients who have
+// consented to research use, and callers who are not administrators get
+// pseudonymous patient identifiers and no clinical notes. The notes of
+// examinations with sensitivity labels are left out for everyone.
+package exports
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/fhir"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// Dir is where export files are written
+var Dir = filepath.Join(os.TempDir(), "hms-exports")
+
+// Retention is how long a finished file is kept
+var Retention = 24 * time.Hour
+
+// pageSize is how many records are read from the database at a time
+const pageSize = 500
+
+// Column sensitivity. Identifiers are replaced by a pseudonym and clinical
+// text is left out for callers who are not administrators.
+const (
+	Public     = ""
+	Identifier = "identifier"
+	Clinical   = "clinical"
+)
+
+// Column is one field of an export
+type Column struct {
+	Name        string
+	Sensitivity string
+}
+
+// record is one exported row. values holds the column values by name.
+type record struct {
+	key    uint32
+	mrn    string
+	values map[string]interface{}
+	fhir   interface{}
+}
+
+// source reads one resource a page at a time, after the given key
+type source struct {
+	columns []Column
+	next    func(db *gorm.DB, job *models.ExportJob, after uint32) ([]record, error)
+}
+
+var sources = map[string]source{
+	"appointments": {
+		columns: []Column{
+			{"appointment_id", Public}, {"mrn", Identifier}, {"employee_id", Public}, {"schedule_code", Public},
+			{"date", Public}, {"start_time", Public}, {"end_time", Public}, {"status", Public}, {"created_at", Public},
+		},
+		next: nextAppointments,
+	},
+	"examinations": {
+		columns: []Column{
+			{"examination_id", Public}, {"appointment_id", Public}, {"mrn", Identifier}, {"employee_id", Public},
+			{"schedule_code", Public}, {"anamnesis", Clinical}, {"diagnosis", Clinical}, {"prescription", Clinical},
+			{"status", Public}, {"created_at", Public}, {"updated_at", Public},
+		},
+		next: nextExaminations,
+	},
+}
+
+func nextAppointments(db *gorm.DB, job *models.ExportJob, after uint32) ([]record, error) {
+	query := db.Debug().Model(&models.Appointment{}).Where("appointment_id > ?", after)
+	if job.DateFrom != "" {
+		query = query.Where("date >= ?", job.DateFrom)
+	}
+	if job.DateTo != "" {
+		query = query.Where("date <= ?", job.DateTo)
+	}
+	appointments := []models.Appointment{}
+	if err := query.Order("appointment_id").Limit(pageSize).Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+	records := make([]record, 0, len(appointments))
+	for i := range appointments {
+		a := &appointments[i]
+		records = append(records, record{
+			key: a.AppointmentID,
+			mrn: a.MRN,
+			values: map[string]interface{}{
+				"appointment_id": a.AppointmentID, "mrn": a.MRN, "employee_id": a.EmployeeID,
+				"schedule_code": a.ScheduleCode, "date": a.Date, "start_time": a.StartTime, "end_time": a.EndTime,
+				"status": a.Status, "created_at": a.CreatedAt,
+			},
+			fhir: fhir.FromAppointment(a),
+		})
+	}
+	return records, nil
+}
+
+func nextExaminations(db *gorm.DB, job *models.ExportJob, after uint32) ([]record, error) {
+	query := db.Debug().Model(&models.Examination{}).Where("examination_id > ?", after)
+	if job.DateFrom != "" {
+		from, _ := time.ParseInLocation("2006-01-02", job.DateFrom, time.Local)
+		query = query.Where("created_at >= ?", from)
+	}
+	if job.DateTo != "" {
+		to, _ := time.ParseInLocation("2006-01-02", job.DateTo, time.Local)
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+	examinations := []models.Examination{}
+	if err := query.Order("examination_id").Limit(pageSize).Find(&examinations).Error; err != nil {
+		return nil, err
+	}
+	records := make([]record, 0, len(examinations))
+	for i := range examinations {
+		e := &examinations[i]
+		if e.Restricted() {
+			e.Redact()
+		}
+		records = append(records, record{
+			key: e.ExaminationID,
+			mrn: e.MRN,
+			values: map[string]interface{}{
+				"examination_id": e.ExaminationID, "appointment_id": e.AppointmentID, "mrn": e.MRN,
+				"employee_id": e.EmployeeID, "schedule_code": e.ScheduleCode, "anamnesis": e.Anamnesis,
+				"diagnosis": e.Diagnosis, "prescription": e.Prescription, "status": e.Status,
+				"created_at": e.CreatedAt, "updated_at": e.UpdatedAt,
+			},
+			fhir: fhir.FromExamination(e),
+		})
+	}
+	return records, nil
+}
+
+// Prepare checks the selected columns of a job and records which of them
+// are redacted for the caller. FHIR resources cannot be redacted column by
+// column, so only administrators may export them.
+func Prepare(job *models.ExportJob, columns []string, admin bool) error {
+	src, ok := sources[job.Resource]
+	if !ok {
+		return fmt.Errorf("Cannot Export %s", job.Resource)
+	}
+	if job.Format == models.ExportFHIR {
+		if !admin {
+			return fmt.Errorf("FHIR Exports Require Administrator Access")
+		}
+		if len(columns) > 0 {
+			return fmt.Errorf("Columns Cannot Be Selected For FHIR Exports")
+		}
+	}
+
+	names := []string{}
+	known := map[string]Column{}
+	for _, c := range src.columns {
+		known[c.Name] = c
+		names = append(names, c.Name)
+	}
+	selected := []Column{}
+	for _, name := range columns {
+		c, ok := known[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("Unknown Column %q, Expected Some Of %s", name, strings.Join(names, ", "))
+		}
+		selected = append(selected, c)
+	}
+	if len(selected) == 0 {
+		selected = src.columns
+	}
+
+	chosen, redacted := []string{}, []string{}
+	for _, c := range selected {
+		chosen = append(chosen, c.Name)
+		if !admin && c.Sensitivity != Public {
+			redacted = append(redacted, c.Name)
+		}
+	}
+	job.Columns = strings.Join(chosen, ",")
+	job.Redacted = strings.Join(redacted, ",")
+	return nil
+}
+
+// pseudonym replaces a patient identifier with a keyed hash, so rows of
+// the same patient can still be linked within and across exports
+func pseudonym(value string) string {
+	mac := hmac.New(sha256.New, []byte(os.Getenv("API_SECRET")))
+	mac.Write([]byte(value))
+	return "P-" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// redact applies the redaction recorded on the job to a row
+func redact(job *models.ExportJob, values map[string]interface{}) {
+	if job.Redacted == "" {
+		return
+	}
+	columns := map[string]string{}
+	for _, c := range sources[job.Resource].columns {
+		columns[c.Name] = c.Sensitivity
+	}
+	for _, name := range strings.Split(job.Redacted, ",") {
+		switch columns[name] {
+		case Identifier:
+			values[name] = pseudonym(fmt.Sprint(values[name]))
+		case Clinical:
+			values[name] = nil
+		}
+	}
+}
+
+// Extension returns the file name extension of a format
+func Extension(format string) string {
+	if format == models.ExportCSV {
+		return "csv"
+	}
+	return "ndjson"
+}
+
+// ContentType returns the media type of a format
+func ContentType(format string) string {
+	switch format {
+	case models.ExportCSV:
+		return "text/csv"
+	case models.ExportFHIR:
+		return "application/fhir+ndjson"
+	}
+	return "application/x-ndjson"
+}
+
+// Run writes the file of a queued job and records the outcome on the job
+func Run(db *gorm.DB, job *models.ExportJob) {
+	path := filepath.Join(Dir, fmt.Sprintf("export-%d.%s", job.ID, Extension(job.Format)))
+	defer func() {
+		if r := recover(); r != nil {
+			os.Remove(path)
+			job.Fail(db, fmt.Errorf("Export Failed: %v", r))
+		}
+	}()
+
+	if err := job.Start(db, path); err != nil {
+		log.Printf("export %d: %v", job.ID, err)
+		return
+	}
+	rows, excluded, size, err := write(db, job, path)
+	if err != nil {
+		os.Remove(path)
+		job.Fail(db, err)
+		return
+	}
+	now := time.Now()
+	if err = job.Complete(db, rows, excluded, size, now, now.Add(Retention)); err != nil {
+		log.Printf("export %d: %v", job.ID, err)
+	}
+}
+
+// Sweep deletes the files of jobs whose retention has passed at now
+func Sweep(db *gorm.DB, now time.Time) error {
+	jobs, err := models.FindExpiredExportJobs(db, now)
+	if err != nil {
+		return err
+	}
+	for i := range jobs {
+		if err = os.Remove(jobs[i].Path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err = jobs[i].Expire(db); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Recover fails the jobs a restart interrupted and removes their partial
+// files
+func Recover(db *gorm.DB) error {
+	paths, err := models.FailInterruptedExportJobs(db)
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		os.Remove(path)
+	}
+	return nil
+}
+
+// write streams every matching record to path and returns the number of
+// rows written, the number left out for lack of consent and the file size
+func write(db *gorm.DB, job *models.ExportJob, path string) (int, int, int64, error) {
+	consented, err := models.ConsentedPatients(db, models.ConsentResearch)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if err = os.MkdirAll(Dir, 0700); err != nil {
+		return 0, 0, 0, err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	defer file.Close()
+	buffered := bufio.NewWriter(file)
+
+	emit, flush, err := encoder(job, buffered)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	src := sources[job.Resource]
+	rows, excluded := 0, 0
+	var after uint32
+	for {
+		records, err := src.next(db, job, after)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if len(records) == 0 {
+			break
+		}
+		for _, r := range records {
+			after = r.key
+			if !consented[r.mrn] {
+				excluded++
+				continue
+			}
+			if err = emit(r); err != nil {
+				return 0, 0, 0, err
+			}
+			rows++
+		}
+	}
+
+	if err = flush(); err != nil {
+		return 0, 0, 0, err
+	}
+	if err = buffered.Flush(); err != nil {
+		return 0, 0, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return rows, excluded, info.Size(), file.Close()
+}
+
+// encoder returns the function writing one record in the job's format, and
+// the function flushing what it has buffered
+func encoder(job *models.ExportJob, w io.Writer) (func(record) error, func() error, error) {
+	columns := job.ColumnList()
+	switch job.Format {
+	case models.ExportCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return nil, nil, err
+		}
+		emit := func(r record) error {
+			redact(job, r.values)
+			line := make([]string, len(columns))
+			for i, name := range columns {
+				line[i] = csvValue(r.values[name])
+			}
+			return cw.Write(line)
+		}
+		flush := func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+		return emit, flush, nil
+
+	case models.ExportFHIR:
+		enc := json.NewEncoder(w)
+		emit := func(r record) error {
+			return enc.Encode(r.fhir)
+		}
+		return emit, func() error { return nil }, nil
+
+	default:
+		emit := func(r record) error {
+			redact(job, r.values)
+			return writeObject(w, columns, r.values)
+		}
+		return emit, func() error { return nil }, nil
+	}
+}
+
+// csvValue formats a value for a CSV cell
+func csvValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case string:
+		return value
+	}
+	return fmt.Sprint(v)
+}
+
+// writeObject writes one NDJSON line with the keys in column order
+func writeObject(w io.Writer, columns []string, values map[string]interface{}) error {
+	var line strings.Builder
+	line.WriteByte('{')
+	for i, name := range columns {
+		if i > 0 {
+			line.WriteByte(',')
+		}
+		value, err := json.Marshal(values[name])
+		if err != nil {
+			return err
+		}
+		line.WriteString(strconv.Quote(name))
+		line.WriteByte(':')
+		line.Write(value)
+	}
+	line.WriteString("}\n")
+	_, err := io.WriteString(w, line.String())
+	return err
+}
@@ -0,0 +1,103 @@
+package fhir
+
+import "time"
+
+// SearchParam ...
+type SearchParam struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// Interaction ...
+type Interaction struct {
+	Code string `json:"code"`
+}
+
+// CapabilityResource describes what is supported for one resource type
+type CapabilityResource struct {
+	Type        string        `json:"type"`
+	Interaction []Interaction `json:"interaction"`
+	SearchParam []SearchParam `json:"searchParam,omitempty"`
+}
+
+// CapabilityRest ...
+type CapabilityRest struct {
+	Mode     string               `json:"mode"`
+	Resource []CapabilityResource `json:"resource"`
+}
+
+// CapabilitySoftware ...
+type CapabilitySoftware struct {
+	Name string `json:"name"`
+}
+
+// CapabilityImplementation ...
+type CapabilityImplementation struct {
+	Description string `json:"description"`
+	URL         string `json:"url"`
+}
+
+// CapabilityStatement is returned by /metadata
+type CapabilityStatement struct {
+	ResourceType   string                   `json:"resourceType"`
+	Status         string                   `json:"status"`
+	Date           string                   `json:"date"`
+	Kind           string                   `json:"kind"`
+	Software       CapabilitySoftware       `json:"software"`
+	Implementation CapabilityImplementation `json:"implementation"`
+	FhirVersion    string                   `json:"fhirVersion"`
+	Format         []string                 `json:"format"`
+	Rest           []CapabilityRest         `json:"rest"`
+}
+
+var (
+	read   = Interaction{Code: "read"}
+	search = Interaction{Code: "search-type"}
+	create = Interaction{Code: "create"}
+	page   = []SearchParam{{Name: "_count", Type: "number"}, {Name: "_offset", Type: "number"}}
+)
+
+func params(list ...SearchParam) []SearchParam {
+	return append(append([]SearchParam{{Name: "_id", Type: "token"}}, list...), page...)
+}
+
+// Capabilities lists the resources, interactions and search parameters the
+// facade serves at base
+func Capabilities(base string) *CapabilityStatement {
+	return &CapabilityStatement{
+		ResourceType:   "CapabilityStatement",
+		Status:         "active",
+		Date:           time.Now().Format("2006-01-02"),
+		Kind:           "instance",
+		Software:       CapabilitySoftware{Name: "HMS"},
+		Implementation: CapabilityImplementation{Description: "HMS FHIR R4 facade", URL: base},
+		FhirVersion:    Version,
+		Format:         []string{"json"},
+		Rest: []CapabilityRest{{
+			Mode: "server",
+			Resource: []CapabilityResource{
+				{Type: "Patient", Interaction: []Interaction{read, search}, SearchParam: params(
+					SearchParam{"identifier", "token"}, SearchParam{"name", "string"},
+					SearchParam{"birthdate", "date"}, SearchParam{"gender", "token"})},
+				{Type: "Practitioner", Interaction: []Interaction{read, search}, SearchParam: params(
+					SearchParam{"identifier", "token"}, SearchParam{"name", "string"}, SearchParam{"active", "token"})},
+				{Type: "Appointment", Interaction: []Interaction{read, search, create}, SearchParam: params(
+					SearchParam{"patient", "reference"}, SearchParam{"practitioner", "reference"},
+					SearchParam{"actor", "reference"}, SearchParam{"date", "date"}, SearchParam{"status", "token"})},
+				{Type: "Schedule", Interaction: []Interaction{read, search}, SearchParam: params()},
+				{Type: "Slot", Interaction: []Interaction{read, search}, SearchParam: []SearchParam{
+					{"schedule", "reference"}, {"start", "date"}, {"status", "token"}}},
+				{Type: "Encounter", Interaction: []Interaction{read, search}, SearchParam: params(
+					SearchParam{"patient", "reference"}, SearchParam{"subject", "reference"},
+					SearchParam{"practitioner", "reference"}, SearchParam{"participant", "reference"},
+					SearchParam{"date", "date"}, SearchParam{"status", "token"})},
+				{Type: "Condition", Interaction: []Interaction{read, search}, SearchParam: params(
+					SearchParam{"patient", "reference"}, SearchParam{"subject", "reference"},
+					SearchParam{"encounter", "reference"}, SearchParam{"recorder", "reference"})},
+				{Type: "MedicationRequest", Interaction: []Interaction{read, search}, SearchParam: params(
+					SearchParam{"patient", "reference"}, SearchParam{"subject", "reference"},
+					SearchParam{"encounter", "reference"}, SearchParam{"requester", "reference"})},
+			},
+		}},
+	}
+}
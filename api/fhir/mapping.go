@@ -0,0 +1,414 @@
+package fhir
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// SlotDateLayout is the date part of a slot id, as in SC-00001.20260112
+const SlotDateLayout = "20060102"
+
+func meta(updated time.Time) *Meta {
+	if updated.IsZero() {
+		return nil
+	}
+	return &Meta{LastUpdated: &updated}
+}
+
+func dateTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// PatientReference ...
+func PatientReference(mrn string) Reference {
+	return Reference{Reference: "Patient/" + mrn}
+}
+
+// PractitionerReference ...
+func PractitionerReference(employeeID int) Reference {
+	return Reference{Reference: "Practitioner/" + strconv.Itoa(employeeID)}
+}
+
+// gender maps our one letter sex to the FHIR administrative gender
+func gender(sex string) string {
+	switch sex {
+	case "M":
+		return "male"
+	case "F":
+		return "female"
+	case "":
+		return ""
+	default:
+		return "unknown"
+	}
+}
+
+// Sex maps a FHIR administrative gender back to our one letter sex
+func Sex(gender string) string {
+	switch gender {
+	case "male":
+		return "M"
+	case "female":
+		return "F"
+	default:
+		return gender
+	}
+}
+
+// nationalIDSystem returns the identifier system of a national ID type
+func nationalIDSystem(idType string) string {
+	switch idType {
+	case "NIK":
+		return SystemNIK
+	case "SSN":
+		return SystemSSN
+	default:
+		return "urn:hms:national-id:" + strings.ToLower(idType)
+	}
+}
+
+// NationalIDType returns the national ID type of an identifier system, or
+// "" when the system is not a national ID
+func NationalIDType(system string) string {
+	switch system {
+	case SystemNIK:
+		return "NIK"
+	case SystemSSN:
+		return "SSN"
+	}
+	if strings.HasPrefix(system, "urn:hms:national-id:") {
+		return strings.ToUpper(strings.TrimPrefix(system, "urn:hms:national-id:"))
+	}
+	return ""
+}
+
+// FromPatient maps a patient. A patient merged into another is inactive
+// and links to the record that replaced it.
+func FromPatient(p *models.Patient) *Patient {
+	res := Patient{
+		ResourceType: "Patient",
+		ID:           p.MRN,
+		Meta:         meta(p.UpdatedAt),
+		Identifier:   []Identifier{{Use: "usual", System: SystemMRN, Value: p.MRN}},
+		Active:       p.MergedInto == "",
+		Name:         []HumanName{{Use: "official", Text: p.Name}},
+		Gender:       gender(p.Sex),
+		BirthDate:    p.DateOfBirth,
+	}
+	if p.NationalID != "" {
+		res.Identifier = append(res.Identifier, Identifier{Use: "official", System: nationalIDSystem(p.NationalIDType), Value: p.NationalID})
+	}
+	for _, phone := range p.Phones {
+		res.Telecom = append(res.Telecom, ContactPoint{System: "phone", Value: phone.Number, Use: phone.Kind})
+	}
+	if p.Email != "" {
+		res.Telecom = append(res.Telecom, ContactPoint{System: "email", Value: p.Email})
+	}
+	if p.Address != "" || p.City != "" {
+		address := Address{City: p.City, State: p.Province, PostalCode: p.PostalCode, Country: "ID"}
+		if p.Address != "" {
+			address.Line = []string{p.Address}
+		}
+		res.Address = []Address{address}
+	}
+	if p.MergedInto != "" {
+		res.Link = []PatientLink{{Other: PatientReference(p.MergedInto), Type: "replaced-by"}}
+	}
+	return &res
+}
+
+// FromEmployee maps an employee to a practitioner, with their professional
+// license as a qualification
+func FromEmployee(e *models.Employee) *Practitioner {
+	res := Practitioner{
+		ResourceType: "Practitioner",
+		ID:           strconv.Itoa(e.EmployeeID),
+		Meta:         meta(e.UpdatedAt),
+		Identifier:   []Identifier{{Use: "usual", System: SystemEmployee, Value: strconv.Itoa(e.EmployeeID)}},
+		Active:       e.Active,
+		Name:         []HumanName{{Use: "official", Text: e.Name}},
+		Telecom:      []ContactPoint{{System: "email", Value: e.Email, Use: "work"}},
+	}
+	if e.LicenseNumber != "" {
+		qualification := Qualification{
+			Identifier: []Identifier{{System: SystemLicense, Value: e.LicenseNumber}},
+			Code:       CodeableConcept{Text: e.JobTitle},
+		}
+		if e.Specialty != nil {
+			qualification.Code.Text = strings.TrimSpace(e.JobTitle + " " + e.Specialty.Name)
+		}
+		if e.LicenseExpiry != "" {
+			qualification.Period = &Period{End: e.LicenseExpiry}
+		}
+		res.Qualification = []Qualification{qualification}
+	}
+	return &res
+}
+
+// AppointmentStatus maps our appointment status to FHIR's. Appointments
+// created by staff carry the schedule's default status and count as
+// pending until booked.
+func AppointmentStatus(status string) string {
+	switch status {
+	case models.AppointmentBooked:
+		return "booked"
+	case models.AppointmentCancelled:
+		return "cancelled"
+	case models.ExaminationCompleted:
+		return "fulfilled"
+	default:
+		return "pending"
+	}
+}
+
+// appointmentStatuses returns our statuses that map to a FHIR status
+func appointmentStatuses(fhirStatus string) []string {
+	switch fhirStatus {
+	case "booked":
+		return []string{models.AppointmentBooked}
+	case "cancelled":
+		return []string{models.AppointmentCancelled}
+	case "fulfilled":
+		return []string{models.ExaminationCompleted}
+	default:
+		return nil
+	}
+}
+
+// FromAppointment maps an appointment
+func FromAppointment(a *models.Appointment) *Appointment {
+	status := AppointmentStatus(a.Status)
+	participantStatus := "accepted"
+	if status == "cancelled" {
+		participantStatus = "declined"
+	}
+	res := Appointment{
+		ResourceType: "Appointment",
+		ID:           strconv.FormatUint(uint64(a.AppointmentID), 10),
+		Meta:         meta(a.UpdatedAt),
+		Status:       status,
+		Created:      dateTime(a.CreatedAt),
+		Participant: []AppointmentParticipant{
+			{Actor: PatientReference(a.MRN), Required: "required", Status: participantStatus},
+			{Actor: PractitionerReference(a.EmployeeID), Required: "required", Status: participantStatus},
+		},
+	}
+	if start, err := a.ScheduledAt(); err == nil {
+		res.Start = dateTime(start)
+	}
+	if a.Date != "" && a.EndTime != "" {
+		if end, err := time.ParseInLocation("2006-01-02 15:04", a.Date+" "+a.EndTime, time.Local); err == nil {
+			res.End = dateTime(end)
+		}
+	}
+	if a.Date != "" {
+		if date, err := time.ParseInLocation("2006-01-02", a.Date, time.Local); err == nil {
+			res.Slot = []Reference{{Reference: "Slot/" + SlotID(a.ScheduleCode, date)}}
+		}
+	}
+	return &res
+}
+
+// ToAppointment reads a booking request: the patient and practitioner from
+// the participants and the schedule and date from the slot
+func ToAppointment(res *Appointment) (*models.Appointment, error) {
+	if res.ResourceType != "Appointment" {
+		return nil, errors.New("Resource Is Not An Appointment")
+	}
+	switch res.Status {
+	case "", "proposed", "pending", "booked":
+	default:
+		return nil, fmt.Errorf("Cannot Create A %s Appointment", res.Status)
+	}
+	a := models.Appointment{}
+	for _, p := range res.Participant {
+		ref := p.Actor.Reference
+		switch {
+		case strings.HasPrefix(ref, "Patient/"):
+			a.MRN = strings.TrimPrefix(ref, "Patient/")
+		case strings.HasPrefix(ref, "Practitioner/"):
+			id, err := strconv.Atoi(strings.TrimPrefix(ref, "Practitioner/"))
+			if err != nil {
+				return nil, errors.New("Invalid Practitioner Reference")
+			}
+			a.EmployeeID = id
+		}
+	}
+	if len(res.Slot) != 1 {
+		return nil, errors.New("Appointment Must Reference Exactly One Slot")
+	}
+	code, date, err := ParseSlotID(strings.TrimPrefix(res.Slot[0].Reference, "Slot/"))
+	if err != nil {
+		return nil, err
+	}
+	a.ScheduleCode = code
+	a.Date = date.Format("2006-01-02")
+	return &a, nil
+}
+
+// FromSchedule maps a weekly schedule. Schedules are not tied to a
+// practitioner, so the actor only names the schedule.
+func FromSchedule(s *models.Schedule) *Schedule {
+	return &Schedule{
+		ResourceType: "Schedule",
+		ID:           s.ScheduleCode,
+		Meta:         meta(s.UpdatedAt),
+		Identifier:   []Identifier{{Value: s.ScheduleCode}},
+		Active:       true,
+		Actor:        []Reference{{Display: "Schedule " + s.ScheduleCode}},
+		Comment:      fmt.Sprintf("Every %s %s-%s", s.Day, s.StartTime, s.EndTime),
+	}
+}
+
+// SlotID names the slot of a schedule on a date
+func SlotID(code string, date time.Time) string {
+	return code + "." + date.Format(SlotDateLayout)
+}
+
+// ParseSlotID splits a slot id into its schedule code and date
+func ParseSlotID(id string) (string, time.Time, error) {
+	i := strings.LastIndex(id, ".")
+	if i <= 0 {
+		return "", time.Time{}, errors.New("Invalid Slot Id")
+	}
+	date, err := time.ParseInLocation(SlotDateLayout, id[i+1:], time.Local)
+	if err != nil {
+		return "", time.Time{}, errors.New("Invalid Slot Id")
+	}
+	return id[:i], date, nil
+}
+
+// FromScheduleDate maps the occurrence of a schedule on a date to a slot,
+// busy when it has been booked
+func FromScheduleDate(s *models.Schedule, date time.Time, busy bool) *Slot {
+	day := date.Format("2006-01-02")
+	res := Slot{
+		ResourceType: "Slot",
+		ID:           SlotID(s.ScheduleCode, date),
+		Schedule:     Reference{Reference: "Schedule/" + s.ScheduleCode},
+		Status:       "free",
+	}
+	if busy {
+		res.Status = "busy"
+	}
+	if start, err := time.ParseInLocation("2006-01-02 15:04", day+" "+s.StartTime, time.Local); err == nil {
+		res.Start = dateTime(start)
+	}
+	if end, err := time.ParseInLocation("2006-01-02 15:04", day+" "+s.EndTime, time.Local); err == nil {
+		res.End = dateTime(end)
+	}
+	return &res
+}
+
+func examinationID(e *models.Examination) string {
+	return strconv.FormatUint(uint64(e.ExaminationID), 10)
+}
+
+// examinationMeta labels the resources of a redacted examination, so a
+// client can tell withheld notes from missing ones
+func examinationMeta(e *models.Examination) *Meta {
+	m := meta(e.UpdatedAt)
+	if !e.Redacted {
+		return m
+	}
+	if m == nil {
+		m = &Meta{}
+	}
+	m.Security = []Coding{{System: SystemObsValue, Code: "REDACTED", Display: "redacted"}}
+	return m
+}
+
+// masked stands in for a code the reader may not see
+var masked = CodeableConcept{Coding: []Coding{{System: SystemDataAbsent, Code: "masked", Display: "Masked"}}}
+
+// FromExamination maps an examination to the encounter it records
+func FromExamination(e *models.Examination) *Encounter {
+	res := Encounter{
+		ResourceType: "Encounter",
+		ID:           examinationID(e),
+		Meta:         examinationMeta(e),
+		Status:       "in-progress",
+		Class:        Coding{System: SystemActCode, Code: "AMB", Display: "ambulatory"},
+		Subject:      PatientReference(e.MRN),
+		Participant:  []EncounterParticipant{{Individual: PractitionerReference(e.EmployeeID)}},
+		Period:       &Period{Start: dateTime(e.CreatedAt)},
+	}
+	if e.AppointmentID != 0 {
+		res.Appointment = []Reference{{Reference: "Appointment/" + strconv.FormatUint(uint64(e.AppointmentID), 10)}}
+	}
+	if e.Status == models.ExaminationCompleted {
+		res.Status = "finished"
+		res.Period.End = dateTime(e.UpdatedAt)
+	}
+	if e.Anamnesis != "" {
+		res.ReasonCode = []CodeableConcept{{Text: e.Anamnesis}}
+	}
+	return &res
+}
+
+// FromDiagnosis maps the diagnosis of an examination to a condition. It
+// returns nil when no diagnosis was recorded, and a condition with a
+// masked code when the examination was redacted.
+func FromDiagnosis(e *models.Examination) *Condition {
+	if e.Diagnosis == "" && !e.Redacted {
+		return nil
+	}
+	encounter := Reference{Reference: "Encounter/" + examinationID(e)}
+	recorder := PractitionerReference(e.EmployeeID)
+	code := CodeableConcept{Text: e.Diagnosis}
+	if e.Redacted {
+		code = masked
+	}
+	return &Condition{
+		ResourceType: "Condition",
+		ID:           examinationID(e),
+		Meta:         examinationMeta(e),
+		Category: []CodeableConcept{{
+			Coding: []Coding{{System: SystemConditionCat, Code: "encounter-diagnosis", Display: "Encounter Diagnosis"}},
+		}},
+		Code:         code,
+		Subject:      PatientReference(e.MRN),
+		Encounter:    &encounter,
+		RecordedDate: dateTime(e.UpdatedAt),
+		Recorder:     &recorder,
+	}
+}
+
+// FromPrescription maps the prescription of an examination to a
+// medication request. It returns nil when nothing was prescribed, and a
+// request with a masked medication when the examination was redacted.
+func FromPrescription(e *models.Examination) *MedicationRequest {
+	if e.Prescription == "" && !e.Redacted {
+		return nil
+	}
+	encounter := Reference{Reference: "Encounter/" + examinationID(e)}
+	requester := PractitionerReference(e.EmployeeID)
+	status := "active"
+	if e.Status == models.ExaminationCompleted {
+		status = "completed"
+	}
+	medication := CodeableConcept{Text: e.Prescription}
+	if e.Redacted {
+		medication = masked
+	}
+	return &MedicationRequest{
+		ResourceType:              "MedicationRequest",
+		ID:                        examinationID(e),
+		Meta:                      examinationMeta(e),
+		Status:                    status,
+		Intent:                    "order",
+		MedicationCodeableConcept: medication,
+		Subject:                   PatientReference(e.MRN),
+		Encounter:                 &encounter,
+		AuthoredOn:                dateTime(e.UpdatedAt),
+		Requester:                 &requester,
+	}
+}
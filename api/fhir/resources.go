@@ -0,0 +1,261 @@
+// Package fhir maps the hospital's records to HL7 FHIR R4 resources. Only
+// the elements we have data for are modelled; everything else is left out
+// of the JSON rather than sent empty.
+package fhir
+
+import "time"
+
+// Version is the FHIR version served
+const Version = "4.0.1"
+
+// ContentType is the media type of FHIR JSON
+const ContentType = "application/fhir+json"
+
+// Identifier systems and code systems
+const (
+	SystemMRN          = "urn:hms:mrn"
+	SystemNIK          = "https://fhir.kemkes.go.id/id/nik"
+	SystemSSN          = "http://hl7.org/fhir/sid/us-ssn"
+	SystemLicense      = "urn:hms:license"
+	SystemEmployee     = "urn:hms:employee"
+	SystemActCode      = "http://terminology.hl7.org/CodeSystem/v3-ActCode"
+	SystemConditionCat = "http://terminology.hl7.org/CodeSystem/condition-category"
+	SystemDataAbsent   = "http://terminology.hl7.org/CodeSystem/data-absent-reason"
+	SystemObsValue     = "http://terminology.hl7.org/CodeSystem/v3-ObservationValue"
+)
+
+// Meta ...
+type Meta struct {
+	LastUpdated *time.Time `json:"lastUpdated,omitempty"`
+	Security    []Coding   `json:"security,omitempty"`
+}
+
+// Coding ...
+type Coding struct {
+	System  string `json:"system,omitempty"`
+	Code    string `json:"code,omitempty"`
+	Display string `json:"display,omitempty"`
+}
+
+// CodeableConcept ...
+type CodeableConcept struct {
+	Coding []Coding `json:"coding,omitempty"`
+	Text   string   `json:"text,omitempty"`
+}
+
+// Identifier ...
+type Identifier struct {
+	Use    string `json:"use,omitempty"`
+	System string `json:"system,omitempty"`
+	Value  string `json:"value"`
+}
+
+// Reference ...
+type Reference struct {
+	Reference string `json:"reference,omitempty"`
+	Display   string `json:"display,omitempty"`
+}
+
+// Period ...
+type Period struct {
+	Start string `json:"start,omitempty"`
+	End   string `json:"end,omitempty"`
+}
+
+// HumanName ...
+type HumanName struct {
+	Use  string `json:"use,omitempty"`
+	Text string `json:"text"`
+}
+
+// ContactPoint ...
+type ContactPoint struct {
+	System string `json:"system"`
+	Value  string `json:"value"`
+	Use    string `json:"use,omitempty"`
+}
+
+// Address ...
+type Address struct {
+	Line       []string `json:"line,omitempty"`
+	City       string   `json:"city,omitempty"`
+	State      string   `json:"state,omitempty"`
+	PostalCode string   `json:"postalCode,omitempty"`
+	Country    string   `json:"country,omitempty"`
+}
+
+// PatientLink points from a merged patient to the record that replaced it
+type PatientLink struct {
+	Other Reference `json:"other"`
+	Type  string    `json:"type"`
+}
+
+// Patient ...
+type Patient struct {
+	ResourceType string         `json:"resourceType"`
+	ID           string         `json:"id"`
+	Meta         *Meta          `json:"meta,omitempty"`
+	Identifier   []Identifier   `json:"identifier,omitempty"`
+	Active       bool           `json:"active"`
+	Name         []HumanName    `json:"name,omitempty"`
+	Telecom      []ContactPoint `json:"telecom,omitempty"`
+	Gender       string         `json:"gender,omitempty"`
+	BirthDate    string         `json:"birthDate,omitempty"`
+	Address      []Address      `json:"address,omitempty"`
+	Link         []PatientLink  `json:"link,omitempty"`
+}
+
+// Qualification is a practitioner's license to practise
+type Qualification struct {
+	Identifier []Identifier    `json:"identifier,omitempty"`
+	Code       CodeableConcept `json:"code"`
+	Period     *Period         `json:"period,omitempty"`
+}
+
+// Practitioner ...
+type Practitioner struct {
+	ResourceType  string          `json:"resourceType"`
+	ID            string          `json:"id"`
+	Meta          *Meta           `json:"meta,omitempty"`
+	Identifier    []Identifier    `json:"identifier,omitempty"`
+	Active        bool            `json:"active"`
+	Name          []HumanName     `json:"name,omitempty"`
+	Telecom       []ContactPoint  `json:"telecom,omitempty"`
+	Qualification []Qualification `json:"qualification,omitempty"`
+}
+
+// AppointmentParticipant ...
+type AppointmentParticipant struct {
+	Actor    Reference `json:"actor"`
+	Required string    `json:"required,omitempty"`
+	Status   string    `json:"status"`
+}
+
+// Appointment ...
+type Appointment struct {
+	ResourceType string                   `json:"resourceType"`
+	ID           string                   `json:"id,omitempty"`
+	Meta         *Meta                    `json:"meta,omitempty"`
+	Status       string                   `json:"status"`
+	Start        string                   `json:"start,omitempty"`
+	End          string                   `json:"end,omitempty"`
+	Slot         []Reference              `json:"slot,omitempty"`
+	Created      string                   `json:"created,omitempty"`
+	Participant  []AppointmentParticipant `json:"participant"`
+}
+
+// Schedule ...
+type Schedule struct {
+	ResourceType string       `json:"resourceType"`
+	ID           string       `json:"id"`
+	Meta         *Meta        `json:"meta,omitempty"`
+	Identifier   []Identifier `json:"identifier,omitempty"`
+	Active       bool         `json:"active"`
+	Actor        []Reference  `json:"actor"`
+	Comment      string       `json:"comment,omitempty"`
+}
+
+// Slot ...
+type Slot struct {
+	ResourceType string    `json:"resourceType"`
+	ID           string    `json:"id"`
+	Schedule     Reference `json:"schedule"`
+	Status       string    `json:"status"`
+	Start        string    `json:"start"`
+	End          string    `json:"end"`
+}
+
+// EncounterParticipant ...
+type EncounterParticipant struct {
+	Individual Reference `json:"individual"`
+}
+
+// Encounter ...
+type Encounter struct {
+	ResourceType string                 `json:"resourceType"`
+	ID           string                 `json:"id"`
+	Meta         *Meta                  `json:"meta,omitempty"`
+	Status       string                 `json:"status"`
+	Class        Coding                 `json:"class"`
+	Subject      Reference              `json:"subject"`
+	Participant  []EncounterParticipant `json:"participant,omitempty"`
+	Appointment  []Reference            `json:"appointment,omitempty"`
+	Period       *Period                `json:"period,omitempty"`
+	ReasonCode   []CodeableConcept      `json:"reasonCode,omitempty"`
+}
+
+// Condition ...
+type Condition struct {
+	ResourceType string            `json:"resourceType"`
+	ID           string            `json:"id"`
+	Meta         *Meta             `json:"meta,omitempty"`
+	Category     []CodeableConcept `json:"category,omitempty"`
+	Code         CodeableConcept   `json:"code"`
+	Subject      Reference         `json:"subject"`
+	Encounter    *Reference        `json:"encounter,omitempty"`
+	RecordedDate string            `json:"recordedDate,omitempty"`
+	Recorder     *Reference        `json:"recorder,omitempty"`
+}
+
+// MedicationRequest ...
+type MedicationRequest struct {
+	ResourceType              string          `json:"resourceType"`
+	ID                        string          `json:"id"`
+	Meta                      *Meta           `json:"meta,omitempty"`
+	Status                    string          `json:"status"`
+	Intent                    string          `json:"intent"`
+	MedicationCodeableConcept CodeableConcept `json:"medicationCodeableConcept"`
+	Subject                   Reference       `json:"subject"`
+	Encounter                 *Reference      `json:"encounter,omitempty"`
+	AuthoredOn                string          `json:"authoredOn,omitempty"`
+	Requester                 *Reference      `json:"requester,omitempty"`
+}
+
+// BundleLink ...
+type BundleLink struct {
+	Relation string `json:"relation"`
+	URL      string `json:"url"`
+}
+
+// BundleSearch ...
+type BundleSearch struct {
+	Mode string `json:"mode"`
+}
+
+// BundleEntry ...
+type BundleEntry struct {
+	FullURL  string        `json:"fullUrl"`
+	Resource interface{}   `json:"resource"`
+	Search   *BundleSearch `json:"search,omitempty"`
+}
+
+// Bundle is a searchset of resources
+type Bundle struct {
+	ResourceType string        `json:"resourceType"`
+	Type         string        `json:"type"`
+	Total        int           `json:"total"`
+	Link         []BundleLink  `json:"link,omitempty"`
+	Entry        []BundleEntry `json:"entry"`
+}
+
+// OperationOutcomeIssue ...
+type OperationOutcomeIssue struct {
+	Severity    string `json:"severity"`
+	Code        string `json:"code"`
+	Diagnostics string `json:"diagnostics,omitempty"`
+}
+
+// OperationOutcome reports an error
+type OperationOutcome struct {
+	ResourceType string                  `json:"resourceType"`
+	Issue        []OperationOutcomeIssue `json:"issue"`
+}
+
+// NewOperationOutcome returns an outcome with a single error issue. code
+// is from the FHIR issue-type value set, such as not-found or invalid.
+func NewOperationOutcome(code, diagnostics string) *OperationOutcome {
+	return &OperationOutcome{
+		ResourceType: "OperationOutcome",
+		Issue:        []OperationOutcomeIssue{{Severity: "error", Code: code, Diagnostics: diagnostics}},
+	}
+}
@@ -0,0 +1,433 @@
+package fhir
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/models"
+)
+
+// Search paging
+const (
+	DefaultCount = 50
+	MaxCount     = 100
+	// MaxSlotDays is the longest range of dates slots are listed for
+	MaxSlotDays = 62
+)
+
+// ParamError is a search parameter the server cannot use
+type ParamError struct {
+	Param string
+	Value string
+}
+
+func (e *ParamError) Error() string {
+	return fmt.Sprintf("Invalid Search Parameter %s=%s", e.Param, e.Value)
+}
+
+// Page is the window of results a search asks for
+type Page struct {
+	Count  int
+	Offset int
+}
+
+// ParsePage reads _count and _offset
+func ParsePage(q url.Values) (Page, error) {
+	page := Page{Count: DefaultCount}
+	if v := q.Get("_count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return page, &ParamError{"_count", v}
+		}
+		if n > MaxCount {
+			n = MaxCount
+		}
+		page.Count = n
+	}
+	if v := q.Get("_offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return page, &ParamError{"_offset", v}
+		}
+		page.Offset = n
+	}
+	return page, nil
+}
+
+// dateParam splits a date search value such as ge2026-01-01 into its SQL
+// operator and date
+func dateParam(name, value string) (string, string, error) {
+	op := "="
+	prefixes := map[string]string{"eq": "=", "ne": "<>", "gt": ">", "ge": ">=", "lt": "<", "le": "<="}
+	if len(value) > 2 {
+		if sql, ok := prefixes[value[:2]]; ok {
+			op = sql
+			value = value[2:]
+		}
+	}
+	if len(value) > 10 {
+		value = value[:10]
+	}
+	if _, err := time.Parse("2006-01-02", value); err != nil {
+		return "", "", &ParamError{name, value}
+	}
+	return op, value, nil
+}
+
+// whereDates applies every value of a date parameter to a column holding
+// YYYY-MM-DD dates, so date=ge2026-01-01&date=le2026-01-31 is a range
+func whereDates(query *gorm.DB, q url.Values, name, column string) (*gorm.DB, error) {
+	for _, value := range q[name] {
+		op, date, err := dateParam(name, value)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where(column+" "+op+" ?", date)
+	}
+	return query, nil
+}
+
+// reference strips the resource type from a reference search value
+func reference(value, resourceType string) string {
+	return strings.TrimPrefix(value, resourceType+"/")
+}
+
+// ids splits a comma separated _id
+func ids(value string) []string {
+	return strings.Split(value, ",")
+}
+
+// paginate counts the matches and limits the query to the page
+func paginate(query *gorm.DB, page Page) (*gorm.DB, int, error) {
+	var total int
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	return query.Offset(page.Offset).Limit(page.Count), total, nil
+}
+
+// SearchPatients supports _id, identifier, name, birthdate and gender
+func SearchPatients(db *gorm.DB, q url.Values, page Page) ([]models.Patient, int, error) {
+	query := db.Debug().Model(&models.Patient{})
+	if v := q.Get("_id"); v != "" {
+		query = query.Where("mrn IN (?)", ids(v))
+	}
+	if v := q.Get("identifier"); v != "" {
+		system, value := "", v
+		if i := strings.Index(v, "|"); i >= 0 {
+			system, value = v[:i], v[i+1:]
+		}
+		switch {
+		case system == "":
+			query = query.Where("mrn = ? OR national_id = ?", value, value)
+		case system == SystemMRN:
+			query = query.Where("mrn = ?", value)
+		case NationalIDType(system) != "":
+			query = query.Where("national_id_type = ? AND national_id = ?", NationalIDType(system), value)
+		default:
+			return nil, 0, &ParamError{"identifier", v}
+		}
+	}
+	if v := q.Get("name"); v != "" {
+		query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(v)+"%")
+	}
+	if v := q.Get("gender"); v != "" {
+		query = query.Where("sex = ?", Sex(v))
+	}
+	query, err := whereDates(query, q, "birthdate", "date_of_birth")
+	if err != nil {
+		return nil, 0, err
+	}
+	query, total, err := paginate(query, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	patients := []models.Patient{}
+	err = query.Preload("Phones").Order("mrn").Find(&patients).Error
+	return patients, total, err
+}
+
+// SearchPractitioners supports _id, identifier, name and active
+func SearchPractitioners(db *gorm.DB, q url.Values, page Page) ([]models.Employee, int, error) {
+	query := db.Debug().Model(&models.Employee{})
+	if v := q.Get("_id"); v != "" {
+		query = query.Where("employee_id IN (?)", ids(v))
+	}
+	if v := q.Get("identifier"); v != "" {
+		system, value := "", v
+		if i := strings.Index(v, "|"); i >= 0 {
+			system, value = v[:i], v[i+1:]
+		}
+		switch system {
+		case "":
+			if id, err := strconv.Atoi(value); err == nil {
+				query = query.Where("license_number = ? OR employee_id = ?", value, id)
+			} else {
+				query = query.Where("license_number = ?", value)
+			}
+		case SystemLicense:
+			query = query.Where("license_number = ?", value)
+		case SystemEmployee:
+			query = query.Where("employee_id = ?", value)
+		default:
+			return nil, 0, &ParamError{"identifier", v}
+		}
+	}
+	if v := q.Get("name"); v != "" {
+		query = query.Where("LOWER(name) LIKE ?", "%"+strings.ToLower(v)+"%")
+	}
+	if v := q.Get("active"); v != "" {
+		active, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, 0, &ParamError{"active", v}
+		}
+		query = query.Where("active = ?", active)
+	}
+	query, total, err := paginate(query, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	employees := []models.Employee{}
+	err = query.Preload("Specialty").Order("employee_id").Find(&employees).Error
+	return employees, total, err
+}
+
+// SearchAppointments supports _id, patient, practitioner, actor, date and
+// status
+func SearchAppointments(db *gorm.DB, q url.Values, page Page) ([]models.Appointment, int, error) {
+	query := db.Debug().Model(&models.Appointment{})
+	if v := q.Get("_id"); v != "" {
+		query = query.Where("appointment_id IN (?)", ids(v))
+	}
+	if v := q.Get("patient"); v != "" {
+		query = query.Where("mrn = ?", reference(v, "Patient"))
+	}
+	if v := q.Get("practitioner"); v != "" {
+		query = query.Where("employee_id = ?", reference(v, "Practitioner"))
+	}
+	if v := q.Get("actor"); v != "" {
+		switch {
+		case strings.HasPrefix(v, "Patient/"):
+			query = query.Where("mrn = ?", reference(v, "Patient"))
+		case strings.HasPrefix(v, "Practitioner/"):
+			query = query.Where("employee_id = ?", reference(v, "Practitioner"))
+		default:
+			return nil, 0, &ParamError{"actor", v}
+		}
+	}
+	if v := q.Get("status"); v != "" {
+		if v == "pending" {
+			query = query.Where("status NOT IN (?)", []string{models.AppointmentBooked, models.AppointmentCancelled, models.ExaminationCompleted})
+		} else if statuses := appointmentStatuses(v); statuses != nil {
+			query = query.Where("status IN (?)", statuses)
+		} else {
+			return nil, 0, &ParamError{"status", v}
+		}
+	}
+	query, err := whereDates(query, q, "date", "date")
+	if err != nil {
+		return nil, 0, err
+	}
+	query, total, err := paginate(query, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	appointments := []models.Appointment{}
+	err = query.Order("date desc").Order("start_time").Find(&appointments).Error
+	return appointments, total, err
+}
+
+// SearchSchedules supports _id
+func SearchSchedules(db *gorm.DB, q url.Values, page Page) ([]models.Schedule, int, error) {
+	query := db.Debug().Model(&models.Schedule{})
+	if v := q.Get("_id"); v != "" {
+		query = query.Where("schedule_code IN (?)", ids(v))
+	}
+	query, total, err := paginate(query, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	schedules := []models.Schedule{}
+	err = query.Order("schedule_code").Find(&schedules).Error
+	return schedules, total, err
+}
+
+// FindSlot returns the slot with the given id, or nil when there is no
+// such schedule or it is not held on that date
+func FindSlot(db *gorm.DB, id string) (*Slot, error) {
+	code, date, err := ParseSlotID(id)
+	if err != nil {
+		return nil, nil
+	}
+	schedule := models.Schedule{}
+	err = db.Debug().Model(&models.Schedule{}).Where("schedule_code = ?", code).Take(&schedule).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if day, ok := schedule.Weekday(); !ok || day != date.Weekday() {
+		return nil, nil
+	}
+	busy, err := bookedDates(db, code, date, date)
+	if err != nil {
+		return nil, err
+	}
+	return FromScheduleDate(&schedule, date, busy[date.Format("2006-01-02")]), nil
+}
+
+// bookedDates returns the dates between from and to on which a schedule
+// has a booking that is not cancelled
+func bookedDates(db *gorm.DB, code string, from, to time.Time) (map[string]bool, error) {
+	dates := []string{}
+	err := db.Debug().Model(&models.Appointment{}).
+		Where("schedule_code = ? AND date >= ? AND date <= ? AND status <> ?", code, from.Format("2006-01-02"), to.Format("2006-01-02"), models.AppointmentCancelled).
+		Pluck("date", &dates).Error
+	if err != nil {
+		return nil, err
+	}
+	busy := map[string]bool{}
+	for _, d := range dates {
+		busy[d] = true
+	}
+	return busy, nil
+}
+
+// SearchSlots lists the slots of a schedule. schedule is required; start
+// bounds the dates with ge/gt and le/lt and defaults to the next two weeks;
+// status filters free or busy slots.
+func SearchSlots(db *gorm.DB, q url.Values, now time.Time) ([]Slot, error) {
+	code := reference(q.Get("schedule"), "Schedule")
+	if code == "" {
+		return nil, &ParamError{"schedule", ""}
+	}
+	schedule := models.Schedule{}
+	if err := db.Debug().Model(&models.Schedule{}).Where("schedule_code = ?", code).Take(&schedule).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return []Slot{}, nil
+		}
+		return nil, err
+	}
+	weekday, ok := schedule.Weekday()
+	if !ok {
+		return []Slot{}, nil
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from, to := today, today.AddDate(0, 0, 13)
+	for _, value := range q["start"] {
+		op, date, err := dateParam("start", value)
+		if err != nil {
+			return nil, err
+		}
+		d, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+		switch op {
+		case "=":
+			from, to = d, d
+		case ">=":
+			from = d
+		case ">":
+			from = d.AddDate(0, 0, 1)
+		case "<=":
+			to = d
+		case "<":
+			to = d.AddDate(0, 0, -1)
+		default:
+			return nil, &ParamError{"start", value}
+		}
+	}
+	if to.Sub(from) > MaxSlotDays*24*time.Hour {
+		return nil, &ParamError{"start", fmt.Sprintf("range longer than %d days", MaxSlotDays)}
+	}
+
+	busy, err := bookedDates(db, code, from, to)
+	if err != nil {
+		return nil, err
+	}
+	status := q.Get("status")
+	slots := []Slot{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		if d.Weekday() != weekday {
+			continue
+		}
+		slot := FromScheduleDate(&schedule, d, busy[d.Format("2006-01-02")])
+		if status != "" && slot.Status != status {
+			continue
+		}
+		slots = append(slots, *slot)
+	}
+	return slots, nil
+}
+
+// SearchExaminations backs the Encounter, Condition and MedicationRequest
+// searches. It supports _id, encounter, patient, subject, practitioner,
+// date and, for encounters, status. require names a column that must be
+// filled in, diagnosis for conditions and prescription for medication
+// requests.
+func SearchExaminations(db *gorm.DB, q url.Values, page Page, require string) ([]models.Examination, int, error) {
+	query := db.Debug().Model(&models.Examination{})
+	if require != "" {
+		query = query.Where(require + " <> ''")
+	}
+	if v := q.Get("_id"); v != "" {
+		query = query.Where("examination_id IN (?)", ids(v))
+	}
+	if v := q.Get("encounter"); v != "" {
+		query = query.Where("examination_id = ?", reference(v, "Encounter"))
+	}
+	for _, name := range []string{"patient", "subject"} {
+		if v := q.Get(name); v != "" {
+			query = query.Where("mrn = ?", reference(v, "Patient"))
+		}
+	}
+	for _, name := range []string{"practitioner", "participant", "requester", "recorder"} {
+		if v := q.Get(name); v != "" {
+			query = query.Where("employee_id = ?", reference(v, "Practitioner"))
+		}
+	}
+	if require == "" {
+		switch v := q.Get("status"); v {
+		case "":
+		case "finished":
+			query = query.Where("status = ?", models.ExaminationCompleted)
+		case "in-progress":
+			query = query.Where("status <> ?", models.ExaminationCompleted)
+		default:
+			return nil, 0, &ParamError{"status", v}
+		}
+	}
+	for _, value := range q["date"] {
+		op, date, err := dateParam("date", value)
+		if err != nil {
+			return nil, 0, err
+		}
+		start, _ := time.ParseInLocation("2006-01-02", date, time.Local)
+		end := start.AddDate(0, 0, 1)
+		switch op {
+		case "=":
+			query = query.Where("created_at >= ? AND created_at < ?", start, end)
+		case "<>":
+			query = query.Where("created_at < ? OR created_at >= ?", start, end)
+		case ">":
+			query = query.Where("created_at >= ?", end)
+		case ">=":
+			query = query.Where("created_at >= ?", start)
+		case "<":
+			query = query.Where("created_at < ?", start)
+		case "<=":
+			query = query.Where("created_at < ?", end)
+		}
+	}
+	query, total, err := paginate(query, page)
+	if err != nil {
+		return nil, 0, err
+	}
+	examinations := []models.Examination{}
+	err = query.Order("created_at desc").Find(&examinations).Error
+	return examinations, total, err
+}
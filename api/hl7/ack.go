@@ -0,0 +1,107 @@
+package hl7
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Acknowledgement codes, MSA-1
+const (
+	AckAccept = "AA"
+	AckError  = "AE"
+	AckReject = "AR"
+)
+
+// Error codes from HL7 table 0357, ERR-3
+const (
+	ErrSegmentSequence        = "100"
+	ErrRequiredFieldMissing   = "101"
+	ErrDataType               = "102"
+	ErrUnsupportedMessageType = "200"
+	ErrUnsupportedEventCode   = "201"
+	ErrUnknownKey             = "204"
+	ErrDuplicateKey           = "205"
+	ErrApplication            = "207"
+)
+
+// Error is an error a handler answers with a negative acknowledgement.
+// Errors of other types are acknowledged AE with code 207.
+type Error struct {
+	Ack  string
+	Code string
+	Text string
+}
+
+func (e *Error) Error() string {
+	return e.Text
+}
+
+// Rejectf returns an AR error: the message will never be accepted, for
+// instance because its type is not supported
+func Rejectf(code, format string, args ...interface{}) *Error {
+	return &Error{Ack: AckReject, Code: code, Text: fmt.Sprintf(format, args...)}
+}
+
+// Errorf returns an AE error: the message was understood but could not be
+// applied, and may succeed if sent again later
+func Errorf(code, format string, args ...interface{}) *Error {
+	return &Error{Ack: AckError, Code: code, Text: fmt.Sprintf(format, args...)}
+}
+
+var ackSequence uint64
+
+// Ack builds the acknowledgement of a message. err is nil for AA.
+func Ack(m *Message, err error) []byte {
+	d := defaultDelimiters
+	if m != nil {
+		d = m.Delimiters
+	}
+	get := func(segment string, field, component int) string {
+		if m == nil {
+			return ""
+		}
+		return d.EscapeText(m.Get(segment, field, component))
+	}
+
+	code, hl7Code, text := AckAccept, "", ""
+	if err != nil {
+		code, hl7Code, text = AckError, ErrApplication, err.Error()
+		if e, ok := err.(*Error); ok {
+			code, hl7Code = e.Ack, e.Code
+		}
+	}
+
+	now := time.Now()
+	version := get("MSH", 12, 1)
+	if version == "" {
+		version = "2.5"
+	}
+	processing := get("MSH", 11, 1)
+	if processing == "" {
+		processing = "P"
+	}
+	controlID := fmt.Sprintf("%s%04d", now.Format("20060102150405"), atomic.AddUint64(&ackSequence, 1)%10000)
+	f := string(d.Field)
+	c := string(d.Component)
+	encoding := string([]byte{d.Component, d.Repetition, d.Escape, d.Subcomponent})
+
+	segments := []string{
+		strings.Join([]string{
+			"MSH", encoding,
+			get("MSH", 5, 0), get("MSH", 6, 0), get("MSH", 3, 0), get("MSH", 4, 0),
+			now.Format("20060102150405"), "",
+			"ACK" + c + get("MSH", 9, 2) + c + "ACK",
+			controlID, processing, version,
+		}, f),
+		strings.Join([]string{"MSA", code, get("MSH", 10, 0), d.EscapeText(text)}, f),
+	}
+	if err != nil {
+		severity := "E"
+		segments = append(segments, strings.Join([]string{
+			"ERR", "", "", hl7Code + c + c + "HL70357", severity, "", "", "", d.EscapeText(text),
+		}, f))
+	}
+	return []byte(strings.Join(segments, "\r") + "\r")
+}
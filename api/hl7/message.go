@@ -0,0 +1,181 @@
+// Package hl7 reads and answers HL7 v2 messages sent over MLLP, the framing
+// used by lab, radiology and other departmental systems.
+//
+// A listener can be tried by hand with netcat, wrapping the message in the
+// MLLP start and end bytes:
+//
+//	printf '\x0bMSH|^~\\&|LAB|RS|HMS|RS|20260112083000||ADT^A08|1|P|2.5\rPID|||MR123||Doe^Jane\r\x1c\r' | nc localhost 2575
+package hl7
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrNotHL7 is returned for data that does not start with an MSH segment
+var ErrNotHL7 = errors.New("Message Does Not Start With MSH")
+
+// Delimiters are the separators a message declares in MSH-1 and MSH-2
+type Delimiters struct {
+	Field        byte
+	Component    byte
+	Repetition   byte
+	Escape       byte
+	Subcomponent byte
+}
+
+// defaultDelimiters are the usual |^~\& separators
+var defaultDelimiters = Delimiters{Field: '|', Component: '^', Repetition: '~', Escape: '\\', Subcomponent: '&'}
+
+// Segment is one line of a message. Fields are numbered as in the HL7
+// standard, so Fields[3] is PID-3; for MSH, Fields[1] is the field
+// separator itself.
+type Segment struct {
+	Name   string
+	Fields []string
+}
+
+// Message is a parsed HL7 v2 message
+type Message struct {
+	Delimiters Delimiters
+	Segments   []Segment
+}
+
+// Parse reads a message. Segments may end in CR, LF or CRLF.
+func Parse(data []byte) (*Message, error) {
+	text := strings.Replace(string(data), "\r\n", "\r", -1)
+	text = strings.Replace(text, "\n", "\r", -1)
+	text = strings.TrimLeft(text, "\r")
+	if len(text) < 8 || !strings.HasPrefix(text, "MSH") {
+		return nil, ErrNotHL7
+	}
+
+	d := defaultDelimiters
+	d.Field = text[3]
+	encoding := text[4:]
+	if i := strings.IndexByte(encoding, d.Field); i >= 0 {
+		encoding = encoding[:i]
+	}
+	for i, c := range []*byte{&d.Component, &d.Repetition, &d.Escape, &d.Subcomponent} {
+		if i < len(encoding) {
+			*c = encoding[i]
+		}
+	}
+
+	msg := Message{Delimiters: d}
+	for _, line := range strings.Split(text, "\r") {
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, string(d.Field))
+		segment := Segment{Name: parts[0]}
+		if segment.Name == "MSH" {
+			segment.Fields = append([]string{"MSH", string(d.Field)}, parts[1:]...)
+		} else {
+			segment.Fields = parts
+		}
+		msg.Segments = append(msg.Segments, segment)
+	}
+	return &msg, nil
+}
+
+// Segment returns the first segment with the given name
+func (m *Message) Segment(name string) (*Segment, bool) {
+	for i := range m.Segments {
+		if m.Segments[i].Name == name {
+			return &m.Segments[i], true
+		}
+	}
+	return nil, false
+}
+
+// Field returns field n of the segment, or "" when it is absent
+func (s *Segment) Field(n int) string {
+	if s == nil || n >= len(s.Fields) {
+		return ""
+	}
+	return s.Fields[n]
+}
+
+// Get returns a component of the first repetition of a field, unescaped.
+// Component 0 returns the whole repetition.
+func (m *Message) Get(segment string, field, component int) string {
+	s, ok := m.Segment(segment)
+	if !ok {
+		return ""
+	}
+	value := s.Field(field)
+	if segment == "MSH" && field <= 2 {
+		return value
+	}
+	if i := strings.IndexByte(value, m.Delimiters.Repetition); i >= 0 {
+		value = value[:i]
+	}
+	return m.Unescape(m.Component(value, component))
+}
+
+// Repetitions returns the repetitions of a field, still escaped
+func (m *Message) Repetitions(segment string, field int) []string {
+	s, ok := m.Segment(segment)
+	if !ok || s.Field(field) == "" {
+		return nil
+	}
+	return strings.Split(s.Field(field), string(m.Delimiters.Repetition))
+}
+
+// Component returns component n, counted from 1, of a field value. 0
+// returns the value unchanged.
+func (m *Message) Component(value string, n int) string {
+	if n == 0 {
+		return value
+	}
+	parts := strings.Split(value, string(m.Delimiters.Component))
+	if n > len(parts) {
+		return ""
+	}
+	return parts[n-1]
+}
+
+// Unescape replaces the \F\, \S\, \T\, \R\ and \E\ escape sequences with
+// the separators they stand for
+func (m *Message) Unescape(value string) string {
+	e := string(m.Delimiters.Escape)
+	if !strings.Contains(value, e) {
+		return value
+	}
+	return strings.NewReplacer(
+		e+"F"+e, string(m.Delimiters.Field),
+		e+"S"+e, string(m.Delimiters.Component),
+		e+"T"+e, string(m.Delimiters.Subcomponent),
+		e+"R"+e, string(m.Delimiters.Repetition),
+		e+"E"+e, e,
+	).Replace(value)
+}
+
+// EscapeText is the reverse of Unescape, for text written into a message
+func (d Delimiters) EscapeText(value string) string {
+	e := string(d.Escape)
+	return strings.NewReplacer(
+		e, e+"E"+e,
+		string(d.Field), e+"F"+e,
+		string(d.Component), e+"S"+e,
+		string(d.Subcomponent), e+"T"+e,
+		string(d.Repetition), e+"R"+e,
+	).Replace(value)
+}
+
+// Type returns the message type and trigger event of MSH-9, such as ADT
+// and A08
+func (m *Message) Type() (string, string) {
+	return m.Get("MSH", 9, 1), m.Get("MSH", 9, 2)
+}
+
+// ControlID returns MSH-10, which the acknowledgement refers back to
+func (m *Message) ControlID() string {
+	return m.Get("MSH", 10, 0)
+}
+
+// Sender identifies the sending application and facility, MSH-3 and MSH-4
+func (m *Message) Sender() string {
+	return m.Get("MSH", 3, 1) + "^" + m.Get("MSH", 4, 1)
+}
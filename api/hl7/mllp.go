@@ -0,0 +1,201 @@
+package hl7
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// MLLP frame bytes
+const (
+	startBlock = 0x0b
+	endBlock   = 0x1c
+	carriage   = 0x0d
+)
+
+// MaxMessageSize bounds a single framed message
+var MaxMessageSize = 1 << 20
+
+// ErrFrameTooLarge is returned for messages larger than MaxMessageSize
+var ErrFrameTooLarge = errors.New("MLLP Frame Too Large")
+
+// WriteFrame writes a message in an MLLP frame
+func WriteFrame(w io.Writer, message []byte) error {
+	frame := make([]byte, 0, len(message)+3)
+	frame = append(frame, startBlock)
+	frame = append(frame, message...)
+	frame = append(frame, endBlock, carriage)
+	_, err := w.Write(frame)
+	return err
+}
+
+// ReadFrame reads the next framed message. Bytes before the start block
+// are skipped. A message larger than MaxMessageSize is read to its end and
+// dropped, so the next frame can still be read, and ErrFrameTooLarge is
+// returned.
+func ReadFrame(r *bufio.Reader) ([]byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b == startBlock {
+			break
+		}
+	}
+	var message bytes.Buffer
+	tooLarge := false
+	for {
+		b, err := r.ReadByte()
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+		if b == endBlock {
+			// The end block is followed by a carriage return, which some
+			// senders leave out
+			if next, err := r.Peek(1); err == nil && next[0] == carriage {
+				r.ReadByte()
+			}
+			if tooLarge {
+				return nil, ErrFrameTooLarge
+			}
+			return message.Bytes(), nil
+		}
+		if message.Len() >= MaxMessageSize {
+			tooLarge = true
+			message.Reset()
+		}
+		if !tooLarge {
+			message.WriteByte(b)
+		}
+	}
+}
+
+// HandlerFunc applies a message. The error it returns, if any, is sent
+// back as a negative acknowledgement.
+type HandlerFunc func(m *Message) error
+
+// Server accepts MLLP connections and acknowledges every message it
+// receives. Messages on one connection are handled in order.
+type Server struct {
+	Handler HandlerFunc
+	// IdleTimeout closes connections that send nothing for this long
+	IdleTimeout time.Duration
+
+	mu       sync.Mutex
+	listener net.Listener
+}
+
+// ListenAndServe listens on addr and serves until the listener is closed
+func (s *Server) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(listener)
+}
+
+// Serve accepts connections on listener
+func (s *Server) Serve(listener net.Listener) error {
+	s.mu.Lock()
+	s.listener = listener
+	s.mu.Unlock()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				time.Sleep(100 * time.Millisecond)
+				continue
+			}
+			return err
+		}
+		go s.serveConn(conn)
+	}
+}
+
+// Close stops accepting connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *Server) serveConn(conn net.Conn) {
+	defer conn.Close()
+	idle := s.IdleTimeout
+	if idle == 0 {
+		idle = 5 * time.Minute
+	}
+	reader := bufio.NewReader(conn)
+	for {
+		conn.SetReadDeadline(time.Now().Add(idle))
+		frame, err := ReadFrame(reader)
+		if err == ErrFrameTooLarge {
+			// The message cannot be parsed, so the rejection does not
+			// echo its control id
+			log.Printf("hl7: %s: %v", conn.RemoteAddr(), err)
+			conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+			if err = WriteFrame(conn, Ack(nil, Rejectf(ErrApplication, "Message Larger Than %d Bytes", MaxMessageSize))); err != nil {
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("hl7: %s: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		conn.SetWriteDeadline(time.Now().Add(30 * time.Second))
+		if err = WriteFrame(conn, s.handle(frame)); err != nil {
+			log.Printf("hl7: %s: %v", conn.RemoteAddr(), err)
+			return
+		}
+	}
+}
+
+// handle parses and applies one message and returns its acknowledgement. A
+// panicking handler is answered AE rather than dropping the connection.
+func (s *Server) handle(frame []byte) (ack []byte) {
+	m, err := Parse(frame)
+	if err != nil {
+		return Ack(nil, Rejectf(ErrSegmentSequence, "%s", err.Error()))
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("hl7: handler panic on %s: %v", m.ControlID(), r)
+			ack = Ack(m, Errorf(ErrApplication, "Internal Error"))
+		}
+	}()
+	return Ack(m, s.Handler(m))
+}
+
+// Send delivers a message to an MLLP listener and returns its
+// acknowledgement
+func Send(addr string, message []byte, timeout time.Duration) (*Message, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err = WriteFrame(conn, message); err != nil {
+		return nil, err
+	}
+	frame, err := ReadFrame(bufio.NewReader(conn))
+	if err != nil {
+		return nil, err
+	}
+	return Parse(frame)
+}
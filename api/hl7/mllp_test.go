@@ -0,0 +1,136 @@
+package hl7
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer runs an MLLP listener on a free local port with a handler
+// that accepts ADT messages and rejects every other type
+func startServer(t *testing.T) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &Server{Handler: func(m *Message) error {
+		switch messageType, _ := m.Type(); messageType {
+		case "ADT":
+			if m.Get("PID", 3, 1) == "" {
+				return Errorf(ErrRequiredFieldMissing, "Required PID-3")
+			}
+			return nil
+		case "ORU":
+			return errors.New("Database Unavailable")
+		case "SIU":
+			panic("handler bug")
+		}
+		return Rejectf(ErrUnsupportedMessageType, "Unsupported Message Type")
+	}}
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String()
+}
+
+func message(messageType, pid string) []byte {
+	return []byte(strings.Join([]string{
+		"MSH|^~\\&|LAB|HOSP|HMS|CLINIC|20240101120000||" + messageType + "|MSG0001|P|2.5",
+		"PID|||" + pid,
+	}, "\r"))
+}
+
+func TestSendAcknowledgements(t *testing.T) {
+	addr := startServer(t)
+
+	tests := []struct {
+		name    string
+		message []byte
+		ack     string
+		code    string
+	}{
+		{"accepted", message("ADT^A01", "MR000000018^^^^MR"), AckAccept, ""},
+		{"application error", message("ADT^A01", ""), AckError, ErrRequiredFieldMissing},
+		{"plain handler error", message("ORU^R01", "MR000000018"), AckError, ErrApplication},
+		{"handler panic", message("SIU^S12", "MR000000018"), AckError, ErrApplication},
+		{"unsupported type", message("MDM^T02", "MR000000018"), AckReject, ErrUnsupportedMessageType},
+		{"parse error", []byte("this is not HL7"), AckReject, ErrSegmentSequence},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ack, err := Send(addr, tt.message, 5*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := ack.Get("MSA", 1, 1); got != tt.ack {
+				t.Errorf("MSA-1 = %q, want %q", got, tt.ack)
+			}
+			if got := ack.Get("ERR", 3, 1); got != tt.code {
+				t.Errorf("ERR-3 = %q, want %q", got, tt.code)
+			}
+			if tt.ack != AckReject || tt.code != ErrSegmentSequence {
+				if got := ack.Get("MSA", 2, 1); got != "MSG0001" {
+					t.Errorf("MSA-2 = %q, want the control id MSG0001", got)
+				}
+			}
+		})
+	}
+}
+
+func TestSendOversizedFrame(t *testing.T) {
+	saved := MaxMessageSize
+	MaxMessageSize = 256
+	defer func() { MaxMessageSize = saved }()
+	addr := startServer(t)
+
+	large := append(message("ADT^A01", "MR000000018"), []byte("\rNTE|1||"+strings.Repeat("x", 1024))...)
+	ack, err := Send(addr, large, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ack.Get("MSA", 1, 1); got != AckReject {
+		t.Errorf("MSA-1 = %q, want %q", got, AckReject)
+	}
+	if got := ack.Get("ERR", 3, 1); got != ErrApplication {
+		t.Errorf("ERR-3 = %q, want %q", got, ErrApplication)
+	}
+}
+
+func TestOversizedFrameKeepsConnection(t *testing.T) {
+	saved := MaxMessageSize
+	MaxMessageSize = 256
+	defer func() { MaxMessageSize = saved }()
+	addr := startServer(t)
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	large := append(message("ADT^A01", "MR000000018"), []byte("\rNTE|1||"+strings.Repeat("x", 1024))...)
+	if err = WriteFrame(conn, large); err != nil {
+		t.Fatal(err)
+	}
+	if err = WriteFrame(conn, message("ADT^A01", "MR000000018")); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	for _, want := range []string{AckReject, AckAccept} {
+		frame, err := ReadFrame(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ack, err := Parse(frame)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := ack.Get("MSA", 1, 1); got != want {
+			t.Errorf("MSA-1 = %q, want %q", got, want)
+		}
+	}
+}
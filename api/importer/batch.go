@@ -0,0 +1,144 @@
+package importer
+
+import (
+	"sort"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/utils/formaterror"
+)
+
+// DefaultBatchSize is how many rows are committed per transaction
+const DefaultBatchSize = 100
+
+// Record is a row decoded into a model, ready to be saved
+type Record struct {
+	Row   int
+	Value interface{}
+}
+
+// RowError is a row that was not imported and why
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// Created is a row that was imported and the key it was saved under
+type Created struct {
+	Row int    `json:"row"`
+	Key string `json:"key"`
+}
+
+// Result reports on an import. In a dry run Imported counts the rows that
+// would have been imported.
+type Result struct {
+	Resource string     `json:"resource"`
+	DryRun   bool       `json:"dry_run"`
+	Rows     int        `json:"rows"`
+	Imported int        `json:"imported"`
+	Failed   int        `json:"failed"`
+	Errors   []RowError `json:"errors"`
+	Created  []Created  `json:"created,omitempty"`
+}
+
+// Fail records a row that will not be imported
+func (res *Result) Fail(row int, err error) {
+	res.Failed++
+	res.Errors = append(res.Errors, RowError{Row: row, Error: err.Error()})
+}
+
+// Importer saves records in batches. Each batch is one transaction, and each
+// row runs under a savepoint so a row the database refuses does not take the
+// rest of its batch with it. A dry run does the same work and rolls every
+// batch back, so it also reports conflicts with existing data.
+type Importer struct {
+	DB        *gorm.DB
+	BatchSize int
+	DryRun    bool
+	// Check runs inside the transaction before a record is saved
+	Check func(tx *gorm.DB, value interface{}) error
+	// Key names a saved record in the result
+	Key func(value interface{}) string
+}
+
+// Run saves records and adds the outcome of each to res
+func (im *Importer) Run(res *Result, records []Record) error {
+	size := im.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	res.DryRun = im.DryRun
+	for start := 0; start < len(records); start += size {
+		end := start + size
+		if end > len(records) {
+			end = len(records)
+		}
+		if err := im.batch(res, records[start:end]); err != nil {
+			return err
+		}
+	}
+	sort.Slice(res.Errors, func(i, j int) bool { return res.Errors[i].Row < res.Errors[j].Row })
+	return nil
+}
+
+func (im *Importer) batch(res *Result, records []Record) (err error) {
+
+	tx := im.DB.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err = tx.Error; err != nil {
+		return err
+	}
+
+	created := []Created{}
+	for _, record := range records {
+		if err = im.save(tx, record.Value); err != nil {
+			res.Fail(record.Row, formaterror.FormatError(err.Error()))
+			continue
+		}
+		key := ""
+		if im.Key != nil {
+			key = im.Key(record.Value)
+		}
+		created = append(created, Created{Row: record.Row, Key: key})
+	}
+
+	if im.DryRun {
+		tx.Rollback()
+		res.Imported += len(created)
+		return nil
+	}
+	if err = tx.Commit().Error; err != nil {
+		for _, c := range created {
+			res.Fail(c.Row, err)
+		}
+		return nil
+	}
+	res.Imported += len(created)
+	res.Created = append(res.Created, created...)
+	return nil
+}
+
+// save creates one record under a savepoint
+func (im *Importer) save(tx *gorm.DB, value interface{}) error {
+	if err := tx.Exec("SAVEPOINT import_row").Error; err != nil {
+		return err
+	}
+	var err error
+	if im.Check != nil {
+		err = im.Check(tx, value)
+	}
+	if err == nil {
+		err = tx.Debug().Create(value).Error
+	}
+	if err != nil {
+		tx.Exec("ROLLBACK TO SAVEPOINT import_row")
+		return err
+	}
+	return tx.Exec("RELEASE SAVEPOINT import_row").Error
+}
@@ -0,0 +1,132 @@
+// Package importer loads records in bulk from CSV files. The header row
+// names the columns by the same keys the JSON API uses, so a file can be
+// prepared from any existing response.
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// MaxRows bounds the number of data rows in one file
+var MaxRows = 5000
+
+// ErrEmptyFile is returned for a file without a header row
+var ErrEmptyFile = errors.New("CSV File Is Empty")
+
+// Row is one data row of a file, keyed by column. Number counts data rows
+// from 1, not including the header.
+type Row struct {
+	Number int
+	Values map[string]string
+}
+
+// ReadCSV reads a file whose first row is the header. Every column must be
+// one of columns. Blank rows are skipped.
+func ReadCSV(r io.Reader, columns []string) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, ErrEmptyFile
+	}
+	if err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	for _, c := range columns {
+		known[c] = true
+	}
+	seen := map[string]bool{}
+	for i, name := range header {
+		if i == 0 {
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !known[name] {
+			return nil, fmt.Errorf("Unknown Column %q, Expected Some Of %s", name, strings.Join(columns, ", "))
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("Duplicate Column %q", name)
+		}
+		seen[name] = true
+		header[i] = name
+	}
+
+	rows := []Row{}
+	for number := 1; ; number++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) > len(header) {
+			return nil, fmt.Errorf("Row %d Has %d Values For %d Columns", number, len(record), len(header))
+		}
+		row := Row{Number: number, Values: map[string]string{}}
+		blank := true
+		for i, value := range record {
+			value = strings.TrimSpace(value)
+			if value != "" {
+				blank = false
+			}
+			row.Values[header[i]] = value
+		}
+		if blank {
+			continue
+		}
+		if len(rows) == MaxRows {
+			return nil, fmt.Errorf("CSV File Has More Than %d Rows", MaxRows)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// Decode copies the values of a row into the fields of the struct dst
+// points to, matching columns to the fields' json names. Empty values leave
+// a field at its zero value.
+func Decode(row Row, dst interface{}) error {
+	v := reflect.ValueOf(dst).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		value, ok := row.Values[name]
+		if !ok || value == "" || name == "" || name == "-" {
+			continue
+		}
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(value)
+		case reflect.Int, reflect.Int32, reflect.Int64:
+			n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("Invalid %s", name)
+			}
+			field.SetInt(n)
+		case reflect.Uint, reflect.Uint32, reflect.Uint64:
+			n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+			if err != nil {
+				return fmt.Errorf("Invalid %s", name)
+			}
+			field.SetUint(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("Invalid %s", name)
+			}
+			field.SetBool(b)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,431 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Admission statuses
+const (
+	AdmissionActive     = "admitted"
+	AdmissionDischarged = "discharged"
+)
+
+// Bed stay kinds
+const (
+	StayAdmit    = "admit"
+	StayTransfer = "transfer"
+)
+
+// Admission is an inpatient stay of a patient, from admission to discharge.
+// BedID and WardID point at the current bed; the beds occupied over time
+// are kept as BedStays.
+type Admission struct {
+	ID           uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	MRN          string     `gorm:"size:20;not null;index" json:"mrn"`
+	BedID        uint32     `gorm:"not null" json:"bed_id"`
+	WardID       uint32     `gorm:"not null;index" json:"ward_id"`
+	AdmittedBy   int        `gorm:"not null" json:"admitted_by"`
+	AttendingID  int        `json:"attending_id"`
+	Reason       string     `gorm:"size:255;not null" json:"reason"`
+	Status       string     `gorm:"size:20;not null;index" json:"status"`
+	AdmittedAt   time.Time  `gorm:"not null" json:"admitted_at"`
+	DischargedAt *time.Time `json:"discharged_at"`
+	DischargedBy int        `json:"discharged_by"`
+	Disposition  string     `gorm:"size:100" json:"disposition"`
+	Stays        []BedStay  `gorm:"foreignkey:AdmissionID" json:"stays,omitempty"`
+}
+
+// BedStay is the time an admitted patient spent in one bed. ToTime is nil
+// for the bed the patient is in now.
+type BedStay struct {
+	ID          uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	AdmissionID uint32     `gorm:"not null;index" json:"admission_id"`
+	BedID       uint32     `gorm:"not null;index" json:"bed_id"`
+	WardID      uint32     `gorm:"not null;index" json:"ward_id"`
+	Kind        string     `gorm:"size:20;not null" json:"kind"`
+	EmployeeID  int        `gorm:"not null" json:"employee_id"`
+	FromTime    time.Time  `gorm:"not null;index" json:"from_time"`
+	ToTime      *time.Time `gorm:"index" json:"to_time"`
+}
+
+// CensusEntry is a patient in a bed at the census time
+type CensusEntry struct {
+	AdmissionID uint32    `json:"admission_id"`
+	MRN         string    `json:"mrn"`
+	Name        string    `json:"name"`
+	BedID       uint32    `json:"bed_id"`
+	AdmittedAt  time.Time `json:"admitted_at"`
+}
+
+// WardCensus lists the patients in a ward at a point in time
+type WardCensus struct {
+	Ward     Ward          `json:"ward"`
+	Beds     int           `json:"beds"`
+	Occupied int           `json:"occupied"`
+	Patients []CensusEntry `json:"patients"`
+}
+
+// Census is the inpatient census of every ward at a point in time
+type Census struct {
+	At    time.Time    `json:"at"`
+	Total int          `json:"total"`
+	Wards []WardCensus `json:"wards"`
+}
+
+// Validate ...
+func (a *Admission) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case "transfer":
+		if a.BedID == 0 {
+			return errors.New("Required Bed ID")
+		}
+		return nil
+
+	default:
+		if a.MRN == "" {
+			return errors.New("Required MRN")
+		}
+		if a.BedID == 0 {
+			return errors.New("Required Bed ID")
+		}
+		if a.Reason == "" {
+			return errors.New("Required Reason")
+		}
+		return nil
+	}
+}
+
+// Admit places a patient in a free bed
+func (a *Admission) Admit(db *gorm.DB) (*Admission, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	patient := Patient{}
+	if _, err := patient.FindPatientByMRN(tx, a.MRN); err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if patient.MergedInto != "" {
+		tx.Rollback()
+		return &Admission{}, errors.New("Patient Has Been Merged Into " + patient.MergedInto)
+	}
+	var current int
+	err := tx.Debug().Model(&Admission{}).Where("mrn = ? AND status = ?", a.MRN, AdmissionActive).Count(&current).Error
+	if err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if current > 0 {
+		tx.Rollback()
+		return &Admission{}, errors.New("Patient Is Already Admitted")
+	}
+	if a.AttendingID != 0 {
+		attending := Employee{}
+		if _, err = attending.FindEmployeeByID(tx, a.AttendingID); err != nil || !attending.Active {
+			tx.Rollback()
+			return &Admission{}, errors.New("Attending Employee Not Found")
+		}
+	}
+
+	bed, err := lockBed(tx, a.BedID)
+	if err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if bed.Status != BedFree {
+		tx.Rollback()
+		return &Admission{}, errors.New("Bed Is Not Free")
+	}
+
+	now := time.Now()
+	a.ID = 0
+	a.WardID = bed.WardID
+	a.Status = AdmissionActive
+	a.AdmittedAt = now
+	a.DischargedAt = nil
+	a.DischargedBy = 0
+	a.Stays = nil
+	if err = tx.Debug().Create(&a).Error; err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	stay := BedStay{AdmissionID: a.ID, BedID: bed.ID, WardID: bed.WardID, Kind: StayAdmit, EmployeeID: a.AdmittedBy, FromTime: now}
+	if err = tx.Debug().Create(&stay).Error; err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if err = setBedStatus(tx, bed.ID, BedOccupied); err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &Admission{}, err
+	}
+	a.Stays = []BedStay{stay}
+	return a, nil
+}
+
+// lockAdmission loads an active admission with a row lock inside tx
+func lockAdmission(tx *gorm.DB, id uint32) (*Admission, error) {
+	admission := Admission{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Admission{}).Where("id = ?", id).Take(&admission).Error
+	if err != nil {
+		return &Admission{}, errors.New("Admission Not Found")
+	}
+	if admission.Status != AdmissionActive {
+		return &Admission{}, errors.New("Patient Has Already Been Discharged")
+	}
+	return &admission, nil
+}
+
+// leaveBed ends the admission's current bed stay and sends the bed to be
+// cleaned
+func leaveBed(tx *gorm.DB, admission *Admission, now time.Time) error {
+	err := tx.Debug().Model(&BedStay{}).Where("admission_id = ? AND to_time IS NULL", admission.ID).UpdateColumn("to_time", now).Error
+	if err != nil {
+		return err
+	}
+	return setBedStatus(tx, admission.BedID, BedCleaning)
+}
+
+// Transfer moves an admitted patient to another free bed, in the same ward
+// or another one
+func (a *Admission) Transfer(db *gorm.DB, id, bedID uint32, employeeID int) (*Admission, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	admission, err := lockAdmission(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if admission.BedID == bedID {
+		tx.Rollback()
+		return &Admission{}, errors.New("Patient Is Already In That Bed")
+	}
+	bed, err := lockBed(tx, bedID)
+	if err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if bed.Status != BedFree {
+		tx.Rollback()
+		return &Admission{}, errors.New("Bed Is Not Free")
+	}
+
+	now := time.Now()
+	if err = leaveBed(tx, admission, now); err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	stay := BedStay{AdmissionID: admission.ID, BedID: bed.ID, WardID: bed.WardID, Kind: StayTransfer, EmployeeID: employeeID, FromTime: now}
+	if err = tx.Debug().Create(&stay).Error; err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if err = setBedStatus(tx, bed.ID, BedOccupied); err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	err = tx.Debug().Model(&Admission{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"bed_id":  bed.ID,
+			"ward_id": bed.WardID,
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &Admission{}, err
+	}
+	return a.FindAdmissionByID(db, id)
+}
+
+// Discharge ends an admission and frees the bed for cleaning
+func (a *Admission) Discharge(db *gorm.DB, id uint32, employeeID int, disposition string) (*Admission, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	admission, err := lockAdmission(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	if _, err = lockBed(tx, admission.BedID); err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+
+	now := time.Now()
+	if err = leaveBed(tx, admission, now); err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+	err = tx.Debug().Model(&Admission{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"status":        AdmissionDischarged,
+			"discharged_at": now,
+			"discharged_by": employeeID,
+			"disposition":   disposition,
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &Admission{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &Admission{}, err
+	}
+	return a.FindAdmissionByID(db, id)
+}
+
+// FindAdmissionByID returns an admission with its bed history
+func (a *Admission) FindAdmissionByID(db *gorm.DB, id uint32) (*Admission, error) {
+	err := db.Debug().Model(&Admission{}).Preload("Stays", func(db *gorm.DB) *gorm.DB {
+		return db.Order("from_time")
+	}).Where("id = ?", id).Take(&a).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Admission{}, errors.New("Admission Not Found")
+	}
+	if err != nil {
+		return &Admission{}, err
+	}
+	return a, nil
+}
+
+// FindAdmissions returns admissions, optionally only those of a patient or
+// with a status
+func (a *Admission) FindAdmissions(db *gorm.DB, mrn, status string) (*[]Admission, error) {
+	var err error
+	admissions := []Admission{}
+	query := db.Debug().Model(&Admission{})
+	if mrn != "" {
+		query = query.Where("mrn = ?", mrn)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Order("admitted_at desc").Limit(100).Find(&admissions).Error
+	if err != nil {
+		return &[]Admission{}, err
+	}
+	return &admissions, err
+}
+
+// BuildCensus lists who was in which bed at the given time, per ward, from
+// the bed stay history. A wardID of zero includes every ward.
+func BuildCensus(db *gorm.DB, at time.Time, wardID uint32) (*Census, error) {
+	wards := []Ward{}
+	query := db.Debug().Model(&Ward{})
+	if wardID != 0 {
+		query = query.Where("id = ?", wardID)
+	}
+	if err := query.Order("name").Find(&wards).Error; err != nil {
+		return &Census{}, err
+	}
+	if wardID != 0 && len(wards) == 0 {
+		return &Census{}, errors.New("Ward Not Found")
+	}
+
+	stays := []BedStay{}
+	query = db.Debug().Model(&BedStay{}).Where("from_time <= ? AND (to_time IS NULL OR to_time > ?)", at, at)
+	if wardID != 0 {
+		query = query.Where("ward_id = ?", wardID)
+	}
+	if err := query.Find(&stays).Error; err != nil {
+		return &Census{}, err
+	}
+
+	admissionIDs := []uint32{}
+	for _, s := range stays {
+		admissionIDs = append(admissionIDs, s.AdmissionID)
+	}
+	admissions := map[uint32]Admission{}
+	names := map[string]string{}
+	if len(admissionIDs) > 0 {
+		found := []Admission{}
+		if err := db.Debug().Model(&Admission{}).Where("id IN (?)", admissionIDs).Find(&found).Error; err != nil {
+			return &Census{}, err
+		}
+		mrns := []string{}
+		for _, adm := range found {
+			admissions[adm.ID] = adm
+			mrns = append(mrns, adm.MRN)
+		}
+		patients := []Patient{}
+		if err := db.Debug().Model(&Patient{}).Select("mrn, name").Where("mrn IN (?)", mrns).Find(&patients).Error; err != nil {
+			return &Census{}, err
+		}
+		for _, p := range patients {
+			names[p.MRN] = p.Name
+		}
+	}
+
+	census := Census{At: at, Wards: []WardCensus{}}
+	for _, ward := range wards {
+		wc := WardCensus{Ward: ward, Patients: []CensusEntry{}}
+		if err := db.Debug().Model(&Bed{}).Where("ward_id = ? AND created_at <= ?", ward.ID, at).Count(&wc.Beds).Error; err != nil {
+			return &Census{}, err
+		}
+		for _, s := range stays {
+			if s.WardID != ward.ID {
+				continue
+			}
+			adm := admissions[s.AdmissionID]
+			wc.Patients = append(wc.Patients, CensusEntry{
+				AdmissionID: adm.ID,
+				MRN:         adm.MRN,
+				Name:        names[adm.MRN],
+				BedID:       s.BedID,
+				AdmittedAt:  adm.AdmittedAt,
+			})
+		}
+		sort.SliceStable(wc.Patients, func(i, j int) bool {
+			return wc.Patients[i].BedID < wc.Patients[j].BedID
+		})
+		wc.Occupied = len(wc.Patients)
+		census.Total += wc.Occupied
+		census.Wards = append(census.Wards, wc)
+	}
+	return &census, nil
+}
@@ -12,8 +12,9 @@ import (
 type Appointment struct {
 	AppointmentID uint32    `gorm:"primary_key;auto_increment" json:"apointment_id"`
 	ScheduleCode  string    `gorm:"not null" json:"schedule_code"`
-	SSN           int       `gorm:"not null" json:"ssn"`
+	MRN           string    `gorm:"size:20;index" json:"mrn"`
 	EmployeeID    int       `gorm:"not null" json:"employee_id"`
+	Date          string    `gorm:"size:10" json:"date"`
 	StartTime     string    `gorm:"size:100;not null;" json:"start_time"`
 	EndTime       string    `gorm:"size:100;not null;" json:"end_time"`
 	Status        string    `gorm:"default:'available'" json:"status"`
@@ -21,9 +22,52 @@ type Appointment struct {
 	UpdatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
+// Appointment statuses
+const (
+	AppointmentBooked    = "booked"
+	AppointmentCancelled = "cancelled"
+	AppointmentCompleted = "completed"
+)
+
+// Booking policy for patients managing their own appointments
+var (
+	BookingLeadTime    = 2 * time.Hour
+	BookingWindow      = 60 * 24 * time.Hour
+	CancellationCutoff = 24 * time.Hour
+)
+
+// scheduleWeekdays maps the day names used on schedules to weekdays
+var scheduleWeekdays = map[string]time.Weekday{
+	"senin":  time.Monday,
+	"selasa": time.Tuesday,
+	"rabu":   time.Wednesday,
+	"kamis":  time.Thursday,
+	"jumat":  time.Friday,
+	"sabtu":  time.Saturday,
+	"minggu": time.Sunday,
+}
+
 // Validate ...
 func (a *Appointment) Validate(action string) error {
 	switch strings.ToLower(action) {
+	case "booking":
+		if a.ScheduleCode == "" {
+			return errors.New("Required Schedule")
+		}
+		if a.EmployeeID == 0 {
+			return errors.New("Required Employee ID")
+		}
+		if a.MRN == "" {
+			return errors.New("Required MRN")
+		}
+		if a.Date == "" {
+			return errors.New("Required Date")
+		}
+		if _, err := time.ParseInLocation("2006-01-02", a.Date, time.Local); err != nil {
+			return errors.New("Invalid Date")
+		}
+		return nil
+
 	case "update":
 		if a.AppointmentID == 0 {
 			return errors.New("Required Appointment ID")
@@ -37,8 +81,11 @@ func (a *Appointment) Validate(action string) error {
 		if a.EndTime == "" {
 			return errors.New("Required End Time")
 		}
-		if a.SSN == 0 {
-			return errors.New("Required SSN")
+		if a.MRN == "" {
+			return errors.New("Required MRN")
+		}
+		if _, err := a.ScheduledAt(); err != nil {
+			return errors.New("Invalid Date")
 		}
 		return nil
 
@@ -55,13 +102,28 @@ func (a *Appointment) Validate(action string) error {
 		if a.EndTime == "" {
 			return errors.New("Required End Time")
 		}
-		if a.SSN == 0 {
-			return errors.New("Required SSN")
+		if a.MRN == "" {
+			return errors.New("Required MRN")
+		}
+		if _, err := a.ScheduledAt(); err != nil {
+			return errors.New("Invalid Date")
 		}
 		return nil
 	}
 }
 
+// ScheduledAt combines Date and StartTime. Appointments booked without a
+// date fall back to the time they were created.
+func (a *Appointment) ScheduledAt() (time.Time, error) {
+	if a.Date == "" {
+		return a.CreatedAt, nil
+	}
+	if a.StartTime == "" {
+		return time.ParseInLocation("2006-01-02", a.Date, time.Local)
+	}
+	return time.ParseInLocation("2006-01-02 15:04", a.Date+" "+a.StartTime, time.Local)
+}
+
 // SaveAppointment ...
 func (a *Appointment) SaveAppointment(db *gorm.DB) (*Appointment, error) {
 
@@ -84,6 +146,150 @@ func (a *Appointment) FindAllAppointment(db *gorm.DB) (*[]Appointment, error) {
 	return &appointments, err
 }
 
+// FindAppointmentsByMRN ...
+func (a *Appointment) FindAppointmentsByMRN(db *gorm.DB, mrn string) (*[]Appointment, error) {
+	var err error
+	appointments := []Appointment{}
+	err = db.Debug().Model(&Appointment{}).Where("mrn = ?", mrn).Find(&appointments).Error
+	if err != nil {
+		return &[]Appointment{}, err
+	}
+	return &appointments, err
+}
+
+// Book reserves a schedule slot on a date for a patient. The slot times are
+// taken from the schedule, whose day must match the date, and the booking
+// must fall inside the booking window.
+func (a *Appointment) Book(db *gorm.DB, now time.Time) (*Appointment, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return &Appointment{}, err
+	}
+
+	booked, err := a.book(tx, now)
+	if err != nil {
+		tx.Rollback()
+		return &Appointment{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &Appointment{}, err
+	}
+	return booked, nil
+}
+
+// book is Book within a transaction the caller already holds. The schedule
+// row stays locked until it ends, so two bookings of one slot cannot both
+// find it free.
+func (a *Appointment) book(tx *gorm.DB, now time.Time) (*Appointment, error) {
+
+	schedule := Schedule{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Schedule{}).Where("schedule_code = ?", a.ScheduleCode).Take(&schedule).Error
+	if err != nil {
+		return &Appointment{}, errors.New("Schedule Not Found")
+	}
+	date, _ := time.ParseInLocation("2006-01-02", a.Date, time.Local)
+	if day, ok := scheduleWeekdays[strings.ToLower(schedule.Day)]; !ok || day != date.Weekday() {
+		return &Appointment{}, errors.New("Schedule Is Not Held On That Date")
+	}
+
+	a.StartTime = schedule.StartTime
+	a.EndTime = schedule.EndTime
+	at, err := a.ScheduledAt()
+	if err != nil {
+		return &Appointment{}, errors.New("Invalid Schedule Time")
+	}
+	if at.Before(now.Add(BookingLeadTime)) {
+		return &Appointment{}, errors.New("Appointment Is Too Soon To Book")
+	}
+	if at.After(now.Add(BookingWindow)) {
+		return &Appointment{}, errors.New("Appointment Is Too Far Ahead To Book")
+	}
+
+	doctor := Employee{}
+	err = tx.Debug().Model(&Employee{}).Where("employee_id = ? AND active = ?", a.EmployeeID, true).Take(&doctor).Error
+	if err != nil {
+		return &Appointment{}, errors.New("Doctor Not Found")
+	}
+
+	// A schedule holds one appointment a day, whichever doctor it names
+	var taken int
+	err = tx.Debug().Model(&Appointment{}).
+		Where("schedule_code = ? AND date = ? AND status <> ?", a.ScheduleCode, a.Date, AppointmentCancelled).
+		Count(&taken).Error
+	if err != nil {
+		return &Appointment{}, err
+	}
+	if taken > 0 {
+		return &Appointment{}, errors.New("Slot Already Booked")
+	}
+
+	a.AppointmentID = 0
+	a.Status = AppointmentBooked
+	return a.SaveAppointment(tx)
+}
+
+// Cancel cancels a patient's own booking, which is only allowed up to
+// CancellationCutoff before the appointment
+func (a *Appointment) Cancel(db *gorm.DB, aid uint32, mrn string, now time.Time) (*Appointment, error) {
+
+	if _, err := a.FindAppointmentByID(db, aid); err != nil || a.MRN != mrn {
+		return &Appointment{}, errors.New("Appointment Not Found")
+	}
+	if a.Status != AppointmentBooked {
+		return &Appointment{}, errors.New("Only Booked Appointments Can Be Cancelled")
+	}
+	at, err := a.ScheduledAt()
+	if err != nil {
+		return &Appointment{}, err
+	}
+	if at.Before(now.Add(CancellationCutoff)) {
+		return &Appointment{}, errors.New("Too Late To Cancel, Please Contact The Clinic")
+	}
+
+	err = db.Debug().Model(&Appointment{}).Where("appointment_id = ?", aid).UpdateColumns(
+		map[string]interface{}{
+			"status":     AppointmentCancelled,
+			"updated_at": now,
+		},
+	).Error
+	if err != nil {
+		return &Appointment{}, err
+	}
+	a.Status = AppointmentCancelled
+	return a, nil
+}
+
+// SetStatus changes the status of an appointment without the patient
+// self-service rules, for staff and feeding systems
+func (a *Appointment) SetStatus(db *gorm.DB, aid uint32, status string) (*Appointment, error) {
+
+	if _, err := a.FindAppointmentByID(db, aid); err != nil {
+		return &Appointment{}, errors.New("Appointment Not Found")
+	}
+	if a.Status == status {
+		return a, nil
+	}
+	err := db.Debug().Model(&Appointment{}).Where("appointment_id = ?", aid).UpdateColumns(
+		map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &Appointment{}, err
+	}
+	a.Status = status
+	return a, nil
+}
+
 // FindAppointmentByID ...
 func (a *Appointment) FindAppointmentByID(db *gorm.DB, aid uint32) (*Appointment, error) {
 	var err error
@@ -116,8 +322,9 @@ func (a *Appointment) UpdateAppointment(db *gorm.DB, aid uint32) (*Appointment,
 		map[string]interface{}{
 			"appointment_id": a.AppointmentID,
 			"schedule_code":  a.ScheduleCode,
-			"ssn":            a.SSN,
+			"mrn":            a.MRN,
 			"employee_id":    a.EmployeeID,
+			"date":           a.Date,
 			"status":         a.Status,
 			"updated_at":     time.Now(),
 		},
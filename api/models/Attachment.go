@@ -0,0 +1,154 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Attachment kinds
+const (
+	AttachmentScan   = "scan"
+	AttachmentPhoto  = "photo"
+	AttachmentReport = "report"
+	AttachmentOther  = "other"
+)
+
+// AttachmentKinds lists what a file may be attached as
+var AttachmentKinds = []string{AttachmentScan, AttachmentPhoto, AttachmentReport, AttachmentOther}
+
+// AttachmentContentTypes lists the file types accepted, as sniffed from
+// their contents rather than taken from the client
+var AttachmentContentTypes = []string{
+	"application/pdf",
+	"image/jpeg",
+	"image/png",
+	"image/webp",
+	"image/tiff",
+	"application/dicom",
+}
+
+// MaxAttachmentSize is the largest file accepted, in bytes
+var MaxAttachmentSize int64 = 20 << 20
+
+// Attachment is a file, such as a scanned document, a photo or an outside
+// report, kept with a patient's record and optionally with one of their
+// examinations. The contents live in a blob store under StorageKey.
+type Attachment struct {
+	ID            uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	MRN           string    `gorm:"size:20;not null;index" json:"mrn"`
+	ExaminationID uint32    `gorm:"index" json:"examination_id,omitempty"`
+	Kind          string    `gorm:"size:20;not null" json:"kind"`
+	FileName      string    `gorm:"size:255" json:"file_name"`
+	Description   string    `gorm:"size:255" json:"description"`
+	ContentType   string    `gorm:"size:100;not null" json:"content_type"`
+	Size          int64     `gorm:"not null" json:"size"`
+	SHA256        string    `gorm:"size:64;not null" json:"sha256"`
+	StorageKey    string    `gorm:"size:255;not null;unique_index" json:"-"`
+	UploadedBy    int       `gorm:"not null" json:"uploaded_by"`
+	CreatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	Redacted      bool      `gorm:"-" json:"redacted,omitempty"`
+}
+
+// Validate ...
+func (a *Attachment) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if a.MRN == "" {
+			return errors.New("Required MRN")
+		}
+		if a.Kind == "" {
+			a.Kind = AttachmentOther
+		}
+		known := false
+		for _, k := range AttachmentKinds {
+			if a.Kind == k {
+				known = true
+			}
+		}
+		if !known {
+			return errors.New("Invalid Kind, Expected " + strings.Join(AttachmentKinds, ", "))
+		}
+		if a.Size == 0 {
+			return errors.New("Required File")
+		}
+		if a.Size > MaxAttachmentSize {
+			return fmt.Errorf("File Too Large, The Limit Is %d MB", MaxAttachmentSize>>20)
+		}
+		accepted := false
+		for _, t := range AttachmentContentTypes {
+			if a.ContentType == t {
+				accepted = true
+			}
+		}
+		if !accepted {
+			return errors.New("Unsupported File Type " + a.ContentType)
+		}
+		if len(a.FileName) > 255 {
+			return errors.New("File Name Too Long")
+		}
+		if len(a.Description) > 255 {
+			return errors.New("Description Too Long")
+		}
+		return nil
+	}
+}
+
+// SourceExamination is the examination the file is attached to, if any
+func (a *Attachment) SourceExamination() uint32 {
+	return a.ExaminationID
+}
+
+// Redact blanks the file's name and description for a reader without
+// access to its examination. The file itself is not served to them.
+func (a *Attachment) Redact() {
+	a.FileName, a.Description = "", ""
+	a.Redacted = true
+}
+
+// SaveAttachment ...
+func (a *Attachment) SaveAttachment(db *gorm.DB) (*Attachment, error) {
+	a.ID = 0
+	if err := db.Debug().Create(&a).Error; err != nil {
+		return &Attachment{}, err
+	}
+	return a, nil
+}
+
+// FindAttachmentByID ...
+func (a *Attachment) FindAttachmentByID(db *gorm.DB, id uint32) (*Attachment, error) {
+	err := db.Debug().Model(&Attachment{}).Where("id = ?", id).Take(&a).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Attachment{}, errors.New("Attachment Not Found")
+	}
+	if err != nil {
+		return &Attachment{}, err
+	}
+	return a, nil
+}
+
+// FindAttachments lists a patient's attachments, of one examination unless
+// examinationID is 0
+func (a *Attachment) FindAttachments(db *gorm.DB, mrn string, examinationID uint32) (*[]Attachment, error) {
+	attachments := []Attachment{}
+	query := db.Debug().Model(&Attachment{}).Where("mrn = ?", mrn)
+	if examinationID != 0 {
+		query = query.Where("examination_id = ?", examinationID)
+	}
+	if err := query.Order("created_at desc").Limit(100).Find(&attachments).Error; err != nil {
+		return &[]Attachment{}, err
+	}
+	return &attachments, nil
+}
+
+// DeleteAttachment removes the record; the caller removes the blob
+func (a *Attachment) DeleteAttachment(db *gorm.DB, id uint32) (int64, error) {
+	db = db.Debug().Model(&Attachment{}).Where("id = ?", id).Delete(&Attachment{})
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
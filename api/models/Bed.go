@@ -0,0 +1,242 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Bed statuses
+const (
+	BedFree         = "free"
+	BedOccupied     = "occupied"
+	BedCleaning     = "cleaning"
+	BedOutOfService = "out_of_service"
+)
+
+// Room is a room of a ward
+type Room struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	WardID    uint32    `gorm:"not null;unique_index:idx_room_ward_number" json:"ward_id"`
+	Number    string    `gorm:"size:20;not null;unique_index:idx_room_ward_number" json:"number"`
+	Class     string    `gorm:"size:20" json:"class"`
+	Beds      []Bed     `gorm:"foreignkey:RoomID" json:"beds"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Bed is a bed in a room. WardID is copied from the room so that occupancy
+// can be counted per ward without a join.
+type Bed struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	RoomID    uint32    `gorm:"not null;unique_index:idx_bed_room_code" json:"room_id"`
+	WardID    uint32    `gorm:"not null;index" json:"ward_id"`
+	Code      string    `gorm:"size:20;not null;unique_index:idx_bed_room_code" json:"code"`
+	Status    string    `gorm:"size:20;not null;default:'free';index" json:"status"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// WardOccupancy counts a ward's beds by status
+type WardOccupancy struct {
+	WardID        uint32         `json:"ward_id"`
+	Beds          int            `json:"beds"`
+	ByStatus      map[string]int `json:"by_status"`
+	OccupancyRate float64        `json:"occupancy_rate"`
+}
+
+// Validate ...
+func (rm *Room) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if rm.WardID == 0 {
+			return errors.New("Required Ward ID")
+		}
+		if rm.Number == "" {
+			return errors.New("Required Room Number")
+		}
+		return nil
+	}
+}
+
+// SaveRoom ...
+func (rm *Room) SaveRoom(db *gorm.DB) (*Room, error) {
+	ward := Ward{}
+	if _, err := ward.FindWardByID(db, rm.WardID); err != nil {
+		return &Room{}, err
+	}
+	rm.Beds = nil
+	err := db.Debug().Create(&rm).Error
+	if err != nil {
+		return &Room{}, err
+	}
+	return rm, nil
+}
+
+// FindRoomsByWard returns a ward's rooms with their beds
+func (rm *Room) FindRoomsByWard(db *gorm.DB, wardID uint32) (*[]Room, error) {
+	var err error
+	rooms := []Room{}
+	err = db.Debug().Model(&Room{}).Preload("Beds", func(db *gorm.DB) *gorm.DB {
+		return db.Order("code")
+	}).Where("ward_id = ?", wardID).Order("number").Find(&rooms).Error
+	if err != nil {
+		return &[]Room{}, err
+	}
+	return &rooms, err
+}
+
+func validBedStatus(status string) bool {
+	switch status {
+	case BedFree, BedOccupied, BedCleaning, BedOutOfService:
+		return true
+	}
+	return false
+}
+
+// Validate ...
+func (b *Bed) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case "status":
+		if !validBedStatus(b.Status) {
+			return errors.New("Invalid Bed Status")
+		}
+		if b.Status == BedOccupied {
+			return errors.New("Beds Are Occupied By Admitting A Patient")
+		}
+		return nil
+
+	default:
+		if b.RoomID == 0 {
+			return errors.New("Required Room ID")
+		}
+		if b.Code == "" {
+			return errors.New("Required Bed Code")
+		}
+		return nil
+	}
+}
+
+// SaveBed adds a free bed to a room
+func (b *Bed) SaveBed(db *gorm.DB) (*Bed, error) {
+	room := Room{}
+	err := db.Debug().Model(&Room{}).Where("id = ?", b.RoomID).Take(&room).Error
+	if err != nil {
+		return &Bed{}, errors.New("Room Not Found")
+	}
+	b.WardID = room.WardID
+	b.Status = BedFree
+	err = db.Debug().Create(&b).Error
+	if err != nil {
+		return &Bed{}, err
+	}
+	return b, nil
+}
+
+// FindBeds returns beds, optionally only those of a ward or with a status
+func (b *Bed) FindBeds(db *gorm.DB, wardID uint32, status string) (*[]Bed, error) {
+	var err error
+	beds := []Bed{}
+	query := db.Debug().Model(&Bed{})
+	if wardID != 0 {
+		query = query.Where("ward_id = ?", wardID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Order("ward_id").Order("room_id").Order("code").Find(&beds).Error
+	if err != nil {
+		return &[]Bed{}, err
+	}
+	return &beds, err
+}
+
+// lockBed loads a bed with a row lock inside tx
+func lockBed(tx *gorm.DB, id uint32) (*Bed, error) {
+	bed := Bed{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Bed{}).Where("id = ?", id).Take(&bed).Error
+	if err != nil {
+		return &Bed{}, errors.New("Bed Not Found")
+	}
+	return &bed, nil
+}
+
+func setBedStatus(tx *gorm.DB, id uint32, status string) error {
+	return tx.Debug().Model(&Bed{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"status":     status,
+			"updated_at": time.Now(),
+		},
+	).Error
+}
+
+// UpdateStatus marks a bed free, being cleaned or out of service. Occupied
+// beds only change status through a transfer or discharge.
+func (b *Bed) UpdateStatus(db *gorm.DB, id uint32, status string) (*Bed, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	bed, err := lockBed(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return &Bed{}, err
+	}
+	if bed.Status == BedOccupied {
+		tx.Rollback()
+		return &Bed{}, errors.New("Bed Is Occupied")
+	}
+	if err = setBedStatus(tx, id, status); err != nil {
+		tx.Rollback()
+		return &Bed{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &Bed{}, err
+	}
+	bed.Status = status
+	return bed, nil
+}
+
+// FindWardOccupancy counts the beds of a ward by their current status
+func FindWardOccupancy(db *gorm.DB, wardID uint32) (*WardOccupancy, error) {
+	ward := Ward{}
+	if _, err := ward.FindWardByID(db, wardID); err != nil {
+		return &WardOccupancy{}, err
+	}
+	rows, err := db.Debug().Model(&Bed{}).Select("status, count(*)").Where("ward_id = ?", wardID).Group("status").Rows()
+	if err != nil {
+		return &WardOccupancy{}, err
+	}
+	defer rows.Close()
+
+	occupancy := WardOccupancy{
+		WardID: wardID,
+		ByStatus: map[string]int{
+			BedFree: 0, BedOccupied: 0, BedCleaning: 0, BedOutOfService: 0,
+		},
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if err = rows.Scan(&status, &count); err != nil {
+			return &WardOccupancy{}, err
+		}
+		occupancy.ByStatus[status] = count
+		occupancy.Beds += count
+	}
+	if inService := occupancy.Beds - occupancy.ByStatus[BedOutOfService]; inService > 0 {
+		occupancy.OccupancyRate = float64(occupancy.ByStatus[BedOccupied]) / float64(inService)
+	}
+	return &occupancy, nil
+}
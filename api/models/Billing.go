@@ -0,0 +1,626 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/utils/money"
+)
+
+// Tariff kinds
+const (
+	TariffConsultation = "consultation"
+	TariffMedication   = "medication"
+	TariffProcedure    = "procedure"
+	TariffOther        = "other"
+)
+
+// Invoice statuses. An open invoice still collects charges for the visit;
+// once issued its lines are final and it becomes paid when the balance
+// reaches zero.
+const (
+	InvoiceOpen   = "open"
+	InvoiceIssued = "issued"
+	InvoicePaid   = "paid"
+	InvoiceVoid   = "void"
+)
+
+// Invoice line sources
+const (
+	ChargeExamination = "examination"
+	ChargeDispense    = "dispense"
+	ChargeManual      = "manual"
+)
+
+// Payment kinds
+const (
+	PaymentReceived = "payment"
+	PaymentRefund   = "refund"
+)
+
+// Tariff is a billable service and its price. A consultation tariff
+// applies to the doctor's department, or to every department when
+// DepartmentID is zero; a medication tariff prices one medication.
+type Tariff struct {
+	ID           uint32       `gorm:"primary_key;auto_increment" json:"id"`
+	Code         string       `gorm:"size:30;not null;unique" json:"code"`
+	Name         string       `gorm:"size:255;not null" json:"name"`
+	Kind         string       `gorm:"size:20;not null;index" json:"kind"`
+	Price        money.Amount `gorm:"not null" json:"price"`
+	TaxRate      int          `gorm:"not null;default:0" json:"tax_rate"`
+	DepartmentID uint32       `gorm:"index" json:"department_id"`
+	MedicationID uint32       `gorm:"index" json:"medication_id"`
+	Active       bool         `gorm:"not null;default:true" json:"active"`
+	CreatedAt    time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt    time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Invoice is the bill of one patient visit, an appointment
+type Invoice struct {
+	ID            uint32        `gorm:"primary_key;auto_increment" json:"id"`
+	Number        string        `gorm:"size:30;index" json:"number"`
+	MRN           string        `gorm:"size:20;not null;index" json:"mrn"`
+	AppointmentID uint32        `gorm:"not null;index" json:"appointment_id"`
+	Status        string        `gorm:"size:20;not null;index" json:"status"`
+	Subtotal      money.Amount  `gorm:"not null;default:0" json:"subtotal"`
+	DiscountTotal money.Amount  `gorm:"not null;default:0" json:"discount_total"`
+	TaxTotal      money.Amount  `gorm:"not null;default:0" json:"tax_total"`
+	Total         money.Amount  `gorm:"not null;default:0" json:"total"`
+	Paid          money.Amount  `gorm:"not null;default:0" json:"paid"`
+	Refunded      money.Amount  `gorm:"not null;default:0" json:"refunded"`
+	Balance       money.Amount  `gorm:"not null;default:0;index" json:"balance"`
+	IssuedAt      *time.Time    `json:"issued_at"`
+	IssuedBy      int           `json:"issued_by"`
+	Lines         []InvoiceLine `gorm:"foreignkey:InvoiceID" json:"lines,omitempty"`
+	Payments      []Payment     `gorm:"foreignkey:InvoiceID" json:"payments,omitempty"`
+	CreatedAt     time.Time     `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt     time.Time     `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// InvoiceLine is one charge. Amounts are worked out in order: gross is
+// unit price times quantity, the discount comes off the gross and tax is
+// charged on what remains.
+type InvoiceLine struct {
+	ID             uint32       `gorm:"primary_key;auto_increment" json:"id"`
+	InvoiceID      uint32       `gorm:"not null;index" json:"invoice_id"`
+	TariffID       uint32       `gorm:"not null" json:"tariff_id"`
+	Description    string       `gorm:"size:255;not null" json:"description"`
+	Quantity       int64        `gorm:"not null" json:"quantity"`
+	UnitPrice      money.Amount `gorm:"not null" json:"unit_price"`
+	DiscountRate   int          `gorm:"not null;default:0" json:"discount_rate"`
+	DiscountAmount money.Amount `gorm:"not null;default:0" json:"discount_amount"`
+	TaxRate        int          `gorm:"not null;default:0" json:"tax_rate"`
+	TaxAmount      money.Amount `gorm:"not null;default:0" json:"tax_amount"`
+	Total          money.Amount `gorm:"not null" json:"total"`
+	Source         string       `gorm:"size:20;not null;unique_index:idx_invoice_line_source" json:"source"`
+	SourceID       uint32       `gorm:"not null;unique_index:idx_invoice_line_source" json:"source_id"`
+	CreatedBy      int          `json:"created_by"`
+	CreatedAt      time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// Payment is money received against an invoice, or a refund of it
+type Payment struct {
+	ID         uint32       `gorm:"primary_key;auto_increment" json:"id"`
+	InvoiceID  uint32       `gorm:"not null;index" json:"invoice_id"`
+	Kind       string       `gorm:"size:20;not null" json:"kind"`
+	Amount     money.Amount `gorm:"not null" json:"amount"`
+	Method     string       `gorm:"size:30;not null" json:"method"`
+	Reference  string       `gorm:"size:100" json:"reference"`
+	ReceivedBy int          `gorm:"not null" json:"received_by"`
+	CreatedAt  time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// OutstandingBalance sums what a patient, or every patient, still owes
+type OutstandingBalance struct {
+	MRN      string       `json:"mrn,omitempty"`
+	Total    money.Amount `json:"total"`
+	Invoices []Invoice    `json:"invoices"`
+}
+
+// Validate ...
+func (t *Tariff) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if t.Code == "" {
+			return errors.New("Required Code")
+		}
+		if t.Name == "" {
+			return errors.New("Required Name")
+		}
+		switch t.Kind {
+		case TariffConsultation, TariffProcedure, TariffOther:
+		case TariffMedication:
+			if t.MedicationID == 0 {
+				return errors.New("Required Medication ID")
+			}
+		default:
+			return errors.New("Invalid Tariff Kind")
+		}
+		if t.Price < 0 {
+			return errors.New("Price Cannot Be Negative")
+		}
+		if t.TaxRate < 0 || t.TaxRate > 10000 {
+			return errors.New("Invalid Tax Rate")
+		}
+		return nil
+	}
+}
+
+// SaveTariff ...
+func (t *Tariff) SaveTariff(db *gorm.DB) (*Tariff, error) {
+	t.Active = true
+	err := db.Debug().Create(&t).Error
+	if err != nil {
+		return &Tariff{}, err
+	}
+	return t, nil
+}
+
+// FindAllTariffs returns the catalogue, optionally only one kind
+func (t *Tariff) FindAllTariffs(db *gorm.DB, kind string) (*[]Tariff, error) {
+	var err error
+	tariffs := []Tariff{}
+	query := db.Debug().Model(&Tariff{})
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	err = query.Order("code").Find(&tariffs).Error
+	if err != nil {
+		return &[]Tariff{}, err
+	}
+	return &tariffs, err
+}
+
+// UpdateTariff changes the price, tax or availability of a tariff. Lines
+// already charged keep the price they were charged at.
+func (t *Tariff) UpdateTariff(db *gorm.DB, id uint32) (*Tariff, error) {
+	err := db.Debug().Model(&Tariff{}).Where("id = ?", id).Take(&Tariff{}).UpdateColumns(
+		map[string]interface{}{
+			"name":          t.Name,
+			"price":         t.Price,
+			"tax_rate":      t.TaxRate,
+			"department_id": t.DepartmentID,
+			"active":        t.Active,
+			"updated_at":    time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &Tariff{}, err
+	}
+	err = db.Debug().Model(&Tariff{}).Where("id = ?", id).Take(&t).Error
+	if err != nil {
+		return &Tariff{}, err
+	}
+	return t, nil
+}
+
+// priceLine works out the discount, tax and total of a line
+func priceLine(l *InvoiceLine) {
+	gross := l.UnitPrice.Times(l.Quantity)
+	l.DiscountAmount = gross.Rate(l.DiscountRate)
+	net := gross - l.DiscountAmount
+	l.TaxAmount = net.Rate(l.TaxRate)
+	l.Total = net + l.TaxAmount
+}
+
+// visitInvoice returns the open invoice of an appointment, creating it on
+// the first charge. It fails if the visit's invoice has already been
+// issued or voided.
+func visitInvoice(tx *gorm.DB, appointmentID uint32, mrn string) (*Invoice, error) {
+	invoice := Invoice{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Invoice{}).
+		Where("appointment_id = ? AND status <> ?", appointmentID, InvoiceVoid).Take(&invoice).Error
+	if err == nil {
+		if invoice.Status != InvoiceOpen {
+			return &Invoice{}, errors.New("Invoice For This Visit Has Already Been Issued")
+		}
+		return &invoice, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return &Invoice{}, err
+	}
+	invoice = Invoice{MRN: mrn, AppointmentID: appointmentID, Status: InvoiceOpen}
+	if err = tx.Debug().Create(&invoice).Error; err != nil {
+		return &Invoice{}, err
+	}
+	invoice.Number = fmt.Sprintf("INV-%s-%06d", time.Now().Format("20060102"), invoice.ID)
+	if err = tx.Debug().Model(&Invoice{}).Where("id = ?", invoice.ID).UpdateColumn("number", invoice.Number).Error; err != nil {
+		return &Invoice{}, err
+	}
+	return &invoice, nil
+}
+
+// addCharge adds a tariff line to the visit's invoice unless the source
+// was already charged
+func addCharge(tx *gorm.DB, appointmentID uint32, mrn string, tariff *Tariff, quantity int64, source string, sourceID uint32, employeeID int) error {
+	var charged int
+	err := tx.Debug().Model(&InvoiceLine{}).Where("source = ? AND source_id = ?", source, sourceID).Count(&charged).Error
+	if err != nil || charged > 0 {
+		return err
+	}
+	invoice, err := visitInvoice(tx, appointmentID, mrn)
+	if err != nil {
+		return err
+	}
+	line := InvoiceLine{
+		InvoiceID:   invoice.ID,
+		TariffID:    tariff.ID,
+		Description: tariff.Name,
+		Quantity:    quantity,
+		UnitPrice:   tariff.Price,
+		TaxRate:     tariff.TaxRate,
+		Source:      source,
+		SourceID:    sourceID,
+		CreatedBy:   employeeID,
+	}
+	priceLine(&line)
+	if err = tx.Debug().Create(&line).Error; err != nil {
+		return err
+	}
+	return recalculateInvoice(tx, invoice.ID)
+}
+
+// CaptureExaminationCharge bills the consultation of a completed
+// examination to its visit, using the consultation tariff of the doctor's
+// department or else the general one. Nothing is charged when no tariff
+// applies, which is how a hospital offers a free service.
+func CaptureExaminationCharge(tx *gorm.DB, e *Examination) error {
+	doctor := Employee{}
+	if _, err := doctor.FindEmployeeByID(tx, e.EmployeeID); err != nil {
+		return errors.New("Doctor Not Found")
+	}
+	tariff := Tariff{}
+	err := tx.Debug().Model(&Tariff{}).
+		Where("kind = ? AND active = ? AND department_id IN (?)", TariffConsultation, true, []uint32{doctor.DepartmentID, 0}).
+		Order("department_id desc").Take(&tariff).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return addCharge(tx, e.AppointmentID, e.MRN, &tariff, 1, ChargeExamination, e.ExaminationID, e.EmployeeID)
+}
+
+// CaptureDispenseCharge bills dispensed medication to the visit of the
+// examination it was prescribed in. sourceID identifies the dispensing so
+// that it is charged once.
+func CaptureDispenseCharge(tx *gorm.DB, e *Examination, medicationID uint32, quantity int, sourceID uint32, employeeID int) error {
+	tariff := Tariff{}
+	err := tx.Debug().Model(&Tariff{}).
+		Where("kind = ? AND active = ? AND medication_id = ?", TariffMedication, true, medicationID).Take(&tariff).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return addCharge(tx, e.AppointmentID, e.MRN, &tariff, int64(quantity), ChargeDispense, sourceID, employeeID)
+}
+
+// recalculateInvoice totals the lines and payments of an invoice and
+// updates its balance and status
+func recalculateInvoice(tx *gorm.DB, id uint32) error {
+	invoice := Invoice{}
+	if err := tx.Debug().Model(&Invoice{}).Where("id = ?", id).Take(&invoice).Error; err != nil {
+		return err
+	}
+	lines := []InvoiceLine{}
+	if err := tx.Debug().Model(&InvoiceLine{}).Where("invoice_id = ?", id).Find(&lines).Error; err != nil {
+		return err
+	}
+	payments := []Payment{}
+	if err := tx.Debug().Model(&Payment{}).Where("invoice_id = ?", id).Find(&payments).Error; err != nil {
+		return err
+	}
+
+	var subtotal, discount, tax, total, paid, refunded money.Amount
+	for _, l := range lines {
+		subtotal += l.UnitPrice.Times(l.Quantity)
+		discount += l.DiscountAmount
+		tax += l.TaxAmount
+		total += l.Total
+	}
+	for _, p := range payments {
+		if p.Kind == PaymentRefund {
+			refunded += p.Amount
+		} else {
+			paid += p.Amount
+		}
+	}
+	balance := total - paid + refunded
+
+	status := invoice.Status
+	switch {
+	case status == InvoiceIssued && balance <= 0:
+		status = InvoicePaid
+	case status == InvoicePaid && balance > 0:
+		status = InvoiceIssued
+	}
+	return tx.Debug().Model(&Invoice{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"subtotal":       subtotal,
+			"discount_total": discount,
+			"tax_total":      tax,
+			"total":          total,
+			"paid":           paid,
+			"refunded":       refunded,
+			"balance":        balance,
+			"status":         status,
+			"updated_at":     time.Now(),
+		},
+	).Error
+}
+
+// lockInvoice loads an invoice with a row lock inside tx
+func lockInvoice(tx *gorm.DB, id uint32) (*Invoice, error) {
+	invoice := Invoice{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Invoice{}).Where("id = ?", id).Take(&invoice).Error
+	if err != nil {
+		return &Invoice{}, errors.New("Invoice Not Found")
+	}
+	return &invoice, nil
+}
+
+// billingTx runs fn in a transaction on the locked invoice and then
+// recalculates it
+func billingTx(db *gorm.DB, id uint32, fn func(tx *gorm.DB, invoice *Invoice) error) error {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return err
+	}
+
+	invoice, err := lockInvoice(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = fn(tx, invoice); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = recalculateInvoice(tx, id); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Validate ...
+func (l *InvoiceLine) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case "discount":
+		if l.DiscountRate < 0 || l.DiscountRate > 10000 {
+			return errors.New("Invalid Discount Rate")
+		}
+		return nil
+
+	default:
+		if l.TariffID == 0 {
+			return errors.New("Required Tariff ID")
+		}
+		if l.Quantity <= 0 {
+			return errors.New("Quantity Must Be Positive")
+		}
+		if l.DiscountRate < 0 || l.DiscountRate > 10000 {
+			return errors.New("Invalid Discount Rate")
+		}
+		return nil
+	}
+}
+
+// AddManualLine charges a catalogue service to an open invoice
+func (l *InvoiceLine) AddManualLine(db *gorm.DB, invoiceID uint32, employeeID int) (*Invoice, error) {
+	err := billingTx(db, invoiceID, func(tx *gorm.DB, invoice *Invoice) error {
+		if invoice.Status != InvoiceOpen {
+			return errors.New("Only Open Invoices Can Be Charged")
+		}
+		tariff := Tariff{}
+		if err := tx.Debug().Model(&Tariff{}).Where("id = ? AND active = ?", l.TariffID, true).Take(&tariff).Error; err != nil {
+			return errors.New("Tariff Not Found")
+		}
+		line := InvoiceLine{
+			InvoiceID:    invoiceID,
+			TariffID:     tariff.ID,
+			Description:  tariff.Name,
+			Quantity:     l.Quantity,
+			UnitPrice:    tariff.Price,
+			DiscountRate: l.DiscountRate,
+			TaxRate:      tariff.TaxRate,
+			Source:       ChargeManual,
+			CreatedBy:    employeeID,
+		}
+		if l.Description != "" {
+			line.Description = l.Description
+		}
+		priceLine(&line)
+		if err := tx.Debug().Create(&line).Error; err != nil {
+			return err
+		}
+		// Manual lines have no source record; their own id keeps the
+		// source index unique
+		return tx.Debug().Model(&InvoiceLine{}).Where("id = ?", line.ID).UpdateColumn("source_id", line.ID).Error
+	})
+	if err != nil {
+		return &Invoice{}, err
+	}
+	invoice := Invoice{}
+	return invoice.FindInvoiceByID(db, invoiceID)
+}
+
+// SetLineDiscount changes the discount of a line on an open invoice
+func (l *InvoiceLine) SetLineDiscount(db *gorm.DB, invoiceID, lineID uint32, rate int) (*Invoice, error) {
+	err := billingTx(db, invoiceID, func(tx *gorm.DB, invoice *Invoice) error {
+		if invoice.Status != InvoiceOpen {
+			return errors.New("Only Open Invoices Can Be Discounted")
+		}
+		line := InvoiceLine{}
+		if err := tx.Debug().Model(&InvoiceLine{}).Where("id = ? AND invoice_id = ?", lineID, invoiceID).Take(&line).Error; err != nil {
+			return errors.New("Invoice Line Not Found")
+		}
+		line.DiscountRate = rate
+		priceLine(&line)
+		return tx.Debug().Model(&InvoiceLine{}).Where("id = ?", lineID).UpdateColumns(
+			map[string]interface{}{
+				"discount_rate":   line.DiscountRate,
+				"discount_amount": line.DiscountAmount,
+				"tax_amount":      line.TaxAmount,
+				"total":           line.Total,
+			},
+		).Error
+	})
+	if err != nil {
+		return &Invoice{}, err
+	}
+	invoice := Invoice{}
+	return invoice.FindInvoiceByID(db, invoiceID)
+}
+
+// Issue finalises an open invoice so that it can no longer be charged
+func (inv *Invoice) Issue(db *gorm.DB, id uint32, employeeID int) (*Invoice, error) {
+	err := billingTx(db, id, func(tx *gorm.DB, invoice *Invoice) error {
+		if invoice.Status != InvoiceOpen {
+			return errors.New("Only Open Invoices Can Be Issued")
+		}
+		var lines int
+		if err := tx.Debug().Model(&InvoiceLine{}).Where("invoice_id = ?", id).Count(&lines).Error; err != nil {
+			return err
+		}
+		if lines == 0 {
+			return errors.New("Invoice Has No Charges")
+		}
+		return tx.Debug().Model(&Invoice{}).Where("id = ?", id).UpdateColumns(
+			map[string]interface{}{
+				"status":    InvoiceIssued,
+				"issued_at": time.Now(),
+				"issued_by": employeeID,
+			},
+		).Error
+	})
+	if err != nil {
+		return &Invoice{}, err
+	}
+	return inv.FindInvoiceByID(db, id)
+}
+
+// Void cancels an invoice that holds no money
+func (inv *Invoice) Void(db *gorm.DB, id uint32) (*Invoice, error) {
+	err := billingTx(db, id, func(tx *gorm.DB, invoice *Invoice) error {
+		if invoice.Status == InvoiceVoid {
+			return errors.New("Invoice Is Already Void")
+		}
+		if invoice.Paid != invoice.Refunded {
+			return errors.New("Refund Payments Before Voiding The Invoice")
+		}
+		return tx.Debug().Model(&Invoice{}).Where("id = ?", id).UpdateColumn("status", InvoiceVoid).Error
+	})
+	if err != nil {
+		return &Invoice{}, err
+	}
+	return inv.FindInvoiceByID(db, id)
+}
+
+// Validate ...
+func (p *Payment) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if p.Amount <= 0 {
+			return errors.New("Amount Must Be Positive")
+		}
+		if p.Method == "" {
+			return errors.New("Required Method")
+		}
+		return nil
+	}
+}
+
+// Record takes a payment, which may be partial, or makes a refund of money
+// already paid. Payments can be taken as a deposit while the invoice is
+// still open.
+func (p *Payment) Record(db *gorm.DB, invoiceID uint32, kind string) (*Invoice, error) {
+	err := billingTx(db, invoiceID, func(tx *gorm.DB, invoice *Invoice) error {
+		if invoice.Status == InvoiceVoid {
+			return errors.New("Invoice Is Void")
+		}
+		switch kind {
+		case PaymentReceived:
+			if p.Amount > invoice.Balance {
+				return fmt.Errorf("Payment Exceeds The Balance Of %s", invoice.Balance)
+			}
+		case PaymentRefund:
+			if p.Amount > invoice.Paid-invoice.Refunded {
+				return fmt.Errorf("Refund Exceeds The %s Paid", invoice.Paid-invoice.Refunded)
+			}
+		default:
+			return errors.New("Invalid Payment Kind")
+		}
+		p.ID = 0
+		p.InvoiceID = invoiceID
+		p.Kind = kind
+		return tx.Debug().Create(&p).Error
+	})
+	if err != nil {
+		return &Invoice{}, err
+	}
+	invoice := Invoice{}
+	return invoice.FindInvoiceByID(db, invoiceID)
+}
+
+// FindInvoiceByID returns an invoice with its lines and payments
+func (inv *Invoice) FindInvoiceByID(db *gorm.DB, id uint32) (*Invoice, error) {
+	err := db.Debug().Model(&Invoice{}).Preload("Lines").Preload("Payments").Where("id = ?", id).Take(&inv).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Invoice{}, errors.New("Invoice Not Found")
+	}
+	if err != nil {
+		return &Invoice{}, err
+	}
+	return inv, nil
+}
+
+// FindInvoices returns invoices, optionally only those of a patient or with
+// a status
+func (inv *Invoice) FindInvoices(db *gorm.DB, mrn, status string) (*[]Invoice, error) {
+	var err error
+	invoices := []Invoice{}
+	query := db.Debug().Model(&Invoice{})
+	if mrn != "" {
+		query = query.Where("mrn = ?", mrn)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Order("created_at desc").Limit(100).Find(&invoices).Error
+	if err != nil {
+		return &[]Invoice{}, err
+	}
+	return &invoices, err
+}
+
+// FindOutstanding returns the invoices with money still owed, for one
+// patient or all of them, and their total
+func FindOutstanding(db *gorm.DB, mrn string) (*OutstandingBalance, error) {
+	outstanding := OutstandingBalance{MRN: mrn, Invoices: []Invoice{}}
+	query := db.Debug().Model(&Invoice{}).Where("status IN (?) AND balance > 0", []string{InvoiceOpen, InvoiceIssued})
+	if mrn != "" {
+		query = query.Where("mrn = ?", mrn)
+	}
+	if err := query.Order("created_at").Find(&outstanding.Invoices).Error; err != nil {
+		return &OutstandingBalance{}, err
+	}
+	for _, inv := range outstanding.Invoices {
+		outstanding.Total += inv.Balance
+	}
+	return &outstanding, nil
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Chart event types
+const (
+	ChartAppointment  = "appointment"
+	ChartExamination  = "examination"
+	ChartDiagnosis    = "diagnosis"
+	ChartPrescription = "prescription"
+	ChartLabResult    = "lab_result"
+)
+
+// ChartEventTypes lists every event type a chart can contain
+var ChartEventTypes = []string{ChartAppointment, ChartExamination, ChartDiagnosis, ChartPrescription, ChartLabResult}
+
+// ChartEvent is one entry on a patient's timeline
+type ChartEvent struct {
+	Type       string      `json:"type"`
+	Time       time.Time   `json:"time"`
+	SourceID   uint32      `json:"source_id"`
+	EmployeeID int         `json:"employee_id"`
+	Status     string      `json:"status"`
+	Summary    string      `json:"summary"`
+	Detail     interface{} `json:"detail"`
+}
+
+// ChartFilter narrows a chart by time and event type. Zero values mean no
+// restriction. Restricted examinations the Access does not allow are
+// redacted, with the lab results of those examinations.
+type ChartFilter struct {
+	From    time.Time
+	To      time.Time
+	Types   []string
+	Page    int
+	PerPage int
+	Access  *ExaminationAccess
+}
+
+// PatientChart is one page of a patient's timeline, newest first
+type PatientChart struct {
+	MRN     string       `json:"mrn"`
+	Page    int          `json:"page"`
+	PerPage int          `json:"per_page"`
+	Total   int          `json:"total"`
+	Events  []ChartEvent `json:"events"`
+}
+
+func (f *ChartFilter) wants(eventType string) bool {
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *ChartFilter) contains(t time.Time) bool {
+	if !f.From.IsZero() && t.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && t.After(f.To) {
+		return false
+	}
+	return true
+}
+
+func (f *ChartFilter) scope(db *gorm.DB, column string) *gorm.DB {
+	if !f.From.IsZero() {
+		db = db.Where(column+" >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		db = db.Where(column+" <= ?", f.To)
+	}
+	return db
+}
+
+// BuildPatientChart collects appointments, examinations and lab results of
+// one patient into a single timeline. Diagnoses and prescriptions are taken
+// from the examination that recorded them.
+func BuildPatientChart(db *gorm.DB, mrn string, filter ChartFilter) (*PatientChart, error) {
+	events := []ChartEvent{}
+
+	if filter.wants(ChartAppointment) {
+		appointment := Appointment{}
+		appointments, err := appointment.FindAppointmentsByMRN(db, mrn)
+		if err != nil {
+			return &PatientChart{}, err
+		}
+		for _, a := range *appointments {
+			at, err := a.ScheduledAt()
+			if err != nil {
+				at = a.CreatedAt
+			}
+			if !filter.contains(at) {
+				continue
+			}
+			events = append(events, ChartEvent{
+				Type:       ChartAppointment,
+				Time:       at,
+				SourceID:   a.AppointmentID,
+				EmployeeID: a.EmployeeID,
+				Status:     a.Status,
+				Summary:    a.ScheduleCode,
+				Detail:     a,
+			})
+		}
+	}
+
+	if filter.wants(ChartExamination) || filter.wants(ChartDiagnosis) || filter.wants(ChartPrescription) {
+		examinations := []Examination{}
+		err := filter.scope(db.Debug().Model(&Examination{}).Where("mrn = ?", mrn), "created_at").Find(&examinations).Error
+		if err != nil {
+			return &PatientChart{}, err
+		}
+		for _, e := range examinations {
+			filter.Access.Filter(&e)
+			if filter.wants(ChartExamination) {
+				events = append(events, ChartEvent{
+					Type:       ChartExamination,
+					Time:       e.CreatedAt,
+					SourceID:   e.ExaminationID,
+					EmployeeID: e.EmployeeID,
+					Status:     e.Status,
+					Summary:    e.Anamnesis,
+					Detail:     e,
+				})
+			}
+			if filter.wants(ChartDiagnosis) && e.Diagnosis != "" {
+				events = append(events, ChartEvent{
+					Type:       ChartDiagnosis,
+					Time:       e.CreatedAt,
+					SourceID:   e.ExaminationID,
+					EmployeeID: e.EmployeeID,
+					Status:     e.Status,
+					Summary:    e.Diagnosis,
+				})
+			}
+			if filter.wants(ChartPrescription) && e.Prescription != "" {
+				events = append(events, ChartEvent{
+					Type:       ChartPrescription,
+					Time:       e.CreatedAt,
+					SourceID:   e.ExaminationID,
+					EmployeeID: e.EmployeeID,
+					Status:     e.Status,
+					Summary:    e.Prescription,
+				})
+			}
+		}
+	}
+
+	if filter.wants(ChartLabResult) {
+		orders := []LabOrder{}
+		err := filter.scope(db.Debug().Model(&LabOrder{}).Preload("LabTest").
+			Where("mrn = ? AND status IN (?)", mrn, []string{LabResulted, LabVerified}), "resulted_at").Find(&orders).Error
+		if err != nil {
+			return &PatientChart{}, err
+		}
+		records := make([]ExaminationRecord, len(orders))
+		for i := range orders {
+			records[i] = &orders[i]
+		}
+		if err = filter.Access.FilterRecords(db, records...); err != nil {
+			return &PatientChart{}, err
+		}
+		for _, o := range orders {
+			events = append(events, ChartEvent{
+				Type:       ChartLabResult,
+				Time:       *o.ResultedAt,
+				SourceID:   o.ID,
+				EmployeeID: o.ResultedBy,
+				Status:     o.Status,
+				Summary:    o.LabTest.Name,
+				Detail:     o,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+
+	chart := PatientChart{MRN: mrn, Page: filter.Page, PerPage: filter.PerPage, Total: len(events)}
+	start := (filter.Page - 1) * filter.PerPage
+	if start > len(events) {
+		start = len(events)
+	}
+	end := start + filter.PerPage
+	if end > len(events) {
+		end = len(events)
+	}
+	chart.Events = events[start:end]
+	return &chart, nil
+}
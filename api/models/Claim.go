@@ -0,0 +1,372 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/payers"
+	"github.com/repoerna/hms_app/api/utils/money"
+)
+
+// Claim statuses. A draft is built from a completed examination and its
+// visit's invoice; the payer's decision replaces submitted with approved,
+// partial or rejected. A rejected claim may be corrected and resubmitted.
+const (
+	ClaimDraft     = "draft"
+	ClaimSubmitted = "submitted"
+	ClaimApproved  = payers.ClaimApproved
+	ClaimPartial   = payers.ClaimPartial
+	ClaimRejected  = payers.ClaimRejected
+)
+
+// PaymentMethodInsurance is the method of payments posted from approved
+// claims
+const PaymentMethodInsurance = "insurance"
+
+// Payer is an insurer the hospital claims from. Adapter names the
+// integration used to reach it.
+type Payer struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Code      string    `gorm:"size:20;not null;unique" json:"code"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	Adapter   string    `gorm:"size:30;not null" json:"adapter"`
+	Active    bool      `gorm:"not null;default:true" json:"active"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// InsuranceClaim is a claim for one examination. The member details are
+// copied from the patient's policy when the claim is made, since policies
+// are replaced whenever the patient's details are edited.
+type InsuranceClaim struct {
+	ID             uint32       `gorm:"primary_key;auto_increment" json:"id"`
+	Number         string       `gorm:"size:30;index" json:"number"`
+	ExaminationID  uint32       `gorm:"not null;unique" json:"examination_id"`
+	InvoiceID      uint32       `gorm:"not null;index" json:"invoice_id"`
+	MRN            string       `gorm:"size:20;not null;index" json:"mrn"`
+	PayerID        uint32       `gorm:"not null;index" json:"payer_id"`
+	MemberNumber   string       `gorm:"size:50;not null" json:"member_number"`
+	Class          string       `gorm:"size:20" json:"class"`
+	ServiceDate    string       `gorm:"size:10;not null" json:"service_date"`
+	Status         string       `gorm:"size:20;not null;index" json:"status"`
+	ClaimedAmount  money.Amount `gorm:"not null;default:0" json:"claimed_amount"`
+	ApprovedAmount money.Amount `gorm:"not null;default:0" json:"approved_amount"`
+	PaymentID      uint32       `json:"payment_id"`
+	PayerReference string       `gorm:"size:100" json:"payer_reference"`
+	Reason         string       `gorm:"size:255" json:"reason"`
+	CreatedBy      int          `gorm:"not null" json:"created_by"`
+	SubmittedBy    int          `json:"submitted_by"`
+	SubmittedAt    *time.Time   `json:"submitted_at"`
+	DecidedAt      *time.Time   `json:"decided_at"`
+	CreatedAt      time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt      time.Time    `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate ...
+func (p *Payer) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if p.Code == "" {
+			return errors.New("Required Code")
+		}
+		if p.Name == "" {
+			return errors.New("Required Name")
+		}
+		if p.Adapter == "" {
+			return errors.New("Required Adapter")
+		}
+		return nil
+	}
+}
+
+// SavePayer ...
+func (p *Payer) SavePayer(db *gorm.DB) (*Payer, error) {
+	p.Code = strings.ToUpper(p.Code)
+	p.Active = true
+	err := db.Debug().Create(&p).Error
+	if err != nil {
+		return &Payer{}, err
+	}
+	return p, nil
+}
+
+// FindAllPayers ...
+func (p *Payer) FindAllPayers(db *gorm.DB) (*[]Payer, error) {
+	var err error
+	payerList := []Payer{}
+	err = db.Debug().Model(&Payer{}).Order("name").Limit(100).Find(&payerList).Error
+	if err != nil {
+		return &[]Payer{}, err
+	}
+	return &payerList, err
+}
+
+// FindPayerByID ...
+func (p *Payer) FindPayerByID(db *gorm.DB, id uint32) (*Payer, error) {
+	err := db.Debug().Model(&Payer{}).Where("id = ?", id).Take(&p).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Payer{}, errors.New("Payer Not Found")
+	}
+	if err != nil {
+		return &Payer{}, err
+	}
+	return p, nil
+}
+
+// findPolicy returns the patient's policy with a payer
+func findPolicy(db *gorm.DB, mrn string, payerID uint32) (*PatientInsurance, error) {
+	policy := PatientInsurance{}
+	err := db.Debug().Model(&PatientInsurance{}).Where("patient_mrn = ? AND payer_id = ?", mrn, payerID).Take(&policy).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &PatientInsurance{}, errors.New("Patient Has No Policy With This Payer")
+	}
+	if err != nil {
+		return &PatientInsurance{}, err
+	}
+	return &policy, nil
+}
+
+// policyExpired reports whether a policy has lapsed by the given date
+func policyExpired(policy *PatientInsurance, date time.Time) bool {
+	return policy.ValidUntil != "" && policy.ValidUntil < date.Format("2006-01-02")
+}
+
+// CheckEligibility asks the payer whether the patient's policy covers the
+// given date. A policy already expired on file is answered locally. The
+// member number is shared with the payer, so the patient must have
+// consented to insurer sharing.
+func CheckEligibility(ctx context.Context, db *gorm.DB, adapter payers.PayerAdapter, mrn string, payerID uint32, date time.Time) (*payers.Eligibility, error) {
+	if err := RequireConsent(db, mrn, ConsentInsurerSharing); err != nil {
+		return nil, err
+	}
+	policy, err := findPolicy(db, mrn, payerID)
+	if err != nil {
+		return nil, err
+	}
+	if policyExpired(policy, date) {
+		return &payers.Eligibility{Class: policy.Class, Reason: "Policy Has Expired", CheckedAt: time.Now()}, nil
+	}
+	return adapter.CheckEligibility(ctx, payers.EligibilityRequest{
+		MemberNumber: policy.MemberNumber,
+		Class:        policy.Class,
+		ServiceDate:  date,
+	})
+}
+
+// visitInvoiceOf returns the invoice of an examination's visit
+func visitInvoiceOf(db *gorm.DB, e *Examination) (*Invoice, error) {
+	invoice := Invoice{}
+	err := db.Debug().Model(&Invoice{}).Preload("Lines").
+		Where("appointment_id = ? AND status <> ?", e.AppointmentID, InvoiceVoid).Take(&invoice).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Invoice{}, errors.New("Visit Has No Charges To Claim")
+	}
+	if err != nil {
+		return &Invoice{}, err
+	}
+	return &invoice, nil
+}
+
+// GenerateClaim drafts a claim to a payer for a completed examination,
+// for the charges on its visit's invoice
+func (c *InsuranceClaim) GenerateClaim(db *gorm.DB, examinationID, payerID uint32, employeeID int) (*InsuranceClaim, error) {
+	examination := Examination{}
+	if _, err := examination.FindExaminationByID(db, examinationID); err != nil {
+		return &InsuranceClaim{}, errors.New("Examination Not Found")
+	}
+	if examination.Status != ExaminationCompleted {
+		return &InsuranceClaim{}, errors.New("Only Completed Examinations Can Be Claimed")
+	}
+	if err := RequireConsent(db, examination.MRN, ConsentInsurerSharing); err != nil {
+		return &InsuranceClaim{}, err
+	}
+	payer := Payer{}
+	if _, err := payer.FindPayerByID(db, payerID); err != nil {
+		return &InsuranceClaim{}, err
+	}
+	if !payer.Active {
+		return &InsuranceClaim{}, errors.New("Payer Is Not Active")
+	}
+	policy, err := findPolicy(db, examination.MRN, payerID)
+	if err != nil {
+		return &InsuranceClaim{}, err
+	}
+	if policyExpired(policy, examination.CreatedAt) {
+		return &InsuranceClaim{}, errors.New("Policy Had Expired On The Service Date")
+	}
+	invoice, err := visitInvoiceOf(db, &examination)
+	if err != nil {
+		return &InsuranceClaim{}, err
+	}
+	if invoice.Total <= 0 {
+		return &InsuranceClaim{}, errors.New("Visit Has No Charges To Claim")
+	}
+
+	var existing int
+	if err = db.Debug().Model(&InsuranceClaim{}).Where("examination_id = ?", examinationID).Count(&existing).Error; err != nil {
+		return &InsuranceClaim{}, err
+	}
+	if existing > 0 {
+		return &InsuranceClaim{}, errors.New("Examination Has Already Been Claimed")
+	}
+
+	c.ID = 0
+	c.ExaminationID = examinationID
+	c.InvoiceID = invoice.ID
+	c.MRN = examination.MRN
+	c.PayerID = payerID
+	c.MemberNumber = policy.MemberNumber
+	c.Class = policy.Class
+	c.ServiceDate = examination.CreatedAt.Format("2006-01-02")
+	c.Status = ClaimDraft
+	c.ClaimedAmount = invoice.Total
+	c.CreatedBy = employeeID
+	if err = db.Debug().Create(&c).Error; err != nil {
+		return &InsuranceClaim{}, err
+	}
+	c.Number = fmt.Sprintf("CLM-%s-%06d", time.Now().Format("20060102"), c.ID)
+	if err = db.Debug().Model(&InsuranceClaim{}).Where("id = ?", c.ID).UpdateColumn("number", c.Number).Error; err != nil {
+		return &InsuranceClaim{}, err
+	}
+	return c, nil
+}
+
+// Submit sends a draft or rejected claim to the payer and records the
+// decision. The claim is priced from the invoice as it stands, and what
+// the payer approves is posted to the invoice as an insurance payment, up
+// to the balance still owed.
+func (c *InsuranceClaim) Submit(ctx context.Context, db *gorm.DB, adapter payers.PayerAdapter, id uint32, employeeID int) (*InsuranceClaim, error) {
+	if _, err := c.FindClaimByID(db, id); err != nil {
+		return &InsuranceClaim{}, err
+	}
+	previous := c.Status
+	if previous != ClaimDraft && previous != ClaimRejected {
+		return &InsuranceClaim{}, fmt.Errorf("Cannot Submit A %s Claim", previous)
+	}
+	if err := RequireConsent(db, c.MRN, ConsentInsurerSharing); err != nil {
+		return &InsuranceClaim{}, err
+	}
+	examination := Examination{}
+	if _, err := examination.FindExaminationByID(db, c.ExaminationID); err != nil {
+		return &InsuranceClaim{}, errors.New("Examination Not Found")
+	}
+	invoice, err := visitInvoiceOf(db, &examination)
+	if err != nil {
+		return &InsuranceClaim{}, err
+	}
+
+	request := payers.ClaimRequest{
+		ClaimNumber:  c.Number,
+		MemberNumber: c.MemberNumber,
+		Class:        c.Class,
+		Diagnosis:    examination.Diagnosis,
+		Total:        invoice.Total,
+	}
+	request.ServiceDate, _ = time.Parse("2006-01-02", c.ServiceDate)
+	for _, l := range invoice.Lines {
+		tariff := Tariff{}
+		db.Debug().Model(&Tariff{}).Where("id = ?", l.TariffID).Take(&tariff)
+		request.Lines = append(request.Lines, payers.ClaimLine{
+			Code:        tariff.Code,
+			Description: l.Description,
+			Quantity:    l.Quantity,
+			Amount:      l.Total,
+		})
+	}
+
+	// Claiming the claim first keeps a second submission from reaching the
+	// payer while this one is in flight
+	now := time.Now()
+	result := db.Debug().Model(&InsuranceClaim{}).Where("id = ? AND status = ?", id, previous).UpdateColumns(
+		map[string]interface{}{
+			"status":         ClaimSubmitted,
+			"claimed_amount": invoice.Total,
+			"submitted_by":   employeeID,
+			"submitted_at":   now,
+			"updated_at":     now,
+		},
+	)
+	if result.Error != nil {
+		return &InsuranceClaim{}, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &InsuranceClaim{}, errors.New("Claim Is Already Being Submitted")
+	}
+
+	decision, err := adapter.SubmitClaim(ctx, request)
+	if err != nil {
+		db.Debug().Model(&InsuranceClaim{}).Where("id = ?", id).UpdateColumn("status", previous)
+		return &InsuranceClaim{}, err
+	}
+
+	err = billingTx(db, invoice.ID, func(tx *gorm.DB, locked *Invoice) error {
+		columns := map[string]interface{}{
+			"status":          decision.Status,
+			"approved_amount": decision.ApprovedAmount,
+			"payer_reference": decision.Reference,
+			"reason":          decision.Reason,
+			"decided_at":      time.Now(),
+			"updated_at":      time.Now(),
+		}
+		amount := decision.ApprovedAmount
+		if amount > locked.Balance {
+			amount = locked.Balance
+		}
+		if amount > 0 && locked.Status != InvoiceVoid {
+			payment := Payment{
+				InvoiceID:  locked.ID,
+				Kind:       PaymentReceived,
+				Amount:     amount,
+				Method:     PaymentMethodInsurance,
+				Reference:  c.Number,
+				ReceivedBy: employeeID,
+			}
+			if err := tx.Debug().Create(&payment).Error; err != nil {
+				return err
+			}
+			columns["payment_id"] = payment.ID
+		}
+		return tx.Debug().Model(&InsuranceClaim{}).Where("id = ?", id).UpdateColumns(columns).Error
+	})
+	if err != nil {
+		return &InsuranceClaim{}, err
+	}
+	return c.FindClaimByID(db, id)
+}
+
+// FindClaimByID ...
+func (c *InsuranceClaim) FindClaimByID(db *gorm.DB, id uint32) (*InsuranceClaim, error) {
+	err := db.Debug().Model(&InsuranceClaim{}).Where("id = ?", id).Take(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &InsuranceClaim{}, errors.New("Claim Not Found")
+	}
+	if err != nil {
+		return &InsuranceClaim{}, err
+	}
+	return c, nil
+}
+
+// FindClaims returns claims, optionally only those of a patient, payer or
+// status
+func (c *InsuranceClaim) FindClaims(db *gorm.DB, mrn string, payerID uint32, status string) (*[]InsuranceClaim, error) {
+	var err error
+	claims := []InsuranceClaim{}
+	query := db.Debug().Model(&InsuranceClaim{})
+	if mrn != "" {
+		query = query.Where("mrn = ?", mrn)
+	}
+	if payerID != 0 {
+		query = query.Where("payer_id = ?", payerID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Order("created_at desc").Limit(100).Find(&claims).Error
+	if err != nil {
+		return &[]InsuranceClaim{}, err
+	}
+	return &claims, err
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Compliance alert kinds
+const (
+	AlertBreakGlass = "break-glass"
+)
+
+// ComplianceAlert is raised with compliance staff when someone does
+// something they must look into, such as breaking the glass on a patient's
+// restricted records. Alerts are kept until acknowledged, so none is lost
+// when no one is watching the event stream.
+type ComplianceAlert struct {
+	ID                uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	Kind              string     `gorm:"size:30;not null;index" json:"kind"`
+	EmergencyAccessID uint32     `gorm:"index" json:"emergency_access_id,omitempty"`
+	EmployeeID        int        `gorm:"not null" json:"employee_id"`
+	MRN               string     `gorm:"size:20;index" json:"mrn"`
+	Message           string     `gorm:"size:1000;not null" json:"message"`
+	CreatedAt         time.Time  `gorm:"not null;index" json:"created_at"`
+	AcknowledgedBy    int        `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt    *time.Time `json:"acknowledged_at,omitempty"`
+}
+
+// FindComplianceAlerts lists alerts, newest first, of one kind unless kind
+// is empty, and only those not yet acknowledged if asked
+func (c *ComplianceAlert) FindComplianceAlerts(db *gorm.DB, kind string, unacknowledged bool) (*[]ComplianceAlert, error) {
+	alerts := []ComplianceAlert{}
+	query := db.Debug().Model(&ComplianceAlert{})
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	if unacknowledged {
+		query = query.Where("acknowledged_at IS NULL")
+	}
+	if err := query.Order("created_at desc").Limit(100).Find(&alerts).Error; err != nil {
+		return &[]ComplianceAlert{}, err
+	}
+	return &alerts, nil
+}
+
+// FindComplianceAlertByID ...
+func (c *ComplianceAlert) FindComplianceAlertByID(db *gorm.DB, id uint32) (*ComplianceAlert, error) {
+	err := db.Debug().Model(&ComplianceAlert{}).Where("id = ?", id).Take(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &ComplianceAlert{}, errors.New("Compliance Alert Not Found")
+	}
+	if err != nil {
+		return &ComplianceAlert{}, err
+	}
+	return c, nil
+}
+
+// Acknowledge records that compliance staff have seen the alert. An alert
+// is acknowledged once, and not by the employee it is about.
+func (c *ComplianceAlert) Acknowledge(db *gorm.DB, employeeID int, now time.Time) (*ComplianceAlert, error) {
+	if employeeID == c.EmployeeID {
+		return &ComplianceAlert{}, errors.New("Cannot Acknowledge Own Compliance Alert")
+	}
+	update := db.Debug().Model(&ComplianceAlert{}).Where("id = ? AND acknowledged_at IS NULL", c.ID).UpdateColumns(
+		map[string]interface{}{
+			"acknowledged_by": employeeID,
+			"acknowledged_at": now,
+		},
+	)
+	if update.Error != nil {
+		return &ComplianceAlert{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return &ComplianceAlert{}, errors.New("Compliance Alert Already Acknowledged")
+	}
+	return c.FindComplianceAlertByID(db, c.ID)
+}
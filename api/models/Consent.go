@@ -0,0 +1,242 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Consent types
+const (
+	ConsentTreatment      = "treatment"
+	ConsentInsurerSharing = "insurer_sharing"
+	ConsentResearch       = "research"
+	ConsentMarketing      = "marketing"
+)
+
+// ConsentTypes lists every consent a patient can give
+var ConsentTypes = []string{ConsentTreatment, ConsentInsurerSharing, ConsentResearch, ConsentMarketing}
+
+// ErrConsentMissing is returned by RequireConsent when the patient has not
+// agreed, or has withdrawn their agreement
+var ErrConsentMissing = errors.New("Patient Has Not Consented")
+
+// ConsentText is the wording a patient agrees to. Texts are never edited;
+// a change is saved as the next version of the same type.
+type ConsentText struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Type      string    `gorm:"size:30;not null;unique_index:idx_consent_type_version" json:"type"`
+	Version   int       `gorm:"not null;unique_index:idx_consent_type_version" json:"version"`
+	Text      string    `gorm:"type:text;not null" json:"text"`
+	CreatedBy int       `json:"created_by"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// PatientConsent is one grant of consent. Granting again adds a new row, so
+// the latest row of a type decides whether consent is currently given.
+type PatientConsent struct {
+	ID          uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	PatientMRN  string     `gorm:"size:20;not null;index" json:"patient_mrn"`
+	Type        string     `gorm:"size:30;not null" json:"type"`
+	Version     int        `gorm:"not null" json:"version"`
+	Method      string     `gorm:"size:20" json:"method"`
+	GrantedAt   time.Time  `gorm:"not null" json:"granted_at"`
+	CapturedBy  int        `json:"captured_by"`
+	WithdrawnAt *time.Time `json:"withdrawn_at"`
+	WithdrawnBy int        `json:"withdrawn_by"`
+}
+
+func validConsentType(t string) bool {
+	for _, known := range ConsentTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate ...
+func (c *ConsentText) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if !validConsentType(c.Type) {
+			return errors.New("Invalid Consent Type")
+		}
+		if c.Text == "" {
+			return errors.New("Required Text")
+		}
+		return nil
+	}
+}
+
+// SaveConsentText stores the text as the next version of its type
+func (c *ConsentText) SaveConsentText(db *gorm.DB) (*ConsentText, error) {
+	latest := ConsentText{}
+	err := db.Debug().Model(&ConsentText{}).Where("type = ?", c.Type).Order("version desc").Take(&latest).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return &ConsentText{}, err
+	}
+	c.ID = 0
+	c.Version = latest.Version + 1
+	err = db.Debug().Create(&c).Error
+	if err != nil {
+		return &ConsentText{}, err
+	}
+	return c, nil
+}
+
+// FindAllConsentTexts ...
+func (c *ConsentText) FindAllConsentTexts(db *gorm.DB) (*[]ConsentText, error) {
+	var err error
+	texts := []ConsentText{}
+	err = db.Debug().Model(&ConsentText{}).Order("type").Order("version desc").Limit(100).Find(&texts).Error
+	if err != nil {
+		return &[]ConsentText{}, err
+	}
+	return &texts, err
+}
+
+// FindConsentText returns the given version of a text, or the latest one
+// when version is zero
+func (c *ConsentText) FindConsentText(db *gorm.DB, consentType string, version int) (*ConsentText, error) {
+	query := db.Debug().Model(&ConsentText{}).Where("type = ?", consentType)
+	if version != 0 {
+		query = query.Where("version = ?", version)
+	}
+	err := query.Order("version desc").Take(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &ConsentText{}, errors.New("Consent Text Not Found")
+	}
+	if err != nil {
+		return &ConsentText{}, err
+	}
+	return c, nil
+}
+
+// Validate ...
+func (c *PatientConsent) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if c.PatientMRN == "" {
+			return errors.New("Required MRN")
+		}
+		if !validConsentType(c.Type) {
+			return errors.New("Invalid Consent Type")
+		}
+		return nil
+	}
+}
+
+// Active reports whether the consent is still in force
+func (c *PatientConsent) Active() bool {
+	return c.WithdrawnAt == nil
+}
+
+// Grant records the patient's agreement to a version of the consent text,
+// the latest one unless Version is set
+func (c *PatientConsent) Grant(db *gorm.DB) (*PatientConsent, error) {
+	patient := Patient{}
+	if _, err := patient.FindPatientByMRN(db, c.PatientMRN); err != nil {
+		return &PatientConsent{}, err
+	}
+	text := ConsentText{}
+	if _, err := text.FindConsentText(db, c.Type, c.Version); err != nil {
+		return &PatientConsent{}, err
+	}
+	c.ID = 0
+	c.Version = text.Version
+	c.GrantedAt = time.Now()
+	c.WithdrawnAt = nil
+	err := db.Debug().Create(&c).Error
+	if err != nil {
+		return &PatientConsent{}, err
+	}
+	return c, nil
+}
+
+// Withdraw ends the patient's current consent of the given type
+func (c *PatientConsent) Withdraw(db *gorm.DB, mrn, consentType string, employeeID int) (*PatientConsent, error) {
+	current, err := c.FindCurrentConsent(db, mrn, consentType)
+	if err != nil {
+		return &PatientConsent{}, err
+	}
+	if !current.Active() {
+		return &PatientConsent{}, errors.New("Consent Already Withdrawn")
+	}
+	now := time.Now()
+	err = db.Debug().Model(&PatientConsent{}).Where("id = ?", current.ID).UpdateColumns(
+		map[string]interface{}{
+			"withdrawn_at": now,
+			"withdrawn_by": employeeID,
+		},
+	).Error
+	if err != nil {
+		return &PatientConsent{}, err
+	}
+	current.WithdrawnAt = &now
+	current.WithdrawnBy = employeeID
+	return current, nil
+}
+
+// FindCurrentConsent returns the most recent consent of a type
+func (c *PatientConsent) FindCurrentConsent(db *gorm.DB, mrn, consentType string) (*PatientConsent, error) {
+	err := db.Debug().Model(&PatientConsent{}).Where("patient_mrn = ? AND type = ?", mrn, consentType).
+		Order("granted_at desc").Order("id desc").Take(&c).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &PatientConsent{}, errors.New("Consent Not Found")
+	}
+	if err != nil {
+		return &PatientConsent{}, err
+	}
+	return c, nil
+}
+
+// FindConsentsByPatient returns the full consent history of a patient
+func (c *PatientConsent) FindConsentsByPatient(db *gorm.DB, mrn string) (*[]PatientConsent, error) {
+	var err error
+	consents := []PatientConsent{}
+	err = db.Debug().Model(&PatientConsent{}).Where("patient_mrn = ?", mrn).Order("granted_at desc").Find(&consents).Error
+	if err != nil {
+		return &[]PatientConsent{}, err
+	}
+	return &consents, err
+}
+
+// RequireConsent must be called before a patient's data is used for
+// anything outside their own care: notifications, exports, sharing with
+// insurers or research. It returns ErrConsentMissing unless the patient's
+// latest consent of that type is in force.
+func RequireConsent(db *gorm.DB, mrn, consentType string) error {
+	consent := PatientConsent{}
+	current, err := consent.FindCurrentConsent(db, mrn, consentType)
+	if err != nil || !current.Active() {
+		return ErrConsentMissing
+	}
+	return nil
+}
+
+// ConsentedPatients returns the MRNs of patients whose consent of the given
+// type is in force, for bulk jobs that would otherwise call RequireConsent
+// once per patient
+func ConsentedPatients(db *gorm.DB, consentType string) (map[string]bool, error) {
+	consents := []PatientConsent{}
+	err := db.Debug().Model(&PatientConsent{}).Where("type = ?", consentType).
+		Order("patient_mrn").Order("granted_at desc").Order("id desc").Find(&consents).Error
+	if err != nil {
+		return nil, err
+	}
+	consented := map[string]bool{}
+	seen := map[string]bool{}
+	for _, c := range consents {
+		if seen[c.PatientMRN] {
+			continue
+		}
+		seen[c.PatientMRN] = true
+		if c.Active() {
+			consented[c.PatientMRN] = true
+		}
+	}
+	return consented, nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/encryption"
+)
+
+// DataKey is a key that sensitive fields are encrypted with, stored wrapped
+// by a master key. New values are sealed with the active key; older keys
+// are kept to open values that have not been re-encrypted yet.
+type DataKey struct {
+	ID          uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	MasterKeyID string     `gorm:"size:50;not null" json:"master_key_id"`
+	WrappedKey  string     `gorm:"size:255;not null" json:"-"`
+	Active      bool       `gorm:"not null;default:false" json:"active"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	RetiredAt   *time.Time `json:"retired_at,omitempty"`
+}
+
+// FindDataKeys lists every data key, newest first
+func (k *DataKey) FindDataKeys(db *gorm.DB) (*[]DataKey, error) {
+	keys := []DataKey{}
+	if err := db.Debug().Model(&DataKey{}).Order("id desc").Find(&keys).Error; err != nil {
+		return &[]DataKey{}, err
+	}
+	return &keys, nil
+}
+
+// LoadDataKeys unwraps every data key with the configured master keys and
+// makes the active one current, creating it on a new database. Keys still
+// wrapped by an older master key are rewrapped with the current one, so an
+// old master key can be removed from the configuration once this has run.
+// It is safe to call again to pick up keys rotated by another instance.
+func LoadDataKeys(db *gorm.DB) error {
+	keys := []DataKey{}
+	if err := db.Debug().Model(&DataKey{}).Order("id").Find(&keys).Error; err != nil {
+		return err
+	}
+	var active uint32
+	for _, k := range keys {
+		key, err := encryption.UnwrapDataKey(k.MasterKeyID, k.WrappedKey)
+		if err != nil {
+			return fmt.Errorf("Data Key %d Under Master Key %s: %v", k.ID, k.MasterKeyID, err)
+		}
+		if k.MasterKeyID != encryption.CurrentMasterKey() {
+			masterID, wrapped, err := encryption.WrapDataKey(key)
+			if err != nil {
+				return err
+			}
+			err = db.Debug().Model(&DataKey{}).Where("id = ? AND master_key_id = ?", k.ID, k.MasterKeyID).UpdateColumns(
+				map[string]interface{}{
+					"master_key_id": masterID,
+					"wrapped_key":   wrapped,
+				},
+			).Error
+			if err != nil {
+				return err
+			}
+		}
+		if err = encryption.AddDataKey(k.ID, key); err != nil {
+			return err
+		}
+		if k.Active {
+			active = k.ID
+		}
+	}
+	encryption.SetLoader(func(id uint32) ([]byte, error) {
+		k := DataKey{}
+		err := db.Debug().Model(&DataKey{}).Where("id = ?", id).Take(&k).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return nil, encryption.ErrUnknownKey
+		}
+		if err != nil {
+			return nil, err
+		}
+		return encryption.UnwrapDataKey(k.MasterKeyID, k.WrappedKey)
+	})
+	if active == 0 {
+		_, err := RotateDataKey(db)
+		return err
+	}
+	return encryption.SetCurrentDataKey(active)
+}
+
+// RotateDataKey creates a new active data key and retires the previous
+// one. Values sealed with retired keys stay readable and are re-encrypted
+// in the background by ReencryptFields.
+func RotateDataKey(db *gorm.DB) (*DataKey, error) {
+	key, err := encryption.NewDataKey()
+	if err != nil {
+		return &DataKey{}, err
+	}
+	masterID, wrapped, err := encryption.WrapDataKey(key)
+	if err != nil {
+		return &DataKey{}, err
+	}
+	k := DataKey{MasterKeyID: masterID, WrappedKey: wrapped, Active: true}
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return &DataKey{}, err
+	}
+
+	err = tx.Debug().Model(&DataKey{}).Where("active = ?", true).UpdateColumns(
+		map[string]interface{}{
+			"active":     false,
+			"retired_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &DataKey{}, err
+	}
+	if err = tx.Debug().Create(&k).Error; err != nil {
+		tx.Rollback()
+		return &DataKey{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &DataKey{}, err
+	}
+
+	if err = encryption.AddDataKey(k.ID, key); err != nil {
+		return &DataKey{}, err
+	}
+	if err = encryption.SetCurrentDataKey(k.ID); err != nil {
+		return &DataKey{}, err
+	}
+	return &k, nil
+}
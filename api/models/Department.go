@@ -0,0 +1,129 @@
+package models
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Department ...
+type Department struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Code      string    `gorm:"size:20;not null;unique" json:"code"`
+	Name      string    `gorm:"size:100;not null;unique" json:"name"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Specialty is a clinical specialty practised within a department
+type Specialty struct {
+	ID           uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	DepartmentID uint32    `gorm:"not null;index" json:"department_id"`
+	Name         string    `gorm:"size:100;not null;unique" json:"name"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// Validate ...
+func (d *Department) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if d.Code == "" {
+			return errors.New("Required Code")
+		}
+		if d.Name == "" {
+			return errors.New("Required Name")
+		}
+		return nil
+	}
+}
+
+// SaveDepartment ...
+func (d *Department) SaveDepartment(db *gorm.DB) (*Department, error) {
+	var err error
+	err = db.Debug().Create(&d).Error
+	if err != nil {
+		return &Department{}, err
+	}
+	return d, nil
+}
+
+// FindAllDepartments ...
+func (d *Department) FindAllDepartments(db *gorm.DB) (*[]Department, error) {
+	var err error
+	departments := []Department{}
+	err = db.Debug().Model(&Department{}).Order("name").Limit(100).Find(&departments).Error
+	if err != nil {
+		return &[]Department{}, err
+	}
+	return &departments, err
+}
+
+// FindDepartmentByID ...
+func (d *Department) FindDepartmentByID(db *gorm.DB, id uint32) (*Department, error) {
+	var err error
+	err = db.Debug().Model(Department{}).Where("id = ?", id).Take(&d).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Department{}, errors.New("Department Not Found")
+	}
+	if err != nil {
+		return &Department{}, err
+	}
+	return d, nil
+}
+
+// FindDepartmentByCodeOrID looks a department up by its code, or by its id
+// when the value is numeric
+func (d *Department) FindDepartmentByCodeOrID(db *gorm.DB, value string) (*Department, error) {
+	if id, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return d.FindDepartmentByID(db, uint32(id))
+	}
+	err := db.Debug().Model(Department{}).Where("code = ?", strings.ToUpper(value)).Take(&d).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Department{}, errors.New("Department Not Found")
+	}
+	if err != nil {
+		return &Department{}, err
+	}
+	return d, nil
+}
+
+// Validate ...
+func (s *Specialty) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if s.DepartmentID == 0 {
+			return errors.New("Required Department ID")
+		}
+		if s.Name == "" {
+			return errors.New("Required Name")
+		}
+		return nil
+	}
+}
+
+// SaveSpecialty ...
+func (s *Specialty) SaveSpecialty(db *gorm.DB) (*Specialty, error) {
+	department := Department{}
+	if _, err := department.FindDepartmentByID(db, s.DepartmentID); err != nil {
+		return &Specialty{}, err
+	}
+	err := db.Debug().Create(&s).Error
+	if err != nil {
+		return &Specialty{}, err
+	}
+	return s, nil
+}
+
+// FindAllSpecialties ...
+func (s *Specialty) FindAllSpecialties(db *gorm.DB) (*[]Specialty, error) {
+	var err error
+	specialties := []Specialty{}
+	err = db.Debug().Model(&Specialty{}).Order("name").Limit(100).Find(&specialties).Error
+	if err != nil {
+		return &[]Specialty{}, err
+	}
+	return &specialties, err
+}
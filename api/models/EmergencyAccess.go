@@ -0,0 +1,179 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// EmergencyAccessDuration is how long a break the glass grant lasts
+var EmergencyAccessDuration = 4 * time.Hour
+
+// minEmergencyReasonLength keeps reasons from being a single word
+const minEmergencyReasonLength = 10
+
+// EmergencyAccess is a "break the glass" grant: an employee without
+// clearance reads a patient's restricted examinations in an emergency. It
+// needs a reason, lapses after EmergencyAccessDuration and is raised with
+// compliance staff, who review every grant.
+type EmergencyAccess struct {
+	ID         uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	EmployeeID int        `gorm:"not null;index" json:"employee_id"`
+	MRN        string     `gorm:"size:20;not null;index" json:"mrn"`
+	Reason     string     `gorm:"size:500;not null" json:"reason"`
+	GrantedAt  time.Time  `gorm:"not null" json:"granted_at"`
+	ExpiresAt  time.Time  `gorm:"not null;index" json:"expires_at"`
+	ReviewedBy int        `json:"reviewed_by,omitempty"`
+	ReviewedAt *time.Time `json:"reviewed_at,omitempty"`
+	ReviewNote string     `gorm:"size:500" json:"review_note,omitempty"`
+}
+
+// Validate ...
+func (a *EmergencyAccess) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case "review":
+		if len(a.ReviewNote) > 500 {
+			return errors.New("Review Note Too Long")
+		}
+		return nil
+
+	default:
+		a.Reason = strings.TrimSpace(a.Reason)
+		if a.Reason == "" {
+			return errors.New("Required Reason")
+		}
+		if len(a.Reason) < minEmergencyReasonLength {
+			return errors.New("Reason Too Short")
+		}
+		if len(a.Reason) > 500 {
+			return errors.New("Reason Too Long")
+		}
+		if a.MRN == "" {
+			return errors.New("Required MRN")
+		}
+		if a.EmployeeID == 0 {
+			return errors.New("Required Employee")
+		}
+		return nil
+	}
+}
+
+// Active reports whether the grant has not expired at t
+func (a *EmergencyAccess) Active(t time.Time) bool {
+	return t.Before(a.ExpiresAt)
+}
+
+// SaveEmergencyAccess grants access from now for EmergencyAccessDuration
+// and raises a compliance alert about it in the same transaction, so no
+// grant goes unreported
+func (a *EmergencyAccess) SaveEmergencyAccess(db *gorm.DB, now time.Time) (*EmergencyAccess, *ComplianceAlert, error) {
+	a.ID = 0
+	a.GrantedAt = now
+	a.ExpiresAt = now.Add(EmergencyAccessDuration)
+	a.ReviewedBy, a.ReviewedAt, a.ReviewNote = 0, nil, ""
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return &EmergencyAccess{}, &ComplianceAlert{}, err
+	}
+
+	if err := tx.Debug().Create(&a).Error; err != nil {
+		tx.Rollback()
+		return &EmergencyAccess{}, &ComplianceAlert{}, err
+	}
+	alert := ComplianceAlert{
+		Kind:              AlertBreakGlass,
+		EmergencyAccessID: a.ID,
+		EmployeeID:        a.EmployeeID,
+		MRN:               a.MRN,
+		Message: fmt.Sprintf("Employee %d opened the restricted records of %s until %s: %s",
+			a.EmployeeID, a.MRN, a.ExpiresAt.Format(time.RFC3339), a.Reason),
+		CreatedAt: now,
+	}
+	if err := tx.Debug().Create(&alert).Error; err != nil {
+		tx.Rollback()
+		return &EmergencyAccess{}, &ComplianceAlert{}, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return &EmergencyAccess{}, &ComplianceAlert{}, err
+	}
+	return a, &alert, nil
+}
+
+// FindEmergencyAccessByID ...
+func (a *EmergencyAccess) FindEmergencyAccessByID(db *gorm.DB, id uint32) (*EmergencyAccess, error) {
+	err := db.Debug().Model(&EmergencyAccess{}).Where("id = ?", id).Take(&a).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &EmergencyAccess{}, errors.New("Emergency Access Not Found")
+	}
+	if err != nil {
+		return &EmergencyAccess{}, err
+	}
+	return a, nil
+}
+
+// FindEmergencyAccesses lists grants, newest first, narrowed to a patient
+// and an employee unless they are empty, and to those not yet reviewed
+func (a *EmergencyAccess) FindEmergencyAccesses(db *gorm.DB, mrn string, employeeID int, unreviewed bool) (*[]EmergencyAccess, error) {
+	grants := []EmergencyAccess{}
+	query := db.Debug().Model(&EmergencyAccess{})
+	if mrn != "" {
+		query = query.Where("mrn = ?", mrn)
+	}
+	if employeeID != 0 {
+		query = query.Where("employee_id = ?", employeeID)
+	}
+	if unreviewed {
+		query = query.Where("reviewed_at IS NULL")
+	}
+	if err := query.Order("granted_at desc").Limit(100).Find(&grants).Error; err != nil {
+		return &[]EmergencyAccess{}, err
+	}
+	return &grants, nil
+}
+
+// Review records a compliance review of the grant and acknowledges its
+// alert. A grant is reviewed once, and not by the employee who broke the
+// glass.
+func (a *EmergencyAccess) Review(db *gorm.DB, reviewerID int, note string, now time.Time) (*EmergencyAccess, error) {
+	if reviewerID == a.EmployeeID {
+		return &EmergencyAccess{}, errors.New("Cannot Review Own Emergency Access")
+	}
+	a.ReviewNote = strings.TrimSpace(note)
+	if err := a.Validate("review"); err != nil {
+		return &EmergencyAccess{}, err
+	}
+	update := db.Debug().Model(&EmergencyAccess{}).Where("id = ? AND reviewed_at IS NULL", a.ID).UpdateColumns(
+		map[string]interface{}{
+			"reviewed_by": reviewerID,
+			"reviewed_at": now,
+			"review_note": a.ReviewNote,
+		},
+	)
+	if update.Error != nil {
+		return &EmergencyAccess{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return &EmergencyAccess{}, errors.New("Emergency Access Already Reviewed")
+	}
+	err := db.Debug().Model(&ComplianceAlert{}).Where("emergency_access_id = ? AND acknowledged_at IS NULL", a.ID).UpdateColumns(
+		map[string]interface{}{
+			"acknowledged_by": reviewerID,
+			"acknowledged_at": now,
+		},
+	).Error
+	if err != nil {
+		return &EmergencyAccess{}, err
+	}
+	return a.FindEmergencyAccessByID(db, a.ID)
+}
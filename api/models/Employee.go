@@ -14,13 +14,78 @@ import (
 
 // Employee ...
 type Employee struct {
-	EmployeeID int       `gorm:"primary_key;auto_increment" json:"employee_id"`
-	Name       string    `gorm:"size:255;not null;unique" json:"name"`
-	Email      string    `gorm:"size:100;not null;unique" json:"email"`
-	Password   string    `gorm:"size:100;not null;" json:"password"`
-	Department string    `gorm:"size:100;not null;" json:"department"`
-	CreatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt  time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	EmployeeID      int         `gorm:"primary_key;auto_increment" json:"employee_id"`
+	Name            string      `gorm:"size:255;not null;unique" json:"name"`
+	Email           string      `gorm:"size:100;not null;unique" json:"email"`
+	Password        string      `gorm:"size:100;not null;" json:"password"`
+	DepartmentID    uint32      `gorm:"not null;index" json:"department_id"`
+	Department      *Department `gorm:"foreignkey:DepartmentID" json:"department,omitempty"`
+	SpecialtyID     uint32      `json:"specialty_id"`
+	Specialty       *Specialty  `gorm:"foreignkey:SpecialtyID" json:"specialty,omitempty"`
+	JobTitle        string      `gorm:"size:100" json:"job_title"`
+	LicenseNumber   string      `gorm:"size:50" json:"license_number"`
+	LicenseExpiry   string      `gorm:"size:10" json:"license_expiry"`
+	LicenseExpiring bool        `gorm:"-" json:"license_expiring"`
+	Active          bool        `gorm:"not null;default:true" json:"active"`
+	Role            string      `gorm:"size:20;not null;default:'staff'" json:"role"`
+	Clearances      string      `gorm:"size:255" json:"clearances"`
+	CreatedAt       time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt       time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// LicenseWarningWindow is how long before its expiry a professional license
+// is flagged as expiring
+var LicenseWarningWindow = 60 * 24 * time.Hour
+
+// Employee roles. Compliance staff review emergency access to restricted
+// records.
+const (
+	RoleStaff      = "staff"
+	RoleAdmin      = "admin"
+	RoleCompliance = "compliance"
+)
+
+// EmployeeRoles lists the roles an employee may be given
+var EmployeeRoles = []string{RoleStaff, RoleAdmin, RoleCompliance}
+
+// IsAdmin ...
+func (e *Employee) IsAdmin() bool {
+	return e.Role == RoleAdmin
+}
+
+// IsCompliance ...
+func (e *Employee) IsCompliance() bool {
+	return e.Role == RoleCompliance
+}
+
+// HasClearance reports whether the employee is cleared to read records
+// with the given sensitivity label
+func (e *Employee) HasClearance(label string) bool {
+	for _, c := range splitLabels(e.Clearances) {
+		if c == label {
+			return true
+		}
+	}
+	return false
+}
+
+// LicenseExpiresWithin reports whether the employee's license has expired or
+// will expire within d of t. Employees without a license are never flagged.
+func (e *Employee) LicenseExpiresWithin(t time.Time, d time.Duration) bool {
+	if e.LicenseExpiry == "" {
+		return false
+	}
+	expiry, err := time.Parse("2006-01-02", e.LicenseExpiry)
+	if err != nil {
+		return false
+	}
+	return !expiry.After(t.Add(d))
+}
+
+// AfterFind flags licenses that expire within LicenseWarningWindow
+func (e *Employee) AfterFind() error {
+	e.LicenseExpiring = e.LicenseExpiresWithin(time.Now(), LicenseWarningWindow)
+	return nil
 }
 
 // BeforeSave ...
@@ -40,9 +105,12 @@ func (e *Employee) Validate(action string) error {
 		if e.Name == "" {
 			return errors.New("Required Name")
 		}
-		if e.Department == "" {
+		if e.DepartmentID == 0 {
 			return errors.New("Required Department")
 		}
+		if err := e.validateLicense(); err != nil {
+			return err
+		}
 		if e.Password == "" {
 			return errors.New("Required Password")
 		}
@@ -73,9 +141,12 @@ func (e *Employee) Validate(action string) error {
 		if e.Name == "" {
 			return errors.New("Required Name")
 		}
-		if e.Department == "" {
+		if e.DepartmentID == 0 {
 			return errors.New("Required Department")
 		}
+		if err := e.validateLicense(); err != nil {
+			return err
+		}
 		if e.Password == "" {
 			return errors.New("Required Password")
 		}
@@ -92,6 +163,19 @@ func (e *Employee) Validate(action string) error {
 	}
 }
 
+func (e *Employee) validateLicense() error {
+	if e.LicenseExpiry == "" {
+		return nil
+	}
+	if e.LicenseNumber == "" {
+		return errors.New("Required License Number")
+	}
+	if _, err := time.Parse("2006-01-02", e.LicenseExpiry); err != nil {
+		return errors.New("Invalid License Expiry")
+	}
+	return nil
+}
+
 // SaveEmployee ...
 func (e *Employee) SaveEmployee(db *gorm.DB) (*Employee, error) {
 
@@ -107,7 +191,37 @@ func (e *Employee) SaveEmployee(db *gorm.DB) (*Employee, error) {
 func (e *Employee) FindAllEmployee(db *gorm.DB) (*[]Employee, error) {
 	var err error
 	employees := []Employee{}
-	err = db.Debug().Model(&Employee{}).Limit(100).Find(&employees).Error
+	err = db.Debug().Model(&Employee{}).Preload("Department").Preload("Specialty").Limit(100).Find(&employees).Error
+	if err != nil {
+		return &[]Employee{}, err
+	}
+	return &employees, err
+}
+
+// FindEmployeesByDepartment returns the department's employees, leaving out
+// inactive ones unless includeInactive is set
+func (e *Employee) FindEmployeesByDepartment(db *gorm.DB, departmentID uint32, includeInactive bool) (*[]Employee, error) {
+	var err error
+	employees := []Employee{}
+	query := db.Debug().Model(&Employee{}).Preload("Specialty").Where("department_id = ?", departmentID)
+	if !includeInactive {
+		query = query.Where("active = ?", true)
+	}
+	err = query.Order("name").Find(&employees).Error
+	if err != nil {
+		return &[]Employee{}, err
+	}
+	return &employees, err
+}
+
+// FindExpiringLicenses returns active employees whose license expires on or
+// before the given date, soonest first
+func (e *Employee) FindExpiringLicenses(db *gorm.DB, before time.Time) (*[]Employee, error) {
+	var err error
+	employees := []Employee{}
+	err = db.Debug().Model(&Employee{}).Preload("Department").
+		Where("active = ? AND license_expiry <> '' AND license_expiry <= ?", true, before.Format("2006-01-02")).
+		Order("license_expiry").Find(&employees).Error
 	if err != nil {
 		return &[]Employee{}, err
 	}
@@ -117,7 +231,7 @@ func (e *Employee) FindAllEmployee(db *gorm.DB) (*[]Employee, error) {
 // FindEmployeeByID ...
 func (e *Employee) FindEmployeeByID(db *gorm.DB, employeeID int) (*Employee, error) {
 	var err error
-	err = db.Debug().Model(Employee{}).Where("employee_id = ?", employeeID).Take(&e).Error
+	err = db.Debug().Model(Employee{}).Preload("Department").Preload("Specialty").Where("employee_id = ?", employeeID).Take(&e).Error
 	if err != nil {
 		return &Employee{}, err
 	}
@@ -137,12 +251,16 @@ func (e *Employee) UpdateEmployee(db *gorm.DB, employeeID uint32) (*Employee, er
 	}
 	db = db.Debug().Model(&Employee{}).Where("employee_id=?", employeeID).Take(&Employee{}).UpdateColumns(
 		map[string]interface{}{
-			"password":    e.Password,
-			"name":        e.Name,
-			"employee_id": e.EmployeeID,
-			"department":  e.Department,
-			"email":       e.Email,
-			"updated_at":  time.Now(),
+			"password":       e.Password,
+			"name":           e.Name,
+			"employee_id":    e.EmployeeID,
+			"department_id":  e.DepartmentID,
+			"specialty_id":   e.SpecialtyID,
+			"job_title":      e.JobTitle,
+			"license_number": e.LicenseNumber,
+			"license_expiry": e.LicenseExpiry,
+			"email":          e.Email,
+			"updated_at":     time.Now(),
 		},
 	)
 	if db.Error != nil {
@@ -156,6 +274,50 @@ func (e *Employee) UpdateEmployee(db *gorm.DB, employeeID uint32) (*Employee, er
 	return e, nil
 }
 
+// SetActive activates or deactivates an employee. Inactive employees cannot
+// sign in and are left out of department listings.
+func (e *Employee) SetActive(db *gorm.DB, employeeID int, active bool) (*Employee, error) {
+	err := db.Debug().Model(&Employee{}).Where("employee_id = ?", employeeID).Take(&Employee{}).UpdateColumns(
+		map[string]interface{}{
+			"active":     active,
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &Employee{}, err
+	}
+	return e.FindEmployeeByID(db, employeeID)
+}
+
+// SetAccess changes an employee's role and the sensitivity labels they are
+// cleared for
+func (e *Employee) SetAccess(db *gorm.DB, employeeID int, role string, clearances []string) (*Employee, error) {
+	known := false
+	for _, r := range EmployeeRoles {
+		if role == r {
+			known = true
+		}
+	}
+	if !known {
+		return &Employee{}, errors.New("Invalid Role, Expected " + strings.Join(EmployeeRoles, ", "))
+	}
+	labels, err := normalizeLabels(strings.Join(clearances, ","))
+	if err != nil {
+		return &Employee{}, err
+	}
+	err = db.Debug().Model(&Employee{}).Where("employee_id = ?", employeeID).Take(&Employee{}).UpdateColumns(
+		map[string]interface{}{
+			"role":       role,
+			"clearances": labels,
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		return &Employee{}, err
+	}
+	return e.FindEmployeeByID(db, employeeID)
+}
+
 // DeleteEmployee ...
 func (e *Employee) DeleteEmployee(db *gorm.DB, employeeID uint32) (int64, error) {
 
@@ -0,0 +1,181 @@
+package models
+
+import (
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/encryption"
+	"github.com/repoerna/hms_app/api/utils/similarity"
+)
+
+// sealedTables lists the columns kept encrypted in each table, with the
+// column that identifies a row so values can be re-encrypted in place
+var sealedTables = []struct {
+	table   string
+	key     string
+	columns []string
+}{
+	{"patients", "mrn", []string{"email", "address"}},
+	{"patient_phones", "id", []string{"number"}},
+	{"emergency_contacts", "id", []string{"phone", "address"}},
+	{"examinations", "examination_id", []string{"anamnesis", "diagnosis", "prescription"}},
+}
+
+// blindIndexes names the index column kept next to each encrypted column
+// that is searched on, with the function computing it from the plaintext
+var blindIndexes = map[string]struct {
+	column string
+	index  func(string) string
+}{
+	"patients.email":        {"email_index", EmailIndex},
+	"patient_phones.number": {"number_index", PhoneIndex},
+}
+
+// EmailIndex is the blind index patients are looked up by email with.
+// Emails are compared without regard to case.
+func EmailIndex(email string) string {
+	return encryption.BlindIndex("patients.email", strings.ToLower(strings.TrimSpace(email)))
+}
+
+// PhoneIndex is the blind index of a phone number, computed from its last
+// nine digits so numbers written differently still match
+func PhoneIndex(number string) string {
+	return encryption.BlindIndex("patient_phones.number", similarity.PhoneKey(number))
+}
+
+// sealedField is an encrypted column and the model field holding it
+type sealedField struct {
+	column string
+	value  *string
+}
+
+// sealFields encrypts the fields in place before a model is written
+func sealFields(table string, fields ...sealedField) error {
+	for _, f := range fields {
+		sealed, err := encryption.Seal(table+"."+f.column, *f.value)
+		if err != nil {
+			return err
+		}
+		*f.value = sealed
+	}
+	return nil
+}
+
+// openFields decrypts the fields in place after a model is read or written
+func openFields(table string, fields ...sealedField) error {
+	for _, f := range fields {
+		plain, err := encryption.Open(table+"."+f.column, *f.value)
+		if err != nil {
+			return err
+		}
+		*f.value = plain
+	}
+	return nil
+}
+
+// sealColumns encrypts the values of encrypted columns in a map given to
+// UpdateColumns, which skips the hooks that seal models, and adds their
+// blind indexes
+func sealColumns(table string, columns map[string]interface{}) error {
+	for _, t := range sealedTables {
+		if t.table != table {
+			continue
+		}
+		for _, column := range t.columns {
+			value, ok := columns[column].(string)
+			if !ok {
+				continue
+			}
+			if index, ok := blindIndexes[table+"."+column]; ok {
+				columns[index.column] = index.index(value)
+			}
+			sealed, err := encryption.Seal(table+"."+column, value)
+			if err != nil {
+				return err
+			}
+			columns[column] = sealed
+		}
+	}
+	return nil
+}
+
+// SealedColumn reports how many values of an encrypted column are not yet
+// sealed with the current data key
+type SealedColumn struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	Stale  int    `json:"stale"`
+}
+
+// staleCondition matches values that are plaintext or sealed with a data
+// key other than the current one
+func staleCondition(column string) (string, string) {
+	return column + " <> '' AND " + column + " NOT LIKE ?", encryption.Prefix(encryption.CurrentDataKey()) + "%"
+}
+
+// FindSealedColumns counts the values of each encrypted column still
+// waiting to be re-encrypted
+func FindSealedColumns(db *gorm.DB) ([]SealedColumn, error) {
+	status := []SealedColumn{}
+	for _, t := range sealedTables {
+		for _, column := range t.columns {
+			condition, pattern := staleCondition(column)
+			count := 0
+			if err := db.Debug().Table(t.table).Where(condition, pattern).Count(&count).Error; err != nil {
+				return nil, err
+			}
+			status = append(status, SealedColumn{Table: t.table, Column: column, Stale: count})
+		}
+	}
+	return status, nil
+}
+
+// ReencryptFields seals up to limit values per column that are plaintext
+// or sealed with a retired data key, again with the current key, and
+// refreshes their blind indexes. Each value is only replaced if it has not
+// changed since it was read. It returns how many values were re-encrypted;
+// callers repeat it until that is 0.
+func ReencryptFields(db *gorm.DB, limit int) (int, error) {
+	done := 0
+	for _, t := range sealedTables {
+		for _, column := range t.columns {
+			context := t.table + "." + column
+			condition, pattern := staleCondition(column)
+			rows, err := db.Debug().Table(t.table).Select(t.key+", "+column).Where(condition, pattern).Order(t.key).Limit(limit).Rows()
+			if err != nil {
+				return done, err
+			}
+			stale := map[string]string{}
+			for rows.Next() {
+				var key, value string
+				if err = rows.Scan(&key, &value); err != nil {
+					rows.Close()
+					return done, err
+				}
+				stale[key] = value
+			}
+			rows.Close()
+
+			for key, value := range stale {
+				plain, err := encryption.Open(context, value)
+				if err != nil {
+					return done, err
+				}
+				sealed, err := encryption.Seal(context, plain)
+				if err != nil {
+					return done, err
+				}
+				columns := map[string]interface{}{column: sealed}
+				if index, ok := blindIndexes[context]; ok {
+					columns[index.column] = index.index(plain)
+				}
+				update := db.Debug().Table(t.table).Where(t.key+" = ? AND "+column+" = ?", key, value).UpdateColumns(columns)
+				if update.Error != nil {
+					return done, update.Error
+				}
+				done += int(update.RowsAffected)
+			}
+		}
+	}
+	return done, nil
+}
@@ -13,16 +13,59 @@ type Examination struct {
 	ExaminationID uint32    `gorm:"primary_key;auto_increment" json:"examination_id"`
 	AppointmentID uint32    `gorm:"not null" json:"apointment_id"`
 	ScheduleCode  string    `gorm:"not null" json:"schedule_code"`
-	SSN           int       `gorm:"not null" json:"ssn"`
+	MRN           string    `gorm:"size:20;index" json:"mrn"`
 	EmployeeID    int       `gorm:"not null" json:"employee_id"`
-	Anamnesis     string    `gorm:"not null" json:"anamnesis"`
-	Diagnosis     string    `gorm:"not null" json:"diagnosis"`
-	Prescription  string    `gorm:"not null" json:"prescription"`
+	Anamnesis     string    `gorm:"type:text;not null" json:"anamnesis"`
+	Diagnosis     string    `gorm:"type:text;not null" json:"diagnosis"`
+	Prescription  string    `gorm:"type:text;not null" json:"prescription"`
+	Sensitivity   string    `gorm:"size:255" json:"sensitivity"`
+	Redacted      bool      `gorm:"-" json:"redacted,omitempty"`
 	Status        string    `gorm:"default:'available'" json:"status"`
 	CreatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
 	UpdatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
+// ExaminationCompleted is the status of an examination the doctor has
+// finalized
+const ExaminationCompleted = "completed"
+
+// Labels returns the examination's sensitivity labels
+func (e *Examination) Labels() []string {
+	return splitLabels(e.Sensitivity)
+}
+
+// Restricted reports whether the examination has any sensitivity label
+func (e *Examination) Restricted() bool {
+	return e.Sensitivity != ""
+}
+
+// Redact blanks the clinical notes for a reader without access. The labels
+// are blanked too, as they say as much as a diagnosis would.
+func (e *Examination) Redact() {
+	e.Anamnesis, e.Diagnosis, e.Prescription = "", "", ""
+	e.Sensitivity = ""
+	e.Redacted = true
+}
+
+// BeforeSave encrypts the clinical notes
+func (e *Examination) BeforeSave() error {
+	return sealFields("examinations", e.sealedFields()...)
+}
+
+// AfterSave ...
+func (e *Examination) AfterSave() error {
+	return openFields("examinations", e.sealedFields()...)
+}
+
+// AfterFind ...
+func (e *Examination) AfterFind() error {
+	return openFields("examinations", e.sealedFields()...)
+}
+
+func (e *Examination) sealedFields() []sealedField {
+	return []sealedField{{"anamnesis", &e.Anamnesis}, {"diagnosis", &e.Diagnosis}, {"prescription", &e.Prescription}}
+}
+
 // Validate ...
 func (e *Examination) Validate(action string) error {
 	switch strings.ToLower(action) {
@@ -33,12 +76,17 @@ func (e *Examination) Validate(action string) error {
 		if e.ScheduleCode == "" {
 			return errors.New("Required Schedule")
 		}
-		if e.SSN == 0 {
-			return errors.New("Required SSN")
+		if e.MRN == "" {
+			return errors.New("Required MRN")
 		}
 		if e.EmployeeID == 0 {
 			return errors.New("Required SSN")
 		}
+		labels, err := normalizeLabels(e.Sensitivity)
+		if err != nil {
+			return err
+		}
+		e.Sensitivity = labels
 		return nil
 
 	default:
@@ -48,12 +96,17 @@ func (e *Examination) Validate(action string) error {
 		if e.ScheduleCode == "" {
 			return errors.New("Required Schedule")
 		}
-		if e.SSN == 0 {
-			return errors.New("Required SSN")
+		if e.MRN == "" {
+			return errors.New("Required MRN")
 		}
 		if e.EmployeeID == 0 {
 			return errors.New("Required SSN")
 		}
+		labels, err := normalizeLabels(e.Sensitivity)
+		if err != nil {
+			return err
+		}
+		e.Sensitivity = labels
 		return nil
 	}
 }
@@ -113,9 +166,10 @@ func (e *Examination) UpdateExamination(db *gorm.DB, eid uint32) (*Examination,
 			"examination_id": e.ExaminationID,
 			"appointment_id": e.AppointmentID,
 			"schedule_code":  e.ScheduleCode,
-			"ssn":            e.SSN,
+			"mrn":            e.MRN,
 			"employee_id":    e.EmployeeID,
 			"status":         e.Status,
+			"sensitivity":    e.Sensitivity,
 			"updated_at":     time.Now(),
 		},
 	).Error; err != nil {
@@ -129,6 +183,14 @@ func (e *Examination) UpdateExamination(db *gorm.DB, eid uint32) (*Examination,
 		return &Examination{}, err
 	}
 
+	// A completed consultation is charged to the visit's invoice
+	if e.Status == ExaminationCompleted {
+		if err := CaptureExaminationCharge(tx, e); err != nil {
+			tx.Rollback()
+			return &Examination{}, err
+		}
+	}
+
 	// Update status on schedule
 	getExamination, err := e.FindExaminationByID(tx, eid)
 	if err != nil {
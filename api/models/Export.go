@@ -0,0 +1,201 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Export formats. FHIR writes one FHIR resource per line, as in the FHIR
+// bulk data format.
+const (
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+	ExportFHIR   = "fhir"
+)
+
+// Export job statuses
+const (
+	ExportQueued    = "queued"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+	ExportExpired   = "expired"
+)
+
+// ExportResources lists what can be exported
+var ExportResources = []string{"appointments", "examinations"}
+
+// ExportJob is a request for a file of every matching record. The file is
+// written in the background and deleted once ExpiresAt has passed. Only
+// patients who have consented to research use are included.
+type ExportJob struct {
+	ID          uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	Resource    string     `gorm:"size:30;not null" json:"resource"`
+	Format      string     `gorm:"size:10;not null" json:"format"`
+	DateFrom    string     `gorm:"size:10" json:"from"`
+	DateTo      string     `gorm:"size:10" json:"to"`
+	Columns     string     `gorm:"size:500" json:"columns"`
+	Redacted    string     `gorm:"size:500" json:"redacted"`
+	Status      string     `gorm:"size:20;not null;index" json:"status"`
+	RequestedBy int        `gorm:"not null;index" json:"requested_by"`
+	RowCount    int        `json:"rows"`
+	Excluded    int        `json:"excluded"`
+	Size        int64      `json:"size"`
+	Path        string     `gorm:"size:500" json:"-"`
+	Error       string     `gorm:"size:255" json:"error,omitempty"`
+	URL         string     `gorm:"-" json:"url,omitempty"`
+	CreatedAt   time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	CompletedAt *time.Time `json:"completed_at"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+// Validate ...
+func (e *ExportJob) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		known := false
+		for _, r := range ExportResources {
+			if e.Resource == r {
+				known = true
+			}
+		}
+		if !known {
+			return errors.New("Invalid Resource, Expected " + strings.Join(ExportResources, " Or "))
+		}
+		if e.Format != ExportCSV && e.Format != ExportNDJSON && e.Format != ExportFHIR {
+			return errors.New("Invalid Format, Expected csv, ndjson Or fhir")
+		}
+		var from, to time.Time
+		var err error
+		if e.DateFrom != "" {
+			if from, err = time.ParseInLocation("2006-01-02", e.DateFrom, time.Local); err != nil {
+				return errors.New("Invalid From Date")
+			}
+		}
+		if e.DateTo != "" {
+			if to, err = time.ParseInLocation("2006-01-02", e.DateTo, time.Local); err != nil {
+				return errors.New("Invalid To Date")
+			}
+		}
+		if e.DateFrom != "" && e.DateTo != "" && to.Before(from) {
+			return errors.New("To Date Is Before From Date")
+		}
+		return nil
+	}
+}
+
+// ColumnList returns the selected columns, or nil for all of them
+func (e *ExportJob) ColumnList() []string {
+	if e.Columns == "" {
+		return nil
+	}
+	return strings.Split(e.Columns, ",")
+}
+
+// SaveExportJob ...
+func (e *ExportJob) SaveExportJob(db *gorm.DB) (*ExportJob, error) {
+	e.Status = ExportQueued
+	if err := db.Debug().Create(&e).Error; err != nil {
+		return &ExportJob{}, err
+	}
+	return e, nil
+}
+
+// FindExportJobByID ...
+func (e *ExportJob) FindExportJobByID(db *gorm.DB, id uint32) (*ExportJob, error) {
+	err := db.Debug().Model(&ExportJob{}).Where("id = ?", id).Take(&e).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &ExportJob{}, errors.New("Export Not Found")
+	}
+	if err != nil {
+		return &ExportJob{}, err
+	}
+	return e, nil
+}
+
+// FindExportJobs returns the latest jobs, of one employee unless
+// employeeID is 0
+func (e *ExportJob) FindExportJobs(db *gorm.DB, employeeID int) (*[]ExportJob, error) {
+	jobs := []ExportJob{}
+	query := db.Debug().Model(&ExportJob{})
+	if employeeID != 0 {
+		query = query.Where("requested_by = ?", employeeID)
+	}
+	if err := query.Order("id desc").Limit(100).Find(&jobs).Error; err != nil {
+		return &[]ExportJob{}, err
+	}
+	return &jobs, nil
+}
+
+func (e *ExportJob) update(db *gorm.DB, columns map[string]interface{}) error {
+	return db.Debug().Model(&ExportJob{}).Where("id = ?", e.ID).UpdateColumns(columns).Error
+}
+
+// Start marks the job as running and records where its file goes
+func (e *ExportJob) Start(db *gorm.DB, path string) error {
+	e.Status = ExportRunning
+	e.Path = path
+	return e.update(db, map[string]interface{}{"status": e.Status, "path": path})
+}
+
+// Complete records a finished file, kept until expiresAt
+func (e *ExportJob) Complete(db *gorm.DB, rows, excluded int, size int64, now, expiresAt time.Time) error {
+	e.Status = ExportCompleted
+	e.RowCount, e.Excluded, e.Size = rows, excluded, size
+	e.CompletedAt, e.ExpiresAt = &now, &expiresAt
+	return e.update(db, map[string]interface{}{
+		"status":       e.Status,
+		"row_count":    rows,
+		"excluded":     excluded,
+		"size":         size,
+		"completed_at": now,
+		"expires_at":   expiresAt,
+	})
+}
+
+// Fail records why a job did not finish
+func (e *ExportJob) Fail(db *gorm.DB, reason error) error {
+	e.Status = ExportFailed
+	e.Error = reason.Error()
+	if len(e.Error) > 255 {
+		e.Error = e.Error[:255]
+	}
+	return e.update(db, map[string]interface{}{"status": e.Status, "error": e.Error, "path": ""})
+}
+
+// Expire records that the job's file has been deleted
+func (e *ExportJob) Expire(db *gorm.DB) error {
+	e.Status = ExportExpired
+	return e.update(db, map[string]interface{}{"status": e.Status, "path": ""})
+}
+
+// FindExpiredExportJobs returns completed jobs whose files are due for
+// deletion at now
+func FindExpiredExportJobs(db *gorm.DB, now time.Time) ([]ExportJob, error) {
+	jobs := []ExportJob{}
+	err := db.Debug().Model(&ExportJob{}).Where("status = ? AND expires_at < ?", ExportCompleted, now).Find(&jobs).Error
+	return jobs, err
+}
+
+// FailInterruptedExportJobs fails jobs left queued or running by a restart.
+// It returns the paths of their partial files so they can be removed.
+func FailInterruptedExportJobs(db *gorm.DB) ([]string, error) {
+	jobs := []ExportJob{}
+	err := db.Debug().Model(&ExportJob{}).Where("status IN (?)", []string{ExportQueued, ExportRunning}).Find(&jobs).Error
+	if err != nil {
+		return nil, err
+	}
+	paths := []string{}
+	for i := range jobs {
+		if jobs[i].Path != "" {
+			paths = append(paths, jobs[i].Path)
+		}
+		if err = jobs[i].Fail(db, errors.New("Interrupted By A Restart")); err != nil {
+			return nil, err
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ExternalAppointment links an appointment booked by another system to the
+// id that system knows it by, so a repeated or cancelling message finds the
+// same appointment. Source identifies the sending application.
+type ExternalAppointment struct {
+	ID            uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Source        string    `gorm:"size:100;not null;unique_index:idx_external_appointment" json:"source"`
+	ExternalID    string    `gorm:"size:100;not null;unique_index:idx_external_appointment" json:"external_id"`
+	AppointmentID uint32    `gorm:"not null;index" json:"appointment_id"`
+	CreatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// FindExternalAppointment returns the link for an id from source
+func (e *ExternalAppointment) FindExternalAppointment(db *gorm.DB, source, externalID string) (*ExternalAppointment, error) {
+	err := db.Debug().Model(&ExternalAppointment{}).Where("source = ? AND external_id = ?", source, externalID).Take(&e).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &ExternalAppointment{}, errors.New("External Appointment Not Found")
+	}
+	if err != nil {
+		return &ExternalAppointment{}, err
+	}
+	return e, nil
+}
+
+// BookExternal books an appointment for another system and links it to
+// externalID in the same transaction
+func (a *Appointment) BookExternal(db *gorm.DB, source, externalID string, now time.Time) (*Appointment, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return &Appointment{}, err
+	}
+
+	booked, err := a.book(tx, now)
+	if err != nil {
+		tx.Rollback()
+		return &Appointment{}, err
+	}
+	link := ExternalAppointment{Source: source, ExternalID: externalID, AppointmentID: booked.AppointmentID}
+	if err = tx.Debug().Create(&link).Error; err != nil {
+		tx.Rollback()
+		return &Appointment{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &Appointment{}, err
+	}
+	return booked, nil
+}
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/utils/identifier"
+)
+
+// DocumentSigningKey signs the serial numbers of issued documents
+var DocumentSigningKey []byte
+
+// ErrDocumentNotFound is returned for serials that were never issued, or
+// whose signature does not match the record
+var ErrDocumentNotFound = errors.New("Document Not Found")
+
+// IssuedDocument is a printed clinical document, recorded under a signed
+// serial number so that anyone shown the paper, such as an employer, can
+// check it was issued by the clinic and has not been revoked. The serial
+// is signed together with the examination and patient it was issued for.
+type IssuedDocument struct {
+	ID               uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	Serial           string     `gorm:"size:30;not null;unique_index" json:"serial"`
+	Type             string     `gorm:"size:30;not null" json:"type"`
+	ExaminationID    uint32     `gorm:"not null;index" json:"examination_id"`
+	MRN              string     `gorm:"size:20;not null;index" json:"mrn"`
+	ReferralID       uint32     `gorm:"not null;default:0" json:"referral_id,omitempty"`
+	ValidFrom        string     `gorm:"size:10" json:"valid_from,omitempty"`
+	ValidTo          string     `gorm:"size:10" json:"valid_to,omitempty"`
+	Purpose          string     `gorm:"size:100" json:"purpose,omitempty"`
+	IssuedBy         int        `json:"issued_by"`
+	IssuedAt         time.Time  `gorm:"not null" json:"issued_at"`
+	RevokedAt        *time.Time `json:"revoked_at"`
+	RevokedBy        int        `json:"revoked_by,omitempty"`
+	RevocationReason string     `gorm:"size:255" json:"revocation_reason,omitempty"`
+}
+
+// subject is what the serial's signature binds it to
+func (d *IssuedDocument) subject() string {
+	return fmt.Sprintf("%s|%d|%s", d.Type, d.ExaminationID, d.MRN)
+}
+
+// Revoked reports whether the document has been withdrawn
+func (d *IssuedDocument) Revoked() bool {
+	return d.RevokedAt != nil
+}
+
+// Issue records a document under a new serial starting with prefix. A
+// document already issued with the same details and not revoked is
+// returned instead, so a reprint carries the same serial.
+func (d *IssuedDocument) Issue(db *gorm.DB, prefix string) (*IssuedDocument, error) {
+	existing := IssuedDocument{}
+	err := db.Debug().Model(&IssuedDocument{}).
+		Where("type = ? AND examination_id = ? AND mrn = ? AND referral_id = ? AND valid_from = ? AND valid_to = ? AND purpose = ? AND revoked_at IS NULL",
+			d.Type, d.ExaminationID, d.MRN, d.ReferralID, d.ValidFrom, d.ValidTo, d.Purpose).
+		Order("id desc").Take(&existing).Error
+	if err == nil {
+		*d = existing
+		return d, nil
+	}
+	if !gorm.IsRecordNotFoundError(err) {
+		return &IssuedDocument{}, err
+	}
+	if len(DocumentSigningKey) == 0 {
+		return &IssuedDocument{}, errors.New("Document Signing Key Not Configured")
+	}
+
+	d.ID = 0
+	d.Serial, err = identifier.NewSerial(prefix, d.subject(), DocumentSigningKey)
+	if err != nil {
+		return &IssuedDocument{}, err
+	}
+	d.IssuedAt = time.Now()
+	d.RevokedAt = nil
+	if err = db.Debug().Create(&d).Error; err != nil {
+		return &IssuedDocument{}, err
+	}
+	return d, nil
+}
+
+// FindIssuedDocumentBySerial loads a document and checks its serial is
+// genuine for the examination and patient on record
+func (d *IssuedDocument) FindIssuedDocumentBySerial(db *gorm.DB, serial string) (*IssuedDocument, error) {
+	serial = strings.ToUpper(strings.TrimSpace(serial))
+	if !identifier.ValidSerial(serial) {
+		return &IssuedDocument{}, ErrDocumentNotFound
+	}
+	err := db.Debug().Model(&IssuedDocument{}).Where("serial = ?", serial).Take(&d).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &IssuedDocument{}, ErrDocumentNotFound
+	}
+	if err != nil {
+		return &IssuedDocument{}, err
+	}
+	if !identifier.CheckSerial(d.Serial, d.subject(), DocumentSigningKey) {
+		return &IssuedDocument{}, ErrDocumentNotFound
+	}
+	return d, nil
+}
+
+// FindIssuedDocumentsByExamination ...
+func (d *IssuedDocument) FindIssuedDocumentsByExamination(db *gorm.DB, examinationID uint32) (*[]IssuedDocument, error) {
+	issued := []IssuedDocument{}
+	err := db.Debug().Model(&IssuedDocument{}).Where("examination_id = ?", examinationID).Order("id desc").Find(&issued).Error
+	if err != nil {
+		return &[]IssuedDocument{}, err
+	}
+	return &issued, nil
+}
+
+// Revoke withdraws the document, which verification then reports
+func (d *IssuedDocument) Revoke(db *gorm.DB, employeeID int, reason string) (*IssuedDocument, error) {
+	if d.Revoked() {
+		return &IssuedDocument{}, errors.New("Document Already Revoked")
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return &IssuedDocument{}, errors.New("Required Reason")
+	}
+	if len(reason) > 255 {
+		return &IssuedDocument{}, errors.New("Reason Too Long")
+	}
+	now := time.Now()
+	err := db.Debug().Model(&IssuedDocument{}).Where("id = ? AND revoked_at IS NULL", d.ID).UpdateColumns(
+		map[string]interface{}{
+			"revoked_at":        now,
+			"revoked_by":        employeeID,
+			"revocation_reason": reason,
+		},
+	).Error
+	if err != nil {
+		return &IssuedDocument{}, err
+	}
+	d.RevokedAt = &now
+	d.RevokedBy = employeeID
+	d.RevocationReason = reason
+	return d, nil
+}
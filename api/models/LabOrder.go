@@ -0,0 +1,267 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Lab order statuses, in lifecycle order
+const (
+	LabOrdered           = "ordered"
+	LabSpecimenCollected = "specimen_collected"
+	LabResulted          = "resulted"
+	LabVerified          = "verified"
+	LabCancelled         = "cancelled"
+)
+
+// labTransitions lists the statuses an order may move to from each status
+var labTransitions = map[string][]string{
+	LabOrdered:           {LabSpecimenCollected, LabCancelled},
+	LabSpecimenCollected: {LabResulted, LabCancelled},
+	LabResulted:          {LabResulted, LabVerified},
+}
+
+// LabOrder is a request for one lab test made during an examination.
+// PatientSex and PatientAge are captured when the order is placed so that
+// the reference range used for flagging does not drift later.
+type LabOrder struct {
+	ID                  uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	ExaminationID       uint32     `gorm:"not null;index" json:"examination_id"`
+	MRN                 string     `gorm:"size:20;index" json:"mrn"`
+	LabTestID           uint32     `gorm:"not null" json:"lab_test_id"`
+	LabTest             LabTest    `gorm:"save_associations:false" json:"lab_test"`
+	OrderedBy           int        `gorm:"not null" json:"ordered_by"`
+	PatientSex          string     `gorm:"size:1" json:"patient_sex"`
+	PatientAge          int        `json:"patient_age"`
+	Status              string     `gorm:"size:30;not null;default:'ordered'" json:"status"`
+	Notes               string     `gorm:"size:255" json:"notes"`
+	SpecimenCollectedAt *time.Time `json:"specimen_collected_at"`
+	SpecimenCollectedBy int        `json:"specimen_collected_by"`
+	ResultValue         *float64   `json:"result_value"`
+	ResultText          string     `gorm:"size:255" json:"result_text"`
+	ReferenceLow        *float64   `json:"reference_low"`
+	ReferenceHigh       *float64   `json:"reference_high"`
+	Flag                string     `gorm:"size:20" json:"flag"`
+	ResultedAt          *time.Time `json:"resulted_at"`
+	ResultedBy          int        `json:"resulted_by"`
+	VerifiedAt          *time.Time `json:"verified_at"`
+	VerifiedBy          int        `json:"verified_by"`
+	Redacted            bool       `gorm:"-" json:"redacted,omitempty"`
+	CreatedAt           time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt           time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate ...
+func (o *LabOrder) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case "result":
+		if o.ResultValue == nil && o.ResultText == "" {
+			return errors.New("Required Result")
+		}
+		return nil
+
+	default:
+		if o.ExaminationID == 0 {
+			return errors.New("Required Examination ID")
+		}
+		if o.LabTestID == 0 {
+			return errors.New("Required Lab Test ID")
+		}
+		if o.PatientSex != "" && o.PatientSex != "M" && o.PatientSex != "F" {
+			return errors.New("Invalid Sex")
+		}
+		if o.PatientAge < 0 {
+			return errors.New("Invalid Age")
+		}
+		return nil
+	}
+}
+
+// CanMoveTo reports whether the order may change to status
+func (o *LabOrder) CanMoveTo(status string) bool {
+	for _, next := range labTransitions[o.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Critical reports whether the result is outside the critical limits
+func (o *LabOrder) Critical() bool {
+	return o.Flag == FlagCriticalLow || o.Flag == FlagCriticalHigh
+}
+
+// SourceExamination is the examination the order was placed in
+func (o *LabOrder) SourceExamination() uint32 {
+	return o.ExaminationID
+}
+
+// Redact blanks the test and its result for a reader without access to
+// the examination. The test name is blanked too, as it can say as much as
+// the result.
+func (o *LabOrder) Redact() {
+	o.LabTestID, o.LabTest = 0, LabTest{}
+	o.Notes, o.ResultValue, o.ResultText = "", nil, ""
+	o.ReferenceLow, o.ReferenceHigh, o.Flag = nil, nil, ""
+	o.Redacted = true
+}
+
+// SaveLabOrder places the order against an existing examination. The
+// patient is taken from the examination.
+func (o *LabOrder) SaveLabOrder(db *gorm.DB) (*LabOrder, error) {
+
+	examination := Examination{}
+	if _, err := examination.FindExaminationByID(db, o.ExaminationID); err != nil {
+		return &LabOrder{}, errors.New("Examination Not Found")
+	}
+	test := LabTest{}
+	if _, err := test.FindLabTestByID(db, o.LabTestID); err != nil {
+		return &LabOrder{}, err
+	}
+
+	o.MRN = examination.MRN
+	o.Status = LabOrdered
+
+	// Fill in sex and age from the patient record unless given explicitly
+	patient := Patient{}
+	if _, err := patient.FindPatientByMRN(db, o.MRN); err == nil {
+		if o.PatientSex == "" {
+			o.PatientSex = patient.Sex
+		}
+		if o.PatientAge == 0 && patient.Age(time.Now()) > 0 {
+			o.PatientAge = patient.Age(time.Now())
+		}
+	}
+	err := db.Debug().Create(&o).Error
+	if err != nil {
+		return &LabOrder{}, err
+	}
+	o.LabTest = test
+	return o, nil
+}
+
+// FindLabOrders lists orders, optionally narrowed by examination, patient
+// and status
+func (o *LabOrder) FindLabOrders(db *gorm.DB, examinationID uint32, mrn string, status string) (*[]LabOrder, error) {
+	var err error
+	orders := []LabOrder{}
+	query := db.Debug().Model(&LabOrder{}).Preload("LabTest")
+	if examinationID != 0 {
+		query = query.Where("examination_id = ?", examinationID)
+	}
+	if mrn != "" {
+		query = query.Where("mrn = ?", mrn)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Order("created_at desc").Limit(100).Find(&orders).Error
+	if err != nil {
+		return &[]LabOrder{}, err
+	}
+	return &orders, err
+}
+
+// FindLabOrderByID ...
+func (o *LabOrder) FindLabOrderByID(db *gorm.DB, id uint32) (*LabOrder, error) {
+	var err error
+	err = db.Debug().Model(LabOrder{}).Preload("LabTest").Preload("LabTest.ReferenceRanges").Where("id = ?", id).Take(&o).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &LabOrder{}, errors.New("Lab Order Not Found")
+	}
+	if err != nil {
+		return &LabOrder{}, err
+	}
+	return o, nil
+}
+
+// CollectSpecimen ...
+func (o *LabOrder) CollectSpecimen(db *gorm.DB, id uint32, employeeID int) (*LabOrder, error) {
+	return o.transition(db, id, LabSpecimenCollected, func(order *LabOrder, now time.Time) (map[string]interface{}, error) {
+		return map[string]interface{}{
+			"specimen_collected_at": now,
+			"specimen_collected_by": employeeID,
+		}, nil
+	})
+}
+
+// EnterResult records the result and flags it against the reference range
+// for the patient's sex and age. A result may be corrected until verified.
+func (o *LabOrder) EnterResult(db *gorm.DB, id uint32, employeeID int) (*LabOrder, error) {
+	value, text := o.ResultValue, o.ResultText
+	return o.transition(db, id, LabResulted, func(order *LabOrder, now time.Time) (map[string]interface{}, error) {
+		columns := map[string]interface{}{
+			"result_value":   value,
+			"result_text":    text,
+			"flag":           "",
+			"reference_low":  nil,
+			"reference_high": nil,
+			"resulted_at":    now,
+			"resulted_by":    employeeID,
+		}
+		if value == nil {
+			return columns, nil
+		}
+		if r := order.LabTest.ReferenceRangeFor(order.PatientSex, order.PatientAge); r != nil {
+			columns["flag"] = r.Classify(*value)
+			columns["reference_low"] = r.Low
+			columns["reference_high"] = r.High
+		}
+		return columns, nil
+	})
+}
+
+// Verify signs off a result. It must be someone other than whoever
+// entered it.
+func (o *LabOrder) Verify(db *gorm.DB, id uint32, employeeID int) (*LabOrder, error) {
+	return o.transition(db, id, LabVerified, func(order *LabOrder, now time.Time) (map[string]interface{}, error) {
+		if order.ResultedBy == employeeID {
+			return nil, errors.New("Result Must Be Verified By Someone Else")
+		}
+		return map[string]interface{}{
+			"verified_at": now,
+			"verified_by": employeeID,
+		}, nil
+	})
+}
+
+// Cancel ...
+func (o *LabOrder) Cancel(db *gorm.DB, id uint32) (*LabOrder, error) {
+	return o.transition(db, id, LabCancelled, func(order *LabOrder, now time.Time) (map[string]interface{}, error) {
+		return map[string]interface{}{}, nil
+	})
+}
+
+func (o *LabOrder) transition(db *gorm.DB, id uint32, status string, columns func(*LabOrder, time.Time) (map[string]interface{}, error)) (*LabOrder, error) {
+
+	current := LabOrder{}
+	if _, err := current.FindLabOrderByID(db, id); err != nil {
+		return &LabOrder{}, err
+	}
+	if !current.CanMoveTo(status) {
+		return &LabOrder{}, errors.New("Cannot Move Lab Order From " + current.Status + " To " + status)
+	}
+
+	now := time.Now()
+	updates, err := columns(&current, now)
+	if err != nil {
+		return &LabOrder{}, err
+	}
+	updates["status"] = status
+	updates["updated_at"] = now
+
+	// Only move the order if no one else has since it was read, so that two
+	// transitions from the same state cannot both succeed
+	update := db.Debug().Model(&LabOrder{}).Where("id = ? AND status = ? AND updated_at = ?", id, current.Status, current.UpdatedAt).UpdateColumns(updates)
+	if update.Error != nil {
+		return &LabOrder{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		return &LabOrder{}, errors.New("Lab Order Was Changed By Someone Else, Try Again")
+	}
+	return o.FindLabOrderByID(db, id)
+}
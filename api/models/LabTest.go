@@ -0,0 +1,163 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Lab result flags
+const (
+	FlagNormal       = "normal"
+	FlagLow          = "low"
+	FlagHigh         = "high"
+	FlagCriticalLow  = "critical_low"
+	FlagCriticalHigh = "critical_high"
+)
+
+// LabTest is an entry in the laboratory test catalogue
+type LabTest struct {
+	ID              uint32              `gorm:"primary_key;auto_increment" json:"id"`
+	Code            string              `gorm:"size:50;not null;unique" json:"code"`
+	Name            string              `gorm:"size:255;not null;" json:"name"`
+	Unit            string              `gorm:"size:50" json:"unit"`
+	ReferenceRanges []LabReferenceRange `gorm:"foreignkey:LabTestID" json:"reference_ranges"`
+	CreatedAt       time.Time           `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt       time.Time           `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// LabReferenceRange is the normal range of a test for one sex and age band.
+// Sex is "M", "F" or empty for both. Ages are in whole years; AgeMax of zero
+// means no upper bound. Critical limits are optional.
+type LabReferenceRange struct {
+	ID           uint32   `gorm:"primary_key;auto_increment" json:"id"`
+	LabTestID    uint32   `gorm:"not null;index" json:"lab_test_id"`
+	Sex          string   `gorm:"size:1" json:"sex"`
+	AgeMin       int      `gorm:"not null;default:0" json:"age_min"`
+	AgeMax       int      `gorm:"not null;default:0" json:"age_max"`
+	Low          float64  `json:"low"`
+	High         float64  `json:"high"`
+	CriticalLow  *float64 `json:"critical_low"`
+	CriticalHigh *float64 `json:"critical_high"`
+}
+
+// Validate ...
+func (t *LabTest) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if t.Code == "" {
+			return errors.New("Required Code")
+		}
+		if t.Name == "" {
+			return errors.New("Required Name")
+		}
+		for i := range t.ReferenceRanges {
+			if err := t.ReferenceRanges[i].Validate(""); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Validate ...
+func (r *LabReferenceRange) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if r.Sex != "" && r.Sex != "M" && r.Sex != "F" {
+			return errors.New("Invalid Sex")
+		}
+		if r.AgeMin < 0 || (r.AgeMax != 0 && r.AgeMax <= r.AgeMin) {
+			return errors.New("Invalid Age Range")
+		}
+		if r.High < r.Low {
+			return errors.New("Invalid Reference Range")
+		}
+		if r.CriticalLow != nil && *r.CriticalLow > r.Low {
+			return errors.New("Critical Low Above Reference Range")
+		}
+		if r.CriticalHigh != nil && *r.CriticalHigh < r.High {
+			return errors.New("Critical High Below Reference Range")
+		}
+		return nil
+	}
+}
+
+// Matches reports whether the range applies to a patient of the given sex
+// and age
+func (r *LabReferenceRange) Matches(sex string, age int) bool {
+	if r.Sex != "" && r.Sex != sex {
+		return false
+	}
+	if age < r.AgeMin {
+		return false
+	}
+	return r.AgeMax == 0 || age < r.AgeMax
+}
+
+// Classify flags a numeric result against the range
+func (r *LabReferenceRange) Classify(value float64) string {
+	switch {
+	case r.CriticalLow != nil && value <= *r.CriticalLow:
+		return FlagCriticalLow
+	case r.CriticalHigh != nil && value >= *r.CriticalHigh:
+		return FlagCriticalHigh
+	case value < r.Low:
+		return FlagLow
+	case value > r.High:
+		return FlagHigh
+	}
+	return FlagNormal
+}
+
+// ReferenceRangeFor picks the range for a patient. A sex specific range wins
+// over one that applies to both sexes.
+func (t *LabTest) ReferenceRangeFor(sex string, age int) *LabReferenceRange {
+	var match *LabReferenceRange
+	for i := range t.ReferenceRanges {
+		r := &t.ReferenceRanges[i]
+		if !r.Matches(sex, age) {
+			continue
+		}
+		if match == nil || (match.Sex == "" && r.Sex != "") {
+			match = r
+		}
+	}
+	return match
+}
+
+// SaveLabTest ...
+func (t *LabTest) SaveLabTest(db *gorm.DB) (*LabTest, error) {
+	var err error
+	err = db.Debug().Create(&t).Error
+	if err != nil {
+		return &LabTest{}, err
+	}
+	return t, nil
+}
+
+// FindAllLabTests ...
+func (t *LabTest) FindAllLabTests(db *gorm.DB) (*[]LabTest, error) {
+	var err error
+	tests := []LabTest{}
+	err = db.Debug().Model(&LabTest{}).Preload("ReferenceRanges").Limit(100).Find(&tests).Error
+	if err != nil {
+		return &[]LabTest{}, err
+	}
+	return &tests, err
+}
+
+// FindLabTestByID ...
+func (t *LabTest) FindLabTestByID(db *gorm.DB, id uint32) (*LabTest, error) {
+	var err error
+	err = db.Debug().Model(LabTest{}).Preload("ReferenceRanges").Where("id = ?", id).Take(&t).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &LabTest{}, errors.New("Lab Test Not Found")
+	}
+	if err != nil {
+		return &LabTest{}, err
+	}
+	return t, nil
+}
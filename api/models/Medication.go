@@ -0,0 +1,159 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Medication ...
+type Medication struct {
+	ID                uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Code              string    `gorm:"size:50;not null;unique" json:"code"`
+	Name              string    `gorm:"size:255;not null;" json:"name"`
+	Unit              string    `gorm:"size:50;not null;" json:"unit"`
+	LowStockThreshold int       `gorm:"not null;default:0" json:"low_stock_threshold"`
+	CreatedAt         time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt         time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// StockLevel is one line of the pharmacy stock report
+type StockLevel struct {
+	Medication     Medication `json:"medication"`
+	OnHand         int        `json:"on_hand"`
+	ExpiredOnHand  int        `json:"expired_on_hand"`
+	NextExpiryDate *time.Time `json:"next_expiry_date"`
+	LowStock       bool       `json:"low_stock"`
+}
+
+// Validate ...
+func (m *Medication) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case "update":
+		if m.Name == "" {
+			return errors.New("Required Name")
+		}
+		if m.Unit == "" {
+			return errors.New("Required Unit")
+		}
+		if m.LowStockThreshold < 0 {
+			return errors.New("Invalid Low Stock Threshold")
+		}
+		return nil
+
+	default:
+		if m.Code == "" {
+			return errors.New("Required Code")
+		}
+		if m.Name == "" {
+			return errors.New("Required Name")
+		}
+		if m.Unit == "" {
+			return errors.New("Required Unit")
+		}
+		if m.LowStockThreshold < 0 {
+			return errors.New("Invalid Low Stock Threshold")
+		}
+		return nil
+	}
+}
+
+// SaveMedication ...
+func (m *Medication) SaveMedication(db *gorm.DB) (*Medication, error) {
+	var err error
+	err = db.Debug().Create(&m).Error
+	if err != nil {
+		return &Medication{}, err
+	}
+	return m, nil
+}
+
+// FindAllMedications ...
+func (m *Medication) FindAllMedications(db *gorm.DB) (*[]Medication, error) {
+	var err error
+	medications := []Medication{}
+	err = db.Debug().Model(&Medication{}).Limit(100).Find(&medications).Error
+	if err != nil {
+		return &[]Medication{}, err
+	}
+	return &medications, err
+}
+
+// FindMedicationByID ...
+func (m *Medication) FindMedicationByID(db *gorm.DB, id uint32) (*Medication, error) {
+	var err error
+	err = db.Debug().Model(Medication{}).Where("id = ?", id).Take(&m).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Medication{}, errors.New("Medication Not Found")
+	}
+	if err != nil {
+		return &Medication{}, err
+	}
+	return m, nil
+}
+
+// UpdateMedication ...
+func (m *Medication) UpdateMedication(db *gorm.DB, id uint32) (*Medication, error) {
+
+	db = db.Debug().Model(&Medication{}).Where("id = ?", id).Take(&Medication{}).UpdateColumns(
+		map[string]interface{}{
+			"name":                m.Name,
+			"unit":                m.Unit,
+			"low_stock_threshold": m.LowStockThreshold,
+			"updated_at":          time.Now(),
+		},
+	)
+	if db.Error != nil {
+		return &Medication{}, db.Error
+	}
+	err := db.Debug().Model(&Medication{}).Where("id = ?", id).Take(&m).Error
+	if err != nil {
+		return &Medication{}, err
+	}
+	return m, nil
+}
+
+// StockReport returns the on hand quantity of every medication. Stock in
+// batches past their expiry date is reported separately and does not count
+// towards the low stock threshold.
+func (m *Medication) StockReport(db *gorm.DB, asOf time.Time) (*[]StockLevel, error) {
+	medications := []Medication{}
+	err := db.Debug().Model(&Medication{}).Order("name").Find(&medications).Error
+	if err != nil {
+		return &[]StockLevel{}, err
+	}
+
+	batches := []MedicationBatch{}
+	err = db.Debug().Model(&MedicationBatch{}).Where("quantity > 0").Order("expiry_date").Find(&batches).Error
+	if err != nil {
+		return &[]StockLevel{}, err
+	}
+
+	levels := make([]StockLevel, 0, len(medications))
+	index := make(map[uint32]int, len(medications))
+	for i := range medications {
+		index[medications[i].ID] = i
+		levels = append(levels, StockLevel{Medication: medications[i]})
+	}
+	for i := range batches {
+		j, ok := index[batches[i].MedicationID]
+		if !ok {
+			continue
+		}
+		if batches[i].Expired(asOf) {
+			levels[j].ExpiredOnHand += batches[i].Quantity
+			continue
+		}
+		levels[j].OnHand += batches[i].Quantity
+		if levels[j].NextExpiryDate == nil {
+			expiry := batches[i].ExpiryDate
+			levels[j].NextExpiryDate = &expiry
+		}
+	}
+	for i := range levels {
+		levels[i].LowStock = levels[i].OnHand <= levels[i].Medication.LowStockThreshold
+	}
+	return &levels, nil
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// MedicationBatch ...
+type MedicationBatch struct {
+	ID           uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	MedicationID uint32    `gorm:"not null;index" json:"medication_id"`
+	BatchNumber  string    `gorm:"size:100;not null;" json:"batch_number"`
+	ExpiryDate   time.Time `gorm:"not null" json:"expiry_date"`
+	Quantity     int       `gorm:"not null;default:0" json:"quantity"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate ...
+func (b *MedicationBatch) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if b.MedicationID == 0 {
+			return errors.New("Required Medication ID")
+		}
+		if b.BatchNumber == "" {
+			return errors.New("Required Batch Number")
+		}
+		if b.ExpiryDate.IsZero() {
+			return errors.New("Required Expiry Date")
+		}
+		if b.Quantity <= 0 {
+			return errors.New("Quantity Must Be Positive")
+		}
+		return nil
+	}
+}
+
+// Expired reports whether the batch can no longer be dispensed at t
+func (b *MedicationBatch) Expired(t time.Time) bool {
+	return !b.ExpiryDate.After(t)
+}
+
+// FindBatchesByMedication ...
+func (b *MedicationBatch) FindBatchesByMedication(db *gorm.DB, medicationID uint32) (*[]MedicationBatch, error) {
+	var err error
+	batches := []MedicationBatch{}
+	err = db.Debug().Model(&MedicationBatch{}).Where("medication_id = ?", medicationID).Order("expiry_date").Find(&batches).Error
+	if err != nil {
+		return &[]MedicationBatch{}, err
+	}
+	return &batches, err
+}
+
+// ReceiveBatch stores a delivered batch and records the receive movement
+func (b *MedicationBatch) ReceiveBatch(db *gorm.DB, employeeID int) (*MedicationBatch, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	medication := Medication{}
+	if _, err := medication.FindMedicationByID(tx, b.MedicationID); err != nil {
+		tx.Rollback()
+		return &MedicationBatch{}, err
+	}
+
+	if err := tx.Debug().Create(&b).Error; err != nil {
+		tx.Rollback()
+		return &MedicationBatch{}, err
+	}
+
+	movement := StockMovement{
+		MedicationID: b.MedicationID,
+		BatchID:      b.ID,
+		Type:         MovementReceive,
+		Quantity:     b.Quantity,
+		EmployeeID:   employeeID,
+	}
+	if err := tx.Debug().Create(&movement).Error; err != nil {
+		tx.Rollback()
+		return &MedicationBatch{}, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return &MedicationBatch{}, err
+	}
+	return b, nil
+}
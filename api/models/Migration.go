@@ -0,0 +1,284 @@
+package models
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+// patientReferences are the tables that pointed at patients by the old
+// integer ssn column, with the column that replaces it
+var patientReferences = []struct {
+	model  interface{}
+	oldKey string
+	newKey string
+}{
+	{&Appointment{}, "ssn", "mrn"},
+	{&Examination{}, "ssn", "mrn"},
+	{&LabOrder{}, "ssn", "mrn"},
+	{&PatientPhone{}, "patient_ssn", "patient_mrn"},
+	{&PatientInsurance{}, "patient_ssn", "patient_mrn"},
+	{&EmergencyContact{}, "patient_ssn", "patient_mrn"},
+}
+
+// MigratePatientIdentifiers upgrades a database created when patients were
+// keyed by their integer SSN. Every patient gets a medical record number,
+// the old SSN is kept as an unverified national ID, references from other
+// tables are rewritten to the MRN and the ssn columns are dropped. It does
+// nothing on a database that has already been migrated.
+func MigratePatientIdentifiers(db *gorm.DB) error {
+	if !db.HasTable(&Patient{}) || !db.Dialect().HasColumn("patients", "ssn") {
+		return nil
+	}
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return err
+	}
+
+	if err := tx.AutoMigrate(&Patient{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	rows, err := tx.Debug().Table("patients").Select("ssn").Where("mrn IS NULL OR mrn = ''").Rows()
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	ssns := []int64{}
+	for rows.Next() {
+		var ssn int64
+		if err = rows.Scan(&ssn); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return err
+		}
+		ssns = append(ssns, ssn)
+	}
+	rows.Close()
+
+	for _, ssn := range ssns {
+		mrn, err := newUnusedMRN(tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Debug().Table("patients").Where("ssn = ?", ssn).UpdateColumns(
+			map[string]interface{}{
+				"mrn":              mrn,
+				"national_id":      strconv.FormatInt(ssn, 10),
+				"national_id_type": "",
+			},
+		).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	for _, ref := range patientReferences {
+		scope := tx.NewScope(ref.model)
+		table := scope.TableName()
+		if !tx.HasTable(table) || !tx.Dialect().HasColumn(table, ref.oldKey) {
+			continue
+		}
+		if err = tx.AutoMigrate(ref.model).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Debug().Exec(fmt.Sprintf(
+			"UPDATE %s SET %s = (SELECT mrn FROM patients WHERE patients.ssn = %s.%s)",
+			table, ref.newKey, table, ref.oldKey,
+		)).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err = tx.Model(ref.model).DropColumn(ref.oldKey).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	// Dropping ssn also drops the old primary key
+	if err = tx.Model(&Patient{}).DropColumn("ssn").Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err = tx.Exec("ALTER TABLE patients ADD PRIMARY KEY (mrn)").Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// MigratePatientNames drops the unique constraint patients were created
+// with on their name, which AutoMigrate leaves in place, so that two
+// patients may share a name. It does nothing once the constraint is gone.
+func MigratePatientNames(db *gorm.DB) error {
+	if !db.HasTable(&Patient{}) {
+		return nil
+	}
+	var query, drop string
+	switch db.Dialect().GetName() {
+	case "mysql":
+		query = `SELECT index_name FROM information_schema.statistics
+			WHERE table_schema = DATABASE() AND table_name = 'patients' AND non_unique = 0
+			GROUP BY index_name HAVING COUNT(*) = 1 AND MAX(column_name) = 'name'`
+		drop = "ALTER TABLE patients DROP INDEX `%s`"
+	case "postgres":
+		query = `SELECT con.conname FROM pg_constraint con
+			JOIN pg_class rel ON rel.oid = con.conrelid
+			JOIN pg_attribute att ON att.attrelid = rel.oid AND att.attnum = con.conkey[1]
+			WHERE rel.relname = 'patients' AND con.contype = 'u'
+			AND array_length(con.conkey, 1) = 1 AND att.attname = 'name'`
+		drop = `ALTER TABLE patients DROP CONSTRAINT "%s"`
+	default:
+		return nil
+	}
+
+	rows, err := db.Debug().Raw(query).Rows()
+	if err != nil {
+		return err
+	}
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		names = append(names, name)
+	}
+	rows.Close()
+
+	for _, name := range names {
+		if err = db.Debug().Exec(fmt.Sprintf(drop, name)).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// departmentCode derives a department code from a legacy department name,
+// e.g. "Dokter Umum" becomes "DOKTER_UMUM"
+func departmentCode(name string) string {
+	code := strings.ToUpper(strings.Join(strings.Fields(name), "_"))
+	if len(code) > 20 {
+		code = code[:20]
+	}
+	return code
+}
+
+// MigrateEmployeeDepartments upgrades a database created when an employee's
+// department was a free text column. A department is created for every
+// distinct name, employees are pointed at it and the old column is dropped.
+// It does nothing on a database that has already been migrated.
+func MigrateEmployeeDepartments(db *gorm.DB) error {
+	if !db.HasTable(&Employee{}) || !db.Dialect().HasColumn("employees", "department") {
+		return nil
+	}
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return err
+	}
+
+	if err := tx.AutoMigrate(&Department{}, &Employee{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	names := []string{}
+	if err := tx.Debug().Table("employees").Where("department <> ''").Pluck("DISTINCT department", &names).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	for _, name := range names {
+		department := Department{}
+		err := tx.Debug().Where("name = ?", name).Take(&department).Error
+		if gorm.IsRecordNotFoundError(err) {
+			department = Department{Code: departmentCode(name), Name: name}
+			err = tx.Debug().Create(&department).Error
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		err = tx.Debug().Table("employees").Where("department = ?", name).UpdateColumn("department_id", department.ID).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	if err := tx.Model(&Employee{}).DropColumn("department").Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+// sealedColumnTypes are the types encrypted columns are widened to, as a
+// sealed value is longer than its plaintext
+var sealedColumnTypes = []struct {
+	model   interface{}
+	table   string
+	column  string
+	typ     string
+	notNull bool
+}{
+	{&Patient{}, "patients", "email", "varchar(512)", true},
+	{&Patient{}, "patients", "address", "text", false},
+	{&PatientPhone{}, "patient_phones", "number", "varchar(255)", true},
+	{&EmergencyContact{}, "emergency_contacts", "phone", "varchar(255)", true},
+	{&EmergencyContact{}, "emergency_contacts", "address", "text", false},
+	{&Examination{}, "examinations", "anamnesis", "text", true},
+	{&Examination{}, "examinations", "diagnosis", "text", true},
+	{&Examination{}, "examinations", "prescription", "text", true},
+}
+
+// MigrateEncryptedFields prepares a database created before sensitive
+// fields were encrypted. The encrypted columns are widened and the blind
+// index columns and data key table are added; the existing plaintext is
+// encrypted afterwards by ReencryptFields. It does nothing on a database
+// that has already been migrated.
+func MigrateEncryptedFields(db *gorm.DB) error {
+	if db.HasTable(&DataKey{}) {
+		return nil
+	}
+	for _, c := range sealedColumnTypes {
+		if !db.HasTable(c.model) || !db.Dialect().HasColumn(c.table, c.column) {
+			continue
+		}
+		typ := c.typ
+		// MySQL replaces the whole column definition
+		if c.notNull && db.Dialect().GetName() == "mysql" {
+			typ += " NOT NULL"
+		}
+		if err := db.Debug().Model(c.model).ModifyColumn(c.column, typ).Error; err != nil {
+			return err
+		}
+	}
+	return db.Debug().AutoMigrate(&Patient{}, &PatientPhone{}, &EmergencyContact{}, &Examination{}, &DataKey{}).Error
+}
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/repoerna/hms_app/api/utils/hash"
+	"github.com/repoerna/hms_app/api/utils/identifier"
 
 	"github.com/badoux/checkmail"
 	"github.com/jinzhu/gorm"
@@ -14,15 +15,31 @@ import (
 
 // Patient ...
 type Patient struct {
-	ID        uint32    `gorm:"auto_increment" json:"id"`
-	SSN       int       `gorm:"primary_key;not null;unique" json:"ssn"`
-	Name      string    `gorm:"size:255;not null;unique" json:"name"`
-	Email     string    `gorm:"size:100;not null;unique" json:"email"`
-	Password  string    `gorm:"size:100;not null;" json:"password"`
-	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
-	UpdatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	ID                uint32             `gorm:"auto_increment;unique" json:"id"`
+	MRN               string             `gorm:"primary_key;size:20" json:"mrn"`
+	NationalID        string             `gorm:"size:20;unique" json:"national_id"`
+	NationalIDType    string             `gorm:"size:10" json:"national_id_type"`
+	Name              string             `gorm:"size:255;not null;index" json:"name"`
+	Email             string             `gorm:"size:512;not null" json:"email"`
+	EmailIndex        string             `gorm:"size:64;unique_index" json:"-"`
+	Password          string             `gorm:"size:100;not null;" json:"password"`
+	DateOfBirth       string             `gorm:"size:10" json:"date_of_birth"`
+	Sex               string             `gorm:"size:1" json:"sex"`
+	BloodType         string             `gorm:"size:3" json:"blood_type"`
+	Address           string             `gorm:"type:text" json:"address"`
+	City              string             `gorm:"size:100" json:"city"`
+	Province          string             `gorm:"size:100" json:"province"`
+	PostalCode        string             `gorm:"size:10" json:"postal_code"`
+	Phones            []PatientPhone     `gorm:"foreignkey:PatientMRN;association_foreignkey:MRN" json:"phones"`
+	Insurances        []PatientInsurance `gorm:"foreignkey:PatientMRN;association_foreignkey:MRN" json:"insurances"`
+	EmergencyContacts []EmergencyContact `gorm:"foreignkey:PatientMRN;association_foreignkey:MRN" json:"emergency_contacts"`
+	MergedInto        string             `gorm:"size:20;index" json:"merged_into"`
+	CreatedAt         time.Time          `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt         time.Time          `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
 }
 
+var bloodTypes = []string{"A+", "A-", "B+", "B-", "AB+", "AB-", "O+", "O-"}
+
 // BeforeSave ...
 func (p *Patient) BeforeSave() error {
 	hashedPassword, err := hash.Hash(p.Password)
@@ -33,6 +50,59 @@ func (p *Patient) BeforeSave() error {
 	return nil
 }
 
+// mrnAttempts is how many random MRNs are tried before giving up on
+// finding one not yet in use
+const mrnAttempts = 5
+
+// newUnusedMRN generates a medical record number no patient has yet,
+// drawing again on a collision
+func newUnusedMRN(db *gorm.DB) (string, error) {
+	for i := 0; i < mrnAttempts; i++ {
+		mrn, err := identifier.NewMRN()
+		if err != nil {
+			return "", err
+		}
+		count := 0
+		if err = db.Table("patients").Where("mrn = ?", mrn).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return mrn, nil
+		}
+	}
+	return "", errors.New("Cannot Generate An Unused MRN")
+}
+
+// BeforeCreate assigns the medical record number. The MRN is generated by
+// us and never changes, unlike the national ID which may be corrected.
+// Email and address are encrypted; later changes go through UpdateColumns
+// and are sealed there.
+func (p *Patient) BeforeCreate(scope *gorm.Scope) error {
+	if p.MRN == "" {
+		mrn, err := newUnusedMRN(scope.NewDB())
+		if err != nil {
+			return err
+		}
+		p.MRN = mrn
+	}
+	p.EmailIndex = EmailIndex(p.Email)
+	return sealFields("patients", p.sealedFields()...)
+}
+
+// AfterCreate ...
+func (p *Patient) AfterCreate() error {
+	return openFields("patients", p.sealedFields()...)
+}
+
+// AfterFind ...
+func (p *Patient) AfterFind() error {
+	return openFields("patients", p.sealedFields()...)
+}
+
+func (p *Patient) sealedFields() []sealedField {
+	return []sealedField{{"email", &p.Email}, {"address", &p.Address}}
+}
+
 // Validate ...
 func (p *Patient) Validate(action string) error {
 	switch strings.ToLower(action) {
@@ -40,9 +110,6 @@ func (p *Patient) Validate(action string) error {
 		if p.Name == "" {
 			return errors.New("Required Name")
 		}
-		if p.SSN == 0 {
-			return errors.New("Required SSN")
-		}
 		if p.Password == "" {
 			return errors.New("Required Password")
 		}
@@ -52,6 +119,25 @@ func (p *Patient) Validate(action string) error {
 		if err := checkmail.ValidateFormat(p.Email); err != nil {
 			return errors.New("Invalid Email")
 		}
+		return p.validateDemographics()
+
+	case "contact":
+		if p.Email == "" {
+			return errors.New("Required Email")
+		}
+		if err := checkmail.ValidateFormat(p.Email); err != nil {
+			return errors.New("Invalid Email")
+		}
+		for i := range p.Phones {
+			if err := p.Phones[i].Validate(""); err != nil {
+				return err
+			}
+		}
+		for i := range p.EmergencyContacts {
+			if err := p.EmergencyContacts[i].Validate(""); err != nil {
+				return err
+			}
+		}
 		return nil
 
 	case "login":
@@ -70,9 +156,6 @@ func (p *Patient) Validate(action string) error {
 		if p.Name == "" {
 			return errors.New("Required Name")
 		}
-		if p.SSN == 0 {
-			return errors.New("Required SSN")
-		}
 		if p.Password == "" {
 			return errors.New("Required Password")
 		}
@@ -82,8 +165,80 @@ func (p *Patient) Validate(action string) error {
 		if err := checkmail.ValidateFormat(p.Email); err != nil {
 			return errors.New("Invalid Email")
 		}
-		return nil
+		return p.validateDemographics()
+	}
+}
+
+func (p *Patient) validateDemographics() error {
+	if p.DateOfBirth == "" {
+		return errors.New("Required Date Of Birth")
 	}
+	dob, err := time.ParseInLocation("2006-01-02", p.DateOfBirth, time.Local)
+	if err != nil {
+		return errors.New("Invalid Date Of Birth")
+	}
+	if dob.After(time.Now()) {
+		return errors.New("Date Of Birth Is In The Future")
+	}
+	if p.Sex != "M" && p.Sex != "F" {
+		return errors.New("Invalid Sex")
+	}
+	if p.NationalID == "" {
+		return errors.New("Required National ID")
+	}
+	p.NationalIDType = strings.ToUpper(p.NationalIDType)
+	p.NationalID = identifier.NormalizeNationalID(p.NationalID)
+	if err := identifier.ValidateNationalID(p.NationalIDType, p.NationalID, p.DateOfBirth, p.Sex); err != nil {
+		return err
+	}
+	if p.BloodType != "" {
+		valid := false
+		for _, t := range bloodTypes {
+			if p.BloodType == t {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.New("Invalid Blood Type")
+		}
+	}
+	for i := range p.Phones {
+		if err := p.Phones[i].Validate(""); err != nil {
+			return err
+		}
+	}
+	for i := range p.Insurances {
+		if err := p.Insurances[i].Validate(""); err != nil {
+			return err
+		}
+	}
+	nextOfKin := 0
+	for i := range p.EmergencyContacts {
+		if err := p.EmergencyContacts[i].Validate(""); err != nil {
+			return err
+		}
+		if p.EmergencyContacts[i].NextOfKin {
+			nextOfKin++
+		}
+	}
+	if nextOfKin > 1 {
+		return errors.New("Only One Next Of Kin Allowed")
+	}
+	return nil
+}
+
+// Age returns the patient's age in whole years at t, or -1 when the date of
+// birth is unknown
+func (p *Patient) Age(t time.Time) int {
+	dob, err := time.ParseInLocation("2006-01-02", p.DateOfBirth, time.Local)
+	if err != nil {
+		return -1
+	}
+	age := t.Year() - dob.Year()
+	if t.Month() < dob.Month() || (t.Month() == dob.Month() && t.Day() < dob.Day()) {
+		age--
+	}
+	return age
 }
 
 // SavePatient ...
@@ -101,58 +256,226 @@ func (p *Patient) SavePatient(db *gorm.DB) (*Patient, error) {
 func (p *Patient) FindAllPatients(db *gorm.DB) (*[]Patient, error) {
 	var err error
 	patients := []Patient{}
-	err = db.Debug().Model(&Patient{}).Limit(100).Find(&patients).Error
+	err = db.Debug().Model(&Patient{}).Preload("Phones").Preload("Insurances").Preload("EmergencyContacts").
+		Where("merged_into IS NULL OR merged_into = ''").Limit(100).Find(&patients).Error
 	if err != nil {
 		return &[]Patient{}, err
 	}
 	return &patients, err
 }
 
-// FindPatientBySSN ...
-func (p *Patient) FindPatientBySSN(db *gorm.DB, ssn uint32) (*Patient, error) {
+// FindPatientByMRN ...
+func (p *Patient) FindPatientByMRN(db *gorm.DB, mrn string) (*Patient, error) {
 	var err error
-	err = db.Debug().Model(Patient{}).Where("ssn = ?", ssn).Take(&p).Error
+	err = db.Debug().Model(Patient{}).Preload("Phones").Preload("Insurances").Preload("EmergencyContacts").Where("mrn = ?", mrn).Take(&p).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Patient{}, errors.New("Patient Not Found")
+	}
 	if err != nil {
 		return &Patient{}, err
 	}
+	return p, err
+}
+
+// FindPatientByNationalID ...
+func (p *Patient) FindPatientByNationalID(db *gorm.DB, nationalID string) (*Patient, error) {
+	var err error
+	err = db.Debug().Model(Patient{}).Where("national_id = ?", identifier.NormalizeNationalID(nationalID)).Take(&p).Error
 	if gorm.IsRecordNotFoundError(err) {
-		return &Patient{}, errors.New("User Not Found")
+		return &Patient{}, errors.New("Patient Not Found")
 	}
-	return p, err
+	if err != nil {
+		return &Patient{}, err
+	}
+	return p.FindPatientByMRN(db, p.MRN)
 }
 
 // UpdatePatient ...
-func (p *Patient) UpdatePatient(db *gorm.DB, ssn uint32) (*Patient, error) {
+func (p *Patient) UpdatePatient(db *gorm.DB, mrn string) (*Patient, error) {
 
 	// To hash the password
 	err := p.BeforeSave()
 	if err != nil {
 		log.Fatal(err)
 	}
-	db = db.Debug().Model(&Patient{}).Where("ssn = ?", ssn).Take(&Patient{}).UpdateColumns(
-		map[string]interface{}{
-			"password":   p.Password,
-			"Name":       p.Name,
-			"SSN":        p.SSN,
-			"email":      p.Email,
-			"updated_at": time.Now(),
-		},
-	)
-	if db.Error != nil {
-		return &Patient{}, db.Error
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	columns := map[string]interface{}{
+		"password":         p.Password,
+		"Name":             p.Name,
+		"national_id":      p.NationalID,
+		"national_id_type": p.NationalIDType,
+		"email":            p.Email,
+		"date_of_birth":    p.DateOfBirth,
+		"sex":              p.Sex,
+		"blood_type":       p.BloodType,
+		"address":          p.Address,
+		"city":             p.City,
+		"province":         p.Province,
+		"postal_code":      p.PostalCode,
+		"updated_at":       time.Now(),
 	}
+	if err = sealColumns("patients", columns); err != nil {
+		tx.Rollback()
+		return &Patient{}, err
+	}
+	err = tx.Debug().Model(&Patient{}).Where("mrn = ?", mrn).Take(&Patient{}).UpdateColumns(columns).Error
+	if err != nil {
+		tx.Rollback()
+		return &Patient{}, err
+	}
+
+	// Phones, insurances and contacts are replaced as a whole
+	p.MRN = mrn
+	if err = p.replaceDetails(tx); err != nil {
+		tx.Rollback()
+		return &Patient{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &Patient{}, err
+	}
+
 	// This is the display the updated user
-	err = db.Debug().Model(&Patient{}).Where("ssn = ?", ssn).Take(&p).Error
+	return p.FindPatientByMRN(db, mrn)
+}
+
+// UpdateContactDetails lets patients change their own address, phones,
+// emergency contacts, email and password. Identity fields such as name,
+// date of birth and national ID can only be changed by staff.
+func (p *Patient) UpdateContactDetails(db *gorm.DB, mrn string) (*Patient, error) {
+
+	// Insurance memberships are kept as they are
+	current := Patient{}
+	if _, err := current.FindPatientByMRN(db, mrn); err != nil {
+		return &Patient{}, err
+	}
+	p.Insurances = current.Insurances
+
+	columns := map[string]interface{}{
+		"email":       p.Email,
+		"address":     p.Address,
+		"city":        p.City,
+		"province":    p.Province,
+		"postal_code": p.PostalCode,
+		"updated_at":  time.Now(),
+	}
+	if p.Password != "" {
+		if err := p.BeforeSave(); err != nil {
+			return &Patient{}, err
+		}
+		columns["password"] = p.Password
+	}
+	if err := sealColumns("patients", columns); err != nil {
+		return &Patient{}, err
+	}
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	err := tx.Debug().Model(&Patient{}).Where("mrn = ?", mrn).Take(&Patient{}).UpdateColumns(columns).Error
 	if err != nil {
+		tx.Rollback()
 		return &Patient{}, err
 	}
-	return p, nil
+	p.MRN = mrn
+	if err = p.replaceDetails(tx); err != nil {
+		tx.Rollback()
+		return &Patient{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &Patient{}, err
+	}
+	return p.FindPatientByMRN(db, mrn)
+}
+
+// UpdateDemographics saves the name, national ID, date of birth, sex and
+// address as sent by another system. Contact details, insurances and login
+// are left alone.
+func (p *Patient) UpdateDemographics(db *gorm.DB, mrn string) (*Patient, error) {
+
+	if p.Name == "" {
+		return &Patient{}, errors.New("Required Name")
+	}
+	if err := p.validateDemographics(); err != nil {
+		return &Patient{}, err
+	}
+	columns := map[string]interface{}{
+		"name":             p.Name,
+		"national_id":      p.NationalID,
+		"national_id_type": p.NationalIDType,
+		"date_of_birth":    p.DateOfBirth,
+		"sex":              p.Sex,
+		"address":          p.Address,
+		"city":             p.City,
+		"province":         p.Province,
+		"postal_code":      p.PostalCode,
+		"updated_at":       time.Now(),
+	}
+	if err := sealColumns("patients", columns); err != nil {
+		return &Patient{}, err
+	}
+	err := db.Debug().Model(&Patient{}).Where("mrn = ?", mrn).Take(&Patient{}).UpdateColumns(columns).Error
+	if err != nil {
+		return &Patient{}, err
+	}
+	return p.FindPatientByMRN(db, mrn)
+}
+
+func (p *Patient) replaceDetails(tx *gorm.DB) error {
+	for _, model := range []interface{}{&PatientPhone{}, &PatientInsurance{}, &EmergencyContact{}} {
+		if err := tx.Debug().Where("patient_mrn = ?", p.MRN).Delete(model).Error; err != nil {
+			return err
+		}
+	}
+	for i := range p.Phones {
+		p.Phones[i].ID = 0
+		p.Phones[i].PatientMRN = p.MRN
+		if err := tx.Debug().Create(&p.Phones[i]).Error; err != nil {
+			return err
+		}
+	}
+	for i := range p.Insurances {
+		p.Insurances[i].ID = 0
+		p.Insurances[i].PatientMRN = p.MRN
+		if err := tx.Debug().Create(&p.Insurances[i]).Error; err != nil {
+			return err
+		}
+	}
+	for i := range p.EmergencyContacts {
+		p.EmergencyContacts[i].ID = 0
+		p.EmergencyContacts[i].PatientMRN = p.MRN
+		if err := tx.Debug().Create(&p.EmergencyContacts[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // DeletePatient ...
-func (p *Patient) DeletePatient(db *gorm.DB, ssn uint32) (int64, error) {
+func (p *Patient) DeletePatient(db *gorm.DB, mrn string) (int64, error) {
 
-	db = db.Debug().Model(&Patient{}).Where("ssn = ?", ssn).Take(&Patient{}).Delete(&Patient{})
+	db = db.Debug().Model(&Patient{}).Where("mrn = ?", mrn).Take(&Patient{}).Delete(&Patient{})
 
 	if db.Error != nil {
 		return 0, db.Error
@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 \-]{5,19}$`)
+
+// Phone kinds
+var phoneKinds = []string{"mobile", "home", "work"}
+
+// PatientPhone ...
+type PatientPhone struct {
+	ID          uint32 `gorm:"primary_key;auto_increment" json:"id"`
+	PatientMRN  string `gorm:"size:20;index" json:"patient_mrn"`
+	Kind        string `gorm:"size:20;not null;default:'mobile'" json:"kind"`
+	Number      string `gorm:"size:255;not null" json:"number"`
+	NumberIndex string `gorm:"size:64;index" json:"-"`
+	Primary     bool   `gorm:"not null;default:false" json:"primary"`
+}
+
+// PatientInsurance is a patient's membership of an insurance scheme. Policies
+// with a PayerID can be checked for eligibility and claimed from.
+type PatientInsurance struct {
+	ID           uint32 `gorm:"primary_key;auto_increment" json:"id"`
+	PatientMRN   string `gorm:"size:20;index" json:"patient_mrn"`
+	PayerID      uint32 `gorm:"index" json:"payer_id"`
+	Provider     string `gorm:"size:100;not null" json:"provider"`
+	MemberNumber string `gorm:"size:50;not null" json:"member_number"`
+	Class        string `gorm:"size:20" json:"class"`
+	ValidUntil   string `gorm:"size:10" json:"valid_until"`
+}
+
+// EmergencyContact is someone to call about the patient. At most one
+// contact per patient is flagged as next of kin.
+type EmergencyContact struct {
+	ID           uint32 `gorm:"primary_key;auto_increment" json:"id"`
+	PatientMRN   string `gorm:"size:20;index" json:"patient_mrn"`
+	Name         string `gorm:"size:255;not null" json:"name"`
+	Relationship string `gorm:"size:50;not null" json:"relationship"`
+	Phone        string `gorm:"size:255;not null" json:"phone"`
+	Address      string `gorm:"type:text" json:"address"`
+	NextOfKin    bool   `gorm:"not null;default:false" json:"next_of_kin"`
+}
+
+// Validate ...
+func (p *PatientPhone) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if p.Kind == "" {
+			p.Kind = "mobile"
+		}
+		valid := false
+		for _, k := range phoneKinds {
+			if p.Kind == k {
+				valid = true
+			}
+		}
+		if !valid {
+			return errors.New("Invalid Phone Kind")
+		}
+		if !phonePattern.MatchString(p.Number) {
+			return errors.New("Invalid Phone Number")
+		}
+		return nil
+	}
+}
+
+// BeforeSave encrypts the number and indexes it for duplicate searches
+func (p *PatientPhone) BeforeSave() error {
+	p.NumberIndex = PhoneIndex(p.Number)
+	return sealFields("patient_phones", sealedField{"number", &p.Number})
+}
+
+// AfterSave ...
+func (p *PatientPhone) AfterSave() error {
+	return openFields("patient_phones", sealedField{"number", &p.Number})
+}
+
+// AfterFind ...
+func (p *PatientPhone) AfterFind() error {
+	return openFields("patient_phones", sealedField{"number", &p.Number})
+}
+
+// Validate ...
+func (i *PatientInsurance) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if i.Provider == "" {
+			return errors.New("Required Insurance Provider")
+		}
+		if i.MemberNumber == "" {
+			return errors.New("Required Insurance Member Number")
+		}
+		if i.ValidUntil != "" {
+			if _, err := time.Parse("2006-01-02", i.ValidUntil); err != nil {
+				return errors.New("Invalid Insurance Valid Until")
+			}
+		}
+		return nil
+	}
+}
+
+// Validate ...
+func (c *EmergencyContact) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if c.Name == "" {
+			return errors.New("Required Contact Name")
+		}
+		if c.Relationship == "" {
+			return errors.New("Required Contact Relationship")
+		}
+		if !phonePattern.MatchString(c.Phone) {
+			return errors.New("Invalid Contact Phone")
+		}
+		return nil
+	}
+}
+
+// BeforeSave ...
+func (c *EmergencyContact) BeforeSave() error {
+	return sealFields("emergency_contacts", c.sealedFields()...)
+}
+
+// AfterSave ...
+func (c *EmergencyContact) AfterSave() error {
+	return openFields("emergency_contacts", c.sealedFields()...)
+}
+
+// AfterFind ...
+func (c *EmergencyContact) AfterFind() error {
+	return openFields("emergency_contacts", c.sealedFields()...)
+}
+
+func (c *EmergencyContact) sealedFields() []sealedField {
+	return []sealedField{{"phone", &c.Phone}, {"address", &c.Address}}
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/repoerna/hms_app/api/utils/identifier"
+	"github.com/repoerna/hms_app/api/utils/similarity"
+)
+
+// DuplicateThreshold is the score from which a patient is reported as a
+// likely duplicate
+const DuplicateThreshold = 0.65
+
+// Weights of the signals that make up a duplicate score. A matching national
+// ID on its own is conclusive.
+const (
+	weightName  = 0.50
+	weightBirth = 0.25
+	weightPhone = 0.15
+	weightEmail = 0.10
+)
+
+// DuplicateCandidate is an existing patient that looks like the same person
+type DuplicateCandidate struct {
+	Patient Patient  `json:"patient"`
+	Score   float64  `json:"score"`
+	Reasons []string `json:"reasons"`
+}
+
+// DuplicateMatch is what registration reveals about a likely duplicate:
+// enough for staff to recognise the record, without its contact details
+type DuplicateMatch struct {
+	MRN         string   `json:"mrn"`
+	Name        string   `json:"name"`
+	DateOfBirth string   `json:"date_of_birth"`
+	Score       float64  `json:"score"`
+	Reasons     []string `json:"reasons"`
+}
+
+// Match is the candidate with its name masked
+func (c *DuplicateCandidate) Match() DuplicateMatch {
+	return DuplicateMatch{
+		MRN:         c.Patient.MRN,
+		Name:        maskName(c.Patient.Name),
+		DateOfBirth: c.Patient.DateOfBirth,
+		Score:       c.Score,
+		Reasons:     c.Reasons,
+	}
+}
+
+// maskName keeps the first letter of each word of a name, e.g. "Purna
+// Wijaya" becomes "P**** W*****"
+func maskName(name string) string {
+	words := strings.Fields(name)
+	for i, word := range words {
+		letters := []rune(word)
+		for j := 1; j < len(letters); j++ {
+			letters[j] = '*'
+		}
+		words[i] = string(letters)
+	}
+	return strings.Join(words, " ")
+}
+
+// FindDuplicates looks for registered patients that are probably the same
+// person as p. Candidates are narrowed in the database by national ID, date
+// of birth, email or phone and then scored on name similarity and the other
+// matching fields. Merged records are ignored.
+func (p *Patient) FindDuplicates(db *gorm.DB) ([]DuplicateCandidate, error) {
+	nationalID := identifier.NormalizeNationalID(p.NationalID)
+
+	// Email and phone are encrypted, so they are matched on blind indexes
+	conditions := []string{"date_of_birth = ?", "email_index = ?"}
+	args := []interface{}{p.DateOfBirth, EmailIndex(p.Email)}
+	if nationalID != "" {
+		conditions = append(conditions, "national_id = ?")
+		args = append(args, nationalID)
+	}
+	for _, phone := range p.Phones {
+		if index := PhoneIndex(phone.Number); index != "" {
+			conditions = append(conditions, "mrn IN (SELECT patient_mrn FROM patient_phones WHERE number_index = ?)")
+			args = append(args, index)
+		}
+	}
+
+	pool := []Patient{}
+	query := db.Debug().Model(&Patient{}).Preload("Phones").
+		Where("merged_into IS NULL OR merged_into = ''").
+		Where(strings.Join(conditions, " OR "), args...)
+	if p.MRN != "" {
+		query = query.Where("mrn <> ?", p.MRN)
+	}
+	if err := query.Limit(200).Find(&pool).Error; err != nil {
+		return nil, err
+	}
+
+	candidates := []DuplicateCandidate{}
+	for _, other := range pool {
+		candidate := p.duplicateScore(other, nationalID)
+		if candidate.Score >= DuplicateThreshold {
+			candidates = append(candidates, candidate)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Score > candidates[j].Score
+	})
+	return candidates, nil
+}
+
+func (p *Patient) duplicateScore(other Patient, nationalID string) DuplicateCandidate {
+	candidate := DuplicateCandidate{Patient: other, Reasons: []string{}}
+	if nationalID != "" && nationalID == other.NationalID {
+		candidate.Score = 1
+		candidate.Reasons = append(candidate.Reasons, "national_id")
+		return candidate
+	}
+
+	name := similarity.NameSimilarity(p.Name, other.Name)
+	candidate.Score += weightName * name
+	if name >= 0.85 {
+		candidate.Reasons = append(candidate.Reasons, "name")
+	}
+	if p.DateOfBirth != "" && p.DateOfBirth == other.DateOfBirth {
+		candidate.Score += weightBirth
+		candidate.Reasons = append(candidate.Reasons, "date_of_birth")
+	}
+	if p.sharesPhoneWith(other) {
+		candidate.Score += weightPhone
+		candidate.Reasons = append(candidate.Reasons, "phone")
+	}
+	if p.Email != "" && strings.EqualFold(p.Email, other.Email) {
+		candidate.Score += weightEmail
+		candidate.Reasons = append(candidate.Reasons, "email")
+	}
+	return candidate
+}
+
+func (p *Patient) sharesPhoneWith(other Patient) bool {
+	for _, a := range p.Phones {
+		for _, b := range other.Phones {
+			if similarity.SamePhone(a.Number, b.Number) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// mergedRecords lists the tables re-pointed by a merge, with the primary key
+// and patient columns of each. Issued documents are not moved: their
+// serials are signed with the MRN printed on the paper.
+var mergedRecords = []struct {
+	name      string
+	model     interface{}
+	key       string
+	patientFK string
+}{
+	{"appointments", &Appointment{}, "appointment_id", "mrn"},
+	{"examinations", &Examination{}, "examination_id", "mrn"},
+	{"lab_orders", &LabOrder{}, "id", "mrn"},
+	{"referrals", &Referral{}, "id", "mrn"},
+	{"attachments", &Attachment{}, "id", "mrn"},
+	{"patient_phones", &PatientPhone{}, "id", "patient_mrn"},
+	{"patient_insurances", &PatientInsurance{}, "id", "patient_mrn"},
+	{"emergency_contacts", &EmergencyContact{}, "id", "patient_mrn"},
+	{"patient_consents", &PatientConsent{}, "id", "patient_mrn"},
+	{"admissions", &Admission{}, "id", "mrn"},
+	{"queue_tickets", &QueueTicket{}, "id", "mrn"},
+	{"invoices", &Invoice{}, "id", "mrn"},
+	{"insurance_claims", &InsuranceClaim{}, "id", "mrn"},
+	{"emergency_accesses", &EmergencyAccess{}, "id", "mrn"},
+	{"compliance_alerts", &ComplianceAlert{}, "id", "mrn"},
+}
+
+// PatientMerge records that MergedMRN was folded into SurvivorMRN. The ids of
+// every row that was moved are kept in MovedRecords so the merge can be
+// undone exactly, without touching rows added to the survivor afterwards.
+type PatientMerge struct {
+	ID           uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	SurvivorMRN  string     `gorm:"size:20;not null;index" json:"survivor_mrn"`
+	MergedMRN    string     `gorm:"size:20;not null;index" json:"merged_mrn"`
+	Reason       string     `gorm:"size:255;not null" json:"reason"`
+	MergedBy     int        `gorm:"not null" json:"merged_by"`
+	MovedRecords string     `gorm:"type:text" json:"moved_records"`
+	UndoneAt     *time.Time `json:"undone_at"`
+	UndoneBy     int        `json:"undone_by"`
+	CreatedAt    time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// Validate ...
+func (m *PatientMerge) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if m.SurvivorMRN == "" {
+			return errors.New("Required Survivor MRN")
+		}
+		if m.MergedMRN == "" {
+			return errors.New("Required Merged MRN")
+		}
+		if m.SurvivorMRN == m.MergedMRN {
+			return errors.New("Cannot Merge A Patient Into Itself")
+		}
+		if m.Reason == "" {
+			return errors.New("Required Reason")
+		}
+		return nil
+	}
+}
+
+// lockPatients locks the patient rows of mrns for the rest of tx. Rows are
+// locked in MRN order, so merges of the same patients in either direction
+// queue up rather than deadlock.
+func lockPatients(tx *gorm.DB, mrns ...string) (map[string]*Patient, error) {
+	sorted := append([]string{}, mrns...)
+	sort.Strings(sorted)
+	patients := map[string]*Patient{}
+	for _, mrn := range sorted {
+		patient := Patient{}
+		err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Patient{}).Where("mrn = ?", mrn).Take(&patient).Error
+		if err != nil {
+			return nil, errors.New("Patient " + mrn + " Not Found")
+		}
+		patients[mrn] = &patient
+	}
+	return patients, nil
+}
+
+// Merge moves every appointment, examination, lab order and contact detail
+// of MergedMRN to SurvivorMRN in one transaction and marks the merged
+// patient as retired
+func (m *PatientMerge) Merge(db *gorm.DB) (*PatientMerge, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	patients, err := lockPatients(tx, m.SurvivorMRN, m.MergedMRN)
+	if err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+	for _, mrn := range []string{m.SurvivorMRN, m.MergedMRN} {
+		if patients[mrn].MergedInto != "" {
+			tx.Rollback()
+			return &PatientMerge{}, errors.New("Patient " + mrn + " Is Already Merged")
+		}
+	}
+
+	moved := map[string][]uint32{}
+	for _, records := range mergedRecords {
+		ids := []uint32{}
+		err := tx.Debug().Model(records.model).Where(records.patientFK+" = ?", m.MergedMRN).Pluck(records.key, &ids).Error
+		if err != nil {
+			tx.Rollback()
+			return &PatientMerge{}, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+		err = tx.Debug().Model(records.model).Where(records.key+" IN (?)", ids).UpdateColumn(records.patientFK, m.SurvivorMRN).Error
+		if err != nil {
+			tx.Rollback()
+			return &PatientMerge{}, err
+		}
+		moved[records.name] = ids
+	}
+
+	err = tx.Debug().Model(&Patient{}).Where("mrn = ?", m.MergedMRN).UpdateColumns(
+		map[string]interface{}{
+			"merged_into": m.SurvivorMRN,
+			"updated_at":  time.Now(),
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+
+	history, err := json.Marshal(moved)
+	if err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+	m.MovedRecords = string(history)
+	if err = tx.Debug().Create(&m).Error; err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &PatientMerge{}, err
+	}
+	return m, nil
+}
+
+// Undo moves the recorded rows back to the merged patient and reactivates
+// it. When the survivor was itself merged into another patient later, that
+// merge holds the rows now and must be undone first.
+func (m *PatientMerge) Undo(db *gorm.DB, id uint32, employeeID int) (*PatientMerge, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&PatientMerge{}).Where("id = ?", id).Take(&m).Error
+	if err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, errors.New("Merge Not Found")
+	}
+	if m.UndoneAt != nil {
+		tx.Rollback()
+		return &PatientMerge{}, errors.New("Merge Already Undone")
+	}
+	patients, err := lockPatients(tx, m.SurvivorMRN, m.MergedMRN)
+	if err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+	if later := patients[m.SurvivorMRN].MergedInto; later != "" {
+		tx.Rollback()
+		return &PatientMerge{}, errors.New("Undo The Merge Of " + m.SurvivorMRN + " Into " + later + " First")
+	}
+
+	moved := map[string][]uint32{}
+	if err = json.Unmarshal([]byte(m.MovedRecords), &moved); err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+	for _, records := range mergedRecords {
+		ids := moved[records.name]
+		if len(ids) == 0 {
+			continue
+		}
+		err = tx.Debug().Model(records.model).Where(records.key+" IN (?)", ids).UpdateColumn(records.patientFK, m.MergedMRN).Error
+		if err != nil {
+			tx.Rollback()
+			return &PatientMerge{}, err
+		}
+	}
+
+	err = tx.Debug().Model(&Patient{}).Where("mrn = ?", m.MergedMRN).UpdateColumns(
+		map[string]interface{}{
+			"merged_into": "",
+			"updated_at":  time.Now(),
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+
+	now := time.Now()
+	err = tx.Debug().Model(&PatientMerge{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"undone_at": now,
+			"undone_by": employeeID,
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &PatientMerge{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &PatientMerge{}, err
+	}
+	m.UndoneAt = &now
+	m.UndoneBy = employeeID
+	return m, nil
+}
+
+// FindAllMerges ...
+func (m *PatientMerge) FindAllMerges(db *gorm.DB) (*[]PatientMerge, error) {
+	var err error
+	merges := []PatientMerge{}
+	err = db.Debug().Model(&PatientMerge{}).Order("created_at desc").Limit(100).Find(&merges).Error
+	if err != nil {
+		return &[]PatientMerge{}, err
+	}
+	return &merges, err
+}
@@ -0,0 +1,99 @@
+package models
+
+import (
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// ExaminationSummary is the part of a finalized examination shown to the
+// patient
+type ExaminationSummary struct {
+	ExaminationID uint32    `json:"examination_id"`
+	AppointmentID uint32    `json:"appointment_id"`
+	Date          time.Time `json:"date"`
+	EmployeeID    int       `json:"employee_id"`
+	Doctor        string    `json:"doctor"`
+	Diagnosis     string    `json:"diagnosis"`
+	Prescription  string    `json:"prescription"`
+}
+
+// PatientRecord is everything a patient may download about themself
+type PatientRecord struct {
+	GeneratedAt  time.Time            `json:"generated_at"`
+	Patient      Patient              `json:"patient"`
+	Appointments []Appointment        `json:"appointments"`
+	Examinations []ExaminationSummary `json:"examinations"`
+	LabResults   []LabOrder           `json:"lab_results"`
+	Consents     []PatientConsent     `json:"consents"`
+}
+
+// FindExaminationSummaries returns the patient's finalized examinations,
+// newest first
+func FindExaminationSummaries(db *gorm.DB, mrn string) ([]ExaminationSummary, error) {
+	examinations := []Examination{}
+	err := db.Debug().Model(&Examination{}).Where("mrn = ? AND status = ?", mrn, ExaminationCompleted).
+		Order("created_at desc").Find(&examinations).Error
+	if err != nil {
+		return nil, err
+	}
+
+	doctors := map[int]string{}
+	summaries := make([]ExaminationSummary, 0, len(examinations))
+	for _, e := range examinations {
+		if _, ok := doctors[e.EmployeeID]; !ok {
+			employee := Employee{}
+			if _, err := employee.FindEmployeeByID(db, e.EmployeeID); err == nil {
+				doctors[e.EmployeeID] = employee.Name
+			}
+		}
+		summaries = append(summaries, ExaminationSummary{
+			ExaminationID: e.ExaminationID,
+			AppointmentID: e.AppointmentID,
+			Date:          e.CreatedAt,
+			EmployeeID:    e.EmployeeID,
+			Doctor:        doctors[e.EmployeeID],
+			Diagnosis:     e.Diagnosis,
+			Prescription:  e.Prescription,
+		})
+	}
+	return summaries, nil
+}
+
+// BuildPatientRecord collects the patient's profile, appointments,
+// finalized examinations, verified lab results and consents
+func BuildPatientRecord(db *gorm.DB, mrn string) (*PatientRecord, error) {
+	record := PatientRecord{GeneratedAt: time.Now()}
+
+	if _, err := record.Patient.FindPatientByMRN(db, mrn); err != nil {
+		return &PatientRecord{}, err
+	}
+	record.Patient.Password = ""
+
+	appointment := Appointment{}
+	appointments, err := appointment.FindAppointmentsByMRN(db, mrn)
+	if err != nil {
+		return &PatientRecord{}, err
+	}
+	record.Appointments = *appointments
+
+	record.Examinations, err = FindExaminationSummaries(db, mrn)
+	if err != nil {
+		return &PatientRecord{}, err
+	}
+
+	err = db.Debug().Model(&LabOrder{}).Preload("LabTest").Where("mrn = ? AND status = ?", mrn, LabVerified).
+		Order("resulted_at desc").Find(&record.LabResults).Error
+	if err != nil {
+		return &PatientRecord{}, err
+	}
+
+	consent := PatientConsent{}
+	consents, err := consent.FindConsentsByPatient(db, mrn)
+	if err != nil {
+		return &PatientRecord{}, err
+	}
+	record.Consents = *consents
+
+	return &record, nil
+}
@@ -0,0 +1,332 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Queue ticket statuses
+const (
+	TicketWaiting = "waiting"
+	TicketCalled  = "called"
+	TicketServing = "serving"
+	TicketDone    = "done"
+	TicketSkipped = "skipped"
+)
+
+// ticketTransitions lists the statuses each status may move to. A skipped
+// patient who turns up again goes back to waiting with the same number.
+var ticketTransitions = map[string][]string{
+	TicketWaiting: {TicketCalled, TicketSkipped},
+	TicketCalled:  {TicketServing, TicketSkipped, TicketWaiting},
+	TicketServing: {TicketDone},
+	TicketSkipped: {TicketWaiting},
+}
+
+// Wait time estimation
+var (
+	// DefaultServiceTime is assumed per patient when a doctor has too few
+	// completed examinations to go by
+	DefaultServiceTime = 15 * time.Minute
+	// ServiceTimeHistory is how far back examinations are sampled
+	ServiceTimeHistory = 30 * 24 * time.Hour
+	// minServiceSamples is the fewest examinations an estimate is based on
+	minServiceSamples = 5
+)
+
+// QueueTicket is a patient's place in a doctor's queue on the day of their
+// appointment. Numbers are handed out per department and restart every day,
+// so a ticket code such as UMUM-007 is unique on the board.
+type QueueTicket struct {
+	ID            uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	Date          string     `gorm:"size:10;not null;unique_index:idx_queue_number" json:"date"`
+	DepartmentID  uint32     `gorm:"not null;unique_index:idx_queue_number" json:"department_id"`
+	EmployeeID    int        `gorm:"not null;index" json:"employee_id"`
+	Number        int        `gorm:"not null;unique_index:idx_queue_number" json:"number"`
+	Code          string     `gorm:"size:40;not null" json:"code"`
+	AppointmentID uint32     `gorm:"not null;unique" json:"appointment_id"`
+	MRN           string     `gorm:"size:20;not null;index" json:"mrn"`
+	Status        string     `gorm:"size:20;not null" json:"status"`
+	CheckedInBy   int        `json:"checked_in_by"`
+	CheckedInAt   time.Time  `gorm:"not null" json:"checked_in_at"`
+	CalledAt      *time.Time `json:"called_at"`
+	ServingAt     *time.Time `json:"serving_at"`
+	DoneAt        *time.Time `json:"done_at"`
+}
+
+// BoardTicket is a ticket as shown on the waiting room board, without any
+// patient details
+type BoardTicket struct {
+	ID            uint32 `json:"id"`
+	Code          string `json:"code"`
+	Number        int    `json:"number"`
+	Status        string `json:"status"`
+	EstimatedWait int    `json:"estimated_wait_minutes"`
+}
+
+// DoctorQueue is one doctor's queue on the board
+type DoctorQueue struct {
+	EmployeeID     int           `json:"employee_id"`
+	Name           string        `json:"name"`
+	ServiceMinutes int           `json:"service_minutes"`
+	NowServing     []BoardTicket `json:"now_serving"`
+	Called         []BoardTicket `json:"called"`
+	Waiting        []BoardTicket `json:"waiting"`
+	Done           int           `json:"done"`
+	Skipped        int           `json:"skipped"`
+}
+
+// QueueBoard is the waiting room board of a department for a day
+type QueueBoard struct {
+	Department Department    `json:"department"`
+	Date       string        `json:"date"`
+	Queues     []DoctorQueue `json:"queues"`
+}
+
+// CheckIn issues a queue ticket for a booked appointment on its day. The
+// ticket joins the queue of the appointment's doctor in the doctor's
+// department.
+func (q *QueueTicket) CheckIn(db *gorm.DB, appointmentID uint32, employeeID int, now time.Time) (*QueueTicket, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	appointment := Appointment{}
+	if _, err := appointment.FindAppointmentByID(tx, appointmentID); err != nil {
+		tx.Rollback()
+		return &QueueTicket{}, errors.New("Appointment Not Found")
+	}
+	if appointment.Status == AppointmentCancelled {
+		tx.Rollback()
+		return &QueueTicket{}, errors.New("Appointment Is Cancelled")
+	}
+	today := now.Format("2006-01-02")
+	if appointment.Date != today {
+		tx.Rollback()
+		return &QueueTicket{}, errors.New("Appointment Is Not Today")
+	}
+
+	doctor := Employee{}
+	if _, err := doctor.FindEmployeeByID(tx, appointment.EmployeeID); err != nil {
+		tx.Rollback()
+		return &QueueTicket{}, errors.New("Doctor Not Found")
+	}
+	// Locking the department serialises its check-ins, so numbers are
+	// handed out without gaps or duplicates
+	department := Department{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Department{}).Where("id = ?", doctor.DepartmentID).Take(&department).Error
+	if err != nil {
+		tx.Rollback()
+		return &QueueTicket{}, errors.New("Department Not Found")
+	}
+
+	var existing int
+	if err = tx.Debug().Model(&QueueTicket{}).Where("appointment_id = ?", appointmentID).Count(&existing).Error; err != nil {
+		tx.Rollback()
+		return &QueueTicket{}, err
+	}
+	if existing > 0 {
+		tx.Rollback()
+		return &QueueTicket{}, errors.New("Appointment Is Already Checked In")
+	}
+
+	last := QueueTicket{}
+	err = tx.Debug().Model(&QueueTicket{}).Where("date = ? AND department_id = ?", today, department.ID).
+		Order("number desc").Take(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		tx.Rollback()
+		return &QueueTicket{}, err
+	}
+
+	q.ID = 0
+	q.Date = today
+	q.DepartmentID = department.ID
+	q.EmployeeID = doctor.EmployeeID
+	q.Number = last.Number + 1
+	q.Code = fmt.Sprintf("%s-%03d", department.Code, q.Number)
+	q.AppointmentID = appointmentID
+	q.MRN = appointment.MRN
+	q.Status = TicketWaiting
+	q.CheckedInBy = employeeID
+	q.CheckedInAt = now
+	if err = tx.Debug().Create(&q).Error; err != nil {
+		tx.Rollback()
+		return &QueueTicket{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &QueueTicket{}, err
+	}
+	return q, nil
+}
+
+// Move changes a ticket's status, stamping the time it was called, started
+// or finished
+func (q *QueueTicket) Move(db *gorm.DB, id uint32, status string, now time.Time) (*QueueTicket, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&QueueTicket{}).Where("id = ?", id).Take(&q).Error
+	if err != nil {
+		tx.Rollback()
+		return &QueueTicket{}, errors.New("Queue Ticket Not Found")
+	}
+	allowed := false
+	for _, next := range ticketTransitions[q.Status] {
+		if next == status {
+			allowed = true
+		}
+	}
+	if !allowed {
+		tx.Rollback()
+		return &QueueTicket{}, fmt.Errorf("Cannot Move A %s Ticket To %s", q.Status, status)
+	}
+
+	columns := map[string]interface{}{"status": status}
+	switch status {
+	case TicketCalled:
+		columns["called_at"] = now
+		q.CalledAt = &now
+	case TicketServing:
+		columns["serving_at"] = now
+		q.ServingAt = &now
+	case TicketDone:
+		columns["done_at"] = now
+		q.DoneAt = &now
+	}
+	if err = tx.Debug().Model(&QueueTicket{}).Where("id = ?", id).UpdateColumns(columns).Error; err != nil {
+		tx.Rollback()
+		return &QueueTicket{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &QueueTicket{}, err
+	}
+	q.Status = status
+	return q, nil
+}
+
+// medianDuration returns the median of the durations, which keeps a few
+// very long consultations from skewing the estimate
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
+
+// EstimateServiceTime is the typical time a doctor spends per patient, the
+// median time from opening to completing their recent examinations
+func EstimateServiceTime(db *gorm.DB, employeeID int, now time.Time) (time.Duration, error) {
+	examinations := []Examination{}
+	err := db.Debug().Model(&Examination{}).Select("created_at, updated_at").
+		Where("employee_id = ? AND status = ? AND created_at >= ?", employeeID, ExaminationCompleted, now.Add(-ServiceTimeHistory)).
+		Order("created_at desc").Limit(200).Find(&examinations).Error
+	if err != nil {
+		return 0, err
+	}
+	durations := []time.Duration{}
+	for _, e := range examinations {
+		d := e.UpdatedAt.Sub(e.CreatedAt)
+		// Examinations finished later in the day, or never really opened,
+		// say nothing about the consultation itself
+		if d < time.Minute || d > 4*time.Hour {
+			continue
+		}
+		durations = append(durations, d)
+	}
+	if len(durations) < minServiceSamples {
+		return DefaultServiceTime, nil
+	}
+	return medianDuration(durations), nil
+}
+
+// BuildQueueBoard returns a department's queues on a date, with an
+// estimated wait for every patient still waiting
+func BuildQueueBoard(db *gorm.DB, department *Department, date string, now time.Time) (*QueueBoard, error) {
+	tickets := []QueueTicket{}
+	err := db.Debug().Model(&QueueTicket{}).Where("date = ? AND department_id = ?", date, department.ID).
+		Order("employee_id").Order("number").Find(&tickets).Error
+	if err != nil {
+		return &QueueBoard{}, err
+	}
+
+	board := QueueBoard{Department: *department, Date: date, Queues: []DoctorQueue{}}
+	byDoctor := map[int]*DoctorQueue{}
+	order := []int{}
+	for _, t := range tickets {
+		queue, ok := byDoctor[t.EmployeeID]
+		if !ok {
+			doctor := Employee{}
+			if _, err = doctor.FindEmployeeByID(db, t.EmployeeID); err != nil {
+				return &QueueBoard{}, err
+			}
+			service, err := EstimateServiceTime(db, t.EmployeeID, now)
+			if err != nil {
+				return &QueueBoard{}, err
+			}
+			queue = &DoctorQueue{
+				EmployeeID:     t.EmployeeID,
+				Name:           doctor.Name,
+				ServiceMinutes: int(service.Round(time.Minute) / time.Minute),
+				NowServing:     []BoardTicket{},
+				Called:         []BoardTicket{},
+				Waiting:        []BoardTicket{},
+			}
+			byDoctor[t.EmployeeID] = queue
+			order = append(order, t.EmployeeID)
+		}
+		entry := BoardTicket{ID: t.ID, Code: t.Code, Number: t.Number, Status: t.Status}
+		switch t.Status {
+		case TicketServing:
+			queue.NowServing = append(queue.NowServing, entry)
+		case TicketCalled:
+			queue.Called = append(queue.Called, entry)
+		case TicketWaiting:
+			queue.Waiting = append(queue.Waiting, entry)
+		case TicketDone:
+			queue.Done++
+		case TicketSkipped:
+			queue.Skipped++
+		}
+	}
+
+	for _, id := range order {
+		queue := byDoctor[id]
+		// Everyone called or being served goes first; the patient being
+		// served is counted as half done on average
+		ahead := float64(len(queue.Called)) + float64(len(queue.NowServing))/2
+		for i := range queue.Waiting {
+			queue.Waiting[i].EstimatedWait = int((ahead + float64(i)) * float64(queue.ServiceMinutes))
+		}
+		board.Queues = append(board.Queues, *queue)
+	}
+	return &board, nil
+}
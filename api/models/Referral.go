@@ -0,0 +1,323 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Referral statuses, in lifecycle order
+const (
+	ReferralSent      = "sent"
+	ReferralAccepted  = "accepted"
+	ReferralScheduled = "scheduled"
+	ReferralCompleted = "completed"
+	ReferralRejected  = "rejected"
+)
+
+// Referral urgencies
+const (
+	UrgencyRoutine   = "routine"
+	UrgencyUrgent    = "urgent"
+	UrgencyEmergency = "emergency"
+)
+
+// referralTransitions lists the statuses a referral may move to from each
+// status. External referrals are never scheduled here, so they complete
+// straight from accepted.
+var referralTransitions = map[string][]string{
+	ReferralSent:      {ReferralAccepted, ReferralRejected},
+	ReferralAccepted:  {ReferralScheduled, ReferralCompleted, ReferralRejected},
+	ReferralScheduled: {ReferralCompleted},
+}
+
+// Referral sends a patient on from an examination, either to a department
+// of this hospital, optionally to a named doctor, or to an external
+// facility
+type Referral struct {
+	ID               uint32      `gorm:"primary_key;auto_increment" json:"id"`
+	ExaminationID    uint32      `gorm:"not null;index" json:"examination_id"`
+	MRN              string      `gorm:"size:20;index" json:"mrn"`
+	ReferredBy       int         `gorm:"not null" json:"referred_by"`
+	DepartmentID     uint32      `gorm:"index" json:"department_id,omitempty"`
+	Department       *Department `gorm:"foreignkey:DepartmentID;save_associations:false" json:"department,omitempty"`
+	EmployeeID       int         `json:"employee_id,omitempty"`
+	ExternalFacility string      `gorm:"size:255" json:"external_facility,omitempty"`
+	Urgency          string      `gorm:"size:20;not null" json:"urgency"`
+	Reason           string      `gorm:"type:text;not null" json:"reason"`
+	Status           string      `gorm:"size:20;not null;index" json:"status"`
+	AppointmentID    uint32      `json:"appointment_id,omitempty"`
+	RespondedBy      int         `json:"responded_by,omitempty"`
+	RespondedAt      *time.Time  `json:"responded_at"`
+	RejectionReason  string      `gorm:"size:255" json:"rejection_reason,omitempty"`
+	CompletedAt      *time.Time  `json:"completed_at"`
+	CreatedAt        time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt        time.Time   `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+	Redacted         bool        `gorm:"-" json:"redacted,omitempty"`
+}
+
+// Validate ...
+func (f *Referral) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case "reject":
+		if strings.TrimSpace(f.RejectionReason) == "" {
+			return errors.New("Required Rejection Reason")
+		}
+		return nil
+
+	default:
+		if f.ExaminationID == 0 {
+			return errors.New("Required Examination ID")
+		}
+		internal := f.DepartmentID != 0 || f.EmployeeID != 0
+		if internal == (f.ExternalFacility != "") {
+			return errors.New("Required Either A Department Or Doctor, Or An External Facility")
+		}
+		switch f.Urgency {
+		case "":
+			f.Urgency = UrgencyRoutine
+		case UrgencyRoutine, UrgencyUrgent, UrgencyEmergency:
+		default:
+			return errors.New("Invalid Urgency, Expected routine, urgent Or emergency")
+		}
+		if strings.TrimSpace(f.Reason) == "" {
+			return errors.New("Required Reason")
+		}
+		return nil
+	}
+}
+
+// External reports whether the patient is referred outside the hospital
+func (f *Referral) External() bool {
+	return f.ExternalFacility != ""
+}
+
+// CanMoveTo reports whether the referral may change to status
+func (f *Referral) CanMoveTo(status string) bool {
+	if status == ReferralScheduled && f.External() {
+		return false
+	}
+	for _, next := range referralTransitions[f.Status] {
+		if next == status {
+			return true
+		}
+	}
+	return false
+}
+
+// SourceExamination is the examination the referral was made from
+func (f *Referral) SourceExamination() uint32 {
+	return f.ExaminationID
+}
+
+// Redact blanks the reason for referral for a reader without access to
+// the examination it was made from
+func (f *Referral) Redact() {
+	f.Reason = ""
+	f.Redacted = true
+}
+
+// SaveReferral sends the referral. The patient is taken from the
+// examination, and the department from the doctor when only a doctor is
+// named.
+func (f *Referral) SaveReferral(db *gorm.DB) (*Referral, error) {
+
+	examination := Examination{}
+	if _, err := examination.FindExaminationByID(db, f.ExaminationID); err != nil {
+		return &Referral{}, errors.New("Examination Not Found")
+	}
+	if f.EmployeeID != 0 {
+		doctor := Employee{}
+		if _, err := doctor.FindEmployeeByID(db, f.EmployeeID); err != nil {
+			return &Referral{}, errors.New("Doctor Not Found")
+		}
+		if f.DepartmentID == 0 {
+			f.DepartmentID = doctor.DepartmentID
+		}
+		if doctor.DepartmentID != f.DepartmentID {
+			return &Referral{}, errors.New("Doctor Is Not In That Department")
+		}
+	}
+	if f.DepartmentID != 0 {
+		department := Department{}
+		if _, err := department.FindDepartmentByID(db, f.DepartmentID); err != nil {
+			return &Referral{}, err
+		}
+	}
+
+	f.ID = 0
+	f.MRN = examination.MRN
+	f.Status = ReferralSent
+	f.AppointmentID = 0
+	f.RespondedBy, f.RespondedAt, f.RejectionReason, f.CompletedAt = 0, nil, "", nil
+	if err := db.Debug().Create(&f).Error; err != nil {
+		return &Referral{}, err
+	}
+	return f.FindReferralByID(db, f.ID)
+}
+
+// FindReferrals lists referrals, optionally narrowed by patient,
+// examination, target department and status
+func (f *Referral) FindReferrals(db *gorm.DB, mrn string, examinationID, departmentID uint32, status string) (*[]Referral, error) {
+	referrals := []Referral{}
+	query := db.Debug().Model(&Referral{}).Preload("Department")
+	if mrn != "" {
+		query = query.Where("mrn = ?", mrn)
+	}
+	if examinationID != 0 {
+		query = query.Where("examination_id = ?", examinationID)
+	}
+	if departmentID != 0 {
+		query = query.Where("department_id = ?", departmentID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if err := query.Order("created_at desc").Limit(100).Find(&referrals).Error; err != nil {
+		return &[]Referral{}, err
+	}
+	return &referrals, nil
+}
+
+// FindReferralByID ...
+func (f *Referral) FindReferralByID(db *gorm.DB, id uint32) (*Referral, error) {
+	err := db.Debug().Model(&Referral{}).Preload("Department").Where("id = ?", id).Take(&f).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Referral{}, errors.New("Referral Not Found")
+	}
+	if err != nil {
+		return &Referral{}, err
+	}
+	return f, nil
+}
+
+// Accept records that the target department, doctor or facility takes the
+// patient on
+func (f *Referral) Accept(db *gorm.DB, id uint32, employeeID int) (*Referral, error) {
+	return f.transition(db, id, ReferralAccepted, func(now time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"responded_by": employeeID,
+			"responded_at": now,
+		}
+	})
+}
+
+// Reject declines the referral, giving the referring doctor a reason
+func (f *Referral) Reject(db *gorm.DB, id uint32, employeeID int) (*Referral, error) {
+	reason := strings.TrimSpace(f.RejectionReason)
+	if len(reason) > 255 {
+		return &Referral{}, errors.New("Rejection Reason Too Long")
+	}
+	return f.transition(db, id, ReferralRejected, func(now time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"responded_by":     employeeID,
+			"responded_at":     now,
+			"rejection_reason": reason,
+		}
+	})
+}
+
+// Complete records that the patient has been seen
+func (f *Referral) Complete(db *gorm.DB, id uint32) (*Referral, error) {
+	return f.transition(db, id, ReferralCompleted, func(now time.Time) map[string]interface{} {
+		return map[string]interface{}{
+			"completed_at": now,
+		}
+	})
+}
+
+// BookAppointment books appointment for the patient of an accepted internal
+// referral and marks the referral scheduled. The doctor defaults to the one
+// the patient was referred to and must work in the target department.
+func (f *Referral) BookAppointment(db *gorm.DB, id uint32, appointment *Appointment, now time.Time) (*Appointment, error) {
+
+	current := Referral{}
+	if _, err := current.FindReferralByID(db, id); err != nil {
+		return &Appointment{}, err
+	}
+	if !current.CanMoveTo(ReferralScheduled) {
+		if current.External() {
+			return &Appointment{}, errors.New("External Referrals Are Booked By The Facility")
+		}
+		return &Appointment{}, errors.New("Cannot Book An Appointment For A Referral That Is " + current.Status)
+	}
+	if appointment.EmployeeID == 0 {
+		appointment.EmployeeID = current.EmployeeID
+	}
+	if appointment.EmployeeID == 0 {
+		return &Appointment{}, errors.New("Required Employee ID")
+	}
+	doctor := Employee{}
+	if _, err := doctor.FindEmployeeByID(db, appointment.EmployeeID); err != nil {
+		return &Appointment{}, errors.New("Doctor Not Found")
+	}
+	if doctor.DepartmentID != current.DepartmentID {
+		return &Appointment{}, errors.New("Doctor Is Not In The Referred Department")
+	}
+	appointment.MRN = current.MRN
+	if err := appointment.Validate("booking"); err != nil {
+		return &Appointment{}, err
+	}
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return &Appointment{}, err
+	}
+
+	booked, err := appointment.book(tx, now)
+	if err != nil {
+		tx.Rollback()
+		return &Appointment{}, err
+	}
+	update := tx.Debug().Model(&Referral{}).Where("id = ? AND status = ?", id, current.Status).UpdateColumns(
+		map[string]interface{}{
+			"status":         ReferralScheduled,
+			"appointment_id": booked.AppointmentID,
+			"updated_at":     now,
+		},
+	)
+	if update.Error != nil {
+		tx.Rollback()
+		return &Appointment{}, update.Error
+	}
+	if update.RowsAffected == 0 {
+		tx.Rollback()
+		return &Appointment{}, errors.New("Referral Changed, Please Try Again")
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &Appointment{}, err
+	}
+	return booked, nil
+}
+
+func (f *Referral) transition(db *gorm.DB, id uint32, status string, columns func(time.Time) map[string]interface{}) (*Referral, error) {
+
+	current := Referral{}
+	if _, err := current.FindReferralByID(db, id); err != nil {
+		return &Referral{}, err
+	}
+	if !current.CanMoveTo(status) {
+		return &Referral{}, errors.New("Cannot Move Referral From " + current.Status + " To " + status)
+	}
+
+	now := time.Now()
+	updates := columns(now)
+	updates["status"] = status
+	updates["updated_at"] = now
+
+	err := db.Debug().Model(&Referral{}).Where("id = ? AND status = ?", id, current.Status).UpdateColumns(updates).Error
+	if err != nil {
+		return &Referral{}, err
+	}
+	return f.FindReferralByID(db, id)
+}
@@ -0,0 +1,595 @@
+package models
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Roster rules, checked whenever a shift is assigned or swapped
+var (
+	// MaxConsecutiveShifts is the most days in a row an employee may work
+	MaxConsecutiveShifts = 5
+	// MinRestBetweenShifts is the shortest break allowed between the end of
+	// one shift and the start of the next
+	MinRestBetweenShifts = 11 * time.Hour
+)
+
+// Shift swap statuses
+const (
+	SwapPending   = "pending"
+	SwapApproved  = "approved"
+	SwapRejected  = "rejected"
+	SwapCancelled = "cancelled"
+)
+
+// scheduleDayNames is the inverse of scheduleWeekdays, for display
+var scheduleDayNames = [...]string{"Minggu", "Senin", "Selasa", "Rabu", "Kamis", "Jumat", "Sabtu"}
+
+// ShiftTemplate is a named block of duty such as morning, evening or night.
+// A shift whose end time is not after its start time runs past midnight.
+type ShiftTemplate struct {
+	ID        uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Code      string    `gorm:"size:20;not null;unique" json:"code"`
+	Name      string    `gorm:"size:100;not null" json:"name"`
+	StartTime string    `gorm:"size:5;not null" json:"start_time"`
+	EndTime   string    `gorm:"size:5;not null" json:"end_time"`
+	CreatedAt time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// ShiftAssignment puts an employee on a shift in a ward on a date
+type ShiftAssignment struct {
+	ID              uint32         `gorm:"primary_key;auto_increment" json:"id"`
+	EmployeeID      int            `gorm:"not null;unique_index:idx_shift_assignment" json:"employee_id"`
+	WardID          uint32         `gorm:"not null;index" json:"ward_id"`
+	ShiftTemplateID uint32         `gorm:"not null;unique_index:idx_shift_assignment" json:"shift_template_id"`
+	ShiftTemplate   *ShiftTemplate `gorm:"foreignkey:ShiftTemplateID" json:"shift,omitempty"`
+	Date            string         `gorm:"size:10;not null;index;unique_index:idx_shift_assignment" json:"date"`
+	AssignedBy      int            `json:"assigned_by"`
+	CreatedAt       time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt       time.Time      `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// ShiftSwap asks to hand an assignment over to another employee, or, when
+// TargetAssignmentID is set, to exchange it for one of theirs. It takes
+// effect once an administrator approves it.
+type ShiftSwap struct {
+	ID                 uint32     `gorm:"primary_key;auto_increment" json:"id"`
+	AssignmentID       uint32     `gorm:"not null;index" json:"assignment_id"`
+	RequestedBy        int        `gorm:"not null" json:"requested_by"`
+	TargetEmployeeID   int        `gorm:"not null" json:"target_employee_id"`
+	TargetAssignmentID uint32     `json:"target_assignment_id"`
+	Reason             string     `gorm:"size:255" json:"reason"`
+	Status             string     `gorm:"size:20;not null;index" json:"status"`
+	DecidedBy          int        `json:"decided_by"`
+	DecidedAt          *time.Time `json:"decided_at"`
+	CreatedAt          time.Time  `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// Validate ...
+func (st *ShiftTemplate) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if st.Code == "" {
+			return errors.New("Required Code")
+		}
+		if st.Name == "" {
+			return errors.New("Required Name")
+		}
+		if _, err := time.Parse("15:04", st.StartTime); err != nil {
+			return errors.New("Invalid Start Time")
+		}
+		if _, err := time.Parse("15:04", st.EndTime); err != nil {
+			return errors.New("Invalid End Time")
+		}
+		return nil
+	}
+}
+
+// Window returns when the shift starts and ends on a date
+func (st *ShiftTemplate) Window(date string) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02 15:04", date+" "+st.StartTime, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	end, err := time.ParseInLocation("2006-01-02 15:04", date+" "+st.EndTime, time.Local)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if !end.After(start) {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, nil
+}
+
+// SaveShiftTemplate ...
+func (st *ShiftTemplate) SaveShiftTemplate(db *gorm.DB) (*ShiftTemplate, error) {
+	err := db.Debug().Create(&st).Error
+	if err != nil {
+		return &ShiftTemplate{}, err
+	}
+	return st, nil
+}
+
+// FindAllShiftTemplates ...
+func (st *ShiftTemplate) FindAllShiftTemplates(db *gorm.DB) (*[]ShiftTemplate, error) {
+	var err error
+	templates := []ShiftTemplate{}
+	err = db.Debug().Model(&ShiftTemplate{}).Order("start_time").Find(&templates).Error
+	if err != nil {
+		return &[]ShiftTemplate{}, err
+	}
+	return &templates, err
+}
+
+// Validate ...
+func (sa *ShiftAssignment) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if sa.EmployeeID == 0 {
+			return errors.New("Required Employee ID")
+		}
+		if sa.WardID == 0 {
+			return errors.New("Required Ward ID")
+		}
+		if sa.ShiftTemplateID == 0 {
+			return errors.New("Required Shift Template ID")
+		}
+		if _, err := time.Parse("2006-01-02", sa.Date); err != nil {
+			return errors.New("Invalid Date")
+		}
+		return nil
+	}
+}
+
+// window returns when the assignment starts and ends. The shift template
+// must be loaded.
+func (sa *ShiftAssignment) window() (time.Time, time.Time, error) {
+	if sa.ShiftTemplate == nil {
+		return time.Time{}, time.Time{}, errors.New("Shift Template Not Loaded")
+	}
+	return sa.ShiftTemplate.Window(sa.Date)
+}
+
+// checkRosterRules reports whether an employee already working the given
+// shifts may also work candidate: shifts must not overlap, must be at least
+// MinRestBetweenShifts apart and must not make a run of more than
+// MaxConsecutiveShifts working days.
+func checkRosterRules(existing []ShiftAssignment, candidate ShiftAssignment) error {
+	start, end, err := candidate.window()
+	if err != nil {
+		return err
+	}
+	worked := map[string]bool{candidate.Date: true}
+	for _, other := range existing {
+		otherStart, otherEnd, err := other.window()
+		if err != nil {
+			return err
+		}
+		if start.Before(otherEnd) && otherStart.Before(end) {
+			return errors.New("Shift Overlaps Another Assignment")
+		}
+		if !otherStart.Before(end) && otherStart.Sub(end) < MinRestBetweenShifts {
+			return errors.New("Not Enough Rest Before The Next Shift")
+		}
+		if !start.Before(otherEnd) && start.Sub(otherEnd) < MinRestBetweenShifts {
+			return errors.New("Not Enough Rest After The Previous Shift")
+		}
+		worked[other.Date] = true
+	}
+
+	day, _ := time.Parse("2006-01-02", candidate.Date)
+	run := 1
+	for d := day.AddDate(0, 0, -1); worked[d.Format("2006-01-02")]; d = d.AddDate(0, 0, -1) {
+		run++
+	}
+	for d := day.AddDate(0, 0, 1); worked[d.Format("2006-01-02")]; d = d.AddDate(0, 0, 1) {
+		run++
+	}
+	if run > MaxConsecutiveShifts {
+		return errors.New("Too Many Consecutive Shifts")
+	}
+	return nil
+}
+
+// nearbyAssignments loads an employee's shifts close enough to date to
+// matter for the roster rules, leaving out the given assignment ids
+func nearbyAssignments(db *gorm.DB, employeeID int, date string, exclude ...uint32) ([]ShiftAssignment, error) {
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil, errors.New("Invalid Date")
+	}
+	from := day.AddDate(0, 0, -(MaxConsecutiveShifts + 1)).Format("2006-01-02")
+	to := day.AddDate(0, 0, MaxConsecutiveShifts+1).Format("2006-01-02")
+	query := db.Debug().Model(&ShiftAssignment{}).Preload("ShiftTemplate").
+		Where("employee_id = ? AND date BETWEEN ? AND ?", employeeID, from, to)
+	if len(exclude) > 0 {
+		query = query.Where("id NOT IN (?)", exclude)
+	}
+	assignments := []ShiftAssignment{}
+	err = query.Find(&assignments).Error
+	return assignments, err
+}
+
+// lockEmployee takes a row lock on an employee so that concurrent roster
+// changes for the same person are checked one after another
+func lockEmployee(tx *gorm.DB, employeeID int) (*Employee, error) {
+	employee := Employee{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&Employee{}).Where("employee_id = ?", employeeID).Take(&employee).Error
+	if err != nil {
+		return &Employee{}, errors.New("Employee Not Found")
+	}
+	return &employee, nil
+}
+
+// Assign puts the employee on the shift after checking the roster rules
+func (sa *ShiftAssignment) Assign(db *gorm.DB) (*ShiftAssignment, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	employee, err := lockEmployee(tx, sa.EmployeeID)
+	if err != nil {
+		tx.Rollback()
+		return &ShiftAssignment{}, err
+	}
+	if !employee.Active {
+		tx.Rollback()
+		return &ShiftAssignment{}, errors.New("Employee Is Inactive")
+	}
+	ward := Ward{}
+	if _, err = ward.FindWardByID(tx, sa.WardID); err != nil {
+		tx.Rollback()
+		return &ShiftAssignment{}, err
+	}
+	template := ShiftTemplate{}
+	if err = tx.Debug().Model(&ShiftTemplate{}).Where("id = ?", sa.ShiftTemplateID).Take(&template).Error; err != nil {
+		tx.Rollback()
+		return &ShiftAssignment{}, errors.New("Shift Template Not Found")
+	}
+	sa.ShiftTemplate = &template
+
+	existing, err := nearbyAssignments(tx, sa.EmployeeID, sa.Date)
+	if err != nil {
+		tx.Rollback()
+		return &ShiftAssignment{}, err
+	}
+	if err = checkRosterRules(existing, *sa); err != nil {
+		tx.Rollback()
+		return &ShiftAssignment{}, err
+	}
+
+	sa.ID = 0
+	if err = tx.Debug().Omit("ShiftTemplate").Create(&sa).Error; err != nil {
+		tx.Rollback()
+		return &ShiftAssignment{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &ShiftAssignment{}, err
+	}
+	return sa, nil
+}
+
+// FindShiftAssignmentByID ...
+func (sa *ShiftAssignment) FindShiftAssignmentByID(db *gorm.DB, id uint32) (*ShiftAssignment, error) {
+	err := db.Debug().Model(&ShiftAssignment{}).Preload("ShiftTemplate").Where("id = ?", id).Take(&sa).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &ShiftAssignment{}, errors.New("Shift Assignment Not Found")
+	}
+	if err != nil {
+		return &ShiftAssignment{}, err
+	}
+	return sa, nil
+}
+
+// DeleteShiftAssignment ...
+func (sa *ShiftAssignment) DeleteShiftAssignment(db *gorm.DB, id uint32) (int64, error) {
+	var pending int
+	err := db.Debug().Model(&ShiftSwap{}).
+		Where("status = ? AND (assignment_id = ? OR target_assignment_id = ?)", SwapPending, id, id).
+		Count(&pending).Error
+	if err != nil {
+		return 0, err
+	}
+	if pending > 0 {
+		return 0, errors.New("Shift Has A Pending Swap Request")
+	}
+	db = db.Debug().Model(&ShiftAssignment{}).Where("id = ?", id).Take(&ShiftAssignment{}).Delete(&ShiftAssignment{})
+	if db.Error != nil {
+		return 0, db.Error
+	}
+	return db.RowsAffected, nil
+}
+
+// Validate ...
+func (ss *ShiftSwap) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if ss.AssignmentID == 0 {
+			return errors.New("Required Assignment ID")
+		}
+		if ss.TargetEmployeeID == 0 {
+			return errors.New("Required Target Employee ID")
+		}
+		if ss.TargetEmployeeID == ss.RequestedBy {
+			return errors.New("Cannot Swap A Shift With Yourself")
+		}
+		return nil
+	}
+}
+
+// RequestSwap files a swap request for one of the requester's own shifts
+func (ss *ShiftSwap) RequestSwap(db *gorm.DB) (*ShiftSwap, error) {
+	assignment := ShiftAssignment{}
+	if _, err := assignment.FindShiftAssignmentByID(db, ss.AssignmentID); err != nil || assignment.EmployeeID != ss.RequestedBy {
+		return &ShiftSwap{}, errors.New("Shift Assignment Not Found")
+	}
+	target := Employee{}
+	if _, err := target.FindEmployeeByID(db, ss.TargetEmployeeID); err != nil || !target.Active {
+		return &ShiftSwap{}, errors.New("Target Employee Not Found")
+	}
+	if ss.TargetAssignmentID != 0 {
+		other := ShiftAssignment{}
+		if _, err := other.FindShiftAssignmentByID(db, ss.TargetAssignmentID); err != nil || other.EmployeeID != ss.TargetEmployeeID {
+			return &ShiftSwap{}, errors.New("Target Shift Assignment Not Found")
+		}
+	}
+	ss.ID = 0
+	ss.Status = SwapPending
+	ss.DecidedBy = 0
+	ss.DecidedAt = nil
+	err := db.Debug().Create(&ss).Error
+	if err != nil {
+		return &ShiftSwap{}, err
+	}
+	return ss, nil
+}
+
+// FindShiftSwaps returns swap requests, optionally only those with a status
+func (ss *ShiftSwap) FindShiftSwaps(db *gorm.DB, status string) (*[]ShiftSwap, error) {
+	var err error
+	swaps := []ShiftSwap{}
+	query := db.Debug().Model(&ShiftSwap{})
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err = query.Order("created_at desc").Limit(100).Find(&swaps).Error
+	if err != nil {
+		return &[]ShiftSwap{}, err
+	}
+	return &swaps, err
+}
+
+// Decide approves, rejects or cancels a pending swap. Approving re-checks
+// the roster rules for both employees and moves the assignments.
+func (ss *ShiftSwap) Decide(db *gorm.DB, id uint32, status string, employeeID int) (*ShiftSwap, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&ShiftSwap{}).Where("id = ?", id).Take(&ss).Error
+	if err != nil {
+		tx.Rollback()
+		return &ShiftSwap{}, errors.New("Shift Swap Not Found")
+	}
+	if ss.Status != SwapPending {
+		tx.Rollback()
+		return &ShiftSwap{}, errors.New("Shift Swap Has Already Been Decided")
+	}
+
+	if status == SwapApproved {
+		if err = ss.apply(tx); err != nil {
+			tx.Rollback()
+			return &ShiftSwap{}, err
+		}
+	}
+
+	now := time.Now()
+	err = tx.Debug().Model(&ShiftSwap{}).Where("id = ?", id).UpdateColumns(
+		map[string]interface{}{
+			"status":     status,
+			"decided_by": employeeID,
+			"decided_at": now,
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &ShiftSwap{}, err
+	}
+	if err = tx.Commit().Error; err != nil {
+		return &ShiftSwap{}, err
+	}
+	ss.Status = status
+	ss.DecidedBy = employeeID
+	ss.DecidedAt = &now
+	return ss, nil
+}
+
+// apply moves the assignments of an approved swap inside tx
+func (ss *ShiftSwap) apply(tx *gorm.DB) error {
+	// Lock both employees in a fixed order so two swaps between the same
+	// pair cannot deadlock
+	ids := []int{ss.RequestedBy, ss.TargetEmployeeID}
+	sort.Ints(ids)
+	for _, id := range ids {
+		employee, err := lockEmployee(tx, id)
+		if err != nil {
+			return err
+		}
+		if !employee.Active {
+			return errors.New("Employee Is Inactive")
+		}
+	}
+
+	given := ShiftAssignment{}
+	if _, err := given.FindShiftAssignmentByID(tx, ss.AssignmentID); err != nil || given.EmployeeID != ss.RequestedBy {
+		return errors.New("Shift Assignment No Longer Belongs To The Requester")
+	}
+	exclude := []uint32{given.ID}
+	taken := ShiftAssignment{}
+	if ss.TargetAssignmentID != 0 {
+		if _, err := taken.FindShiftAssignmentByID(tx, ss.TargetAssignmentID); err != nil || taken.EmployeeID != ss.TargetEmployeeID {
+			return errors.New("Target Shift Assignment No Longer Belongs To The Target Employee")
+		}
+		exclude = append(exclude, taken.ID)
+	}
+
+	given.EmployeeID = ss.TargetEmployeeID
+	existing, err := nearbyAssignments(tx, ss.TargetEmployeeID, given.Date, exclude...)
+	if err != nil {
+		return err
+	}
+	if err = checkRosterRules(existing, given); err != nil {
+		return errors.New("Target Employee: " + err.Error())
+	}
+	if taken.ID != 0 {
+		taken.EmployeeID = ss.RequestedBy
+		existing, err = nearbyAssignments(tx, ss.RequestedBy, taken.Date, exclude...)
+		if err != nil {
+			return err
+		}
+		if err = checkRosterRules(existing, taken); err != nil {
+			return errors.New("Requester: " + err.Error())
+		}
+	}
+
+	for _, moved := range []ShiftAssignment{given, taken} {
+		if moved.ID == 0 {
+			continue
+		}
+		err = tx.Debug().Model(&ShiftAssignment{}).Where("id = ?", moved.ID).UpdateColumns(
+			map[string]interface{}{
+				"employee_id": moved.EmployeeID,
+				"updated_at":  time.Now(),
+			},
+		).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RosterEntry is one employee on a shift
+type RosterEntry struct {
+	AssignmentID uint32 `json:"assignment_id"`
+	EmployeeID   int    `json:"employee_id"`
+	Name         string `json:"name"`
+	JobTitle     string `json:"job_title"`
+}
+
+// RosterShift lists who works a shift on a day
+type RosterShift struct {
+	Shift     ShiftTemplate `json:"shift"`
+	Employees []RosterEntry `json:"employees"`
+}
+
+// RosterDay ...
+type RosterDay struct {
+	Date   string        `json:"date"`
+	Day    string        `json:"day"`
+	Shifts []RosterShift `json:"shifts"`
+}
+
+// WeekRoster is a ward's roster from Monday to Sunday
+type WeekRoster struct {
+	Ward      Ward        `json:"ward"`
+	WeekStart string      `json:"week_start"`
+	WeekEnd   string      `json:"week_end"`
+	Days      []RosterDay `json:"days"`
+}
+
+// BuildWeekRoster returns the roster of a ward for the week containing day
+func BuildWeekRoster(db *gorm.DB, wardID uint32, day time.Time) (*WeekRoster, error) {
+	ward := Ward{}
+	if _, err := ward.FindWardByID(db, wardID); err != nil {
+		return &WeekRoster{}, err
+	}
+	template := ShiftTemplate{}
+	templates, err := template.FindAllShiftTemplates(db)
+	if err != nil {
+		return &WeekRoster{}, err
+	}
+
+	offset := (int(day.Weekday()) + 6) % 7
+	monday := time.Date(day.Year(), day.Month(), day.Day()-offset, 0, 0, 0, 0, time.Local)
+	roster := WeekRoster{
+		Ward:      ward,
+		WeekStart: monday.Format("2006-01-02"),
+		WeekEnd:   monday.AddDate(0, 0, 6).Format("2006-01-02"),
+		Days:      []RosterDay{},
+	}
+
+	assignments := []ShiftAssignment{}
+	err = db.Debug().Model(&ShiftAssignment{}).
+		Where("ward_id = ? AND date BETWEEN ? AND ?", wardID, roster.WeekStart, roster.WeekEnd).
+		Find(&assignments).Error
+	if err != nil {
+		return &WeekRoster{}, err
+	}
+	employeeIDs := []int{}
+	for _, a := range assignments {
+		employeeIDs = append(employeeIDs, a.EmployeeID)
+	}
+	employees := map[int]Employee{}
+	if len(employeeIDs) > 0 {
+		found := []Employee{}
+		if err = db.Debug().Model(&Employee{}).Where("employee_id IN (?)", employeeIDs).Find(&found).Error; err != nil {
+			return &WeekRoster{}, err
+		}
+		for _, e := range found {
+			employees[e.EmployeeID] = e
+		}
+	}
+
+	for i := 0; i < 7; i++ {
+		date := monday.AddDate(0, 0, i)
+		rosterDay := RosterDay{
+			Date:   date.Format("2006-01-02"),
+			Day:    scheduleDayNames[date.Weekday()],
+			Shifts: []RosterShift{},
+		}
+		for _, t := range *templates {
+			shift := RosterShift{Shift: t, Employees: []RosterEntry{}}
+			for _, a := range assignments {
+				if a.Date != rosterDay.Date || a.ShiftTemplateID != t.ID {
+					continue
+				}
+				e := employees[a.EmployeeID]
+				shift.Employees = append(shift.Employees, RosterEntry{
+					AssignmentID: a.ID,
+					EmployeeID:   a.EmployeeID,
+					Name:         e.Name,
+					JobTitle:     e.JobTitle,
+				})
+			}
+			sort.SliceStable(shift.Employees, func(i, j int) bool {
+				return shift.Employees[i].Name < shift.Employees[j].Name
+			})
+			rosterDay.Shifts = append(rosterDay.Shifts, shift)
+		}
+		roster.Days = append(roster.Days, rosterDay)
+	}
+	return &roster, nil
+}
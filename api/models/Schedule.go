@@ -55,6 +55,12 @@ func (s *Schedule) Validate(action string) error {
 	}
 }
 
+// Weekday returns the day of the week the schedule is held on
+func (s *Schedule) Weekday() (time.Weekday, bool) {
+	day, ok := scheduleWeekdays[strings.ToLower(s.Day)]
+	return day, ok
+}
+
 // SaveSchedule ...
 func (s *Schedule) SaveSchedule(db *gorm.DB) (*Schedule, error) {
 	var err error
@@ -68,7 +74,10 @@ func (s *Schedule) SaveSchedule(db *gorm.DB) (*Schedule, error) {
 // FindSchedulesByCode ...
 func (s *Schedule) FindSchedulesByCode(db *gorm.DB, sc string) (*Schedule, error) {
 	var err error
-	err = db.Debug().Model(Schedule{}).Where("sc = ?", sc).Take(&s).Error
+	err = db.Debug().Model(Schedule{}).Where("schedule_code = ?", sc).Take(&s).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Schedule{}, errors.New("Schedule Not Found")
+	}
 	if err != nil {
 		return &Schedule{}, err
 	}
@@ -0,0 +1,161 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Sensitivity labels. An examination with any of them is restricted: only
+// its own doctor, employees cleared for every one of its labels and
+// employees with emergency access to the patient read it in full.
+const (
+	SensitivityMentalHealth  = "mental-health"
+	SensitivityHIV           = "hiv"
+	SensitivitySubstanceUse  = "substance-use"
+	SensitivityReproductive  = "reproductive-health"
+	SensitivityGenetic       = "genetic"
+	SensitivitySexualHealth  = "sexual-health"
+	SensitivityDomesticAbuse = "domestic-abuse"
+	SensitivityVIP           = "vip"
+)
+
+// SensitivityLabels lists the labels an examination may be given
+var SensitivityLabels = []string{
+	SensitivityMentalHealth, SensitivityHIV, SensitivitySubstanceUse, SensitivityReproductive,
+	SensitivityGenetic, SensitivitySexualHealth, SensitivityDomesticAbuse, SensitivityVIP,
+}
+
+// splitLabels reads a comma separated list of labels
+func splitLabels(labels string) []string {
+	if labels == "" {
+		return nil
+	}
+	return strings.Split(labels, ",")
+}
+
+// normalizeLabels checks a comma separated list of labels and returns it
+// lower cased, without blanks or repeats, in the order of SensitivityLabels
+func normalizeLabels(labels string) (string, error) {
+	given := map[string]bool{}
+	for _, label := range strings.Split(labels, ",") {
+		label = strings.ToLower(strings.TrimSpace(label))
+		if label == "" {
+			continue
+		}
+		known := false
+		for _, l := range SensitivityLabels {
+			if label == l {
+				known = true
+			}
+		}
+		if !known {
+			return "", errors.New("Invalid Sensitivity Label " + label + ", Expected " + strings.Join(SensitivityLabels, ", "))
+		}
+		given[label] = true
+	}
+	normalized := []string{}
+	for _, l := range SensitivityLabels {
+		if given[l] {
+			normalized = append(normalized, l)
+		}
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+// ExaminationAccess decides which restricted examinations a caller may read
+// in full. A nil access allows everything; it is used for patients reading
+// their own record.
+type ExaminationAccess struct {
+	employee  *Employee
+	emergency map[string]bool
+}
+
+// NewExaminationAccess loads the access of an employee, including the
+// patients they hold unexpired emergency access to at now. A nil employee
+// may read no restricted examination.
+func NewExaminationAccess(db *gorm.DB, employee *Employee, now time.Time) (*ExaminationAccess, error) {
+	access := ExaminationAccess{employee: employee, emergency: map[string]bool{}}
+	if employee == nil {
+		return &access, nil
+	}
+	mrns := []string{}
+	err := db.Debug().Model(&EmergencyAccess{}).Where("employee_id = ? AND expires_at > ?", employee.EmployeeID, now).Pluck("mrn", &mrns).Error
+	if err != nil {
+		return &ExaminationAccess{}, err
+	}
+	for _, mrn := range mrns {
+		access.emergency[mrn] = true
+	}
+	return &access, nil
+}
+
+// Allows reports whether e may be read in full
+func (a *ExaminationAccess) Allows(e *Examination) bool {
+	if a == nil || !e.Restricted() {
+		return true
+	}
+	if a.employee == nil {
+		return false
+	}
+	if e.EmployeeID == a.employee.EmployeeID || a.emergency[e.MRN] {
+		return true
+	}
+	for _, label := range e.Labels() {
+		if !a.employee.HasClearance(label) {
+			return false
+		}
+	}
+	return true
+}
+
+// Filter redacts e unless it may be read in full
+func (a *ExaminationAccess) Filter(e *Examination) {
+	if !a.Allows(e) {
+		e.Redact()
+	}
+}
+
+// ExaminationRecord is a record made during an examination, such as a lab
+// order, an attachment or a referral, that is withheld along with it
+type ExaminationRecord interface {
+	SourceExamination() uint32
+	Redact()
+}
+
+// FilterRecords redacts the records whose examination may not be read in
+// full. Records not made during an examination are left as they are.
+func (a *ExaminationAccess) FilterRecords(db *gorm.DB, records ...ExaminationRecord) error {
+	if a == nil || len(records) == 0 {
+		return nil
+	}
+	ids := []uint32{}
+	for _, r := range records {
+		if id := r.SourceExamination(); id != 0 {
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	examinations := []Examination{}
+	err := db.Debug().Model(&Examination{}).Select("examination_id, mrn, employee_id, sensitivity").
+		Where("examination_id IN (?) AND sensitivity <> ''", ids).Find(&examinations).Error
+	if err != nil {
+		return err
+	}
+	denied := map[uint32]bool{}
+	for i := range examinations {
+		if !a.Allows(&examinations[i]) {
+			denied[examinations[i].ExaminationID] = true
+		}
+	}
+	for _, r := range records {
+		if denied[r.SourceExamination()] {
+			r.Redact()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Stock movement types
+const (
+	MovementReceive  = "receive"
+	MovementDispense = "dispense"
+	MovementAdjust   = "adjust"
+	MovementExpire   = "expire"
+)
+
+// StockMovement is an entry in the pharmacy stock ledger. Quantity is signed:
+// receipts are positive, dispensing and expiry are negative.
+type StockMovement struct {
+	ID            uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	MedicationID  uint32    `gorm:"not null;index" json:"medication_id"`
+	BatchID       uint32    `gorm:"not null;index" json:"batch_id"`
+	Type          string    `gorm:"size:20;not null;" json:"type"`
+	Quantity      int       `gorm:"not null" json:"quantity"`
+	ExaminationID uint32    `gorm:"index" json:"examination_id"`
+	EmployeeID    int       `json:"employee_id"`
+	Note          string    `gorm:"size:255" json:"note"`
+	CreatedAt     time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+}
+
+// Validate ...
+func (s *StockMovement) Validate(action string) error {
+	switch strings.ToLower(action) {
+	case MovementDispense:
+		if s.ExaminationID == 0 {
+			return errors.New("Required Examination ID")
+		}
+		if s.MedicationID == 0 {
+			return errors.New("Required Medication ID")
+		}
+		if s.Quantity <= 0 {
+			return errors.New("Quantity Must Be Positive")
+		}
+		return nil
+
+	case MovementAdjust:
+		if s.BatchID == 0 {
+			return errors.New("Required Batch ID")
+		}
+		if s.Quantity == 0 {
+			return errors.New("Required Quantity")
+		}
+		if s.Note == "" {
+			return errors.New("Required Note")
+		}
+		return nil
+
+	default:
+		if s.MedicationID == 0 {
+			return errors.New("Required Medication ID")
+		}
+		if s.BatchID == 0 {
+			return errors.New("Required Batch ID")
+		}
+		return nil
+	}
+}
+
+// FindMovementsByMedication ...
+func (s *StockMovement) FindMovementsByMedication(db *gorm.DB, medicationID uint32) (*[]StockMovement, error) {
+	var err error
+	movements := []StockMovement{}
+	err = db.Debug().Model(&StockMovement{}).Where("medication_id = ?", medicationID).Order("created_at desc").Limit(100).Find(&movements).Error
+	if err != nil {
+		return &[]StockMovement{}, err
+	}
+	return &movements, err
+}
+
+// Dispense takes Quantity units of a medication for an examination. Batches
+// are drawn first-expiry-first-out, skipping anything already expired, so a
+// single request may produce several movements.
+func (s *StockMovement) Dispense(db *gorm.DB) (*[]StockMovement, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	examination := Examination{}
+	if _, err := examination.FindExaminationByID(tx, s.ExaminationID); err != nil {
+		tx.Rollback()
+		return &[]StockMovement{}, errors.New("Examination Not Found")
+	}
+
+	now := time.Now()
+	batches := []MedicationBatch{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&MedicationBatch{}).
+		Where("medication_id = ? AND quantity > 0 AND expiry_date > ?", s.MedicationID, now).
+		Order("expiry_date").Order("id").Find(&batches).Error
+	if err != nil {
+		tx.Rollback()
+		return &[]StockMovement{}, err
+	}
+
+	available := 0
+	for i := range batches {
+		available += batches[i].Quantity
+	}
+	if available < s.Quantity {
+		tx.Rollback()
+		return &[]StockMovement{}, errors.New("Insufficient Stock")
+	}
+
+	movements := []StockMovement{}
+	remaining := s.Quantity
+	for i := 0; remaining > 0; i++ {
+		take := batches[i].Quantity
+		if take > remaining {
+			take = remaining
+		}
+		err = tx.Debug().Model(&MedicationBatch{}).Where("id = ?", batches[i].ID).UpdateColumns(
+			map[string]interface{}{
+				"quantity":   batches[i].Quantity - take,
+				"updated_at": now,
+			},
+		).Error
+		if err != nil {
+			tx.Rollback()
+			return &[]StockMovement{}, err
+		}
+
+		movement := StockMovement{
+			MedicationID:  s.MedicationID,
+			BatchID:       batches[i].ID,
+			Type:          MovementDispense,
+			Quantity:      -take,
+			ExaminationID: s.ExaminationID,
+			EmployeeID:    s.EmployeeID,
+			Note:          s.Note,
+		}
+		if err = tx.Debug().Create(&movement).Error; err != nil {
+			tx.Rollback()
+			return &[]StockMovement{}, err
+		}
+		movements = append(movements, movement)
+		remaining -= take
+	}
+
+	// The first movement stands for the whole dispensing on the invoice
+	err = CaptureDispenseCharge(tx, &examination, s.MedicationID, s.Quantity, movements[0].ID, s.EmployeeID)
+	if err != nil {
+		tx.Rollback()
+		return &[]StockMovement{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &[]StockMovement{}, err
+	}
+	return &movements, nil
+}
+
+// Adjust corrects the quantity of a single batch after a stock count
+func (s *StockMovement) Adjust(db *gorm.DB) (*StockMovement, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	batch := MedicationBatch{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&MedicationBatch{}).Where("id = ?", s.BatchID).Take(&batch).Error
+	if err != nil {
+		tx.Rollback()
+		return &StockMovement{}, errors.New("Batch Not Found")
+	}
+	if batch.Quantity+s.Quantity < 0 {
+		tx.Rollback()
+		return &StockMovement{}, errors.New("Adjustment Exceeds Batch Quantity")
+	}
+
+	err = tx.Debug().Model(&MedicationBatch{}).Where("id = ?", batch.ID).UpdateColumns(
+		map[string]interface{}{
+			"quantity":   batch.Quantity + s.Quantity,
+			"updated_at": time.Now(),
+		},
+	).Error
+	if err != nil {
+		tx.Rollback()
+		return &StockMovement{}, err
+	}
+
+	s.MedicationID = batch.MedicationID
+	s.Type = MovementAdjust
+	if err = tx.Debug().Create(&s).Error; err != nil {
+		tx.Rollback()
+		return &StockMovement{}, err
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &StockMovement{}, err
+	}
+	return s, nil
+}
+
+// ExpireBatches writes off every batch that expired on or before asOf and
+// still has stock, recording one expire movement per batch.
+func (s *StockMovement) ExpireBatches(db *gorm.DB, asOf time.Time) (*[]StockMovement, error) {
+
+	tx := db.Begin()
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := tx.Error; err != nil {
+		return nil, err
+	}
+
+	batches := []MedicationBatch{}
+	err := tx.Debug().Set("gorm:query_option", "FOR UPDATE").Model(&MedicationBatch{}).
+		Where("quantity > 0 AND expiry_date <= ?", asOf).Find(&batches).Error
+	if err != nil {
+		tx.Rollback()
+		return &[]StockMovement{}, err
+	}
+
+	movements := []StockMovement{}
+	for i := range batches {
+		err = tx.Debug().Model(&MedicationBatch{}).Where("id = ?", batches[i].ID).UpdateColumns(
+			map[string]interface{}{
+				"quantity":   0,
+				"updated_at": time.Now(),
+			},
+		).Error
+		if err != nil {
+			tx.Rollback()
+			return &[]StockMovement{}, err
+		}
+
+		movement := StockMovement{
+			MedicationID: batches[i].MedicationID,
+			BatchID:      batches[i].ID,
+			Type:         MovementExpire,
+			Quantity:     -batches[i].Quantity,
+			EmployeeID:   s.EmployeeID,
+			Note:         "batch " + batches[i].BatchNumber + " expired",
+		}
+		if err = tx.Debug().Create(&movement).Error; err != nil {
+			tx.Rollback()
+			return &[]StockMovement{}, err
+		}
+		movements = append(movements, movement)
+	}
+
+	if err = tx.Commit().Error; err != nil {
+		return &[]StockMovement{}, err
+	}
+	return &movements, nil
+}
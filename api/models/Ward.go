@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Ward ...
+type Ward struct {
+	ID           uint32    `gorm:"primary_key;auto_increment" json:"id"`
+	Code         string    `gorm:"size:20;not null;unique" json:"code"`
+	Name         string    `gorm:"size:100;not null;unique" json:"name"`
+	DepartmentID uint32    `gorm:"index" json:"department_id"`
+	CreatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"created_at"`
+	UpdatedAt    time.Time `gorm:"default:CURRENT_TIMESTAMP" json:"updated_at"`
+}
+
+// Validate ...
+func (wd *Ward) Validate(action string) error {
+	switch strings.ToLower(action) {
+	default:
+		if wd.Code == "" {
+			return errors.New("Required Code")
+		}
+		if wd.Name == "" {
+			return errors.New("Required Name")
+		}
+		return nil
+	}
+}
+
+// SaveWard ...
+func (wd *Ward) SaveWard(db *gorm.DB) (*Ward, error) {
+	if wd.DepartmentID != 0 {
+		department := Department{}
+		if _, err := department.FindDepartmentByID(db, wd.DepartmentID); err != nil {
+			return &Ward{}, err
+		}
+	}
+	err := db.Debug().Create(&wd).Error
+	if err != nil {
+		return &Ward{}, err
+	}
+	return wd, nil
+}
+
+// FindAllWards ...
+func (wd *Ward) FindAllWards(db *gorm.DB) (*[]Ward, error) {
+	var err error
+	wards := []Ward{}
+	err = db.Debug().Model(&Ward{}).Order("name").Limit(100).Find(&wards).Error
+	if err != nil {
+		return &[]Ward{}, err
+	}
+	return &wards, err
+}
+
+// FindWardByID ...
+func (wd *Ward) FindWardByID(db *gorm.DB, id uint32) (*Ward, error) {
+	err := db.Debug().Model(&Ward{}).Where("id = ?", id).Take(&wd).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return &Ward{}, errors.New("Ward Not Found")
+	}
+	if err != nil {
+		return &Ward{}, err
+	}
+	return wd, nil
+}
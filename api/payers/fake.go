@@ -0,0 +1,94 @@
+package payers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/repoerna/hms_app/api/utils/money"
+)
+
+// FakePayer is a local payer for development and testing. Its answers are
+// driven by the member number so every outcome can be produced on demand:
+//
+//	member number ending in 0  not eligible
+//	member number ending in 9  claims are rejected
+//	otherwise                  claims are approved up to the class ceiling,
+//	                           and partially approved above it
+type FakePayer struct {
+	// Ceilings is the most approved per claim for each class; classes not
+	// listed use DefaultCeiling
+	Ceilings       map[string]money.Amount
+	DefaultCeiling money.Amount
+
+	mu   sync.Mutex
+	next int
+}
+
+// NewFakePayer returns a fake payer with ceilings for classes 1 to 3
+func NewFakePayer() *FakePayer {
+	return &FakePayer{
+		Ceilings: map[string]money.Amount{
+			"1": money.FromUnits(1000000),
+			"2": money.FromUnits(750000),
+			"3": money.FromUnits(500000),
+		},
+		DefaultCeiling: money.FromUnits(500000),
+	}
+}
+
+func (f *FakePayer) reference(prefix string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next++
+	return fmt.Sprintf("FAKE-%s-%06d", prefix, f.next)
+}
+
+// CheckEligibility ...
+func (f *FakePayer) CheckEligibility(ctx context.Context, req EligibilityRequest) (*Eligibility, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	result := Eligibility{
+		Eligible:  true,
+		Class:     req.Class,
+		Reference: f.reference("ELG"),
+		CheckedAt: time.Now(),
+	}
+	if strings.HasSuffix(req.MemberNumber, "0") {
+		result.Eligible = false
+		result.Reason = "Membership Is Not Active"
+	}
+	return &result, nil
+}
+
+// SubmitClaim ...
+func (f *FakePayer) SubmitClaim(ctx context.Context, req ClaimRequest) (*ClaimDecision, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	decision := ClaimDecision{Reference: f.reference("CLM")}
+	switch {
+	case strings.HasSuffix(req.MemberNumber, "0"):
+		decision.Status = ClaimRejected
+		decision.Reason = "Membership Is Not Active"
+	case strings.HasSuffix(req.MemberNumber, "9"):
+		decision.Status = ClaimRejected
+		decision.Reason = "Service Not Covered"
+	default:
+		ceiling, ok := f.Ceilings[req.Class]
+		if !ok {
+			ceiling = f.DefaultCeiling
+		}
+		decision.Status = ClaimApproved
+		decision.ApprovedAmount = req.Total
+		if req.Total > ceiling {
+			decision.Status = ClaimPartial
+			decision.ApprovedAmount = ceiling
+			decision.Reason = fmt.Sprintf("Approved Up To The Class Ceiling Of %s", ceiling)
+		}
+	}
+	return &decision, nil
+}
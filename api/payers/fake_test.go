@@ -0,0 +1,127 @@
+package payers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/repoerna/hms_app/api/utils/money"
+)
+
+var _ PayerAdapter = (*FakePayer)(nil)
+
+func claim(member, class string, total money.Amount) ClaimRequest {
+	return ClaimRequest{
+		ClaimNumber:  "CLM-2024-000001",
+		MemberNumber: member,
+		Class:        class,
+		ServiceDate:  time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC),
+		Diagnosis:    "J06.9",
+		Lines: []ClaimLine{
+			{Code: "CONS-GP", Description: "General consultation", Quantity: 1, Amount: total},
+		},
+		Total: total,
+	}
+}
+
+func TestFakePayerSubmitClaim(t *testing.T) {
+	tests := []struct {
+		name     string
+		request  ClaimRequest
+		status   string
+		approved money.Amount
+		reason   string
+	}{
+		{"approved", claim("0001234561", "2", money.FromUnits(250000)), ClaimApproved, money.FromUnits(250000), ""},
+		{"approved at the ceiling", claim("0001234561", "3", money.FromUnits(500000)), ClaimApproved, money.FromUnits(500000), ""},
+		{"partial above the ceiling", claim("0001234561", "1", money.FromUnits(1500000)), ClaimPartial, money.FromUnits(1000000),
+			"Approved Up To The Class Ceiling Of " + money.FromUnits(1000000).String()},
+		{"unknown class uses the default ceiling", claim("0001234561", "VIP", money.FromUnits(600000)), ClaimPartial, money.FromUnits(500000),
+			"Approved Up To The Class Ceiling Of " + money.FromUnits(500000).String()},
+		{"inactive membership", claim("0001234560", "1", money.FromUnits(100000)), ClaimRejected, 0, "Membership Is Not Active"},
+		{"service not covered", claim("0001234569", "1", money.FromUnits(100000)), ClaimRejected, 0, "Service Not Covered"},
+	}
+	payer := NewFakePayer()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := payer.SubmitClaim(context.Background(), tt.request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if decision.Status != tt.status {
+				t.Errorf("Status = %q, want %q", decision.Status, tt.status)
+			}
+			if decision.ApprovedAmount != tt.approved {
+				t.Errorf("ApprovedAmount = %s, want %s", decision.ApprovedAmount, tt.approved)
+			}
+			if decision.Reason != tt.reason {
+				t.Errorf("Reason = %q, want %q", decision.Reason, tt.reason)
+			}
+			if decision.Reference == "" {
+				t.Error("decision has no payer reference")
+			}
+		})
+	}
+}
+
+func TestFakePayerCeilings(t *testing.T) {
+	payer := NewFakePayer()
+	payer.Ceilings["1"] = money.FromUnits(100000)
+
+	decision, err := payer.SubmitClaim(context.Background(), claim("0001234561", "1", money.FromUnits(150000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision.Status != ClaimPartial || decision.ApprovedAmount != money.FromUnits(100000) {
+		t.Errorf("decision = %s %s, want partial %s", decision.Status, decision.ApprovedAmount, money.FromUnits(100000))
+	}
+}
+
+func TestFakePayerReferences(t *testing.T) {
+	payer := NewFakePayer()
+	seen := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		decision, err := payer.SubmitClaim(context.Background(), claim("0001234561", "2", money.FromUnits(1000)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[decision.Reference] {
+			t.Fatalf("reference %s was issued twice", decision.Reference)
+		}
+		seen[decision.Reference] = true
+	}
+}
+
+func TestFakePayerCancelled(t *testing.T) {
+	payer := NewFakePayer()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := payer.SubmitClaim(ctx, claim("0001234561", "2", money.FromUnits(1000))); err != context.Canceled {
+		t.Errorf("SubmitClaim: err = %v, want context.Canceled", err)
+	}
+	if _, err := payer.CheckEligibility(ctx, EligibilityRequest{MemberNumber: "0001234561"}); err != context.Canceled {
+		t.Errorf("CheckEligibility: err = %v, want context.Canceled", err)
+	}
+}
+
+func TestFakePayerCheckEligibility(t *testing.T) {
+	payer := NewFakePayer()
+	date := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	eligibility, err := payer.CheckEligibility(context.Background(), EligibilityRequest{MemberNumber: "0001234561", Class: "2", ServiceDate: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !eligibility.Eligible || eligibility.Class != "2" || eligibility.Reference == "" {
+		t.Errorf("active member: got %+v", eligibility)
+	}
+
+	eligibility, err = payer.CheckEligibility(context.Background(), EligibilityRequest{MemberNumber: "0001234560", Class: "2", ServiceDate: date})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eligibility.Eligible || eligibility.Reason != "Membership Is Not Active" {
+		t.Errorf("inactive member: got %+v", eligibility)
+	}
+}
@@ -0,0 +1,74 @@
+// Package payers talks to insurers. Each insurer is reached through a
+// PayerAdapter, so a national scheme's bridging API and a private
+// insurer's portal can sit behind the same calls.
+package payers
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/repoerna/hms_app/api/utils/money"
+)
+
+// Claim decisions
+const (
+	ClaimApproved = "approved"
+	ClaimPartial  = "partial"
+	ClaimRejected = "rejected"
+)
+
+// ErrUnavailable is returned when the payer cannot be reached; the request
+// may be retried later
+var ErrUnavailable = errors.New("Payer Is Unavailable")
+
+// EligibilityRequest asks whether a member is covered on a date
+type EligibilityRequest struct {
+	MemberNumber string
+	Class        string
+	ServiceDate  time.Time
+}
+
+// Eligibility is the payer's answer to an EligibilityRequest
+type Eligibility struct {
+	Eligible  bool      `json:"eligible"`
+	Class     string    `json:"class"`
+	Reason    string    `json:"reason,omitempty"`
+	Reference string    `json:"reference"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// ClaimLine is one billed service on a claim
+type ClaimLine struct {
+	Code        string
+	Description string
+	Quantity    int64
+	Amount      money.Amount
+}
+
+// ClaimRequest is a claim for one visit
+type ClaimRequest struct {
+	ClaimNumber  string
+	MemberNumber string
+	Class        string
+	ServiceDate  time.Time
+	Diagnosis    string
+	Lines        []ClaimLine
+	Total        money.Amount
+}
+
+// ClaimDecision is the payer's ruling on a claim
+type ClaimDecision struct {
+	Status         string
+	ApprovedAmount money.Amount
+	Reference      string
+	Reason         string
+}
+
+// PayerAdapter is implemented once per insurer integration
+type PayerAdapter interface {
+	// CheckEligibility reports whether the member is covered
+	CheckEligibility(ctx context.Context, req EligibilityRequest) (*Eligibility, error)
+	// SubmitClaim sends a claim and returns the payer's decision
+	SubmitClaim(ctx context.Context, req ClaimRequest) (*ClaimDecision, error)
+}
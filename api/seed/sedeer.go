@@ -5,37 +5,109 @@ import (
 
 	"github.com/jinzhu/gorm"
 	"github.com/repoerna/hms_app/api/models"
+	"github.com/repoerna/hms_app/api/utils/money"
 )
 
+// Seed patients keep the same MRNs across reseeds, as appointments and
+// examinations are not dropped with them and still refer to those MRNs
 var patients = []models.Patient{
 	models.Patient{
-		Name:     "Purna",
-		SSN:      1234567777,
-		Email:    "purna@gmail.com",
-		Password: "password",
+		MRN:            "MR000000018",
+		Name:           "Purna",
+		NationalID:     "3171011204900001",
+		NationalIDType: "NIK",
+		Email:          "purna@gmail.com",
+		Password:       "password",
+		DateOfBirth:    "1990-04-12",
+		Sex:            "M",
+		BloodType:      "O+",
+		City:           "Jakarta",
+		Phones: []models.PatientPhone{
+			models.PatientPhone{Kind: "mobile", Number: "+6281234567777", Primary: true},
+		},
 	},
 	models.Patient{
-		Name:     "Fajar",
-		SSN:      1234568888,
-		Email:    "Fajar@gmail.com",
-		Password: "password",
+		MRN:            "MR000000026",
+		Name:           "Fajar",
+		NationalID:     "3273013009850002",
+		NationalIDType: "NIK",
+		Email:          "Fajar@gmail.com",
+		Password:       "password",
+		DateOfBirth:    "1985-09-30",
+		Sex:            "M",
+		City:           "Bandung",
 	},
 }
 
+var departments = []models.Department{
+	models.Department{Code: "UMUM", Name: "Dokter Umum"},
+	models.Department{Code: "KEPERAWATAN", Name: "Perawat"},
+	models.Department{Code: "ADMIN", Name: "Administrasi"},
+}
+
+var specialties = []models.Specialty{
+	models.Specialty{DepartmentID: 1, Name: "Kedokteran Umum"},
+}
+
+var wards = []models.Ward{
+	models.Ward{Code: "MELATI", Name: "Bangsal Melati", DepartmentID: 2},
+}
+
+var rooms = []models.Room{
+	models.Room{WardID: 1, Number: "101", Class: "III"},
+	models.Room{WardID: 1, Number: "102", Class: "II"},
+}
+
+var beds = []models.Bed{
+	models.Bed{RoomID: 1, Code: "101-A"},
+	models.Bed{RoomID: 1, Code: "101-B"},
+	models.Bed{RoomID: 2, Code: "102-A"},
+}
+
+var shiftTemplates = []models.ShiftTemplate{
+	models.ShiftTemplate{Code: "morning", Name: "Pagi", StartTime: "07:00", EndTime: "14:00"},
+	models.ShiftTemplate{Code: "evening", Name: "Sore", StartTime: "14:00", EndTime: "21:00"},
+	models.ShiftTemplate{Code: "night", Name: "Malam", StartTime: "21:00", EndTime: "07:00"},
+}
+
+var tariffs = []models.Tariff{
+	models.Tariff{Code: "CONS-GEN", Name: "Konsultasi Dokter Umum", Kind: models.TariffConsultation, Price: money.FromUnits(150000)},
+}
+
+var payerList = []models.Payer{
+	models.Payer{Code: "BPJS", Name: "BPJS Kesehatan", Adapter: "fake"},
+}
+
 var employees = []models.Employee{
 	models.Employee{
-		Name:       "dr. Bob",
-		EmployeeID: 201103001,
-		Email:      "bob@gmail.com",
-		Password:   "password",
-		Department: "Dokter Umum",
+		Name:          "dr. Bob",
+		EmployeeID:    201103001,
+		Email:         "bob@gmail.com",
+		Password:      "password",
+		DepartmentID:  1,
+		SpecialtyID:   1,
+		JobTitle:      "Dokter Umum",
+		LicenseNumber: "STR-3171-0001",
+		LicenseExpiry: "2027-06-30",
 	},
 	models.Employee{
-		Name:       "Ella",
-		EmployeeID: 201103002,
-		Email:      "ella@gmail.com",
-		Password:   "password",
-		Department: "Perawat",
+		Name:          "Ella",
+		EmployeeID:    201103002,
+		Email:         "ella@gmail.com",
+		Password:      "password",
+		DepartmentID:  2,
+		JobTitle:      "Perawat",
+		LicenseNumber: "STR-3171-0002",
+		LicenseExpiry: "2028-01-31",
+	},
+	models.Employee{
+		Name:         "Rina",
+		EmployeeID:   201103003,
+		Email:        "rina@gmail.com",
+		Password:     "password",
+		DepartmentID: 3,
+		JobTitle:     "Staf Administrasi",
+		Role:         models.RoleAdmin,
 	},
 }
 
@@ -105,11 +177,29 @@ var schedules = []models.Schedule{
 // Load ...
 func Load(db *gorm.DB) {
 
-	err := db.Debug().DropTableIfExists(&models.Patient{}, &models.Employee{}, &models.Schedule{}).Error
+	err := db.Debug().DropTableIfExists(&models.Patient{}, &models.PatientPhone{}, &models.PatientInsurance{}, &models.EmergencyContact{},
+		&models.Employee{}, &models.Department{}, &models.Specialty{}, &models.Schedule{},
+		&models.Ward{}, &models.ShiftTemplate{}, &models.ShiftAssignment{}, &models.ShiftSwap{},
+		&models.Room{}, &models.Bed{}, &models.Admission{}, &models.BedStay{},
+		&models.Tariff{}, &models.Payer{},
+	).Error
 	if err != nil {
 		log.Fatalf("cannot drop table: %v", err)
 	}
-	err = db.Debug().AutoMigrate(&models.Patient{}, &models.Employee{}, &models.Schedule{}).Error
+	err = db.Debug().AutoMigrate(
+		&models.Patient{}, &models.PatientPhone{}, &models.PatientInsurance{}, &models.EmergencyContact{},
+		&models.Department{}, &models.Specialty{}, &models.Employee{}, &models.Schedule{},
+		&models.Appointment{}, &models.ExternalAppointment{}, &models.Examination{}, &models.IssuedDocument{}, &models.Attachment{},
+		&models.Medication{}, &models.MedicationBatch{}, &models.StockMovement{},
+		&models.LabTest{}, &models.LabReferenceRange{}, &models.LabOrder{}, &models.Referral{}, &models.EmergencyAccess{}, &models.ComplianceAlert{},
+		&models.PatientMerge{}, &models.ConsentText{}, &models.PatientConsent{},
+		&models.Ward{}, &models.ShiftTemplate{}, &models.ShiftAssignment{}, &models.ShiftSwap{},
+		&models.Room{}, &models.Bed{}, &models.Admission{}, &models.BedStay{},
+		&models.QueueTicket{},
+		&models.Tariff{}, &models.Invoice{}, &models.InvoiceLine{}, &models.Payment{},
+		&models.Payer{}, &models.InsuranceClaim{},
+		&models.ExportJob{},
+	).Error
 	if err != nil {
 		log.Fatalf("cannot migrate table: %v", err)
 	}
@@ -121,6 +211,20 @@ func Load(db *gorm.DB) {
 		}
 	}
 
+	for i := range departments {
+		err = db.Debug().Model(&models.Department{}).Create(&departments[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed departments table: %v", err)
+		}
+	}
+
+	for i := range specialties {
+		err = db.Debug().Model(&models.Specialty{}).Create(&specialties[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed specialties table: %v", err)
+		}
+	}
+
 	for i := range employees {
 		err = db.Debug().Model(&models.Employee{}).Create(&employees[i]).Error
 		if err != nil {
@@ -128,6 +232,51 @@ func Load(db *gorm.DB) {
 		}
 	}
 
+	for i := range wards {
+		err = db.Debug().Model(&models.Ward{}).Create(&wards[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed wards table: %v", err)
+		}
+	}
+
+	for i := range rooms {
+		err = db.Debug().Model(&models.Room{}).Create(&rooms[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed rooms table: %v", err)
+		}
+	}
+
+	for i := range beds {
+		beds[i].WardID = rooms[beds[i].RoomID-1].WardID
+		err = db.Debug().Model(&models.Bed{}).Create(&beds[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed beds table: %v", err)
+		}
+	}
+
+	for i := range tariffs {
+		tariffs[i].Active = true
+		err = db.Debug().Model(&models.Tariff{}).Create(&tariffs[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed tariffs table: %v", err)
+		}
+	}
+
+	for i := range payerList {
+		payerList[i].Active = true
+		err = db.Debug().Model(&models.Payer{}).Create(&payerList[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed payers table: %v", err)
+		}
+	}
+
+	for i := range shiftTemplates {
+		err = db.Debug().Model(&models.ShiftTemplate{}).Create(&shiftTemplates[i]).Error
+		if err != nil {
+			log.Fatalf("cannot seed shift templates table: %v", err)
+		}
+	}
+
 	for i := range schedules {
 		err = db.Debug().Model(&models.Schedule{}).Create(&schedules[i]).Error
 		if err != nil {
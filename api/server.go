@@ -1,13 +1,20 @@
 package api
 
 import (
-	"fmt"
+	"encoding/base64"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/repoerna/hms_app/api/controllers"
+	"github.com/repoerna/hms_app/api/documents"
+	"github.com/repoerna/hms_app/api/encryption"
+	"github.com/repoerna/hms_app/api/exports"
+	"github.com/repoerna/hms_app/api/models"
 	"github.com/repoerna/hms_app/api/seed"
+	"github.com/repoerna/hms_app/api/storage"
 )
 
 var server = controllers.Server{}
@@ -18,14 +25,100 @@ func Run() {
 	err = godotenv.Load()
 	if err != nil {
 		log.Fatalf("Error getting env, not comming through %v", err)
-	} else {
-		fmt.Println("We are getting the env values")
+	}
+
+	if days := os.Getenv("LICENSE_EXPIRY_WARNING_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			log.Fatalf("Invalid LICENSE_EXPIRY_WARNING_DAYS %q", days)
+		}
+		models.LicenseWarningWindow = time.Duration(n) * 24 * time.Hour
+	}
+
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		exports.Dir = dir
+	}
+	if hours := os.Getenv("EXPORT_RETENTION_HOURS"); hours != "" {
+		n, err := strconv.Atoi(hours)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid EXPORT_RETENTION_HOURS %q", hours)
+		}
+		exports.Retention = time.Duration(n) * time.Hour
+	}
+	if hours := os.Getenv("EMERGENCY_ACCESS_HOURS"); hours != "" {
+		n, err := strconv.Atoi(hours)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid EMERGENCY_ACCESS_HOURS %q", hours)
+		}
+		models.EmergencyAccessDuration = time.Duration(n) * time.Hour
+	}
+
+	if name := os.Getenv("CLINIC_NAME"); name != "" {
+		documents.ClinicDetails = documents.Clinic{Name: name, Address: os.Getenv("CLINIC_ADDRESS"), Phone: os.Getenv("CLINIC_PHONE")}
+	}
+	if url := os.Getenv("DOCUMENT_VERIFY_URL"); url != "" {
+		documents.VerifyURL = url
+	}
+	// The signing key is kept apart from API_SECRET, so rotating the token
+	// secret does not invalidate every serial already printed
+	models.DocumentSigningKey = []byte(os.Getenv("DOCUMENT_SIGNING_KEY"))
+	if len(models.DocumentSigningKey) < 16 {
+		log.Fatalf("DOCUMENT_SIGNING_KEY must be set to at least 16 characters")
+	}
+	if dir := os.Getenv("DOCUMENT_TEMPLATE_DIR"); dir != "" {
+		if err = documents.LoadTemplates(dir); err != nil {
+			log.Fatalf("Cannot load document templates: %v", err)
+		}
+	}
+
+	if size := os.Getenv("ATTACHMENT_MAX_MB"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 {
+			log.Fatalf("Invalid ATTACHMENT_MAX_MB %q", size)
+		}
+		models.MaxAttachmentSize = int64(n) << 20
+	}
+
+	masterKeys, err := encryption.ParseMasterKeys(os.Getenv("ENCRYPTION_MASTER_KEYS"))
+	if err != nil {
+		log.Fatalf("Invalid ENCRYPTION_MASTER_KEYS: %v", err)
+	}
+	indexKey, err := base64.StdEncoding.DecodeString(os.Getenv("BLIND_INDEX_KEY"))
+	if err != nil {
+		log.Fatalf("Invalid BLIND_INDEX_KEY: %v", err)
+	}
+	if err = encryption.Configure(masterKeys, indexKey); err != nil {
+		log.Fatalf("Cannot configure encryption: %v", err)
 	}
 
 	server.Initialize(os.Getenv("DB_DRIVER"), os.Getenv("DB_USER"), os.Getenv("DB_PASSWORD"), os.Getenv("DB_PORT"), os.Getenv("DB_HOST"), os.Getenv("DB_NAME"))
 
 	seed.Load(server.DB)
 
+	switch os.Getenv("ATTACHMENT_STORE") {
+	case "s3":
+		server.Attachments, err = storage.NewS3(os.Getenv("S3_ENDPOINT"), os.Getenv("S3_REGION"), os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY"), os.Getenv("S3_SECRET_KEY"), os.Getenv("S3_PATH_STYLE") == "true")
+	case "", "local":
+		dir := os.Getenv("ATTACHMENT_DIR")
+		if dir == "" {
+			dir = "data/attachments"
+		}
+		server.Attachments, err = storage.NewLocal(dir)
+	default:
+		log.Fatalf("Invalid ATTACHMENT_STORE %q, expected local or s3", os.Getenv("ATTACHMENT_STORE"))
+	}
+	if err != nil {
+		log.Fatalf("Cannot open attachment store: %v", err)
+	}
+
+	go server.SweepExports(10 * time.Minute)
+	go server.SweepEncryption(10 * time.Minute)
+
+	if addr := os.Getenv("MLLP_ADDR"); addr != "" {
+		go server.RunMLLP(addr)
+	}
+
 	server.Run(":8080")
 
 }
@@ -0,0 +1,148 @@
+// Package storage keeps file contents, such as clinical attachments, in a
+// BlobStore. Blobs live in a local directory or in an S3 compatible object
+// store; records in the database refer to them by key.
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ErrNotFound is returned when no blob is stored under a key
+var ErrNotFound = errors.New("Blob Not Found")
+
+// ErrTooLarge is returned by Spool when the upload exceeds its limit
+var ErrTooLarge = errors.New("File Too Large")
+
+// ErrChecksumMismatch is returned by a VerifyingReader whose blob has
+// changed since it was stored
+var ErrChecksumMismatch = errors.New("Checksum Mismatch")
+
+// ErrInvalidKey is returned for keys outside the characters ValidKey allows
+var ErrInvalidKey = errors.New("Invalid Blob Key")
+
+// BlobStore is implemented once per storage backend
+type BlobStore interface {
+	// Put stores size bytes of body under key, replacing any blob already
+	// there. body is read from its start, and may be read more than once.
+	Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error
+	// Get opens the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob under key; a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+}
+
+// ValidKey reports whether key is a relative, slash separated path of
+// letters, digits, dots, dashes and underscores. Keys are chosen by the
+// application, never taken from file names.
+func ValidKey(key string) bool {
+	if key == "" || len(key) > 255 {
+		return false
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return false
+		}
+		for _, c := range segment {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '.' || c == '-' || c == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Upload is a file received from a client, spooled to a temporary file so
+// it can be checked before it is stored
+type Upload struct {
+	File        *os.File
+	Size        int64
+	SHA256      string
+	ContentType string
+}
+
+// Spool copies r to a temporary file, up to limit bytes, while computing
+// its SHA-256 checksum and sniffing its content type from its first bytes.
+// The caller must Close the upload.
+func Spool(r io.Reader, limit int64) (*Upload, error) {
+	file, err := ioutil.TempFile("", "upload-")
+	if err != nil {
+		return nil, err
+	}
+	upload := &Upload{File: file}
+	sum := sha256.New()
+	upload.Size, err = io.Copy(io.MultiWriter(file, sum), io.LimitReader(r, limit+1))
+	if err == nil && upload.Size > limit {
+		err = ErrTooLarge
+	}
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		upload.Close()
+		return nil, err
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(file, head)
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		upload.Close()
+		return nil, err
+	}
+	upload.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	upload.ContentType = DetectContentType(head[:n])
+	return upload, nil
+}
+
+// Close removes the temporary file
+func (u *Upload) Close() error {
+	u.File.Close()
+	return os.Remove(u.File.Name())
+}
+
+// DetectContentType sniffs the media type of data from its first bytes,
+// like http.DetectContentType, and also recognises the TIFF images scanners
+// produce and DICOM files. Parameters such as charset are dropped.
+func DetectContentType(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("II*\x00")), bytes.HasPrefix(head, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(head) >= 132 && string(head[128:132]) == "DICM":
+		return "application/dicom"
+	}
+	contentType := http.DetectContentType(head)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	return contentType
+}
+
+// VerifyingReader passes a blob through while computing its SHA-256, and
+// fails at the end if it does not match the checksum recorded on upload
+type VerifyingReader struct {
+	r        io.Reader
+	expected string
+	hash     hash.Hash
+}
+
+// NewVerifyingReader checks r against the hex SHA-256 checksum expected
+func NewVerifyingReader(r io.Reader, expected string) *VerifyingReader {
+	return &VerifyingReader{r: r, expected: expected, hash: sha256.New()}
+}
+
+func (v *VerifyingReader) Read(p []byte) (int, error) {
+	n, err := v.r.Read(p)
+	v.hash.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(v.hash.Sum(nil)) != v.expected {
+		return n, ErrChecksumMismatch
+	}
+	return n, err
+}
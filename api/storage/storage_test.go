@@ -0,0 +1,263 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 is a MinIO-like stand-in: one path style bucket kept in memory.
+// It checks every request's Signature Version 4 signature and the SHA-256
+// of uploaded bodies, as a real store would.
+type fakeS3 struct {
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+	types   map[string]string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{
+		bucket: "attachments", region: "us-east-1", accessKey: "minio", secretKey: "minio-secret",
+		objects: map[string][]byte{}, types: map[string]string{},
+	}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeS3) fail(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	io.WriteString(w, "<Error><Code>"+code+"</Code><Message>"+code+"</Message></Error>")
+}
+
+// signed reports whether r carries the signature the client should have
+// computed over the headers it lists as signed
+func (f *fakeS3) signed(r *http.Request) bool {
+	authorization := r.Header.Get("Authorization")
+	i := strings.Index(authorization, "SignedHeaders=")
+	if i < 0 {
+		return false
+	}
+	names := strings.Split(strings.SplitN(authorization[i+len("SignedHeaders="):], ",", 2)[0], ";")
+	now, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return false
+	}
+	resigned := &http.Request{
+		Method: r.Method,
+		URL:    &url.URL{Host: r.Host, Path: r.URL.Path, RawPath: r.URL.RawPath},
+		Header: http.Header{},
+	}
+	for _, name := range names {
+		if name != "host" {
+			resigned.Header.Set(name, r.Header.Get(name))
+		}
+	}
+	signer := S3{Region: f.region, AccessKey: f.accessKey, SecretKey: f.secretKey}
+	signer.sign(resigned, r.Header.Get("X-Amz-Content-Sha256"), now)
+	return resigned.Header.Get("Authorization") == authorization
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !f.signed(r) {
+		f.fail(w, http.StatusForbidden, "SignatureDoesNotMatch")
+		return
+	}
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		f.fail(w, http.StatusNotFound, "NoSuchBucket")
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			f.fail(w, http.StatusBadRequest, "IncompleteBody")
+			return
+		}
+		sum := sha256.Sum256(body)
+		if hex.EncodeToString(sum[:]) != r.Header.Get("X-Amz-Content-Sha256") {
+			f.fail(w, http.StatusBadRequest, "XAmzContentSHA256Mismatch")
+			return
+		}
+		f.objects[key] = body
+		f.types[key] = r.Header.Get("Content-Type")
+	case http.MethodGet:
+		body, ok := f.objects[key]
+		if !ok {
+			f.fail(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Content-Type", f.types[key])
+		w.Write(body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		f.fail(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+// checkRoundTrip stores, reads back and deletes a blob
+func checkRoundTrip(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	key := "attachments/MR000000018/0123abcd"
+	content := []byte("%PDF-1.4 scanned referral letter")
+
+	if err := store.Put(ctx, key, bytes.NewReader(content), int64(len(content)), "application/pdf"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	blob, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := ioutil.ReadAll(blob)
+	blob.Close()
+	if err != nil {
+		t.Fatalf("reading blob: %v", err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Errorf("Get = %q, want %q", got, content)
+	}
+
+	if err = store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err = store.Get(ctx, key); err != ErrNotFound {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err = store.Delete(ctx, key); err != nil {
+		t.Errorf("Delete of a missing blob: %v", err)
+	}
+	if err = store.Put(ctx, "../escape", bytes.NewReader(content), int64(len(content)), ""); err != ErrInvalidKey {
+		t.Errorf("Put with an invalid key: err = %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestLocal(t *testing.T) {
+	store, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, store)
+}
+
+func TestS3(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store, err := NewS3(server.URL, fake.region, fake.bucket, fake.accessKey, fake.secretKey, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkRoundTrip(t, store)
+
+	content := []byte("\x89PNG photo")
+	if err = store.Put(context.Background(), "photos/wound.png", bytes.NewReader(content), int64(len(content)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if got := fake.types["photos/wound.png"]; got != "image/png" {
+		t.Errorf("stored content type = %q, want image/png", got)
+	}
+}
+
+func TestS3WrongCredentials(t *testing.T) {
+	fake, server := newFakeS3(t)
+	store, err := NewS3(server.URL, fake.region, fake.bucket, fake.accessKey, "not-the-secret", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("report")
+	err = store.Put(context.Background(), "reports/a", bytes.NewReader(content), int64(len(content)), "")
+	if err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Errorf("Put with a wrong secret: err = %v, want SignatureDoesNotMatch", err)
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	for _, endpoint := range []string{"", "localhost:9000", "ftp://localhost"} {
+		if _, err := NewS3(endpoint, "", "bucket", "", "", true); err == nil {
+			t.Errorf("NewS3(%q) accepted an invalid endpoint", endpoint)
+		}
+	}
+	if _, err := NewS3("http://localhost:9000", "", "", "", "", true); err == nil {
+		t.Error("NewS3 accepted an empty bucket")
+	}
+}
+
+func TestVerifyingReader(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	content := []byte(strings.Repeat("lab report line\n", 1000))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	if err = store.Put(ctx, "reports/cbc", bytes.NewReader(content), int64(len(content)), ""); err != nil {
+		t.Fatal(err)
+	}
+
+	blob, err := store.Get(ctx, "reports/cbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	_, err = io.Copy(&out, NewVerifyingReader(blob, checksum))
+	blob.Close()
+	if err != nil {
+		t.Errorf("intact blob: %v", err)
+	}
+
+	// Damage the file behind the store's back
+	damaged := append([]byte{}, content...)
+	damaged[len(damaged)/2] ^= 0xff
+	if err = ioutil.WriteFile(filepath.Join(dir, "reports", "cbc"), damaged, 0600); err != nil {
+		t.Fatal(err)
+	}
+	blob, err = store.Get(ctx, "reports/cbc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	if _, err = io.Copy(ioutil.Discard, NewVerifyingReader(blob, checksum)); err != ErrChecksumMismatch {
+		t.Errorf("damaged blob: err = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestSpool(t *testing.T) {
+	upload, err := Spool(strings.NewReader("%PDF-1.7 discharge letter"), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer upload.Close()
+	if upload.ContentType != "application/pdf" {
+		t.Errorf("ContentType = %q, want application/pdf", upload.ContentType)
+	}
+	if upload.Size != 25 {
+		t.Errorf("Size = %d, want 25", upload.Size)
+	}
+
+	if _, err = Spool(strings.NewReader(strings.Repeat("x", 2048)), 1024); err != ErrTooLarge {
+		t.Errorf("oversized upload: err = %v, want ErrTooLarge", err)
+	}
+}
@@ -11,8 +11,8 @@ func FormatError(err string) error {
 		return errors.New("Email Already Taken")
 	}
 
-	if strings.Contains(err, "ssn") {
-		return errors.New("SSN Already Taken")
+	if strings.Contains(err, "national_id") {
+		return errors.New("National ID Already Registered")
 	}
 
 	if strings.Contains(err, "hashedPassword") {
@@ -0,0 +1,218 @@
+package identifier
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// National ID kinds
+const (
+	NIK = "NIK"
+	SSN = "SSN"
+)
+
+const mrnPrefix = "MR"
+
+// NewMRN generates a medical record number: "MR", eight random digits and a
+// Luhn check digit
+func NewMRN() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(100000000))
+	if err != nil {
+		return "", err
+	}
+	digits := fmt.Sprintf("%08d", n.Int64())
+	return mrnPrefix + digits + strconv.Itoa(luhnDigit(digits)), nil
+}
+
+// ValidMRN checks the prefix, length and check digit of a medical record
+// number
+func ValidMRN(mrn string) bool {
+	if len(mrn) != len(mrnPrefix)+9 || !strings.HasPrefix(mrn, mrnPrefix) {
+		return false
+	}
+	digits := mrn[len(mrnPrefix):]
+	if !allDigits(digits) {
+		return false
+	}
+	return luhnDigit(digits[:8]) == int(digits[8]-'0')
+}
+
+// NormalizeNationalID strips the separators people commonly type
+func NormalizeNationalID(id string) string {
+	return strings.NewReplacer("-", "", " ", "", ".", "").Replace(id)
+}
+
+// ValidateNationalID checks a normalized national ID of the given kind. When
+// dateOfBirth (YYYY-MM-DD) and sex ("M"/"F") are known they are checked
+// against the values encoded in a NIK.
+func ValidateNationalID(kind, id, dateOfBirth, sex string) error {
+	switch strings.ToUpper(kind) {
+	case NIK:
+		return validateNIK(id, dateOfBirth, sex)
+	case SSN:
+		return validateSSN(id)
+	}
+	return errors.New("Invalid National ID Type")
+}
+
+// validateNIK checks an Indonesian Nomor Induk Kependudukan:
+// PPKKCC DDMMYY NNNN, where PP is the province code, DD is the day of birth
+// plus 40 for women and NNNN is a non zero serial.
+func validateNIK(id, dateOfBirth, sex string) error {
+	if len(id) != 16 || !allDigits(id) {
+		return errors.New("NIK Must Be 16 Digits")
+	}
+	province, _ := strconv.Atoi(id[0:2])
+	if province < 11 || province > 94 {
+		return errors.New("Invalid NIK Province Code")
+	}
+	if id[2:4] == "00" || id[4:6] == "00" {
+		return errors.New("Invalid NIK Region Code")
+	}
+	day, _ := strconv.Atoi(id[6:8])
+	month, _ := strconv.Atoi(id[8:10])
+	year, _ := strconv.Atoi(id[10:12])
+	encodedSex := "M"
+	if day > 40 {
+		day -= 40
+		encodedSex = "F"
+	}
+	if day < 1 || day > 31 || month < 1 || month > 12 {
+		return errors.New("Invalid NIK Birth Date")
+	}
+	if id[12:16] == "0000" {
+		return errors.New("Invalid NIK Serial")
+	}
+
+	if sex != "" && sex != encodedSex {
+		return errors.New("NIK Does Not Match Sex")
+	}
+	if dateOfBirth != "" {
+		dob, err := time.Parse("2006-01-02", dateOfBirth)
+		if err != nil {
+			return nil
+		}
+		if dob.Day() != day || int(dob.Month()) != month || dob.Year()%100 != year {
+			return errors.New("NIK Does Not Match Date Of Birth")
+		}
+	}
+	return nil
+}
+
+// validateSSN applies the US Social Security Administration rules: area
+// 000, 666 and 900-999, group 00 and serial 0000 are never issued
+func validateSSN(id string) error {
+	if len(id) != 9 || !allDigits(id) {
+		return errors.New("SSN Must Be 9 Digits")
+	}
+	area := id[0:3]
+	if area == "000" || area == "666" || area[0] == '9' {
+		return errors.New("Invalid SSN Area Number")
+	}
+	if id[3:5] == "00" {
+		return errors.New("Invalid SSN Group Number")
+	}
+	if id[5:9] == "0000" {
+		return errors.New("Invalid SSN Serial Number")
+	}
+	return nil
+}
+
+// serialAlphabet is base 32 without 0, 1, I and O, which are easily
+// misread on paper
+const serialAlphabet = "23456789ABCDEFGHJKLMNPQRSTUVWXYZ"
+
+// Lengths of the random and signature parts of a serial
+const (
+	serialRandom    = 10
+	serialSignature = 8
+)
+
+// NewSerial generates a serial number of the form PREFIX-RANDOM-SIGNATURE.
+// The signature is an HMAC of the prefix, the random part and subject, so
+// a serial can only have been issued by whoever holds key, and only for
+// that subject.
+func NewSerial(prefix, subject string, key []byte) (string, error) {
+	random := make([]byte, serialRandom)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	for i := range random {
+		random[i] = serialAlphabet[random[i]%32]
+	}
+	body := prefix + "-" + string(random)
+	return body + "-" + serialSignatureOf(body, subject, key), nil
+}
+
+// CheckSerial reports whether serial was issued by NewSerial with the same
+// subject and key
+func CheckSerial(serial, subject string, key []byte) bool {
+	if !ValidSerial(serial) {
+		return false
+	}
+	cut := len(serial) - serialSignature - 1
+	expected := serialSignatureOf(serial[:cut], subject, key)
+	return hmac.Equal([]byte(serial[cut+1:]), []byte(expected))
+}
+
+// ValidSerial checks the shape of a serial number without its signature,
+// so malformed input can be turned away before any lookup
+func ValidSerial(serial string) bool {
+	parts := strings.Split(serial, "-")
+	if len(parts) != 3 || parts[0] == "" || len(parts[0]) > 4 ||
+		len(parts[1]) != serialRandom || len(parts[2]) != serialSignature {
+		return false
+	}
+	for _, part := range parts {
+		for i := 0; i < len(part); i++ {
+			if !strings.ContainsRune(serialAlphabet, rune(part[i])) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func serialSignatureOf(body, subject string, key []byte) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body + "|" + subject))
+	sum := mac.Sum(nil)
+	out := make([]byte, serialSignature)
+	for i := range out {
+		out[i] = serialAlphabet[sum[i]%32]
+	}
+	return string(out)
+}
+
+func luhnDigit(digits string) int {
+	sum := 0
+	double := true
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return (10 - sum%10) % 10
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
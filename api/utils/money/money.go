@@ -0,0 +1,122 @@
+// Package money does currency arithmetic on whole hundredths so that
+// amounts never pass through floating point.
+package money
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Amount is a sum of money in hundredths of the currency unit
+type Amount int64
+
+// scale is the number of hundredths in one unit
+const scale = 100
+
+// ErrInvalidAmount is returned for text that is not a decimal amount with
+// at most two fraction digits
+var ErrInvalidAmount = errors.New("Invalid Amount")
+
+// FromUnits returns an amount of whole currency units
+func FromUnits(units int64) Amount {
+	return Amount(units * scale)
+}
+
+// Parse reads a decimal amount such as "150000", "-12.5" or "99.95"
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	negative := strings.HasPrefix(s, "-")
+	s = strings.TrimPrefix(s, "-")
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+		if frac == "" || len(frac) > 2 {
+			return 0, ErrInvalidAmount
+		}
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	for _, part := range []string{whole, frac} {
+		for _, c := range part {
+			if c < '0' || c > '9' {
+				return 0, ErrInvalidAmount
+			}
+		}
+	}
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (1<<63-1)/scale-1 {
+		return 0, ErrInvalidAmount
+	}
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+	a := Amount(units*scale + cents)
+	if negative {
+		a = -a
+	}
+	return a, nil
+}
+
+// String formats the amount with two fraction digits, e.g. "150000.00"
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	cents := strconv.FormatInt(v%scale, 10)
+	if len(cents) < 2 {
+		cents = "0" + cents
+	}
+	return sign + strconv.FormatInt(v/scale, 10) + "." + cents
+}
+
+// Times multiplies the amount by a quantity
+func (a Amount) Times(quantity int64) Amount {
+	return a * Amount(quantity)
+}
+
+// Rate returns the given rate of the amount, in basis points (1100 is
+// 11%), rounded half away from zero to the nearest hundredth
+func (a Amount) Rate(basisPoints int) Amount {
+	n := int64(a) * int64(basisPoints)
+	q, r := n/10000, n%10000
+	if r < 0 {
+		r = -r
+	}
+	if r*2 >= 10000 {
+		if n < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return Amount(q)
+}
+
+// MarshalJSON writes the amount as a decimal string, which JSON clients
+// cannot mistake for a float
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.Quote(a.String())), nil
+}
+
+// UnmarshalJSON accepts a decimal string or a plain JSON number
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
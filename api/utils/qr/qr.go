@@ -0,0 +1,458 @@
+// Package qr encodes text as a QR code, in byte mode at error correction
+// level M. Versions 1 to 10 are supported, enough for a URL of up to 213
+// bytes.
+package qr
+
+import "errors"
+
+// ErrTooLong is returned for text that does not fit in version 10
+var ErrTooLong = errors.New("Text Too Long For QR Code")
+
+// Code is a square of modules; true is dark. Modules[y][x] is row y,
+// column x. A quiet zone of 4 modules is expected around it.
+type Code struct {
+	Size    int
+	Modules [][]bool
+}
+
+// blockSpec is the error correction layout of one version at level M:
+// codewords of error correction per block, and the data codewords of each
+// block
+type blockSpec struct {
+	ecPerBlock int
+	blocks     []int
+}
+
+var specs = []blockSpec{
+	{10, []int{16}},
+	{16, []int{28}},
+	{26, []int{44}},
+	{18, []int{32, 32}},
+	{24, []int{43, 43}},
+	{16, []int{27, 27, 27, 27}},
+	{18, []int{31, 31, 31, 31}},
+	{22, []int{38, 38, 39, 39}},
+	{22, []int{36, 36, 36, 37, 37}},
+	{26, []int{43, 43, 43, 43, 44}},
+}
+
+var alignments = [][]int{
+	nil, {6, 18}, {6, 22}, {6, 26}, {6, 30}, {6, 34},
+	{6, 22, 38}, {6, 24, 42}, {6, 26, 46}, {6, 28, 50},
+}
+
+// Encode returns the smallest QR code holding text
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+	for version := 1; version <= len(specs); version++ {
+		spec := specs[version-1]
+		capacity := 0
+		for _, n := range spec.blocks {
+			capacity += n
+		}
+		countBits := 8
+		if version >= 10 {
+			countBits = 16
+		}
+		if 4+countBits+8*len(data) > 8*capacity {
+			continue
+		}
+		codewords := addErrorCorrection(encodeData(data, countBits, capacity), spec)
+		return build(version, codewords), nil
+	}
+	return nil, ErrTooLong
+}
+
+// encodeData writes the mode, length and bytes of the data, then the
+// terminator and padding up to capacity codewords
+func encodeData(data []byte, countBits, capacity int) []byte {
+	bits := &bitBuffer{}
+	bits.append(0x4, 4)
+	bits.append(len(data), countBits)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	terminator := 8*capacity - bits.n
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	if bits.n%8 != 0 {
+		bits.append(0, 8-bits.n%8)
+	}
+	out := bits.bytes
+	for pad := byte(0xEC); len(out) < capacity; pad ^= 0xEC ^ 0x11 {
+		out = append(out, pad)
+	}
+	return out
+}
+
+type bitBuffer struct {
+	bytes []byte
+	n     int
+}
+
+func (b *bitBuffer) append(value, length int) {
+	for i := length - 1; i >= 0; i-- {
+		if b.n%8 == 0 {
+			b.bytes = append(b.bytes, 0)
+		}
+		if (value>>uint(i))&1 != 0 {
+			b.bytes[b.n/8] |= 0x80 >> uint(b.n%8)
+		}
+		b.n++
+	}
+}
+
+// addErrorCorrection splits data into blocks, computes the Reed-Solomon
+// codewords of each and interleaves the result
+func addErrorCorrection(data []byte, spec blockSpec) []byte {
+	divisor := rsDivisor(spec.ecPerBlock)
+	blocks := [][]byte{}
+	ecc := [][]byte{}
+	longest := 0
+	for _, n := range spec.blocks {
+		block := data[:n]
+		data = data[n:]
+		blocks = append(blocks, block)
+		ecc = append(ecc, rsRemainder(block, divisor))
+		if n > longest {
+			longest = n
+		}
+	}
+	out := []byte{}
+	for i := 0; i < longest; i++ {
+		for _, block := range blocks {
+			if i < len(block) {
+				out = append(out, block[i])
+			}
+		}
+	}
+	for i := 0; i < spec.ecPerBlock; i++ {
+		for _, block := range ecc {
+			out = append(out, block[i])
+		}
+	}
+	return out
+}
+
+// gfMultiply multiplies in GF(256) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	var z int
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i := range result {
+			result[i] ^= gfMultiply(divisor[i], factor)
+		}
+	}
+	return result
+}
+
+// matrix is a code under construction. function marks the modules of
+// finder, timing, alignment, format and version patterns, which data and
+// masks leave alone.
+type matrix struct {
+	size     int
+	modules  [][]bool
+	function [][]bool
+}
+
+func (m *matrix) set(x, y int, dark bool) {
+	m.modules[y][x] = dark
+	m.function[y][x] = true
+}
+
+func build(version int, codewords []byte) *Code {
+	size := 4*version + 17
+	m := &matrix{size: size, modules: grid(size), function: grid(size)}
+
+	for i := 0; i < size; i++ {
+		m.set(6, i, i%2 == 0)
+		m.set(i, 6, i%2 == 0)
+	}
+	m.finder(3, 3)
+	m.finder(size-4, 3)
+	m.finder(3, size-4)
+	positions := alignments[version-1]
+	last := len(positions) - 1
+	for i, x := range positions {
+		for j, y := range positions {
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			m.alignment(x, y)
+		}
+	}
+	m.format(0)
+	m.version(version)
+	m.place(codewords)
+
+	best, bestPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		m.applyMask(mask)
+		m.format(mask)
+		if p := m.penalty(); bestPenalty < 0 || p < bestPenalty {
+			best, bestPenalty = mask, p
+		}
+		m.applyMask(mask)
+	}
+	m.applyMask(best)
+	m.format(best)
+	return &Code{Size: size, Modules: m.modules}
+}
+
+func grid(size int) [][]bool {
+	g := make([][]bool, size)
+	for i := range g {
+		g[i] = make([]bool, size)
+	}
+	return g
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// finder draws a finder pattern and its separator around the center x, y
+func (m *matrix) finder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= m.size || yy < 0 || yy >= m.size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			m.set(xx, yy, d != 2 && d != 4)
+		}
+	}
+}
+
+func (m *matrix) alignment(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			m.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// format draws both copies of the format information for level M and the
+// given mask, and the dark module
+func (m *matrix) format(mask int) {
+	data := mask // level M is 00
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	bit := func(i int) bool { return (bits>>uint(i))&1 != 0 }
+
+	for i := 0; i <= 5; i++ {
+		m.set(8, i, bit(i))
+	}
+	m.set(8, 7, bit(6))
+	m.set(8, 8, bit(7))
+	m.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		m.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		m.set(m.size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		m.set(8, m.size-15+i, bit(i))
+	}
+	m.set(8, m.size-8, true)
+}
+
+// version draws the version information of versions 7 and up
+func (m *matrix) version(version int) {
+	if version < 7 {
+		return
+	}
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := version<<12 | rem
+	for i := 0; i < 18; i++ {
+		dark := (bits>>uint(i))&1 != 0
+		a, b := m.size-11+i%3, i/3
+		m.set(a, b, dark)
+		m.set(b, a, dark)
+	}
+}
+
+// place fills the data modules in the zigzag order of the standard, two
+// columns at a time from the bottom right
+func (m *matrix) place(codewords []byte) {
+	i := 0
+	for right := m.size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < m.size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = m.size - 1 - vert
+				}
+				if m.function[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				m.modules[y][x] = (codewords[i>>3]>>uint(7-i&7))&1 != 0
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by a mask; applying it twice
+// undoes it
+func (m *matrix) applyMask(mask int) {
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.function[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				m.modules[y][x] = !m.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard a masked code is to read; the mask with the
+// lowest score is used
+func (m *matrix) penalty() int {
+	score := 0
+	at := func(x, y int, horizontal bool) bool {
+		if horizontal {
+			return m.modules[y][x]
+		}
+		return m.modules[x][y]
+	}
+	finderLike := []bool{true, false, true, true, true, false, true}
+
+	for _, horizontal := range []bool{true, false} {
+		for y := 0; y < m.size; y++ {
+			run := 1
+			for x := 1; x <= m.size; x++ {
+				if x < m.size && at(x, y, horizontal) == at(x-1, y, horizontal) {
+					run++
+					continue
+				}
+				if run >= 5 {
+					score += 3 + run - 5
+				}
+				run = 1
+			}
+			for x := 0; x+7 <= m.size; x++ {
+				match := true
+				for k, dark := range finderLike {
+					if at(x+k, y, horizontal) != dark {
+						match = false
+						break
+					}
+				}
+				if match && (m.light(x-4, x, y, horizontal) || m.light(x+7, x+11, y, horizontal)) {
+					score += 40
+				}
+			}
+		}
+	}
+
+	dark := 0
+	for y := 0; y < m.size; y++ {
+		for x := 0; x < m.size; x++ {
+			if m.modules[y][x] {
+				dark++
+			}
+			if x+1 < m.size && y+1 < m.size {
+				c := m.modules[y][x]
+				if c == m.modules[y][x+1] && c == m.modules[y+1][x] && c == m.modules[y+1][x+1] {
+					score += 3
+				}
+			}
+		}
+	}
+	percent := dark * 100 / (m.size * m.size)
+	score += abs(percent-50) / 5 * 10
+	return score
+}
+
+// light reports whether modules from..to-1 of a line are all light, counting
+// those outside the code as light
+func (m *matrix) light(from, to, line int, horizontal bool) bool {
+	for i := from; i < to; i++ {
+		if i < 0 || i >= m.size {
+			continue
+		}
+		var dark bool
+		if horizontal {
+			dark = m.modules[line][i]
+		} else {
+			dark = m.modules[i][line]
+		}
+		if dark {
+			return false
+		}
+	}
+	return true
+}
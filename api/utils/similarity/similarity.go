@@ -0,0 +1,128 @@
+package similarity
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// JaroWinkler returns the Jaro-Winkler similarity of two strings, from 0
+// (nothing in common) to 1 (identical)
+func JaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 && len(rb) == 0 {
+		return 1
+	}
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+
+	window := max(len(ra), len(rb))/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(rb) {
+			hi = len(rb)
+		}
+		for j := lo; j < hi; j++ {
+			if matchedB[j] || ra[i] != rb[j] {
+				continue
+			}
+			matchedA[i], matchedB[j] = true, true
+			matches++
+			break
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < 4 && prefix < len(ra) && prefix < len(rb) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// NameSimilarity compares two person names ignoring case, punctuation, word
+// order and honorifics such as "dr." so that "Budi Santoso" matches
+// "santoso, budi"
+func NameSimilarity(a, b string) float64 {
+	return JaroWinkler(normalizeName(a), normalizeName(b))
+}
+
+var honorifics = map[string]bool{"dr": true, "drg": true, "ir": true, "h": true, "hj": true, "mr": true, "mrs": true, "ms": true, "bpk": true, "ibu": true}
+
+func normalizeName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	kept := words[:0]
+	for _, w := range words {
+		if !honorifics[w] {
+			kept = append(kept, w)
+		}
+	}
+	// Sort so that word order does not matter
+	sort.Strings(kept)
+	return strings.Join(kept, " ")
+}
+
+// SamePhone compares the last nine digits of two phone numbers so that
+// "+62 812-3456-7777" and "0812 3456 7777" are treated as the same number
+func SamePhone(a, b string) bool {
+	a = PhoneKey(a)
+	return a != "" && a == PhoneKey(b)
+}
+
+// PhoneKey returns the last nine digits of a phone number, which SamePhone
+// compares, or "" for numbers with fewer digits
+func PhoneKey(number string) string {
+	digits := digitsOnly(number)
+	if len(digits) < 9 {
+		return ""
+	}
+	return digits[len(digits)-9:]
+}
+
+func digitsOnly(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}